@@ -23,13 +23,18 @@ import (
 
 	build "github.com/commonjava/indy-tests/pkg/buildtest"
 	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/perfcompare"
+	"github.com/commonjava/indy-tests/pkg/report"
 
 	"github.com/spf13/cobra"
 )
 
 // example: http://orchhost/pnc-rest/v2/builds/97241/logs/build
-var targetIndy, repoReplPattern, buildType string
+var targetIndy, repoReplPattern, buildType, fromLog, logRepoId string
 var processNum int
+var replay build.ReplayOptions
+var gate perfcompare.GateOptions
+var failFast bool
 
 const DEFAULT_PROCESS_NUM = 1
 const DEFAULT_REPO_REPL_PATTERN = ""
@@ -38,34 +43,54 @@ const DEFAULT_BUILD_TYPE = "maven"
 func NewBuildTestCmd() *cobra.Command {
 
 	exec := &cobra.Command{
-		Use:   "build $indy_url $folo_track_id",
-		Short: "To do a build test by 'replay' a pnc successful build through its folo tracking record",
+		Use:   "build $indy_url [$folo_track_id]",
+		Short: "To do a build test by 'replay' a pnc successful build through its folo tracking record, or its build log by --fromLog",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			perfcompare.PrepareGate(&gate)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			if !validate(args) {
 				cmd.Help()
-				os.Exit(1)
+				report.Exit(1)
 			}
 			// here will use env variables if they are specified for some flags
 			checkEnvVars()
+			if err := build.ValidateReplayOptions(replay); err != nil {
+				fmt.Printf("%s\n\n", err)
+				cmd.Help()
+				report.Exit(1)
+			}
 			indyURL := args[0]
-			foloTrackId := args[1]
 			if common.IsEmptyString(targetIndy) {
 				fmt.Printf("targetIndy is not specified, will use the same one as the $indy_url: %s\n", indyURL)
 				targetIndy = indyURL
 			}
-			build.Run(indyURL, foloTrackId, "", targetIndy, buildType, processNum)
+			if !common.IsEmptyString(fromLog) {
+				build.RunFromLog(indyURL, fromLog, logRepoId, targetIndy, buildType, processNum, failFast, replay)
+			} else {
+				foloTrackId := args[1]
+				build.Run(indyURL, foloTrackId, "", targetIndy, buildType, processNum, failFast, replay)
+			}
+			perfcompare.Gate(gate, cmd.Name())
 		},
 	}
 
 	exec.Flags().StringVarP(&targetIndy, "targetIndy", "t", "", "The target indy server to do the testing. Will get from this flag or from env variables 'INDY_TARGET' if flag is not specified. If both are not specified, will use $indy_url.")
 	exec.Flags().StringVarP(&buildType, "buildType", "b", DEFAULT_BUILD_TYPE, "The type of the build, should be 'maven' or 'npm'. Default is 'maven'.")
 	exec.Flags().IntVarP(&processNum, "processNum", "p", DEFAULT_PROCESS_NUM, "The number of processes to download and upload files in parralel.")
+	exec.Flags().StringVar(&fromLog, "fromLog", "", "Replay the build by the downloads and uploads in its build log (an url, e.g., http://orchhost/pnc-rest/v2/builds/97241/logs/build, or a file) instead of its folo record, e.g., when the record is purged. $folo_track_id is not needed then.")
+	exec.Flags().StringVar(&logRepoId, "logRepoId", build.DEFAULT_LOG_REPO_ID, "The id of the indy repo in the maven settings of the build, used to find the downloads and uploads in the log of --fromLog.")
+	exec.Flags().StringVar(&replay.Mode, "replayMode", build.REPLAY_MODE_BATCH, "How to replay the downloads and uploads. 'batch' does all downloads, then all uploads. 'faithful' starts them at the times of the folo record timestamps, interleaving downloads and uploads as the original build did.")
+	exec.Flags().Float64Var(&replay.Speed, "replaySpeed", 1, "The speed multiplier of the 'faithful' replay mode, e.g., 10 replays a 10 minutes build in 1 minute.")
+	exec.Flags().BoolVar(&replay.VerifySidecars, "verifySidecars", false, "Also verify the downloads against the checksum files (.md5, .sha1, .sha256) served by indy, which sends 3 more requests for each download.")
+	exec.Flags().BoolVar(&failFast, "failFast", false, "Stop handling the remaining files after the first download or upload failure. By default all failures are collected.")
+	perfcompare.AddGateFlags(exec.Flags(), &gate)
 
 	return exec
 }
 
 func validate(args []string) bool {
-	if len(args) <= 1 {
+	if len(args) < 1 || (len(args) == 1 && common.IsEmptyString(fromLog)) {
 		fmt.Printf("indy_url or folo_track_id is not specified!\n\n")
 		return false
 	}
@@ -73,7 +98,7 @@ func validate(args []string) bool {
 		fmt.Printf("$indy_url cannot be empty!\n\n")
 		return false
 	}
-	if common.IsEmptyString(args[1]) {
+	if common.IsEmptyString(fromLog) && common.IsEmptyString(args[1]) {
 		fmt.Printf("$folo_track_id cannot be empty!\n\n")
 		return false
 	}
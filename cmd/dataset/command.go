@@ -19,12 +19,17 @@ package dataset
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/commonjava/indy-tests/pkg/common"
 	"github.com/commonjava/indy-tests/pkg/dataset"
+	"github.com/commonjava/indy-tests/pkg/pnc"
+	"github.com/commonjava/indy-tests/pkg/report"
 	"github.com/spf13/cobra"
 )
 
 func NewDatasetCmd() *cobra.Command {
+	var queueFormat string
 
 	exec := &cobra.Command{
 		Use:     "dataset $pncBaseUrl $indyBaseUrl $buildId",
@@ -33,17 +38,122 @@ func NewDatasetCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			if !validate(args) {
 				cmd.Help()
-				os.Exit(1)
+				report.Exit(1)
+			}
+			if err := dataset.ValidateQueueFormat(queueFormat); err != nil {
+				fmt.Printf("%s\n\n", err)
+				cmd.Help()
+				report.Exit(1)
 			}
 			groupBuild, _ := cmd.Flags().GetBool("groupBuild")
-			dataset.Run(args[0], args[1], args[2], groupBuild)
+			if err := dataset.Run(newPncClient(cmd, args[0]), args[1], args[2], groupBuild, queueFormat); err != nil {
+				fmt.Printf("Error: %s\n", err)
+				report.Exit(1)
+			}
 		},
 	}
 
 	exec.Flags().BoolP("groupBuild", "g", false, "Is group build.")
+	exec.Flags().StringVar(&queueFormat, "queueFormat", dataset.FORMAT_YAML, "The format of the build queue file of a group build, 'yaml' (build-queue.yaml) or 'json' (build-queue.json).")
+	addPncFlags(exec)
+	exec.AddCommand(NewValidateCmd())
+	exec.AddCommand(NewHarvestCmd())
+	return exec
+}
+
+func NewValidateCmd() *cobra.Command {
+	var strict bool
+
+	exec := &cobra.Command{
+		Use:     "validate $datasetDir",
+		Short:   "To check the builds of a test dataset are complete and well-formed, e.g., to gate the dataset PRs.",
+		Example: "dataset validate ./dataset",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fmt.Printf("the dataset directory is not specified!\n\n")
+				cmd.Help()
+				report.Exit(1)
+			}
+			results, err := dataset.ValidateDataset(args[0])
+			if err != nil {
+				fmt.Printf("Error: %s\n", err)
+				report.Exit(1)
+			}
+			if len(results) == 0 {
+				fmt.Printf("Error: no build found in %s\n", args[0])
+				report.Exit(1)
+			}
+			dataset.PrintHealth(os.Stdout, results)
+			if !dataset.ReportHealth(results, strict) {
+				report.Exit(1)
+			}
+		},
+	}
+
+	exec.Flags().BoolVar(&strict, "strict", false, "Fail on the warnings too, e.g., unknown json fields or duplicated tracking entries.")
+	return exec
+}
+
+func NewHarvestCmd() *cobra.Command {
+	options := dataset.HarvestOptions{}
+
+	exec := &cobra.Command{
+		Use:   "harvest $pncBaseUrl $indyBaseUrl",
+		Short: "To generate test datasets from a sample of the successful PNC builds of the last days or of a product milestone.",
+		Example: `dataset harvest https://orch-stage.xyz.com http://indy-admin-stage.xyz.com --days 7 --sample 30
+dataset harvest https://orch-stage.xyz.com http://indy-admin-stage.xyz.com --milestone 1234 --buildTypes NPM`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 2 {
+				fmt.Printf("there are 2 mandatory arguments: pncBaseUrl, indyBaseUrl!\n\n")
+				cmd.Help()
+				report.Exit(1)
+			}
+			for i, t := range options.BuildTypes {
+				options.BuildTypes[i] = strings.ToUpper(strings.TrimSpace(t))
+			}
+			if err := dataset.ValidateHarvestOptions(options); err != nil {
+				fmt.Printf("%s\n\n", err)
+				cmd.Help()
+				report.Exit(1)
+			}
+			results, err := dataset.Harvest(newPncClient(cmd, args[0]), args[1], options)
+			if err != nil {
+				fmt.Printf("Error: %s\n", err)
+				report.Exit(1)
+			}
+			dataset.PrintHarvest(os.Stdout, results)
+			if !dataset.ReportHarvest(results) {
+				report.Exit(1)
+			}
+		},
+	}
+
+	exec.Flags().IntVar(&options.Days, "days", dataset.DEFAULT_HARVEST_DAYS, "Harvest the builds ended in the last days.")
+	exec.Flags().StringVar(&options.MilestoneId, "milestone", "", "Harvest the builds of the product milestone id instead of the last days.")
+	exec.Flags().StringSliceVar(&options.BuildTypes, "buildTypes", []string{dataset.BUILD_MVN, dataset.BUILD_NPM}, "The build types to harvest.")
+	exec.Flags().BoolVar(&options.Temporary, "temporary", false, "Harvest the temporary builds too.")
+	exec.Flags().IntVar(&options.MaxCandidates, "maxCandidates", dataset.DEFAULT_HARVEST_MAX_CANDIDATES, "The max number of the latest builds to get from PNC to sample from, 0 for no limit.")
+	exec.Flags().IntVar(&options.Sample, "sample", dataset.DEFAULT_HARVEST_SAMPLE, "The number of builds to sample, stratified by build type and artifact count (small < 10 <= medium < 100 <= large).")
+	exec.Flags().Int64Var(&options.Seed, "seed", 0, "The seed of the sampling, to sample the same builds again. A random seed is used (and printed) if 0.")
+	exec.Flags().IntVar(&options.Parallel, "parallel", dataset.DEFAULT_HARVEST_PARALLEL, "The number of builds to generate in parallel.")
+	exec.Flags().BoolVar(&options.Resume, "resume", false, "Resume the previous harvest in the dataset dir, with the builds it sampled, skipping the ones done.")
+	addPncFlags(exec)
 	return exec
 }
 
+// addPncFlags adds the flags of the PNC client, see newPncClient
+func addPncFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("pncKeycloak", false, "Authenticate the PNC requests with a keycloak bearer token, see the KEYCLOAK_* env variables. The global --keycloak authenticates all requests, including the ones to indy.")
+}
+
+func newPncClient(cmd *cobra.Command, pncBaseUrl string) *pnc.Client {
+	var auth common.Authenticate
+	if pncKeycloak, _ := cmd.Flags().GetBool("pncKeycloak"); pncKeycloak {
+		auth = common.KeycloakAuthenticator
+	}
+	return pnc.NewClient(pncBaseUrl, auth)
+}
+
 func validate(args []string) bool {
 	if len(args) < 3 {
 		fmt.Printf("there are 3 mandatory arguments: pncBaseUrl, indyBaseUrl, buildId!\n\n")
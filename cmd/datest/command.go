@@ -18,34 +18,47 @@ package datest
 
 import (
 	"fmt"
-	"os"
 	"strconv"
 
 	"github.com/commonjava/indy-tests/pkg/datest"
+	"github.com/commonjava/indy-tests/pkg/perfcompare"
+	"github.com/commonjava/indy-tests/pkg/report"
 
 	"github.com/spf13/cobra"
 )
 
-var targetIndy, daGroup, dataDir string
+var targetIndy, daGroup, dataDir, packageType string
 var processNum int
+var gate perfcompare.GateOptions
 
 func NewDATestCmd() *cobra.Command {
 
 	exec := &cobra.Command{
 		Use:   "datest $targetIndy $daGroup $processNum",
 		Short: "To do a da test based on the alignment logs from PNC build",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			perfcompare.PrepareGate(&gate)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			if !validate(args) {
 				cmd.Help()
-				os.Exit(1)
+				report.Exit(1)
+			}
+			if packageType != datest.PACKAGE_TYPE_MAVEN && packageType != datest.PACKAGE_TYPE_NPM {
+				fmt.Printf("packageType should be '%s' or '%s'!\n\n", datest.PACKAGE_TYPE_MAVEN, datest.PACKAGE_TYPE_NPM)
+				cmd.Help()
+				report.Exit(1)
 			}
 			processNum, err := strconv.Atoi(args[3])
 			if err == nil {
 				fmt.Println(processNum)
 			}
-			datest.Run(args[0], args[1], args[2], processNum)
+			datest.Run(args[0], args[1], args[2], packageType, processNum)
+			perfcompare.Gate(gate, cmd.Name())
 		},
 	}
+	exec.Flags().StringVar(&packageType, "packageType", datest.PACKAGE_TYPE_MAVEN, "The package type of the metadata, 'maven' or 'npm'. The npm metadata is checked to be a valid package metadata (packument).")
+	perfcompare.AddGateFlags(exec.Flags(), &gate)
 
 	return exec
 }
@@ -23,6 +23,7 @@ import (
 
 	"github.com/commonjava/indy-tests/pkg/common"
 	event "github.com/commonjava/indy-tests/pkg/event"
+	"github.com/commonjava/indy-tests/pkg/report"
 
 	"github.com/spf13/cobra"
 )
@@ -31,6 +32,7 @@ import (
 var targetIndy, repoReplPattern, buildType string
 var processNum int
 var doRunEnablement bool
+var wait = common.DEFAULT_WAIT
 
 const DEFAULT_PROCESS_NUM = 1
 const DEFAULT_REPO_REPL_PATTERN = ""
@@ -44,10 +46,15 @@ func NewEventTestCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			if !validate(args) {
 				cmd.Help()
-				os.Exit(1)
+				report.Exit(1)
 			}
 			// here will use env variables if they are specified for some flags
 			checkEnvVars()
+			if err := wait.Validate(); err != nil {
+				fmt.Printf("%s\n\n", err)
+				cmd.Help()
+				report.Exit(1)
+			}
 			indyURL := args[0]
 			foloTrackId := args[1]
 			if common.IsEmptyString(targetIndy) {
@@ -56,7 +63,7 @@ func NewEventTestCmd() *cobra.Command {
 			}
 			doRunEnablement, _ := cmd.Flags().GetBool("doRunEnablement")
 			fmt.Printf("doRunEnablement: %t\n", doRunEnablement)
-			event.Run(indyURL, foloTrackId, targetIndy, buildType, processNum, doRunEnablement)
+			event.Run(indyURL, foloTrackId, targetIndy, buildType, processNum, doRunEnablement, wait)
 		},
 	}
 
@@ -64,6 +71,8 @@ func NewEventTestCmd() *cobra.Command {
 	exec.Flags().StringVarP(&buildType, "buildType", "b", DEFAULT_BUILD_TYPE, "The type of the build, should be 'maven' or 'npm'. Default is 'maven'.")
 	exec.Flags().IntVarP(&processNum, "processNum", "p", DEFAULT_PROCESS_NUM, "The number of processes to download and upload files in parralel.")
 	exec.Flags().BoolP("doRunEnablement", "e", true, "Decide whether to run store enablement validation or not.")
+	exec.Flags().DurationVar(&wait.Timeout, "waitTimeout", wait.Timeout, "Max time to wait for indy to handle each repo change, e.g., to merge the hosted content into the group.")
+	exec.Flags().DurationVar(&wait.Interval, "waitInterval", wait.Interval, "Interval to check the repos while waiting for indy.")
 	return exec
 }
 
@@ -0,0 +1,78 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package folodiff
+
+import (
+	"fmt"
+
+	"github.com/commonjava/indy-tests/pkg/folodiff"
+	"github.com/commonjava/indy-tests/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+func NewFoloDiffCmd() *cobra.Command {
+	var indyURL, releaseNumber, format, jsonFile string
+	var storeKeys map[string]string
+	var ignoreFields []string
+	var allFiles bool
+
+	exec := &cobra.Command{
+		Use:   "folo-diff $originalRecord $replayedRecord",
+		Short: "To compare the folo record of a replayed build with the original one",
+		Long: "To compare the folo record of a replayed build with the original one. A record is an url of the record json, " +
+			"a json file like the tracking.json of a dataset, or a tracking id in the indy of --indy. " +
+			"It exits with 1 if the records differ.",
+		Example: "folo-diff tracking.json build-test-90001 --indy http://indy.xyz.com --releaseNumber 90001",
+		Run: func(cmd *cobra.Command, args []string) {
+			if !validate(args) {
+				cmd.Help()
+				report.Exit(1)
+			}
+			if format != folodiff.FORMAT_TEXT && format != folodiff.FORMAT_JSON {
+				fmt.Printf("Unsupported format %s, it should be text or json\n\n", format)
+				report.Exit(1)
+			}
+			options := folodiff.Options{
+				ReleaseNumber: releaseNumber,
+				StoreKeys:     storeKeys,
+				IgnoreFields:  ignoreFields,
+			}
+			if !allFiles {
+				options.Filter = folodiff.SkipMetadata
+			}
+			folodiff.Run(args[0], args[1], indyURL, options, format, jsonFile)
+		},
+	}
+
+	exec.Flags().StringVar(&indyURL, "indy", "", "The indy to get the records by tracking id from.")
+	exec.Flags().StringVar(&releaseNumber, "releaseNumber", "", "Rewrite the original upload paths with this release number, e.g., 90001 for a replay as build-test-90001.")
+	exec.Flags().StringToStringVar(&storeKeys, "storeKey", nil, "Rewrite an original store key to the replayed one, e.g., maven:hosted:build-1234=maven:hosted:build-test-90001.")
+	exec.Flags().StringSliceVar(&ignoreFields, "ignore", nil, "Fields not to compare: md5, sha1, sha256, size, storeKey, accessChannel, effect.")
+	exec.Flags().BoolVar(&allFiles, "allFiles", false, "Also compare the maven-metadata.xml and npm metadata files.")
+	exec.Flags().StringVarP(&format, "format", "f", folodiff.FORMAT_TEXT, "Output format: text or json.")
+	exec.Flags().StringVar(&jsonFile, "jsonFile", "", "Also write the diff as json to this file.")
+
+	return exec
+}
+
+func validate(args []string) bool {
+	if len(args) < 2 {
+		fmt.Printf("There are 2 mandatory arguments: originalRecord, replayedRecord!\n\n")
+		return false
+	}
+	return true
+}
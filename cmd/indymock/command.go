@@ -0,0 +1,54 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package indymock
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/commonjava/indy-tests/pkg/indymock"
+	"github.com/commonjava/indy-tests/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+const DEFAULT_PORT = 8080
+
+var port int
+var contextPath string
+
+func NewMockIndyCmd() *cobra.Command {
+
+	exec := &cobra.Command{
+		Use:   "mock-indy",
+		Short: "To run an in-memory fake indy server, so the tests can be run locally without a real indy",
+		Run: func(cmd *cobra.Command, args []string) {
+			server := indymock.New()
+			server.ContextPath = contextPath
+			addr := fmt.Sprintf(":%d", port)
+			fmt.Printf("Mock indy is listening on http://localhost%s%s\n", addr, contextPath)
+			if err := http.ListenAndServe(addr, server); err != nil {
+				fmt.Printf("Error: mock indy stopped, %s\n", err)
+				report.Exit(1)
+			}
+		},
+	}
+
+	exec.Flags().IntVarP(&port, "port", "p", DEFAULT_PORT, "The port the mock indy listens on.")
+	exec.Flags().StringVar(&contextPath, "contextPath", "", "The context path of the mock indy, e.g., '/indy' to mock an indy behind a reverse proxy.")
+
+	return exec
+}
@@ -18,33 +18,57 @@ package integrationtest
 
 import (
 	"fmt"
-	"os"
+	"strings"
 
+	"github.com/commonjava/indy-tests/pkg/common"
 	"github.com/commonjava/indy-tests/pkg/integrationtest"
+	"github.com/commonjava/indy-tests/pkg/perfcompare"
+	"github.com/commonjava/indy-tests/pkg/report"
 	"github.com/spf13/cobra"
 )
 
 func NewIntegrationTestCmd() *cobra.Command {
+	var gate perfcompare.GateOptions
+	wait := common.DEFAULT_WAIT
+	var steps integrationtest.StepOptions
 
 	exec := &cobra.Command{
-		Use:     "integrationtest $indyBaseUrl $datasetRepoUrl $buildId $promoteTargetStore $metaCheckRepo(optional) --dryRun(optional)",
-		Short:   "To run integration test",
-		Example: "integrationtest http://indy.xyz.com https://gitlab.xyz.com/nos/nos-integrationtest-dataset 2836 test-builds",
+		Use:   "integrationtest $indyBaseUrl $datasetRepoUrl $buildId $promoteTargetStore $metaCheckRepo(optional) --dryRun(optional)",
+		Short: "To run integration test",
+		Example: "integrationtest http://indy.xyz.com https://gitlab.xyz.com/nos/nos-integrationtest-dataset 2836 test-builds\n" +
+			"integrationtest --resume /tmp/integrationtest/build-test-91234 --fromStep after-promote",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			perfcompare.PrepareGate(&gate)
+		},
 		Run: func(cmd *cobra.Command, args []string) {
-			if !validate(args) {
+			if !validate(args, steps) {
+				cmd.Help()
+				report.Exit(1)
+			}
+			if err := integrationtest.ValidateStepOptions(steps); err != nil {
+				fmt.Printf("%s\n\n", err)
 				cmd.Help()
-				os.Exit(1)
+				report.Exit(1)
+			}
+			if err := wait.Validate(); err != nil {
+				fmt.Printf("%s\n\n", err)
+				cmd.Help()
+				report.Exit(1)
 			}
 			clearCache, _ := cmd.Flags().GetBool("clearCache")
 			dryRun, _ := cmd.Flags().GetBool("dryRun")
 			keepPod, _ := cmd.Flags().GetBool("keepPod")
 			sidecar, _ := cmd.Flags().GetBool("sidecar")
 			indyProxyUrl, _ := cmd.Flags().GetString("indyProxyUrl")
-			metaCheckRepo := ""
+			config := integrationtest.Config{ClearCache: clearCache, DryRun: dryRun, KeepPod: keepPod, Sidecar: sidecar, IndyProxyUrl: indyProxyUrl}
+			if len(args) >= 4 {
+				config.IndyBaseUrl, config.DatasetRepoUrl, config.BuildId, config.PromoteTargetStore = args[0], args[1], args[2], args[3]
+			}
 			if len(args) >= 5 {
-				metaCheckRepo = args[4]
+				config.MetaCheckRepo = args[4]
 			}
-			integrationtest.Run(args[0], args[1], args[2], args[3], metaCheckRepo, clearCache, dryRun, keepPod, sidecar, indyProxyUrl)
+			integrationtest.Run(config, steps, wait)
+			perfcompare.Gate(gate, cmd.Name())
 		},
 	}
 
@@ -53,10 +77,25 @@ func NewIntegrationTestCmd() *cobra.Command {
 	exec.Flags().BoolP("keepPod", "k", false, "Keep the pod after test to debug.")
 	exec.Flags().BoolP("sidecar", "s", false, "Send requests through sidecar.")
 	exec.Flags().StringP("indyProxyUrl", "p", "", "Indy generic proxy url.")
+	exec.Flags().DurationVar(&wait.Timeout, "waitTimeout", wait.Timeout, "Max time to wait for indy to update the metadata after the promotion and the rollback.")
+	exec.Flags().DurationVar(&wait.Interval, "waitInterval", wait.Interval, "Interval to check the metadata while waiting for indy.")
+	exec.Flags().StringVar(&steps.FromStep, "fromStep", "", "Skip the steps before this one. The steps are: "+strings.Join(integrationtest.ALL_STEPS, ", ")+".")
+	exec.Flags().StringSliceVar(&steps.OnlySteps, "onlySteps", nil, "Run these steps only, e.g., after-promote,rollback.")
+	exec.Flags().StringSliceVar(&steps.SkipSteps, "skipSteps", nil, "Do not run these steps, e.g., cleanup to keep the repos.")
+	exec.Flags().StringVar(&steps.RunDir, "runDir", "", "Directory to keep the state and the metadata snapshots of the run. Default is "+integrationtest.TMP_RUN_DIR+"/<build name>.")
+	exec.Flags().StringVar(&steps.Resume, "resume", "", "Continue the failed run of this run dir against its build-test-NNNNN repos, the arguments are read from its state. Without a step selection, the steps not completed are run.")
+	exec.Flags().BoolVar(&steps.KeepOnFailure, "keepOnFailure", false, "Keep the repos of a failed run so it can be resumed. By default they are cleaned up.")
+	perfcompare.AddGateFlags(exec.Flags(), &gate)
 	return exec
 }
 
-func validate(args []string) bool {
+func validate(args []string, steps integrationtest.StepOptions) bool {
+	if steps.Resume != "" {
+		if len(args) > 0 {
+			fmt.Printf("The arguments are ignored, the ones of the resumed run %s are used.\n", steps.Resume)
+		}
+		return true
+	}
 	if len(args) < 4 {
 		fmt.Printf("There are 4 mandatory arguments: indyBaseUrl, datasetRepoUrl, buildId, promoteTargetStore!\n")
 		return false
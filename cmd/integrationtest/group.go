@@ -0,0 +1,82 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package integrationtest
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/integrationtest"
+	"github.com/commonjava/indy-tests/pkg/perfcompare"
+	"github.com/commonjava/indy-tests/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+func NewIntegrationTestGroupCmd() *cobra.Command {
+	var gate perfcompare.GateOptions
+	var config integrationtest.GroupConfig
+	wait := common.DEFAULT_WAIT
+
+	exec := &cobra.Command{
+		Use:     "integrationtest-group $datasetRepoUrl $groupBuildId",
+		Short:   "To run the integration test of the builds of a group build level by level, as in its build-queue.yaml",
+		Example: "integrationtest-group https://gitlab.xyz.com/nos/nos-integrationtest-dataset 2836 -i http://indy.xyz.com --metaCheckRepo test-builds",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			perfcompare.PrepareGate(&gate)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 2 {
+				fmt.Printf("There are 2 mandatory arguments: datasetRepoUrl, groupBuildId!\n")
+				cmd.Help()
+				report.Exit(1)
+			}
+			if common.IsEmptyString(config.IndyBaseUrl) {
+				config.IndyBaseUrl = os.Getenv("INDY_TARGET")
+			}
+			if common.IsEmptyString(config.IndyBaseUrl) {
+				fmt.Printf("indyUrl is not specified by the flag or env variable 'INDY_TARGET'!\n")
+				cmd.Help()
+				report.Exit(1)
+			}
+			if err := wait.Validate(); err != nil {
+				fmt.Printf("%s\n\n", err)
+				cmd.Help()
+				report.Exit(1)
+			}
+			config.DatasetRepoUrl, config.BuildId = args[0], args[1]
+			results := integrationtest.RunGroup(config, wait)
+			perfcompare.Gate(gate, cmd.Name())
+			if !integrationtest.GroupSucceeded(results) {
+				report.Exit(1)
+			}
+		},
+	}
+
+	exec.Flags().StringVarP(&config.IndyBaseUrl, "indyUrl", "i", "", "The indy server to do the testing. Will get from this flag or from env variables 'INDY_TARGET' if flag is not specified.")
+	exec.Flags().StringVar(&config.PromoteTargetStore, "promoteTargetStore", integrationtest.PROMOTE_TARGET_STORE, "The hosted repo to promote the builds to, which is added to the build groups of the downstream builds.")
+	exec.Flags().StringVar(&config.MetaCheckRepo, "metaCheckRepo", "", "The repo to check the metadata of the promoted versions in, e.g., maven:group:test-builds. The check is skipped if not specified.")
+	exec.Flags().IntVar(&config.Parallel, "parallel", 0, "Max number of builds of a level to run at the same time, 0 for all of them.")
+	exec.Flags().BoolVarP(&config.ClearCache, "clearCache", "c", false, "Clear cached built artifact files. This will force download from origin again.")
+	exec.Flags().BoolVarP(&config.DryRun, "dryRun", "d", false, "Print msg for repo creation, down/upload, promote, and clean up, without really doing it.")
+	exec.Flags().BoolVarP(&config.Sidecar, "sidecar", "s", false, "Send requests through sidecar.")
+	exec.Flags().StringVarP(&config.IndyProxyUrl, "indyProxyUrl", "p", "", "Indy generic proxy url.")
+	exec.Flags().DurationVar(&wait.Timeout, "waitTimeout", wait.Timeout, "Max time to wait for indy to update the metadata after the promotions and the rollbacks.")
+	exec.Flags().DurationVar(&wait.Interval, "waitInterval", wait.Interval, "Interval to check the metadata while waiting for indy.")
+	perfcompare.AddGateFlags(exec.Flags(), &gate)
+	return exec
+}
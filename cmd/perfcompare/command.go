@@ -0,0 +1,56 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package perfcompare
+
+import (
+	"fmt"
+
+	"github.com/commonjava/indy-tests/pkg/perfcompare"
+	"github.com/commonjava/indy-tests/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+func NewCompareCmd() *cobra.Command {
+	var format string
+	var options perfcompare.GateOptions
+
+	exec := &cobra.Command{
+		Use:   "compare $baseline $current",
+		Short: "To compare the request metrics of a run with a baseline run",
+		Long: "To compare the request metrics of a run with a baseline run, e.g., the run of the previous indy release. " +
+			"The metrics are the json files written by --metricsFile. It exits with 1 if the p95 latency or the error rate " +
+			"of any request class regressed beyond the thresholds.",
+		Example: "compare baseline/indy-3.1.json metrics.json --maxP95Increase 10",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 2 {
+				fmt.Printf("There are 2 mandatory arguments: baseline, current!\n\n")
+				cmd.Help()
+				report.Exit(1)
+			}
+			if format != perfcompare.FORMAT_TEXT && format != perfcompare.FORMAT_JSON {
+				fmt.Printf("Unsupported format %s, it should be text or json\n\n", format)
+				report.Exit(1)
+			}
+			perfcompare.Run(args[0], args[1], options.Thresholds(), format)
+		},
+	}
+
+	perfcompare.AddThresholdFlags(exec.Flags(), &options)
+	exec.Flags().StringVarP(&format, "format", "f", perfcompare.FORMAT_TEXT, "Output format: text or json.")
+
+	return exec
+}
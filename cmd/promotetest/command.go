@@ -18,9 +18,9 @@ package promotetest
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/commonjava/indy-tests/pkg/promotetest"
+	"github.com/commonjava/indy-tests/pkg/report"
 	"github.com/spf13/cobra"
 )
 
@@ -34,7 +34,7 @@ func NewPromoteTestCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			if !validate(args) {
 				cmd.Help()
-				os.Exit(1)
+				report.Exit(1)
 			}
 
 			promotetest.Run(args[0], args[1], args[2])
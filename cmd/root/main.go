@@ -3,35 +3,113 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/commonjava/indy-tests/cmd/buildtest"
 	"github.com/commonjava/indy-tests/cmd/dataset"
 	"github.com/commonjava/indy-tests/cmd/datest"
 	"github.com/commonjava/indy-tests/cmd/event"
+	"github.com/commonjava/indy-tests/cmd/folodiff"
+	"github.com/commonjava/indy-tests/cmd/indymock"
 	"github.com/commonjava/indy-tests/cmd/integrationtest"
+	"github.com/commonjava/indy-tests/cmd/perfcompare"
 	"github.com/commonjava/indy-tests/cmd/promotetest"
 	"github.com/commonjava/indy-tests/cmd/statictest"
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
 	"github.com/spf13/cobra"
 )
 
 func main() {
+	clientConfig := common.ClientConfigFromEnv()
+	retries := clientConfig.Retry.MaxAttempts - 1
+	useKeycloak := strings.ToLower(strings.TrimSpace(os.Getenv("USE_KEYCLOAK"))) == "true"
+	reportFormat := report.FORMAT_TEXT
+	if f := os.Getenv(report.ENVAR_REPORT_FORMAT); f != "" {
+		reportFormat = f
+	}
+	reportFile := os.Getenv(report.ENVAR_REPORT_FILE)
+	metricsFile := os.Getenv(common.ENVAR_METRICS_FILE)
+	metricsListen := os.Getenv(common.ENVAR_METRICS_LISTEN)
+	metricsPush := os.Getenv(common.ENVAR_METRICS_PUSH)
 	rootCmd := &cobra.Command{
 		Use:   "indy-test",
 		Short: "indy-test is a tool to do indy integration test against runnable indy server",
 		Run: func(cmd *cobra.Command, args []string) {
 			cmd.Help()
 		},
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			report.Start(cmd.Name(), args)
+			if err := report.Configure(reportFormat, reportFile); err != nil {
+				fmt.Printf("Error: %s\n", err)
+				os.Exit(1)
+			}
+			clientConfig.Retry.MaxAttempts = retries + 1
+			client, err := common.NewIndyClient(clientConfig)
+			if err != nil {
+				fmt.Printf("Error: cannot create http client, %s\n", err)
+				report.Exit(1)
+			}
+			if useKeycloak {
+				client.Authenticate = common.KeycloakAuthenticator
+			}
+			common.SetDefaultIndyClient(client)
+			if metricsListen != "" {
+				if _, err := common.ServeMetrics(metricsListen, common.DefaultMetrics()); err != nil {
+					fmt.Printf("Error: %s\n", err)
+					report.Exit(1)
+				}
+			}
+			report.OnExit(func(exitCode int) {
+				common.DefaultMetrics().PrintSummary()
+				common.DefaultMetrics().Report()
+				if metricsFile != "" {
+					if err := common.WriteMetricsSnapshot(common.DefaultMetrics().Snapshot(cmd.Name()), metricsFile); err != nil {
+						fmt.Printf("Warning: cannot write the metrics, %s\n", err)
+					}
+				}
+				if metricsPush != "" {
+					if err := common.PushMetrics(metricsPush, "indy-test-"+cmd.Name(), common.DefaultMetrics()); err != nil {
+						fmt.Printf("Warning: %s\n", err)
+					}
+				}
+			})
+		},
 	}
+	flags := rootCmd.PersistentFlags()
+	flags.DurationVar(&clientConfig.ConnectTimeout, "connectTimeout", clientConfig.ConnectTimeout, "Timeout to connect to a server, including TLS handshake. Env: "+common.ENVAR_CONNECT_TIMEOUT)
+	flags.DurationVar(&clientConfig.ReadTimeout, "readTimeout", clientConfig.ReadTimeout, "Timeout to wait for the response headers of a request. Env: "+common.ENVAR_READ_TIMEOUT)
+	flags.DurationVar(&clientConfig.Timeout, "timeout", clientConfig.Timeout, "Timeout of a whole request including the response body, 0 for no limit. Env: "+common.ENVAR_TIMEOUT)
+	flags.IntVar(&clientConfig.MaxConnsPerHost, "maxConnsPerHost", clientConfig.MaxConnsPerHost, "Max connections to one host, 0 for no limit. Env: "+common.ENVAR_MAX_CONNS_PER_HOST)
+	flags.IntVar(&retries, "retries", retries, "Max retries of a request failed with 502/503/504 or a connection error, 0 to disable retry. Env: "+common.ENVAR_RETRIES)
+	flags.DurationVar(&clientConfig.Retry.InitialBackoff, "retryBackoff", clientConfig.Retry.InitialBackoff, "Wait before the first retry, doubled (with jitter) for each following retry. Env: "+common.ENVAR_RETRY_BACKOFF)
+	flags.BoolVar(&clientConfig.Retry.RetryUploads, "retryUploads", clientConfig.Retry.RetryUploads, "Also retry the failed PUT uploads, whose content can be sent again.")
+	flags.BoolVar(&useKeycloak, "keycloak", useKeycloak, "Authenticate all requests with a keycloak bearer token, see the KEYCLOAK_* env variables. Env: USE_KEYCLOAK")
+	flags.BoolVar(&clientConfig.InsecureSkipVerify, "insecure", clientConfig.InsecureSkipVerify, "Skip verifying the server certificates. Env: "+common.ENVAR_INSECURE_SKIP_VERIFY)
+	flags.StringVar(&reportFormat, "report-format", reportFormat, "Format of the run report: json, junit or text. Env: "+report.ENVAR_REPORT_FORMAT)
+	flags.StringVar(&reportFile, "report-file", reportFile, "File to write the run report to, stdout if not specified. Env: "+report.ENVAR_REPORT_FILE)
+	flags.StringVar(&metricsFile, "metricsFile", metricsFile, "File to write the request metrics of the run to as json, which can be used as the --baseline of later runs. Env: "+common.ENVAR_METRICS_FILE)
+	flags.StringVar(&metricsListen, "metricsListen", metricsListen, "Address to expose the request metrics on in the prometheus text format during the run, e.g., :9100 for http://localhost:9100/metrics. Env: "+common.ENVAR_METRICS_LISTEN)
+	flags.StringVar(&metricsPush, "metricsPush", metricsPush, "Pushgateway url to push the final request metrics to, e.g., http://pushgateway:9091, under the job 'indy-test-<command>'. Env: "+common.ENVAR_METRICS_PUSH)
+	flags.StringVar(&clientConfig.CACertFile, "caCert", clientConfig.CACertFile, "PEM bundle of the CAs to trust in addition to the system ones, e.g., for an https indy with an internal CA. Env: "+common.ENVAR_CA_CERT)
+	flags.StringVar(&clientConfig.ClientCertFile, "clientCert", clientConfig.ClientCertFile, "PEM client certificate for servers requiring mutual TLS, used with --clientKey. Env: "+common.ENVAR_CLIENT_CERT)
+	flags.StringVar(&clientConfig.ClientKeyFile, "clientKey", clientConfig.ClientKeyFile, "PEM private key of the client certificate. Env: "+common.ENVAR_CLIENT_KEY)
 	rootCmd.AddCommand(buildtest.NewBuildTestCmd())
 	rootCmd.AddCommand(promotetest.NewPromoteTestCmd())
 	rootCmd.AddCommand(datest.NewDATestCmd())
 	rootCmd.AddCommand(dataset.NewDatasetCmd())
 	rootCmd.AddCommand(integrationtest.NewIntegrationTestCmd())
+	rootCmd.AddCommand(integrationtest.NewIntegrationTestGroupCmd())
 	rootCmd.AddCommand(event.NewEventTestCmd())
 	rootCmd.AddCommand(statictest.NewStaticTestCmd())
+	rootCmd.AddCommand(indymock.NewMockIndyCmd())
+	rootCmd.AddCommand(folodiff.NewFoloDiffCmd())
+	rootCmd.AddCommand(perfcompare.NewCompareCmd())
 
+	defer report.Recover()
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		report.Exit(1)
 	}
+	report.Finish(0, "")
 }
@@ -22,6 +22,7 @@ import (
 	"strconv"
 
 	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
 	static "github.com/commonjava/indy-tests/pkg/statictest"
 
 	"github.com/spf13/cobra"
@@ -30,6 +31,7 @@ import (
 // example: http://orchhost/pnc-rest/v2/builds/97241/logs/build
 var originalIndy, staticIndy, foloTrackId string
 var processNum int
+var verifySidecars bool
 
 const DEFAULT_PROCESS_NUM = 1
 const DEFAULT_REPO_REPL_PATTERN = ""
@@ -43,11 +45,11 @@ func NewStaticTestCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			if !validate() {
 				cmd.Help()
-				os.Exit(1)
+				report.Exit(1)
 			}
 			// here will use env variables if they are specified for some flags
 			checkEnvVars()
-			static.Run(originalIndy, foloTrackId, staticIndy, processNum)
+			static.Run(originalIndy, foloTrackId, staticIndy, processNum, verifySidecars)
 		},
 	}
 
@@ -55,6 +57,7 @@ func NewStaticTestCmd() *cobra.Command {
 	exec.Flags().StringVarP(&staticIndy, "staticIndy", "s", "", "The static indy server to do the testing.")
 	exec.Flags().StringVarP(&foloTrackId, "floloTrackId", "f", "", "The folo tracking id in the original indy server to get download entries.")
 	exec.Flags().IntVarP(&processNum, "processNum", "p", DEFAULT_PROCESS_NUM, "The number of processes to download files in parralel.")
+	exec.Flags().BoolVar(&verifySidecars, "verifySidecars", false, "Also verify the downloads against the checksum files (.md5, .sha1, .sha256) served by the static proxy, which sends 3 more requests for each download.")
 
 	exec.MarkFlagRequired("originalIndy")
 	exec.MarkFlagRequired("staticIndy")
@@ -10,5 +10,6 @@ require (
 	github.com/sirupsen/logrus v1.4.2
 	github.com/smartystreets/goconvey v1.6.4
 	github.com/spf13/cobra v0.0.3
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/spf13/pflag v1.0.3
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -2,7 +2,6 @@ package buildtest
 
 import (
 	"fmt"
-	"io"
 	"strings"
 
 	common "github.com/commonjava/indy-tests/pkg/common"
@@ -52,22 +51,14 @@ func prepareIndyRepos(indyURL, buildName string, buildMeta BuildMetadata, additi
 }
 
 func prepareIndyHosted(indyURL, buildType, buildName string) bool {
-	hostedVars := IndyHostedVars{
-		Name: buildName,
-		Type: buildType,
-	}
-
-	URL := fmt.Sprintf("%s/api/admin/stores/%s/hosted/%s", indyURL, buildType, buildName)
-
-	hosted := IndyHostedTemplate(&hostedVars)
 	fmt.Printf("Start creating hosted repo %s\n", buildName)
-	result := putRequest(URL, strings.NewReader(hosted))
-	if result {
-		fmt.Printf("Hosted repo %s created successfully, check %s for details\n", buildName, URL)
-	} else {
-		fmt.Printf("Hosted repo %s creation fail, no following operations\n", buildName)
+	stores := newStoreClient(indyURL)
+	if err := stores.Update(common.NewHostedRepository(buildType, buildName)); err != nil {
+		fmt.Printf("Hosted repo %s creation fail, no following operations. Cause: %s\n", buildName, err)
+		return false
 	}
-	return result
+	fmt.Printf("Hosted repo %s created successfully, check %s/api/admin/stores/%s/hosted/%s for details\n", buildName, stores.IndyURL, buildType, buildName)
+	return true
 }
 
 func prepareIndyGroup(indyURL, buildName string, buildMeta BuildMetadata, additionalRepos []string) bool {
@@ -81,23 +72,14 @@ func prepareIndyGroup(indyURL, buildName string, buildMeta BuildMetadata, additi
 		constituents = append(constituents, additionalRepos...)
 	}
 
-	groupVars := IndyGroupVars{
-		Name:         buildName,
-		Type:         buildMeta.buildType,
-		Constituents: constituents,
-	}
-	group := IndyGroupTemplate(&groupVars)
-
-	URL := fmt.Sprintf("%s/api/admin/stores/%s/group/%s", indyURL, buildType, buildName)
-
 	fmt.Printf("Start creating group repo %s\n", buildName)
-	result := putRequest(URL, strings.NewReader(group))
-	if result {
-		fmt.Printf("Group repo %s created successfully, check %s for details\n", buildName, URL)
-	} else {
-		fmt.Printf("Group repo %s created failed, no following operations\n", buildName)
+	stores := newStoreClient(indyURL)
+	if err := stores.Update(common.NewGroup(buildType, buildName, constituents...)); err != nil {
+		fmt.Printf("Group repo %s created failed, no following operations. Cause: %s\n", buildName, err)
+		return false
 	}
-	return result
+	fmt.Printf("Group repo %s created successfully, check %s/api/admin/stores/%s/group/%s for details\n", buildName, stores.IndyURL, buildType, buildName)
+	return true
 }
 
 // Delete group and hosted repo (with content)
@@ -119,50 +101,28 @@ func delAllowed(buildName string) bool {
 
 // Delete hosted repo and content
 func deleteIndyHosted(indyURL, buildType, repoName string) {
-	URL := fmt.Sprintf("%s/api/admin/stores/%s/hosted/%s?deleteContent=true", indyURL, buildType, repoName)
-	fmt.Printf("Start deleting hosted repo %s\n", repoName)
-	result := delRequest(URL)
-	if result {
-		fmt.Printf("Hosted repo %s deleted successfully\n", repoName)
-	}
+	deleteIndyStore(indyURL, common.StoreKey{PackageType: buildType, Type: common.STORE_TYPE_HOSTED, Name: repoName}, true)
 }
 
 func deleteIndyRemote(indyURL, buildType, repoName string) {
-	URL := fmt.Sprintf("%s/api/admin/stores/%s/remote/%s?deleteContent=true", indyURL, buildType, repoName)
-	fmt.Printf("Start deleting remote repo %s\n", repoName)
-	result := delRequest(URL)
-	if result {
-		fmt.Printf("Remote repo %s deleted successfully\n", repoName)
-	}
+	deleteIndyStore(indyURL, common.StoreKey{PackageType: buildType, Type: common.STORE_TYPE_REMOTE, Name: repoName}, true)
 }
 
 func deleteIndyGroup(indyURL, buildType, repoName string) {
-	URL := fmt.Sprintf("%s/api/admin/stores/%s/group/%s", indyURL, buildType, repoName)
-	fmt.Printf("Start deleting group repo %s\n", repoName)
-	result := delRequest(URL)
-	if result {
-		fmt.Printf("Group repo %s deleted successfully\n", repoName)
-	}
+	deleteIndyStore(indyURL, common.StoreKey{PackageType: buildType, Type: common.STORE_TYPE_GROUP, Name: repoName}, false)
 }
 
-func getRequest(url string) (string, int, bool) {
-	content, code, succeeded := common.HTTPRequest(url, common.MethodGet, nil, true, nil, nil, "", false)
-	return content, code, succeeded
+func deleteIndyStore(indyURL string, key common.StoreKey, deleteContent bool) {
+	fmt.Printf("Start deleting %s repo %s\n", key.Type, key.Name)
+	if err := newStoreClient(indyURL).Delete(key, deleteContent); err != nil {
+		fmt.Printf("Warning: %s\n", err)
+		return
+	}
+	fmt.Printf("%s repo %s deleted successfully\n", key.Type, key.Name)
 }
 
 var authenticator = common.DecideAuthenticator()
 
-func postRequest(url string, data io.Reader) (string, bool) {
-	content, _, succeeded := common.HTTPRequest(url, common.MethodPost, authenticator, true, data, nil, "", false)
-	return content, succeeded
-}
-
-func putRequest(url string, data io.Reader) bool {
-	_, _, succeeded := common.HTTPRequest(url, common.MethodPut, authenticator, false, data, nil, "", false)
-	return succeeded
-}
-
-func delRequest(url string) bool {
-	_, _, succeeded := common.HTTPRequest(url, common.MethodDelete, authenticator, false, nil, nil, "", false)
-	return succeeded
+func newStoreClient(indyURL string) *common.StoreClient {
+	return common.NewStoreClient(indyURL, authenticator)
 }
@@ -18,35 +18,154 @@ package buildtest
 
 import (
 	"fmt"
-	"os"
+	"io/ioutil"
+	"net/url"
 	"regexp"
+	"strings"
 
 	common "github.com/commonjava/indy-tests/pkg/common"
 )
 
-// Not used
-func PrepareEntriesByLog(logUrl string) map[string][]string {
-	log, err := common.GetRespAsPlaintext(logUrl)
+// DEFAULT_LOG_REPO_ID is the id of the indy repo in the maven settings of PNC builds
+const DEFAULT_LOG_REPO_ID = "indy-mvn"
+
+const (
+	EFFECT_DOWNLOAD = "DOWNLOAD"
+	EFFECT_UPLOAD   = "UPLOAD"
+)
+
+// npm logs the requests like "npm http fetch GET 200 http://indyhost/api/folo/track/build-1/npm/group/build-1/lodash 96ms"
+var npmFetchRegexp = regexp.MustCompile(`npm (?:http fetch|sill fetch|http) (GET|PUT) (2\d\d) (https?://\S+)`)
+
+// indy api paths which carry the store key, e.g., /api/folo/track/build-1/maven/group/build-1/org/foo.pom or
+// /api/content/maven/hosted/build-1/org/foo.pom
+var indyPathRegexp = regexp.MustCompile(`/api/(?:folo/track/([^/]+)|content)/([^/]+)/(hosted|group|remote)/([^/]+)(/.*)$`)
+
+// PrepareEntriesByLog reads a build log from an url or a file, and turns it into a replay plan, see LogToTrackedContent
+func PrepareEntriesByLog(logSource, repoId string) (common.TrackedContent, error) {
+	var logCnt string
+	if strings.HasPrefix(logSource, "http://") || strings.HasPrefix(logSource, "https://") {
+		content, err := common.GetRespAsPlaintext(logSource)
+		if err != nil {
+			return common.TrackedContent{}, fmt.Errorf("cannot get log %s, %s", logSource, err)
+		}
+		logCnt = content
+	} else {
+		b, err := ioutil.ReadFile(logSource)
+		if err != nil {
+			return common.TrackedContent{}, fmt.Errorf("cannot read log %s, %s", logSource, err)
+		}
+		logCnt = string(b)
+	}
+	return LogToTrackedContent(logCnt, repoId)
+}
+
+// LogToTrackedContent turns the "Downloaded from"/"Uploaded to" lines of a maven build log, and the successful
+// GET/PUT requests of a npm build log, into a record like the folo record of the build. The entries have no
+// checksums, so they are not verified by md5. The tracking id is taken from the folo urls in the log.
+func LogToTrackedContent(logCnt, repoId string) (common.TrackedContent, error) {
+	record := common.TrackedContent{Uploads: []common.TrackedContentEntry{}, Downloads: []common.TrackedContentEntry{}}
+	entries, err := parseLogURLs(logCnt, repoId)
 	if err != nil {
-		httpErr := err.(common.HTTPError)
-		fmt.Printf("Request failed! Log url: %s, response status: %d, error message: %s\n", logUrl, httpErr.StatusCode, httpErr.Message)
-		os.Exit(1)
+		return record, err
+	}
+	for _, npm := range npmFetchRegexp.FindAllStringSubmatch(logCnt, -1) {
+		if npm[1] == "GET" {
+			entries["downloads"] = append(entries["downloads"], npm[3])
+		} else {
+			entries["uploads"] = append(entries["uploads"], npm[3])
+		}
+	}
+
+	seen := make(map[string]bool)
+	add := func(URL, effect string) error {
+		entry, trackingId, err := logURLToEntry(URL, effect)
+		if err != nil {
+			return err
+		}
+		if trackingId != "" && record.TrackingKey.Id == "" {
+			record.TrackingKey.Id = trackingId
+		}
+		k := effect + " " + entry.StoreKey + entry.Path
+		if seen[k] {
+			return nil
+		}
+		seen[k] = true
+		if effect == EFFECT_UPLOAD {
+			record.Uploads = append(record.Uploads, entry)
+		} else {
+			record.Downloads = append(record.Downloads, entry)
+		}
+		return nil
+	}
+	for _, u := range entries["downloads"] {
+		if err := add(u, EFFECT_DOWNLOAD); err != nil {
+			return record, err
+		}
+	}
+	for _, u := range entries["uploads"] {
+		if err := add(u, EFFECT_UPLOAD); err != nil {
+			return record, err
+		}
+	}
+	// The files downloaded from the build's own hosted repo are produced by the build, e.g., the maven-metadata.xml
+	// read by the deploy plugin. They do not exist before the uploads of the replay, so they are not replayed.
+	if record.TrackingKey.Id != "" {
+		downloads := []common.TrackedContentEntry{}
+		for _, down := range record.Downloads {
+			if key, err := common.ParseStoreKey(down.StoreKey); err == nil && key.Type == common.STORE_TYPE_HOSTED && key.Name == record.TrackingKey.Id {
+				continue
+			}
+			downloads = append(downloads, down)
+		}
+		record.Downloads = downloads
 	}
-	result, err := ParseLog(log)
+	if len(record.Uploads) == 0 && len(record.Downloads) == 0 {
+		return record, fmt.Errorf("no download or upload of repo %s found in the log", repoId)
+	}
+	return record, nil
+}
+
+func logURLToEntry(URL, effect string) (common.TrackedContentEntry, string, error) {
+	u, err := url.Parse(URL)
 	if err != nil {
-		fmt.Printf("Log parse failed! Log url: %s, error message: %s\n", logUrl, err.Error())
-		os.Exit(1)
+		return common.TrackedContentEntry{}, "", fmt.Errorf("invalid url %s in the log, %s", URL, err)
+	}
+	m := indyPathRegexp.FindStringSubmatch(u.Path) // the path is decoded, e.g., npm "@redhat%2fopossum"
+	if m == nil {
+		return common.TrackedContentEntry{}, "", fmt.Errorf("url %s in the log is not an indy content url", URL)
 	}
+	return common.TrackedContentEntry{
+		AccessChannel: "NATIVE",
+		Path:          m[5],
+		LocalUrl:      URL,
+		Effect:        effect,
+		StoreKey:      strings.Join([]string{m[2], m[3], m[4]}, ":"),
+	}, m[1], nil
+}
 
-	return result
+// RewriteBuildStoreKey points a store key of the original build repos to the repos of the replay, e.g.,
+// "maven:group:build-1" => "maven:group:build-test-90001". The store keys of the other repos are kept.
+func RewriteBuildStoreKey(storeKey, trackingId, newBuildName string) string {
+	key, err := common.ParseStoreKey(storeKey)
+	if err != nil || trackingId == "" || key.Name != trackingId || key.Type == common.STORE_TYPE_REMOTE {
+		return storeKey
+	}
+	return strings.Join([]string{key.PackageType, key.Type, newBuildName}, ":")
 }
 
+// ParseLog collects the urls of the "Downloaded from indy-mvn"/"Uploaded to indy-mvn" lines of a maven build log
 func ParseLog(logCnt string) (map[string][]string, error) {
+	return parseLogURLs(logCnt, DEFAULT_LOG_REPO_ID)
+}
+
+func parseLogURLs(logCnt, repoId string) (map[string][]string, error) {
 	if common.IsEmptyString(logCnt) {
 		return nil, fmt.Errorf("The log content is empty!")
 	}
-	downloadR := regexp.MustCompile(`\[INFO\] Downloaded from indy-mvn:\s*(https{0,1}:\/\/.+)\s{1}(\(.+at.+\))`)
-	uploadR := regexp.MustCompile(`\[INFO\] Uploaded to indy-mvn:\s*(https{0,1}:\/\/.+)\s{1}(\(.+at.+\))`)
+	repo := regexp.QuoteMeta(repoId)
+	downloadR := regexp.MustCompile(`\[INFO\]\s+Downloaded from ` + repo + `:\s*(https{0,1}:\/\/\S+)\s+(\(.+at.+\))`)
+	uploadR := regexp.MustCompile(`\[INFO\]\s+Uploaded to ` + repo + `:\s*(https{0,1}:\/\/\S+)\s+(\(.+at.+\))`)
 	result := make(map[string][]string)
 	downloads := collectEntries(downloadR, logCnt)
 	if downloads != nil {
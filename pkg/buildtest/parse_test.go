@@ -17,6 +17,7 @@
 package buildtest
 
 import (
+	"strings"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -59,3 +60,62 @@ func TestParseLog(t *testing.T) {
 	})
 
 }
+
+var TEST_NPM_CONTENT = `
+npm http fetch GET 200 http://indyhost/api/folo/track/build-5120/npm/group/build-5120/@redhat%2fopossum 96ms
+npm http fetch GET 200 http://indyhost/api/folo/track/build-5120/npm/group/build-5120/@redhat/opossum/-/opossum-6.2.1.tgz 12ms
+npm http fetch GET 304 http://indyhost/api/folo/track/build-5120/npm/group/build-5120/lodash 8ms (from cache)
+npm http fetch GET 200 http://indyhost/api/folo/track/build-5120/npm/group/build-5120/@redhat/opossum/-/opossum-6.2.1.tgz 3ms
+npm http fetch PUT 201 http://indyhost/api/folo/track/build-5120/npm/hosted/build-5120/@redhat%2fmy-app 405ms
+`
+
+func TestLogToTrackedContent(t *testing.T) {
+	Convey("TestLogToTrackedContent", t, func() {
+		Convey("Maven log should be turned into a replay plan", func() {
+			record, err := LogToTrackedContent(TEST_CONTENT, DEFAULT_LOG_REPO_ID)
+			So(err, ShouldBeNil)
+			So(record.TrackingKey.Id, ShouldEqual, "build-97241")
+			// the maven-metadata.xml downloaded from the build repo is produced by the build
+			So(len(record.Downloads), ShouldEqual, 2)
+			So(record.Downloads[0].Path, ShouldEqual, "/org/jboss/jboss-parent/35/jboss-parent-35.pom")
+			So(record.Downloads[0].StoreKey, ShouldEqual, "maven:group:build-97241")
+			So(record.Downloads[0].Effect, ShouldEqual, EFFECT_DOWNLOAD)
+			So(len(record.Uploads), ShouldEqual, 2)
+			So(record.Uploads[1].Path, ShouldEqual, "/org/jboss/eap/jboss-eap-parent/maven-metadata.xml")
+			So(record.Uploads[1].StoreKey, ShouldEqual, "maven:hosted:build-97241")
+		})
+		Convey("Repo id should be configurable", func() {
+			content := strings.ReplaceAll(TEST_CONTENT, "indy-mvn", "pnc-indy")
+			_, err := LogToTrackedContent(content, DEFAULT_LOG_REPO_ID)
+			So(err, ShouldNotBeNil)
+			record, err := LogToTrackedContent(content, "pnc-indy")
+			So(err, ShouldBeNil)
+			So(len(record.Uploads), ShouldEqual, 2)
+		})
+		Convey("Npm log should be turned into a replay plan", func() {
+			record, err := LogToTrackedContent(TEST_NPM_CONTENT, DEFAULT_LOG_REPO_ID)
+			So(err, ShouldBeNil)
+			So(record.TrackingKey.Id, ShouldEqual, "build-5120")
+			So(len(record.Downloads), ShouldEqual, 2)
+			So(record.Downloads[0].Path, ShouldEqual, "/@redhat/opossum")
+			So(record.Downloads[1].Path, ShouldEqual, "/@redhat/opossum/-/opossum-6.2.1.tgz")
+			So(record.Downloads[1].StoreKey, ShouldEqual, "npm:group:build-5120")
+			So(len(record.Uploads), ShouldEqual, 1)
+			So(record.Uploads[0].StoreKey, ShouldEqual, "npm:hosted:build-5120")
+		})
+		Convey("Empty log should fail", func() {
+			_, err := LogToTrackedContent("", DEFAULT_LOG_REPO_ID)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRewriteBuildStoreKey(t *testing.T) {
+	Convey("The store keys of the original build repos should be rewritten", t, func() {
+		So(RewriteBuildStoreKey("maven:group:build-1", "build-1", "build-test-90001"), ShouldEqual, "maven:group:build-test-90001")
+		So(RewriteBuildStoreKey("npm:hosted:build-1", "build-1", "build-test-90001"), ShouldEqual, "npm:hosted:build-test-90001")
+		So(RewriteBuildStoreKey("maven:remote:central", "build-1", "build-test-90001"), ShouldEqual, "maven:remote:central")
+		So(RewriteBuildStoreKey("maven:group:build-12", "build-1", "build-test-90001"), ShouldEqual, "maven:group:build-12")
+		So(RewriteBuildStoreKey("maven:group:build-1", "", "build-test-90001"), ShouldEqual, "maven:group:build-1")
+	})
+}
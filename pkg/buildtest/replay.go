@@ -0,0 +1,116 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package buildtest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	common "github.com/commonjava/indy-tests/pkg/common"
+)
+
+const (
+	// REPLAY_MODE_BATCH does all downloads, then all uploads, as fast as processNum allows
+	REPLAY_MODE_BATCH = "batch"
+	// REPLAY_MODE_FAITHFUL starts the downloads and uploads at the times of the original build, see ReplayOptions
+	REPLAY_MODE_FAITHFUL = "faithful"
+)
+
+// ReplayOptions decides the order and pace of the downloads and uploads of DoRun, and how the downloads are verified
+type ReplayOptions struct {
+	// Mode is REPLAY_MODE_BATCH (the default if empty) or REPLAY_MODE_FAITHFUL. In faithful mode every entry of
+	// the folo record starts at the offset of its first timestamp from the earliest timestamp of the record, so
+	// downloads and uploads are interleaved as in the original build. The entries without timestamps, e.g., those
+	// parsed from a build log, start at the beginning.
+	Mode string
+	// Speed divides the offsets in faithful mode, e.g., 10 replays a 10 minutes build in 1 minute
+	Speed float64
+	// VerifySidecars checks the downloads against the checksum files served by indy too, which costs a request
+	// for each checksum algorithm of every download. The downloads are always checked against the folo record.
+	VerifySidecars bool
+}
+
+// DEFAULT_REPLAY is the batch replay, which was the only mode before the faithful one
+var DEFAULT_REPLAY = ReplayOptions{Mode: REPLAY_MODE_BATCH, Speed: 1}
+
+// ValidateReplayOptions checks the mode and speed given by the flags
+func ValidateReplayOptions(replay ReplayOptions) error {
+	if replay.Mode != "" && replay.Mode != REPLAY_MODE_BATCH && replay.Mode != REPLAY_MODE_FAITHFUL {
+		return fmt.Errorf("unknown replay mode %q, should be '%s' or '%s'", replay.Mode, REPLAY_MODE_BATCH, REPLAY_MODE_FAITHFUL)
+	}
+	if replay.Speed <= 0 {
+		return fmt.Errorf("replay speed should be positive, got %v", replay.Speed)
+	}
+	return nil
+}
+
+// scheduleByTimestamps puts the prepared download and upload entries on the timeline of the folo record
+func scheduleByTimestamps(record common.TrackedContent, downloads, uploads map[string][]string,
+	downloadFunc, uploadFunc common.ArtifactJob) []common.ScheduledArtifact {
+	var base int64
+	for _, entries := range [][]common.TrackedContentEntry{record.Downloads, record.Uploads} {
+		for _, e := range entries {
+			if ts := firstTimestamp(e); ts > 0 && (base == 0 || ts < base) {
+				base = ts
+			}
+		}
+	}
+	schedule := []common.ScheduledArtifact{}
+	add := func(entries []common.TrackedContentEntry, prepared map[string][]string, job common.ArtifactJob) {
+		for _, e := range entries {
+			entry, ok := prepared[e.Path]
+			if !ok {
+				continue
+			}
+			var offset time.Duration
+			if ts := firstTimestamp(e); ts > 0 {
+				offset = time.Duration(ts-base) * time.Millisecond
+			}
+			schedule = append(schedule, common.ScheduledArtifact{Path: e.Path, Entry: entry, Offset: offset, Job: job})
+		}
+	}
+	add(record.Downloads, downloads, downloadFunc)
+	add(record.Uploads, uploads, uploadFunc)
+	return schedule
+}
+
+// firstTimestamp is the first access of the entry in milliseconds, folo appends a timestamp on every access
+func firstTimestamp(e common.TrackedContentEntry) int64 {
+	var first int64
+	for _, ts := range e.Timestamps {
+		if ts > 0 && (first == 0 || ts < first) {
+			first = ts
+		}
+	}
+	return first
+}
+
+// prefetchUploadFiles downloads the original files of the uploads before the faithful replay starts, so the
+// uploads are sent at their time instead of being delayed by the download from the original indy
+func prefetchUploadFiles(ctx context.Context, uploadDir string, uploads map[string][]string, verifier common.Verifier, processNum int) {
+	if len(uploads) == 0 {
+		return
+	}
+	fmt.Println("Prefetch the original files of the uploads.")
+	results := common.ConcurrentRun(ctx, processNum, false, uploads, func(ctx context.Context, artiPath, md5str, originalArtiURL, targetArtiURL string) common.JobResult {
+		_, err := cacheUploadFile(uploadDir, artiPath, originalArtiURL, verifier)
+		return common.JobResult{URL: originalArtiURL, Err: err}
+	})
+	// The failed ones are retried by the uploads of the replay, which report the failures
+	results.PrintSummary("Prefetch")
+}
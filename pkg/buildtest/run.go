@@ -1,6 +1,7 @@
 package buildtest
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"os"
@@ -8,141 +9,230 @@ import (
 	"strings"
 
 	common "github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
 const (
-	TMP_DOWNLOAD_DIR = "/tmp/download"
-	TMP_UPLOAD_DIR   = "/tmp/upload"
-	PROXY_           = "proxy-"
+	TMP_UPLOAD_DIR = "/tmp/upload"
+	PROXY_         = "proxy-"
 )
 
-func Run(originalIndy, foloId, replacement, targetIndy, packageType string, processNum int) {
-	origIndy := originalIndy
-	if !strings.HasPrefix(origIndy, "http://") {
-		origIndy = "http://" + origIndy
-	}
+func Run(originalIndy, foloId, replacement, targetIndy, packageType string, processNum int, failFast bool, replay ReplayOptions) {
+	origIndy := common.NormIndyURL(originalIndy)
 	foloTrackContent := common.GetFoloRecord(origIndy, foloId)
 	newBuildName := common.GenerateRandomBuildName()
-	DoRun(originalIndy, targetIndy, "", packageType, newBuildName, foloTrackContent, nil, processNum, false, false)
+	exitOnError(DoRun(originalIndy, targetIndy, "", packageType, newBuildName, foloTrackContent, nil, processNum, failFast, false, false, replay))
+}
+
+// RunFromLog replays a build by its build log (an url or a file) instead of its folo record, e.g., when the record
+// is already purged. repoId is the id of the indy repo in the maven settings, see DEFAULT_LOG_REPO_ID.
+func RunFromLog(originalIndy, logSource, repoId, targetIndy, packageType string, processNum int, failFast bool, replay ReplayOptions) {
+	step := report.Step("build", "parse log "+logSource)
+	foloTrackContent, err := PrepareEntriesByLog(logSource, repoId)
+	if err != nil {
+		step.Fail("%s", err)
+		fmt.Printf("Error: cannot replay the build by log %s, %s\n", logSource, err)
+		report.Exit(1)
+	}
+	step.Pass()
+	fmt.Printf("Parsed log %s, tracking id: %s, downloads: %d, uploads: %d\n", logSource, foloTrackContent.TrackingKey.Id,
+		len(foloTrackContent.Downloads), len(foloTrackContent.Uploads))
+	newBuildName := common.GenerateRandomBuildName()
+	rewriteBuildRepos(&foloTrackContent, newBuildName)
+	exitOnError(DoRun(originalIndy, targetIndy, "", packageType, newBuildName, foloTrackContent, nil, processNum, failFast, false, false, replay))
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		report.Exit(1)
+	}
+}
+
+// rewriteBuildRepos points the downloads from the original build repos to the repos of the new build, which are
+// the urls DoRun requests. The store keys of the uploads are kept to address the original content.
+func rewriteBuildRepos(record *common.TrackedContent, newBuildName string) {
+	for i, down := range record.Downloads {
+		record.Downloads[i].StoreKey = RewriteBuildStoreKey(down.StoreKey, record.TrackingKey.Id, newBuildName)
+	}
 }
 
-// Create the repo structure and do the download/upload
+// Create the repo structure and do the download/upload. The downloads and uploads are run by processNum
+// workers in parallel; with failFast the remaining artifacts are skipped after the first failure. By default all
+// downloads are done before the uploads, see ReplayOptions for the replay by the original timestamps. An error is
+// returned instead of exiting, so the caller can go on with other builds, e.g., the parallel builds of a group.
 func DoRun(originalIndy, targetIndy, indyProxyUrl, packageType, newBuildName string, foloTrackContent common.TrackedContent,
 	additionalRepos []string,
-	processNum int, clearCache, dryRun bool) bool {
+	processNum int, failFast, clearCache, dryRun bool, replay ReplayOptions) error {
 
-	common.ValidateTargetIndyOrExit(originalIndy)
-	targetIndyHost, _ := common.ValidateTargetIndyOrExit(targetIndy)
+	if _, validated := common.ValidateTargetIndy(originalIndy); !validated {
+		return fmt.Errorf("original indy %s is not valid", originalIndy)
+	}
+	targetIndyURL, validated := common.ValidateTargetIndy(targetIndy)
+	if !validated {
+		return fmt.Errorf("target indy %s is not valid", targetIndy)
+	}
 
 	// Prepare the indy repos for the whole testing
 	buildMeta := decideMeta(packageType)
-	if !prepareIndyRepos("http://"+targetIndyHost, newBuildName, *buildMeta, additionalRepos, dryRun) {
-		os.Exit(1)
+	common.DefaultMetrics().SetPhase("prepare")
+	step := report.Step("build", "prepare repos "+newBuildName)
+	if !prepareIndyRepos(targetIndyURL, newBuildName, *buildMeta, additionalRepos, dryRun) {
+		step.Fail("cannot create the build repos in %s", targetIndyURL)
+		return fmt.Errorf("cannot create the build repos of %s in %s", newBuildName, targetIndyURL)
 	}
+	step.Pass()
 
 	trackingId := foloTrackContent.TrackingKey.Id
-	downloadDir, uploadDir := prepareDownUploadDirectories(trackingId, clearCache)
+	uploadDir, err := prepareUploadDirectory(trackingId, clearCache)
+	if err != nil {
+		return err
+	}
 
 	proxyEnabled := (indyProxyUrl != "")
 	downloads := prepareDownloadEntriesByFolo(targetIndy, newBuildName, packageType, foloTrackContent, additionalRepos, proxyEnabled)
-	defer cleanGenericProxyReposIfAny(targetIndy, newBuildName, foloTrackContent, proxyEnabled)
+	defer cleanGenericProxyReposIfAny(targetIndyURL, newBuildName, foloTrackContent, proxyEnabled)
 
-	downloadFunc := func(md5str, originalArtiURL, targetArtiURL string) bool {
-		fileLoc := path.Join(downloadDir, path.Base(targetArtiURL))
+	downloadVerifier := common.NewChecksumVerifier(foloTrackContent.Downloads, replay.VerifySidecars)
+	uploadVerifier := common.NewChecksumVerifier(foloTrackContent.Uploads, false)
+	ctx := context.Background()
+	downloadFunc := func(ctx context.Context, artiPath, md5str, originalArtiURL, targetArtiURL string) common.JobResult {
+		result := common.JobResult{URL: targetArtiURL}
 		if dryRun {
 			fmt.Printf("Dry run download, url: %s\n", targetArtiURL)
-			return true
+			return result
 		}
+		// The downloads are only verified, so they are streamed instead of stored
+		var downloaded common.StreamedDownload
 		success := false
+		sidecarURL := targetArtiURL
 		if strings.HasPrefix(targetArtiURL, PROXY_) {
-			success = common.DownloadFileByProxy(targetArtiURL[len(PROXY_):], fileLoc, indyProxyUrl, newBuildName+common.TRACKING_SUFFIX, "pass")
+			// the proxied url is not an indy url, there are no checksum files next to it
+			downloaded, success = common.DownloadStreamByProxy(targetArtiURL[len(PROXY_):], indyProxyUrl, newBuildName+common.TRACKING_SUFFIX, "pass")
+			sidecarURL = ""
 		} else {
-			success, _ = common.DownloadFile(targetArtiURL, fileLoc)
+			downloaded, success = common.DownloadStream(targetArtiURL)
+			result.StatusCode = downloaded.StatusCode
 		}
-		if success {
-			common.Md5Check(fileLoc, md5str)
+		if !success {
+			result.Err = fmt.Errorf("download failed")
+			return result
 		}
-		return success
+		result.Bytes = downloaded.Size
+		result.Err = downloadVerifier.VerifyChecksums(artiPath, downloaded.Checksums, sidecarURL)
+		return result
 	}
-	broken := false
-	if len(downloads) > 0 {
-		fmt.Println("Start handling downloads artifacts.")
-		fmt.Printf("==========================================\n\n")
-		if processNum > 1 {
-			broken = !common.ConcurrentRun(processNum, downloads, downloadFunc)
-		} else {
-			for _, down := range downloads {
-				broken = !downloadFunc(down[0], down[1], down[2])
-				if broken {
-					break
-				}
-			}
-		}
-		fmt.Println("==========================================")
-		if broken {
-			fmt.Printf("Build test failed due to some downloading errors. Please see above logs to see the details.\n\n")
-			os.Exit(1)
-		}
-		fmt.Printf("Downloads artifacts handling finished.\n\n")
-	}
-
-	uploadFunc := func(md5str, originalArtiURL, targetArtiURL string) bool {
+	uploadFunc := func(ctx context.Context, artiPath, md5str, originalArtiURL, targetArtiURL string) common.JobResult {
+		result := common.JobResult{URL: targetArtiURL}
 		if dryRun {
 			fmt.Printf("Dry run upload, originalArtiURL: %s, targetArtiURL: %s\n", originalArtiURL, targetArtiURL)
-			return true
+			return result
 		}
 
-		cacheFile := path.Join(uploadDir, path.Base(originalArtiURL))
-		var downloaded bool
-		if common.FileOrDirExists(cacheFile) {
-			fmt.Printf("File already downloaded, reuse cacheFile: %s\n", cacheFile)
-			downloaded = true
-		} else {
-			downloaded = common.DownloadUploadFileForCache(originalArtiURL, cacheFile)
+		cacheFile, err := cacheUploadFile(uploadDir, artiPath, originalArtiURL, uploadVerifier)
+		if err != nil {
+			result.Err = err
+			return result
 		}
-		if downloaded {
-			common.Md5Check(cacheFile, md5str)
-			return common.UploadFile(targetArtiURL, cacheFile)
+		var uploaded bool
+		uploaded, result.StatusCode = common.UploadFile(targetArtiURL, cacheFile)
+		if !uploaded {
+			result.Err = fmt.Errorf("upload failed")
+			return result
 		}
-		return false
+		result.Bytes = common.FileSize(cacheFile)
+		return result
 	}
 
 	uploads := prepareUploadEntriesByFolo(originalIndy, targetIndy, newBuildName, foloTrackContent)
 
-	if len(uploads) > 0 {
-		fmt.Println("Start handling uploads artifacts.")
-		fmt.Printf("==========================================\n\n")
-		if processNum > 1 {
-			broken = !common.ConcurrentRun(processNum, uploads, uploadFunc)
-		} else {
-			for _, up := range uploads {
-				broken = !uploadFunc(up[0], up[1], up[2])
-				if broken {
-					break
-				}
-			}
+	if replay.Mode == REPLAY_MODE_FAITHFUL {
+		if !dryRun {
+			common.DefaultMetrics().SetPhase("prefetch")
+			prefetchUploadFiles(ctx, uploadDir, uploads, uploadVerifier, processNum)
 		}
+		common.DefaultMetrics().SetPhase("replay")
+		schedule := scheduleByTimestamps(foloTrackContent, downloads, uploads, downloadFunc, uploadFunc)
+		fmt.Println("Start replaying downloads and uploads by the original timestamps.")
+		fmt.Printf("==========================================\n\n")
+		results := common.PacedRun(ctx, processNum, failFast, replay.Speed, schedule)
 		fmt.Println("==========================================")
-		if broken {
-			fmt.Printf("Build test failed due to some uploadig errors. Please see above logs to see the details.\n\n")
-			os.Exit(1)
+		results.PrintSummary("Replay")
+		results.Report("replay")
+		if !results.Succeeded() {
+			fmt.Printf("Build test failed due to some downloading or uploading errors. Please see above logs to see the details.\n\n")
+			common.PrintRetryReport()
+			return fmt.Errorf("replay of %s failed, %d of %d requests failed", newBuildName, len(results.Failed()), len(results))
+		}
+		fmt.Printf("Replay finished.\n\n")
+	} else {
+		if len(downloads) > 0 {
+			common.DefaultMetrics().SetPhase("downloads")
+			fmt.Println("Start handling downloads artifacts.")
+			fmt.Printf("==========================================\n\n")
+			results := common.ConcurrentRun(ctx, processNum, failFast, downloads, downloadFunc)
+			fmt.Println("==========================================")
+			results.PrintSummary("Downloads")
+			results.Report("downloads")
+			if !results.Succeeded() {
+				fmt.Printf("Build test failed due to some downloading errors. Please see above logs to see the details.\n\n")
+				common.PrintRetryReport()
+				return fmt.Errorf("downloads of %s failed, %d of %d artifacts failed", newBuildName, len(results.Failed()), len(results))
+			}
+			fmt.Printf("Downloads artifacts handling finished.\n\n")
 		}
 
-		fmt.Printf("Uploads artifacts handling finished.\n\n")
-	}
-	if !broken && !dryRun {
-		targIndy := targetIndy
-		if !strings.HasPrefix(targIndy, "http://") {
-			targIndy = "http://" + targIndy
+		if len(uploads) > 0 {
+			common.DefaultMetrics().SetPhase("uploads")
+			fmt.Println("Start handling uploads artifacts.")
+			fmt.Printf("==========================================\n\n")
+			results := common.ConcurrentRun(ctx, processNum, failFast, uploads, uploadFunc)
+			fmt.Println("==========================================")
+			results.PrintSummary("Uploads")
+			results.Report("uploads")
+			if !results.Succeeded() {
+				fmt.Printf("Build test failed due to some uploadig errors. Please see above logs to see the details.\n\n")
+				common.PrintRetryReport()
+				return fmt.Errorf("uploads of %s failed, %d of %d artifacts failed", newBuildName, len(results.Failed()), len(results))
+			}
+
+			fmt.Printf("Uploads artifacts handling finished.\n\n")
 		}
-		if common.SealFoloRecord(targIndy, newBuildName) {
+	}
+	if !dryRun {
+		common.DefaultMetrics().SetPhase("seal")
+		step := report.Step("build", "seal folo record "+newBuildName)
+		if common.SealFoloRecord(targetIndyURL, newBuildName) {
 			fmt.Printf("Folo record sealing succeeded for %s\n", newBuildName)
+			step.Pass()
 		} else {
 			fmt.Printf("Warning: folo record sealing failed for %s\n", newBuildName)
+			step.Skip("sealing failed")
 		}
 	}
+	common.PrintRetryReport()
+
+	return nil
+}
 
-	return true
+// cacheUploadFile downloads the original file of an upload into uploadDir, unless it is cached by a former run.
+// The file is verified either way, so a corrupted cache is not uploaded.
+func cacheUploadFile(uploadDir, artiPath, originalArtiURL string, verifier common.Verifier) (string, error) {
+	cacheFile := common.CacheFilePath(uploadDir, artiPath)
+	var downloaded bool
+	if common.FileOrDirExists(cacheFile) {
+		fmt.Printf("File already downloaded, reuse cacheFile: %s\n", cacheFile)
+		downloaded = true
+	} else {
+		downloaded = common.DownloadUploadFileForCache(originalArtiURL, cacheFile)
+	}
+	if !downloaded {
+		return "", fmt.Errorf("download from %s failed", originalArtiURL)
+	}
+	if err := verifier.Verify(artiPath, cacheFile, originalArtiURL); err != nil {
+		return "", err
+	}
+	return cacheFile, nil
 }
 
 // Remove the repositories that were generated by httproxy. We need to clean them after the test.
@@ -173,7 +263,7 @@ func getRepoNameByOriginUrl(originUrl string) string {
 // as they should be directly download from target indy.
 func prepareDownloadEntriesByFolo(targetIndyURL, newBuildId, packageType string,
 	foloRecord common.TrackedContent, additionalRepos []string, proxyEnabled bool) map[string][]string {
-	targetIndy := normIndyURL(targetIndyURL)
+	targetIndy := common.NormIndyURL(targetIndyURL)
 	result := make(map[string][]string)
 	for _, down := range foloRecord.Downloads {
 		var p string
@@ -187,7 +277,7 @@ func prepareDownloadEntriesByFolo(targetIndyURL, newBuildId, packageType string,
 				// so we replace "generic-http/remote/r-xxxx" to "generic-http:hosted:h-xxxx"
 				repoPath = strings.Replace(repoPath, "generic-http/remote/r-", "generic-http/hosted/h-", 1)
 				p = path.Join("api/content", repoPath, down.Path)
-				downUrl = fmt.Sprintf("%s%s", targetIndy, p)
+				downUrl = fmt.Sprintf("%s/%s", targetIndy, p)
 			}
 		} else {
 			// To explain the 'HasPrefix': NPM build can have downloads from maven repos (or vice verse). We use the original repo
@@ -197,7 +287,7 @@ func prepareDownloadEntriesByFolo(targetIndyURL, newBuildId, packageType string,
 			} else {
 				p = path.Join("api/folo/track", newBuildId, packageType, "group", newBuildId, down.Path)
 			}
-			downUrl = fmt.Sprintf("%s%s", targetIndy, p)
+			downUrl = fmt.Sprintf("%s/%s", targetIndy, p)
 		}
 		result[down.Path] = []string{down.Md5, "", downUrl}
 	}
@@ -207,8 +297,8 @@ func prepareDownloadEntriesByFolo(targetIndyURL, newBuildId, packageType string,
 // For uploads entries, firstly they should be downloaded from original indy server. We use original indy server to
 // make the download url, and use the target indy server to make the upload url
 func prepareUploadEntriesByFolo(originalIndyURL, targetIndyURL, newBuildId string, foloRecord common.TrackedContent) map[string][]string {
-	originalIndy := normIndyURL(originalIndyURL)
-	targetIndy := normIndyURL(targetIndyURL)
+	originalIndy := common.NormIndyURL(originalIndyURL)
+	targetIndy := common.NormIndyURL(targetIndyURL)
 	result := make(map[string][]string)
 	for _, up := range foloRecord.Uploads {
 		orgiUpUrl, targUpUrl := createUploadUrls(originalIndy, targetIndy, newBuildId, up)
@@ -220,36 +310,17 @@ func prepareUploadEntriesByFolo(originalIndyURL, targetIndyURL, newBuildId strin
 func createUploadUrls(originalIndy, targetIndy, newBuildId string, up common.TrackedContentEntry) (string, string) {
 	storePath := common.StoreKeyToPath(up.StoreKey) // original store, e.g, maven/hosted/build-1234
 	uploadPath := path.Join("api/content", storePath, up.Path)
-	orgiUpUrl := fmt.Sprintf("%s%s", originalIndy, uploadPath)                                              // original url to retrieve artifact
+	orgiUpUrl := fmt.Sprintf("%s/%s", originalIndy, uploadPath)                                             // original url to retrieve artifact
 	alteredUploadPath := common.AlterUploadPath(up.Path, up.StoreKey, newBuildId[len(common.BUILD_TEST_):]) // replace version number
 	toks := strings.Split(storePath, "/")                                                                   // get package/type, e.g., maven/hosted
 	targetStorePath := path.Join(toks[0], toks[1], newBuildId, alteredUploadPath)                           // e.g, maven/hosted/build-913413/org/...
-	targUpUrl := fmt.Sprintf("%sapi/folo/track/%s/%s", targetIndy, newBuildId, targetStorePath)
+	targUpUrl := fmt.Sprintf("%s/api/folo/track/%s/%s", targetIndy, newBuildId, targetStorePath)
 	return orgiUpUrl, targUpUrl
 }
 
-func normIndyURL(indyURL string) string {
-	indy := indyURL
-	if !strings.HasPrefix(indy, "http://") {
-		indy = "http://" + indy
-	}
-	if !strings.HasSuffix(indy, "/") {
-		indy = indy + "/"
-	}
-	return indy
-}
-
-func prepareDownUploadDirectories(buildId string, clearCache bool) (string, string) {
-	// use "/tmp/download", which will be dropped after each run
-	downloadDir := TMP_DOWNLOAD_DIR
-	if !common.FileOrDirExists(downloadDir) {
-		os.MkdirAll(downloadDir, os.FileMode(0755))
-	}
-	if !common.FileOrDirExists(downloadDir) {
-		fmt.Printf("Error: cannot create directory %s for file downloading.\n", downloadDir)
-		os.Exit(1)
-	}
-
+// prepareUploadDirectory creates the directory to cache the original files of the uploads, the files are kept
+// by their full paths, see common.CacheFilePath
+func prepareUploadDirectory(buildId string, clearCache bool) (string, error) {
 	// use ENVAR_TEST_MOUNT_PATH + "bulidId/upload" if this envar is defined
 	uploadDir := TMP_UPLOAD_DIR
 	envarTestMountPath := os.Getenv(common.ENVAR_TEST_MOUNT_PATH)
@@ -265,9 +336,8 @@ func prepareDownUploadDirectories(buildId string, clearCache bool) (string, stri
 	}
 
 	if !common.FileOrDirExists(uploadDir) {
-		fmt.Printf("Error: cannot create directory %s for caching uploading files.\n", uploadDir)
-		os.Exit(1)
+		return "", fmt.Errorf("cannot create directory %s for caching uploading files", uploadDir)
 	}
-	fmt.Printf("Prepared download dir: %s, upload dir: %s\n", downloadDir, uploadDir)
-	return downloadDir, uploadDir
+	fmt.Printf("Prepared upload dir: %s\n", uploadDir)
+	return uploadDir, nil
 }
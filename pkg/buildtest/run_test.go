@@ -1,9 +1,14 @@
 package buildtest
 
 import (
+	"crypto/md5"
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/indymock"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -36,3 +41,160 @@ func Test_getRepoNameByOriginUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestDoRunWithMockIndy(t *testing.T) {
+	Convey("DoRun should replay a folo record against a mock indy", t, func() {
+		mock, server := indymock.Start()
+		defer server.Close()
+		os.Setenv(common.ENVAR_TEST_MOUNT_PATH, t.TempDir())
+		defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+		pom := []byte("<project><version>1.0.0.redhat-00001</version></project>")
+		dep := []byte("<project><version>2.0</version></project>")
+		uploadPath := "/org/foo/foo/1.0.0.redhat-00001/foo-1.0.0.redhat-00001.pom"
+		downloadPath := "/org/bar/bar/2.0/bar-2.0.pom"
+		mock.PutStore(indymock.NewHosted("maven", "build-1"))
+		mock.PutContent("maven:hosted:build-1", uploadPath, pom)
+		mock.PutContent("maven:remote:central", downloadPath, dep)
+		record := common.TrackedContent{
+			TrackingKey: common.TrackingKey{Id: "build-1"},
+			Uploads:     []common.TrackedContentEntry{{Path: uploadPath, StoreKey: "maven:hosted:build-1", Md5: md5Hex(pom)}},
+			Downloads:   []common.TrackedContentEntry{{Path: downloadPath, StoreKey: "maven:remote:central", Md5: md5Hex(dep)}},
+		}
+
+		buildName := common.GenerateRandomBuildName()
+		So(DoRun(server.URL, server.URL, "", TYPE_MVN, buildName, record, nil, 2, true, true, false, DEFAULT_REPLAY), ShouldBeNil)
+
+		replayed, sealed, found := mock.GetFoloRecord(buildName)
+		So(found, ShouldBeTrue)
+		So(sealed, ShouldBeTrue)
+		So(len(replayed.Downloads), ShouldEqual, 1)
+		So(replayed.Downloads[0].Path, ShouldEqual, downloadPath)
+		So(replayed.Downloads[0].Md5, ShouldEqual, md5Hex(dep))
+		So(len(replayed.Uploads), ShouldEqual, 1)
+		altered := common.AlterUploadPath(uploadPath, "maven:hosted:build-1", buildName[len(common.BUILD_TEST_):])
+		So(replayed.Uploads[0].Path, ShouldEqual, altered)
+		So(replayed.Uploads[0].StoreKey, ShouldEqual, "maven:hosted:"+buildName)
+
+		group, ok := mock.GetStore("maven:group:" + buildName)
+		So(ok, ShouldBeTrue)
+		So(group.Constituents(), ShouldResemble, []string{"maven:hosted:" + buildName, "maven:group:" + DEFAULT_SHARED_GROUP})
+
+		DeleteIndyTestRepos(server.URL, TYPE_MVN, buildName)
+		_, ok = mock.GetStore("maven:group:" + buildName)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestDoRunFaithfulWithMockIndy(t *testing.T) {
+	Convey("Faithful DoRun should interleave downloads and uploads by the timestamps", t, func() {
+		mock, server := indymock.Start()
+		defer server.Close()
+		os.Setenv(common.ENVAR_TEST_MOUNT_PATH, t.TempDir())
+		defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+		pom := []byte("<project><version>1.0.0.redhat-00001</version></project>")
+		dep1 := []byte("<project><version>2.0</version></project>")
+		dep2 := []byte("<project><version>3.0</version></project>")
+		uploadPath := "/org/foo/foo/1.0.0.redhat-00001/foo-1.0.0.redhat-00001.pom"
+		mock.PutStore(indymock.NewHosted("maven", "build-1"))
+		mock.PutContent("maven:hosted:build-1", uploadPath, pom)
+		mock.PutContent("maven:remote:central", "/org/bar/bar/2.0/bar-2.0.pom", dep1)
+		mock.PutContent("maven:remote:central", "/org/baz/baz/3.0/baz-3.0.pom", dep2)
+		record := common.TrackedContent{
+			TrackingKey: common.TrackingKey{Id: "build-1"},
+			Uploads: []common.TrackedContentEntry{
+				{Path: uploadPath, StoreKey: "maven:hosted:build-1", Md5: md5Hex(pom), Timestamps: []int64{1600000000400}},
+			},
+			Downloads: []common.TrackedContentEntry{
+				{Path: "/org/baz/baz/3.0/baz-3.0.pom", StoreKey: "maven:remote:central", Md5: md5Hex(dep2), Timestamps: []int64{1600000000800}},
+				{Path: "/org/bar/bar/2.0/bar-2.0.pom", StoreKey: "maven:remote:central", Md5: md5Hex(dep1), Timestamps: []int64{1600000000900, 1600000000000}},
+			},
+		}
+
+		buildName := common.GenerateRandomBuildName()
+		replay := ReplayOptions{Mode: REPLAY_MODE_FAITHFUL, Speed: 4}
+		start := time.Now()
+		So(DoRun(server.URL, server.URL, "", TYPE_MVN, buildName, record, nil, 1, true, true, false, replay), ShouldBeNil)
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 200*time.Millisecond)
+
+		replayed, _, found := mock.GetFoloRecord(buildName)
+		So(found, ShouldBeTrue)
+		So(len(replayed.Downloads), ShouldEqual, 2)
+		So(len(replayed.Uploads), ShouldEqual, 1)
+		times := map[string]int64{}
+		for _, e := range append(replayed.Downloads, replayed.Uploads...) {
+			times[e.Path] = e.Timestamps[0]
+		}
+		altered := common.AlterUploadPath(uploadPath, "maven:hosted:build-1", buildName[len(common.BUILD_TEST_):])
+		So(times["/org/bar/bar/2.0/bar-2.0.pom"], ShouldBeLessThanOrEqualTo, times[altered])
+		So(times[altered], ShouldBeLessThanOrEqualTo, times["/org/baz/baz/3.0/baz-3.0.pom"])
+	})
+}
+
+func TestDoRunFromLogWithMockIndy(t *testing.T) {
+	Convey("A build replayed by its log should request the repos of the new build", t, func() {
+		mock, server := indymock.Start()
+		defer server.Close()
+		os.Setenv(common.ENVAR_TEST_MOUNT_PATH, t.TempDir())
+		defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+		pom := []byte("<project><version>1.0.0.redhat-00001</version></project>")
+		uploadPath := "/org/foo/foo/1.0.0.redhat-00001/foo-1.0.0.redhat-00001.pom"
+		downloadPath := "/org/bar/bar/2.0/bar-2.0.pom"
+		mock.PutStore(indymock.NewHosted("maven", "build-1"))
+		mock.PutContent("maven:hosted:build-1", uploadPath, pom)
+		mock.PutContent("maven:remote:central", downloadPath, []byte("<project><version>2.0</version></project>"))
+		log := fmt.Sprintf("[INFO] Downloaded from indy-mvn: %s/api/folo/track/build-1/maven/group/build-1%s (41 B at 1 kB/s)\n"+
+			"[INFO] Uploaded to indy-mvn: %s/api/folo/track/build-1/maven/hosted/build-1%s (56 B at 1 kB/s)\n", server.URL, downloadPath, server.URL, uploadPath)
+		record, err := LogToTrackedContent(log, DEFAULT_LOG_REPO_ID)
+		So(err, ShouldBeNil)
+
+		buildName := common.GenerateRandomBuildName()
+		rewriteBuildRepos(&record, buildName)
+		So(record.Downloads[0].StoreKey, ShouldEqual, "maven:group:"+buildName)
+		So(record.Uploads[0].StoreKey, ShouldEqual, "maven:hosted:build-1")
+		So(DoRun(server.URL, server.URL, "", TYPE_MVN, buildName, record, nil, 1, true, true, false, DEFAULT_REPLAY), ShouldBeNil)
+
+		requests := mock.Requests()
+		So(requests, ShouldContain, fmt.Sprintf("GET /api/folo/track/%s/maven/group/%s%s", buildName, buildName, downloadPath))
+		So(requests, ShouldContain, "GET /api/content/maven/hosted/build-1"+uploadPath)
+		for _, r := range requests {
+			So(r, ShouldNotContainSubstring, "/group/build-1/")
+		}
+
+		Convey("Also for the downloads from the repos of another package type", func() {
+			npmRecord := common.TrackedContent{TrackingKey: common.TrackingKey{Id: "build-1"},
+				Downloads: []common.TrackedContentEntry{{Path: downloadPath, StoreKey: "maven:group:build-1"}}}
+			rewriteBuildRepos(&npmRecord, buildName)
+			downloads := prepareDownloadEntriesByFolo(server.URL, buildName, TYPE_NPM, npmRecord, nil, false)
+			So(downloads[downloadPath][2], ShouldEqual, fmt.Sprintf("%s/api/folo/track/%s/maven/group/%s%s", server.URL, buildName, buildName, downloadPath))
+		})
+	})
+}
+
+func TestScheduleByTimestamps(t *testing.T) {
+	Convey("Entries should be scheduled at the offsets of their first timestamps", t, func() {
+		record := common.TrackedContent{
+			Uploads: []common.TrackedContentEntry{{Path: "/a.pom", Timestamps: []int64{3000}}},
+			Downloads: []common.TrackedContentEntry{
+				{Path: "/b.pom", Timestamps: []int64{5000, 1000}},
+				{Path: "/c.pom"},
+				{Path: "/not-prepared.pom", Timestamps: []int64{2000}},
+			},
+		}
+		entry := []string{"", "", ""}
+		downloads := map[string][]string{"/b.pom": entry, "/c.pom": entry}
+		uploads := map[string][]string{"/a.pom": entry}
+		schedule := scheduleByTimestamps(record, downloads, uploads, nil, nil)
+		offsets := map[string]time.Duration{}
+		for _, s := range schedule {
+			offsets[s.Path] = s.Offset
+		}
+		So(offsets, ShouldResemble, map[string]time.Duration{"/a.pom": 2 * time.Second, "/b.pom": 0, "/c.pom": 0})
+	})
+}
+
+func md5Hex(data []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(data))
+}
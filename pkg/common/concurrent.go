@@ -1,48 +1,250 @@
 package common
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
-func ConcurrentRun(numWorkers int, artifacts map[string][]string, job func(md5, originalURL, targetURL string) bool) bool {
+// JobResult is the outcome of one artifact job run by ConcurrentRun.
+type JobResult struct {
+	Path       string
+	URL        string
+	StatusCode int
+	Bytes      int64
+	Duration   time.Duration
+	Err        error
+}
+
+// Succeeded tells if the job finished without error
+func (r JobResult) Succeeded() bool {
+	return r.Err == nil
+}
+
+// JobResults are the results of all artifact jobs in a run, in the order they finished.
+type JobResults []JobResult
+
+// Succeeded tells if all jobs finished without error
+func (rs JobResults) Succeeded() bool {
+	for _, r := range rs {
+		if !r.Succeeded() {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed returns the results with an error
+func (rs JobResults) Failed() JobResults {
+	failed := JobResults{}
+	for _, r := range rs {
+		if !r.Succeeded() {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// TotalBytes sums the bytes transferred by all jobs
+func (rs JobResults) TotalBytes() int64 {
+	var total int64
+	for _, r := range rs {
+		total += r.Bytes
+	}
+	return total
+}
+
+// PrintSummary prints the numbers of the run and every failed artifact
+func (rs JobResults) PrintSummary(title string) {
+	failed := rs.Failed()
+	fmt.Printf("%s: %d finished, %d failed, %s transferred\n", title, len(rs), len(failed), ByteCountSI(rs.TotalBytes()))
+	for _, r := range failed {
+		fmt.Printf("  [FAILED] %s, status: %d, error: %s\n", r.Path, r.StatusCode, r.Err)
+	}
+	if mismatches := rs.Mismatches(); len(mismatches) > 0 {
+		fmt.Printf("%s: %d checksum mismatches\n", title, len(mismatches))
+		for _, m := range mismatches {
+			fmt.Printf("  [CORRUPTED] %s, %s\n", m.Path, m)
+		}
+	}
+}
+
+// Report adds a case for every artifact to the suite of the run report. The artifacts which were not started
+// because the run was canceled are skipped.
+func (rs JobResults) Report(suite string) {
+	s := report.GetSuite(suite)
+	for _, r := range rs {
+		status, message := report.StatusPassed, ""
+		if errors.Is(r.Err, context.Canceled) {
+			status, message = report.StatusSkipped, "canceled"
+		} else if !r.Succeeded() {
+			status, message = report.StatusFailed, r.Err.Error()
+		}
+		c := s.Add(r.Path, status, r.Duration, message)
+		if r.URL != "" {
+			c.Set("url", r.URL)
+		}
+		if r.StatusCode != 0 {
+			c.Set("status", r.StatusCode)
+		}
+		if r.Bytes > 0 {
+			c.Set("bytes", r.Bytes)
+		}
+		var checksumErr *ChecksumError
+		if errors.As(r.Err, &checksumErr) {
+			for _, m := range checksumErr.Mismatches {
+				c.Set(m.Source+"."+m.Algorithm, fmt.Sprintf("expected %s, calculated %s", m.Expected, m.Actual))
+			}
+		}
+	}
+}
+
+// ArtifactJob handles one artifact. The md5, originalURL and targetURL are the entries prepared for the path
+// (see prepareDownloadEntriesByFolo in buildtest). The job should stop early when ctx is done.
+type ArtifactJob func(ctx context.Context, path, md5, originalURL, targetURL string) JobResult
+
+// ConcurrentRun runs job for every artifact with numWorkers goroutines in parallel and returns the result of
+// each artifact. With failFast, the first failure cancels the artifacts which are not started yet, otherwise all
+// artifacts are handled and all failures are collected. Artifacts not started because of cancellation (either by
+// failFast or by ctx) are returned as failed with the context error.
+func ConcurrentRun(ctx context.Context, numWorkers int, failFast bool, artifacts map[string][]string, job ArtifactJob) JobResults {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
 	fmt.Printf("Start to run job in concurrent mode with thread number %v\n", numWorkers)
-	ch := make(chan []string, numWorkers*5) // This buffered number of chan can be anything as long as it's larger than numWorkers
+	scheduled := make([]ScheduledArtifact, 0, len(artifacts))
+	for p, a := range artifacts {
+		scheduled = append(scheduled, ScheduledArtifact{Path: p, Entry: a, Job: job})
+	}
+	results, _ := runScheduled(ctx, numWorkers, failFast, 0, scheduled)
+	return results
+}
+
+// ScheduledArtifact is an artifact job which starts at Offset after the start of PacedRun
+type ScheduledArtifact struct {
+	Path string
+	// Entry is the md5, originalURL and targetURL passed to Job, like the entries of ConcurrentRun
+	Entry  []string
+	Offset time.Duration
+	Job    ArtifactJob
+}
+
+// LATE_START_THRESHOLD is how much later than scheduled an artifact of PacedRun can start before it is reported
+const LATE_START_THRESHOLD = time.Second
+
+// PacedRun is ConcurrentRun with every artifact started at its Offset divided by speed, e.g., speed 2 replays the
+// timeline twice as fast. The artifacts are started in the order of their offsets. An artifact starts late when
+// all numWorkers workers are busy at its time, the number of such artifacts is printed.
+func PacedRun(ctx context.Context, numWorkers int, failFast bool, speed float64, artifacts []ScheduledArtifact) JobResults {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+	fmt.Printf("Start to run job in paced mode with thread number %v, speed %vx\n", numWorkers, speed)
+	sorted := append([]ScheduledArtifact{}, artifacts...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Offset < sorted[j].Offset })
+	results, late := runScheduled(ctx, numWorkers, failFast, speed, sorted)
+	if late > 0 {
+		fmt.Printf("Warning: %d artifacts started more than %s later than scheduled as all %d workers were busy\n", late, LATE_START_THRESHOLD, numWorkers)
+	}
+	return results
+}
+
+// runScheduled feeds the artifacts in order to numWorkers workers. With speed 0 they are fed as soon as a worker
+// is free, otherwise each is fed at its Offset/speed. It returns the results and the number of late starts.
+func runScheduled(ctx context.Context, numWorkers int, failFast bool, speed float64, artifacts []ScheduledArtifact) (JobResults, int) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan ScheduledArtifact)
 	var wg sync.WaitGroup
 	var mu sync.Mutex
-	var results = []bool{}
+	results := make(JobResults, 0, len(artifacts))
 
 	// This starts numWorkers number of goroutines that wait for something to do
 	wg.Add(numWorkers)
 	for i := 0; i < numWorkers; i++ {
 		go func() {
-			for {
-				a, ok := <-ch
-				if !ok { // if there is nothing to do and the channel has been closed then end the goroutine
-					wg.Done()
-					return
+			defer wg.Done()
+			for a := range ch {
+				var result JobResult
+				if err := ctx.Err(); err != nil {
+					result = JobResult{Err: err}
+				} else {
+					start := time.Now()
+					result = a.Job(ctx, a.Path, a.Entry[0], a.Entry[1], a.Entry[2])
+					if result.Duration == 0 {
+						result.Duration = time.Since(start)
+					}
+				}
+				result.Path = a.Path
+				if failFast && !result.Succeeded() {
+					cancel()
 				}
 				mu.Lock()
-				results = append(results, job(a[0], a[1], a[2]))
+				results = append(results, result)
 				mu.Unlock()
 			}
 		}()
 	}
 
 	// Now the jobs can be added to the channel, which is used as a queue
-	for _, artifact := range artifacts {
-		ch <- artifact // add artifact to the queue
+	late := 0
+	start := time.Now()
+	for _, a := range artifacts {
+		if speed > 0 && ctx.Err() == nil {
+			due := start.Add(time.Duration(float64(a.Offset) / speed))
+			timer := time.NewTimer(time.Until(due))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+			ch <- a
+			if ctx.Err() == nil && time.Since(due) > LATE_START_THRESHOLD {
+				late++
+			}
+			continue
+		}
+		ch <- a
 	}
 
 	close(ch) // This tells the goroutines there's nothing else to do
 	wg.Wait() // Wait for the threads to finish
 
-	finalResult := true
-	for _, result := range results {
-		if finalResult = result; !finalResult {
-			break
-		}
-	}
+	return results, late
+}
 
-	return finalResult
+// RunParallel runs the n jobs by the workers, all at once if workers is not positive, and returns the error of
+// each job in order. A panic of a job is returned as its error, so the other jobs can still be finished.
+func RunParallel(n, workers int, run func(i int) error) []error {
+	if workers <= 0 {
+		workers = n
+	}
+	errs := make([]error, n)
+	slots := make(chan bool, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		slots <- true
+		go func(i int) {
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("panic: %v", r)
+				}
+				<-slots
+				wg.Done()
+			}()
+			errs[i] = run(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
 }
@@ -0,0 +1,190 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+func testArtifacts(n int) map[string][]string {
+	artifacts := make(map[string][]string)
+	for i := 0; i < n; i++ {
+		p := fmt.Sprintf("/org/foo/bar/%d/bar-%d.jar", i, i)
+		artifacts[p] = []string{"", "", "http://indy" + p}
+	}
+	return artifacts
+}
+
+func TestConcurrentRun(t *testing.T) {
+	Convey("ConcurrentRun", t, func() {
+		Convey("Jobs should run in parallel", func() {
+			var running, maxRunning int32
+			job := func(ctx context.Context, p, md5, originalURL, targetURL string) JobResult {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				time.Sleep(50 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return JobResult{URL: targetURL, StatusCode: StatusOK, Bytes: 10}
+			}
+			results := ConcurrentRun(context.Background(), 4, false, testArtifacts(8), job)
+			So(len(results), ShouldEqual, 8)
+			So(results.Succeeded(), ShouldBeTrue)
+			So(results.TotalBytes(), ShouldEqual, 80)
+			So(maxRunning, ShouldEqual, 4)
+			for _, r := range results {
+				So(r.Path, ShouldNotBeEmpty)
+				So(r.Duration, ShouldBeGreaterThan, 0)
+			}
+		})
+		Convey("All failures should be collected without failFast", func() {
+			job := func(ctx context.Context, p, md5, originalURL, targetURL string) JobResult {
+				return JobResult{StatusCode: StatusNotFound, Err: errors.New("not found")}
+			}
+			results := ConcurrentRun(context.Background(), 2, false, testArtifacts(5), job)
+			So(len(results.Failed()), ShouldEqual, 5)
+			for _, r := range results {
+				So(r.StatusCode, ShouldEqual, StatusNotFound)
+			}
+		})
+		Convey("Remaining jobs should be skipped with failFast", func() {
+			var called int32
+			job := func(ctx context.Context, p, md5, originalURL, targetURL string) JobResult {
+				atomic.AddInt32(&called, 1)
+				return JobResult{Err: errors.New("failed")}
+			}
+			results := ConcurrentRun(context.Background(), 1, true, testArtifacts(5), job)
+			So(len(results), ShouldEqual, 5)
+			So(called, ShouldEqual, 1)
+			canceled := 0
+			for _, r := range results {
+				if errors.Is(r.Err, context.Canceled) {
+					canceled++
+				}
+			}
+			So(canceled, ShouldEqual, 4)
+		})
+		Convey("Canceled context should stop the run", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			job := func(ctx context.Context, p, md5, originalURL, targetURL string) JobResult {
+				return JobResult{}
+			}
+			results := ConcurrentRun(ctx, 2, false, testArtifacts(3), job)
+			So(len(results.Failed()), ShouldEqual, 3)
+		})
+	})
+}
+
+func TestPacedRun(t *testing.T) {
+	Convey("PacedRun", t, func() {
+		var mu sync.Mutex
+		started := []string{}
+		job := func(ctx context.Context, p, md5, originalURL, targetURL string) JobResult {
+			mu.Lock()
+			started = append(started, p)
+			mu.Unlock()
+			return JobResult{}
+		}
+		artifacts := []ScheduledArtifact{
+			{Path: "c", Entry: []string{"", "", ""}, Offset: 600 * time.Millisecond, Job: job},
+			{Path: "a", Entry: []string{"", "", ""}, Offset: 0, Job: job},
+			{Path: "b", Entry: []string{"", "", ""}, Offset: 300 * time.Millisecond, Job: job},
+		}
+		Convey("Jobs should start in the order and at the pace of their offsets", func() {
+			start := time.Now()
+			results := PacedRun(context.Background(), 2, false, 3, artifacts)
+			So(results.Succeeded(), ShouldBeTrue)
+			So(started, ShouldResemble, []string{"a", "b", "c"})
+			elapsed := time.Since(start)
+			So(elapsed, ShouldBeGreaterThanOrEqualTo, 200*time.Millisecond)
+			So(elapsed, ShouldBeLessThan, 600*time.Millisecond)
+		})
+		Convey("Canceled context should stop the waiting", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			start := time.Now()
+			results := PacedRun(ctx, 1, false, 1, artifacts)
+			So(time.Since(start), ShouldBeLessThan, 300*time.Millisecond)
+			So(len(results.Failed()), ShouldEqual, 3)
+		})
+	})
+}
+
+func TestJobResultsReport(t *testing.T) {
+	Convey("JobResults.Report should add a case for each artifact", t, func() {
+		results := JobResults{
+			{Path: "a.pom", URL: "http://indy/a.pom", StatusCode: 200, Bytes: 10, Duration: time.Second},
+			{Path: "b.jar", URL: "http://indy/b.jar", StatusCode: 500, Err: errors.New("download failed")},
+			{Path: "c.jar", Err: context.Canceled},
+		}
+		results.Report("test-downloads")
+		suite := report.GetSuite("test-downloads")
+		So(len(suite.Cases), ShouldEqual, 3)
+		So(suite.Cases[0].Status, ShouldEqual, report.StatusPassed)
+		So(suite.Cases[0].Properties["url"], ShouldEqual, "http://indy/a.pom")
+		So(suite.Cases[1].Status, ShouldEqual, report.StatusFailed)
+		So(suite.Cases[1].Message, ShouldEqual, "download failed")
+		So(suite.Cases[1].Properties["status"], ShouldEqual, "500")
+		So(suite.Cases[2].Status, ShouldEqual, report.StatusSkipped)
+	})
+}
+
+func TestRunParallel(t *testing.T) {
+	Convey("RunParallel should run at most workers jobs at the same time and return their errors in order", t, func() {
+		var running, maxRunning int32
+		errs := RunParallel(5, 2, func(i int) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			switch i {
+			case 1:
+				return errors.New("failed")
+			case 3:
+				panic("unexpected")
+			}
+			return nil
+		})
+		So(atomic.LoadInt32(&maxRunning), ShouldEqual, 2)
+		So(len(errs), ShouldEqual, 5)
+		So(errs[0], ShouldBeNil)
+		So(errs[1].Error(), ShouldEqual, "failed")
+		So(errs[3].Error(), ShouldEqual, "panic: unexpected")
+		So(errs[4], ShouldBeNil)
+		So(RunParallel(0, 0, func(i int) error { return nil }), ShouldBeEmpty)
+	})
+}
@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 )
 
 func FileOrDirExists(name string) bool {
@@ -32,6 +33,12 @@ func FileOrDirExists(name string) bool {
 	return true
 }
 
+// CacheFilePath is where the artifact of the path is cached in cacheDir. The full path is kept, so the artifacts
+// with the same file name do not overwrite each other, and the path cannot go out of cacheDir.
+func CacheFilePath(cacheDir, artiPath string) string {
+	return filepath.Join(cacheDir, filepath.Clean("/"+artiPath))
+}
+
 func GetFileContentType(out *os.File) (string, error) {
 
 	// Only the first 512 bytes are used to sniff the content type.
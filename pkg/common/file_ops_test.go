@@ -34,6 +34,14 @@ func TestFileExists(t *testing.T) {
 
 }
 
+func TestCacheFilePath(t *testing.T) {
+	Convey("Cache files should be kept by their full paths", t, func() {
+		So(CacheFilePath("/tmp/upload", "/org/foo/1.0/foo-1.0.pom"), ShouldEqual, "/tmp/upload/org/foo/1.0/foo-1.0.pom")
+		So(CacheFilePath("/tmp/upload", "/org/bar/1.0/foo-1.0.pom"), ShouldNotEqual, CacheFilePath("/tmp/upload", "/org/foo/1.0/foo-1.0.pom"))
+		So(CacheFilePath("/tmp/upload", "../../etc/passwd"), ShouldEqual, "/tmp/upload/etc/passwd")
+	})
+}
+
 func nowInMillis() int64 {
 	return time.Now().UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
 }
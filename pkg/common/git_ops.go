@@ -23,6 +23,8 @@ import (
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
+
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
 func DownloadRepo(gitURL string) string {
@@ -65,7 +67,7 @@ func goGit(gitURL, directory string) string {
 	r, err := getRepo(gitURL, directory, clone)
 	if err != nil {
 		fmt.Printf("Get repo failed due to error: %s", err)
-		os.Exit(1)
+		report.Exit(1)
 	}
 
 	// Updating heads
@@ -17,7 +17,7 @@
 package common
 
 import (
-	"crypto/tls"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -130,11 +130,11 @@ func GetPort(URLString string) string {
 }
 
 func GetRespAsPlaintext(url string) (string, error) {
-	resp, err := http.Get(url)
+	resp, err := DefaultIndyClient().Get(url, nil)
 	if err != nil {
 		return "", newHTTPError(err.Error(), 0)
 	}
-	defer resp.Body.Close()
+	defer closeBody(resp)
 
 	status, statusCode := resp.Status, resp.StatusCode
 
@@ -160,11 +160,11 @@ func GetRespAsPlaintext(url string) (string, error) {
 }
 
 func GetRespAsJSONType(url string, jsonType interface{}) error {
-	resp, err := http.Get(url)
+	resp, err := DefaultIndyClient().Get(url, nil)
 	if err != nil {
 		return newHTTPError(err.Error(), 0)
 	}
-	defer resp.Body.Close()
+	defer closeBody(resp)
 
 	status, statusCode := resp.Status, resp.StatusCode
 
@@ -198,14 +198,13 @@ func GetRespAsJSONType(url string, jsonType interface{}) error {
 // Parameters: request url; request method; authentication method; if need response content; data payload to send(POST or PUT); headers to send; the file location to store if response is a binary download; if print verbose log message for debugging
 // Returns: content as string, response status code as int, if succeeded as bool
 func HTTPRequest(url, method string, auth Authenticate, needResult bool, dataPayload io.Reader, headers map[string]string, filename string, verbose bool) (string, int, bool) {
-	client := &http.Client{}
+	client := DefaultIndyClient()
 	respText := ""
-	req, err := http.NewRequest(method, url, dataPayload)
+	req, err := newReplayableRequest(method, url, dataPayload)
 	if err != nil {
 		fmt.Printf("New request failed, %s\n", err)
 		return respText, StatusUnknown, false
 	}
-	req.Close = true // prevents the connection from being re-used
 
 	if len(headers) > 0 {
 		for key, val := range headers {
@@ -224,7 +223,7 @@ func HTTPRequest(url, method string, auth Authenticate, needResult bool, dataPay
 		fmt.Printf("Client failed, %s\n", err)
 		return respText, StatusUnknown, false
 	}
-	defer resp.Body.Close()
+	defer closeBody(resp)
 
 	if resp.StatusCode >= 400 {
 		fmt.Printf("%s request not success for %s, status: %s, return code: %v\n", method, url, resp.Status, resp.StatusCode)
@@ -242,6 +241,94 @@ func HTTPRequest(url, method string, auth Authenticate, needResult bool, dataPay
 	return respText, resp.StatusCode, true
 }
 
+// doJSON sends in as the json body of the request, and decodes the json response into out if out is not nil.
+// The auth is applied to the request if it is not nil. A response with an error status is returned as HTTPError
+// with the response text as the message.
+func doJSON(client *IndyClient, auth Authenticate, method, url string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", ContentTypeJSON)
+	}
+	req.Header.Set("Accept", ContentTypeJSON)
+	resp, err := doRequest(client, auth, req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode >= 400 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return newHTTPError(strings.TrimSpace(string(msg)), resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid json response, %s", err)
+	}
+	return nil
+}
+
+// doRequest sends the request by the client, DefaultIndyClient if it is nil, authenticated by auth if it is not nil
+func doRequest(client *IndyClient, auth Authenticate, req *http.Request) (*http.Response, error) {
+	if auth != nil {
+		if err := auth(req); err != nil {
+			return nil, fmt.Errorf("auth failed, %s", err)
+		}
+	}
+	if client == nil {
+		client = DefaultIndyClient()
+	}
+	return client.Do(req)
+}
+
+// newReplayableRequest creates the request with a body which can be sent again when the request is retried.
+// The payload like an opened file is not closed by the request, the caller still owns it.
+func newReplayableRequest(method, url string, dataPayload io.Reader) (*http.Request, error) {
+	rs, ok := dataPayload.(io.ReadSeeker)
+	if !ok {
+		return http.NewRequest(method, url, dataPayload)
+	}
+	switch dataPayload.(type) {
+	case *strings.Reader, *bytes.Reader:
+		return http.NewRequest(method, url, dataPayload) // already replayable
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = rs.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, url, ioutil.NopCloser(rs))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	req.GetBody = func() (io.ReadCloser, error) {
+		_, err := rs.Seek(0, io.SeekStart)
+		return ioutil.NopCloser(rs), err
+	}
+	return req, nil
+}
+
+// closeBody reads the rest of the body before closing it, so the connection can be reused
+func closeBody(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
 func newHTTPError(message string, statusCode int) HTTPError {
 	return HTTPError{message, statusCode}
 }
@@ -261,13 +348,12 @@ func (err HTTPError) Error() string {
 }
 
 func HttpExists(url string) bool {
-	client := &http.Client{}
-	req, _ := http.NewRequest(MethodGet, url, nil)
-	resp, err := client.Do(req)
+	resp, err := DefaultIndyClient().Get(url, nil)
 	if err != nil {
 		fmt.Printf("Can not get %s, err: %s\n", url, err)
 		return false
 	}
+	defer closeBody(resp)
 	if resp.StatusCode == 200 {
 		return true
 	}
@@ -306,6 +392,9 @@ func DownloadFile(url, storeFileName string) (bool, int) {
 }
 
 func calculateSpeed(size, duration int64) string {
+	if duration <= 0 {
+		duration = 1 // sub-millisecond transfers against a local server
+	}
 	speed := (size * 1000) / duration
 	return fmt.Sprintf("%s/s", ByteCountSI(speed))
 }
@@ -320,8 +409,57 @@ func DownloadUploadFileForCache(url, cacheFileName string) bool {
 	return false
 }
 
-func download(targetUrl, storeFileName string, proxyConfig *ProxyConfig) (bool, int) {
-	var client *http.Client
+// StreamedDownload is the result of DownloadStream
+type StreamedDownload struct {
+	Checksums  Checksums
+	Size       int64
+	StatusCode int
+}
+
+// DownloadStream downloads the url through a ChecksumWriter without storing the content, for the downloads which
+// are only verified. It does not fill the disk on large builds, and the artifacts with the same file name do
+// not overwrite each other.
+func DownloadStream(url string) (StreamedDownload, bool) {
+	return streamDownload(url, nil)
+}
+
+// DownloadStreamByProxy is DownloadStream through the indy generic proxy
+func DownloadStreamByProxy(url, indyProxyUrl, user, pass string) (StreamedDownload, bool) {
+	return streamDownload(url, &ProxyConfig{ProxyUrl: indyProxyUrl, User: user, Pass: pass})
+}
+
+func streamDownload(targetUrl string, proxyConfig *ProxyConfig) (StreamedDownload, bool) {
+	fmt.Printf("[%s] Downloading %s\n", time.Now().Format(DATA_TIME), targetUrl)
+	start := time.Now()
+	resp, status := openDownload(targetUrl, proxyConfig)
+	result := StreamedDownload{StatusCode: status}
+	if resp == nil {
+		return result, false
+	}
+	defer closeBody(resp)
+
+	w := NewChecksumWriter()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		fmt.Printf("Warning: cannot download file due to io error! error is %s\n", err.Error())
+		// see download for the chunked response
+		if !strings.Contains(err.Error(), "tls: user canceled") {
+			return result, false
+		}
+	}
+	result.Checksums, result.Size = w.Checksums(), w.Size()
+	fmt.Printf("[%s] Downloaded %s (%s at %s)\n", time.Now().Format(DATA_TIME), targetUrl, ByteCountSI(result.Size),
+		calculateSpeed(result.Size, time.Since(start).Milliseconds()))
+	return result, true
+}
+
+// openDownload sends the GET request, it returns the response if the status is successful, nil otherwise
+func openDownload(targetUrl string, proxyConfig *ProxyConfig) (*http.Response, int) {
+	req, err := http.NewRequest(MethodGet, targetUrl, nil)
+	if err != nil {
+		fmt.Printf("Can not download file %s, new request err: %s\n", targetUrl, err)
+		return nil, -1
+	}
+	var resp *http.Response
 	if proxyConfig != nil {
 		pTmp, _ := url.Parse(proxyConfig.ProxyUrl)
 		var proxyUrl *url.URL
@@ -330,28 +468,29 @@ func download(targetUrl, storeFileName string, proxyConfig *ProxyConfig) (bool,
 		} else {
 			proxyUrl, _ = url.Parse(fmt.Sprintf("http://%s:%s@%s", proxyConfig.User, proxyConfig.Pass, pTmp.Host))
 		}
-		tr := &http.Transport{Proxy: http.ProxyURL(proxyUrl), TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-		client = &http.Client{Transport: tr}
-		fmt.Printf("Create http client with proxy %s\n", proxyUrl)
+		resp, err = DefaultIndyClient().DoByProxy(req, proxyUrl)
 	} else {
-		client = &http.Client{}
+		resp, err = DefaultIndyClient().Do(req)
 	}
-
-	req, err := http.NewRequest(MethodGet, targetUrl, nil)
-	if err != nil {
-		fmt.Printf("Can not download file %s, new request err: %s\n", targetUrl, err)
-		return false, -1
-	}
-	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Printf("Can not download file %s, err: %s\n", targetUrl, err)
-		return false, -1
+		return nil, -1
 	}
 
 	if resp.StatusCode >= 400 {
 		fmt.Printf("Can not download file %s because of error response, status: %s, return code: %v\n", targetUrl, resp.Status, resp.StatusCode)
-		return false, resp.StatusCode
+		closeBody(resp)
+		return nil, resp.StatusCode
 	}
+	return resp, resp.StatusCode
+}
+
+func download(targetUrl, storeFileName string, proxyConfig *ProxyConfig) (bool, int) {
+	resp, status := openDownload(targetUrl, proxyConfig)
+	if resp == nil {
+		return false, status
+	}
+	defer closeBody(resp)
 
 	conDispo := resp.Header.Get("Content-Disposition")
 	filePath := ""
@@ -395,13 +534,13 @@ func download(targetUrl, storeFileName string, proxyConfig *ProxyConfig) (bool,
 	return true, resp.StatusCode
 }
 
-func UploadFile(uploadUrl, cacheFile string) bool {
+func UploadFile(uploadUrl, cacheFile string) (bool, int) {
 	fmt.Printf("[%s] Uploading %s\n", time.Now().Format(DATA_TIME), uploadUrl)
 	start := time.Now()
 	data, err := os.Open(cacheFile)
 	if err != nil {
 		fmt.Printf("Warning: Upload failed for %s, error: %s", uploadUrl, err.Error())
-		return false
+		return false, StatusUnknown
 	}
 	defer data.Close()
 
@@ -411,14 +550,14 @@ func UploadFile(uploadUrl, cacheFile string) bool {
 	// 	mimeType = "text/plain"
 	// }
 	// headers := map[string]string{"Content-Type": mimeType}
-	_, _, succeeded := HTTPRequest(uploadUrl, MethodPut, nil, false, data, nil, "", false)
+	_, status, succeeded := HTTPRequest(uploadUrl, MethodPut, nil, false, data, nil, "", false)
 	if succeeded {
 		end := time.Now()
 		diff := end.Sub(start)
 		milliSecs := diff.Milliseconds()
 		size := FileSize(cacheFile)
 		fmt.Printf("[%s] Uploaded %s (%s at %s)\n", time.Now().Format(DATA_TIME), uploadUrl, ByteCountSI(size), calculateSpeed(size, int64(milliSecs)))
-		return true
+		return true, status
 	}
-	return false
+	return false, status
 }
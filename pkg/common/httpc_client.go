@@ -0,0 +1,282 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables to configure the http client. The command flags take precedence over them.
+const (
+	ENVAR_CONNECT_TIMEOUT      = "INDY_CONNECT_TIMEOUT"
+	ENVAR_READ_TIMEOUT         = "INDY_READ_TIMEOUT"
+	ENVAR_TIMEOUT              = "INDY_TIMEOUT"
+	ENVAR_MAX_CONNS_PER_HOST   = "INDY_MAX_CONNS_PER_HOST"
+	ENVAR_INSECURE_SKIP_VERIFY = "INDY_INSECURE_SKIP_VERIFY"
+	ENVAR_CA_CERT              = "INDY_CA_CERT"
+	ENVAR_CLIENT_CERT          = "INDY_CLIENT_CERT"
+	ENVAR_CLIENT_KEY           = "INDY_CLIENT_KEY"
+)
+
+// ClientConfig holds the connection settings of IndyClient.
+type ClientConfig struct {
+	// ConnectTimeout limits the TCP connect and the TLS handshake
+	ConnectTimeout time.Duration
+	// ReadTimeout limits the wait for the response headers after the request is sent
+	ReadTimeout time.Duration
+	// Timeout limits the whole request including reading the response body, 0 means no limit
+	Timeout time.Duration
+	// MaxConnsPerHost limits the connections (idle and active) to one host, 0 means no limit
+	MaxConnsPerHost int
+	// InsecureSkipVerify disables the verification of server certificates
+	InsecureSkipVerify bool
+	// CACertFile is a PEM bundle of the CAs trusted in addition to the system ones, e.g., the internal CA of a
+	// TLS-only staging indy
+	CACertFile string
+	// ClientCertFile and ClientKeyFile are the PEM certificate and key sent to servers which require mutual TLS
+	ClientCertFile string
+	ClientKeyFile  string
+	// Retry is applied to requests which fail with a transient error
+	Retry RetryPolicy
+}
+
+// DefaultClientConfig returns the settings used when nothing is configured
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		ConnectTimeout:  30 * time.Second,
+		ReadTimeout:     5 * time.Minute,
+		Timeout:         30 * time.Minute,
+		MaxConnsPerHost: 50,
+		Retry:           DefaultRetryPolicy(),
+	}
+}
+
+// ClientConfigFromEnv returns the default settings overridden by the environment variables, if they are set
+func ClientConfigFromEnv() ClientConfig {
+	config := DefaultClientConfig()
+	if d, ok := durationFromEnv(ENVAR_CONNECT_TIMEOUT); ok {
+		config.ConnectTimeout = d
+	}
+	if d, ok := durationFromEnv(ENVAR_READ_TIMEOUT); ok {
+		config.ReadTimeout = d
+	}
+	if d, ok := durationFromEnv(ENVAR_TIMEOUT); ok {
+		config.Timeout = d
+	}
+	if num, err := strconv.Atoi(os.Getenv(ENVAR_MAX_CONNS_PER_HOST)); err == nil {
+		config.MaxConnsPerHost = num
+	}
+	if strings.ToLower(strings.TrimSpace(os.Getenv(ENVAR_INSECURE_SKIP_VERIFY))) == "true" {
+		config.InsecureSkipVerify = true
+	}
+	config.CACertFile = strings.TrimSpace(os.Getenv(ENVAR_CA_CERT))
+	config.ClientCertFile = strings.TrimSpace(os.Getenv(ENVAR_CLIENT_CERT))
+	config.ClientKeyFile = strings.TrimSpace(os.Getenv(ENVAR_CLIENT_KEY))
+	if num, err := strconv.Atoi(os.Getenv(ENVAR_RETRIES)); err == nil {
+		config.Retry.MaxAttempts = num + 1
+	}
+	if d, ok := durationFromEnv(ENVAR_RETRY_BACKOFF); ok {
+		config.Retry.InitialBackoff = d
+	}
+	return config
+}
+
+func durationFromEnv(name string) (time.Duration, bool) {
+	v := os.Getenv(name)
+	if IsEmptyString(v) {
+		return 0, false
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		fmt.Printf("Warning: ignore invalid duration %s=%s, error: %s\n", name, v, err)
+		return 0, false
+	}
+	return d, true
+}
+
+// IndyClient is the http client shared by all requests to indy (and to the other services the tests talk to).
+// It keeps the connections alive and reuses them like the maven and npm clients do.
+type IndyClient struct {
+	Config ClientConfig
+	// Authenticate is applied to every request which does not bring its own authenticator
+	Authenticate Authenticate
+
+	httpClient   *http.Client
+	mu           sync.Mutex
+	proxyClients map[string]*http.Client
+}
+
+// NewIndyClient creates a client with its own connection pool
+func NewIndyClient(config ClientConfig) (*IndyClient, error) {
+	transport, err := newTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	return &IndyClient{
+		Config:       config,
+		httpClient:   &http.Client{Transport: transport, Timeout: config.Timeout},
+		proxyClients: make(map[string]*http.Client),
+	}, nil
+}
+
+func newTransport(config ClientConfig) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   config.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	maxIdle := config.MaxConnsPerHost
+	if maxIdle <= 0 {
+		maxIdle = http.DefaultMaxIdleConnsPerHost
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxConnsPerHost:       config.MaxConnsPerHost,
+		MaxIdleConnsPerHost:   maxIdle,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   config.ConnectTimeout,
+		ResponseHeaderTimeout: config.ReadTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}, nil
+}
+
+func newTLSConfig(config ClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if !IsEmptyString(config.CACertFile) {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA bundle %s, %s", config.CACertFile, err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificate found in CA bundle %s", config.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if !IsEmptyString(config.ClientCertFile) || !IsEmptyString(config.ClientKeyFile) {
+		if IsEmptyString(config.ClientCertFile) || IsEmptyString(config.ClientKeyFile) {
+			return nil, fmt.Errorf("both client certificate and key are required for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate %s, %s", config.ClientCertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Do sends the request, authenticated by the client Authenticate if the request has no Authorization yet.
+// Transient failures are retried by the Retry policy of the client config. The request is measured by
+// DefaultMetrics, including its retries.
+func (c *IndyClient) Do(req *http.Request) (*http.Response, error) {
+	return c.do(c.httpClient, req)
+}
+
+// DoByProxy sends the request through an http proxy, e.g., the indy generic proxy. The clients are cached by
+// the proxy url, so the connections to the same proxy are reused as well.
+func (c *IndyClient) DoByProxy(req *http.Request, proxyURL *url.URL) (*http.Response, error) {
+	c.mu.Lock()
+	client, ok := c.proxyClients[proxyURL.String()]
+	if !ok {
+		transport, err := newTransport(c.Config)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+		// the generic proxy does MITM for https with its own certificate
+		transport.TLSClientConfig.InsecureSkipVerify = true
+		client = &http.Client{Transport: transport, Timeout: c.Config.Timeout}
+		c.proxyClients[proxyURL.String()] = client
+		fmt.Printf("Create http client with proxy %s\n", proxyURL)
+	}
+	c.mu.Unlock()
+	return c.do(client, req)
+}
+
+func (c *IndyClient) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	if c.Authenticate != nil && req.Header.Get("Authorization") == "" {
+		if err := c.Authenticate(req); err != nil {
+			return nil, fmt.Errorf("auth failed, %s", err)
+		}
+	}
+	start := time.Now()
+	resp, err := doWithRetry(client, req, c.Config.Retry)
+	return defaultMetrics.record(req, start, resp, err), err
+}
+
+// send sends the request through the connections of the client with its TLS settings and retries, but without
+// the authentication and the metrics, e.g., for the keycloak token and the metrics push which are not requests
+// of the tests
+func (c *IndyClient) send(req *http.Request) (*http.Response, error) {
+	return doWithRetry(c.httpClient, req, c.Config.Retry)
+}
+
+// Get sends a GET request with the headers
+func (c *IndyClient) Get(url string, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range headers {
+		req.Header.Set(key, val)
+	}
+	return c.Do(req)
+}
+
+var defaultIndyClient = mustNewIndyClient(ClientConfigFromEnv())
+
+func mustNewIndyClient(config ClientConfig) *IndyClient {
+	c, err := NewIndyClient(config)
+	if err != nil {
+		// a bad TLS file in the env should not crash the start, the command reports it when it creates its client
+		fmt.Printf("Warning: cannot create http client from env, use the default settings. Cause: %s\n", err)
+		c, err = NewIndyClient(DefaultClientConfig())
+	}
+	RePanic(err)
+	return c
+}
+
+// DefaultIndyClient returns the client used by the request helpers in this package
+func DefaultIndyClient() *IndyClient {
+	return defaultIndyClient
+}
+
+// SetDefaultIndyClient replaces the client used by the request helpers in this package. It should be called
+// before any request is sent, e.g., when the command flags are parsed.
+func SetDefaultIndyClient(c *IndyClient) {
+	defaultIndyClient = c
+}
@@ -0,0 +1,110 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func withDefaultIndyClient(c *IndyClient, f func()) {
+	orig := DefaultIndyClient()
+	SetDefaultIndyClient(c)
+	defer SetDefaultIndyClient(orig)
+	f()
+}
+
+func TestIndyClient(t *testing.T) {
+	Convey("IndyClient", t, func() {
+		Convey("Connections should be reused", func() {
+			var conns int32
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("content"))
+			}))
+			server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&conns, 1)
+				}
+			}
+			server.Start()
+			defer server.Close()
+
+			client, err := NewIndyClient(DefaultClientConfig())
+			So(err, ShouldBeNil)
+			withDefaultIndyClient(client, func() {
+				for i := 0; i < 5; i++ {
+					_, status, ok := HTTPRequest(server.URL+"/api/content", MethodGet, nil, false, nil, nil, "", false)
+					So(ok, ShouldBeTrue)
+					So(status, ShouldEqual, StatusOK)
+				}
+			})
+			So(atomic.LoadInt32(&conns), ShouldEqual, 1)
+		})
+		Convey("Hung server should time out", func() {
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			}))
+			defer server.Close()
+			defer close(release)
+
+			config := DefaultClientConfig()
+			config.ReadTimeout = 100 * time.Millisecond
+			config.Retry.MaxAttempts = 1
+			client, _ := NewIndyClient(config)
+			start := time.Now()
+			_, err := client.Get(server.URL, nil)
+			So(err, ShouldNotBeNil)
+			So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+		})
+		Convey("Authenticate should be applied", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer test" {
+					w.WriteHeader(StatusUnauthorized)
+				}
+			}))
+			defer server.Close()
+
+			client, _ := NewIndyClient(DefaultClientConfig())
+			client.Authenticate = func(req *http.Request) error {
+				req.Header.Set("Authorization", "Bearer test")
+				return nil
+			}
+			resp, err := client.Get(server.URL, nil)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, StatusOK)
+		})
+		Convey("Env variables should override defaults", func() {
+			os.Setenv(ENVAR_READ_TIMEOUT, "10s")
+			os.Setenv(ENVAR_MAX_CONNS_PER_HOST, "8")
+			defer os.Unsetenv(ENVAR_READ_TIMEOUT)
+			defer os.Unsetenv(ENVAR_MAX_CONNS_PER_HOST)
+			config := ClientConfigFromEnv()
+			So(config.ReadTimeout, ShouldEqual, 10*time.Second)
+			So(config.MaxConnsPerHost, ShouldEqual, 8)
+			So(config.ConnectTimeout, ShouldEqual, DefaultClientConfig().ConnectTimeout)
+		})
+	})
+}
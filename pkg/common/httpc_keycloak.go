@@ -1,7 +1,6 @@
 package common
 
 import (
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -9,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,8 +19,12 @@ const (
 	KeycloakCredential = "KEYCLOAK_CLIENT_CREDENTIAL"
 )
 
-var token *AccessToken
-var tokenExpireAt time.Time
+// The token is shared by all requests, which may be sent by concurrent goroutines
+var (
+	tokenMu       sync.Mutex
+	token         *AccessToken
+	tokenExpireAt time.Time
+)
 
 type AccessToken struct {
 	Token            string `json:"access_token"`
@@ -31,35 +35,25 @@ type AccessToken struct {
 	Scope            string `json:"scope,omitempty"`
 }
 
+// KeycloakAuthenticator adds the bearer token got from keycloak to the request. The token is got again when it
+// expires. An error is returned if the keycloak configurations are missing or the token cannot be got.
 func KeycloakAuthenticator(request *http.Request) error {
-	wrapToken := ""
-	if token != nil && !tokenExpireAt.IsZero() && time.Now().Local().Before(tokenExpireAt) {
-		wrapToken = token.Token
-	} else {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	if token == nil || tokenExpireAt.IsZero() || !time.Now().Local().Before(tokenExpireAt) {
 		accessToken, err := auth()
 		if err != nil {
 			return err
 		}
-		if accessToken != nil {
-			fmt.Println("Access token got or refreshed, will set as beare token")
-			token = accessToken
-			wrapToken = token.Token
+		if accessToken == nil || IsEmptyString(accessToken.Token) {
+			return fmt.Errorf("no authorized token found! Please set the keycloak environment variables %s, %s, %s and %s",
+				KeycloakServer, KeycloakRealm, KeycloakResource, KeycloakCredential)
 		}
+		fmt.Println("Access token got or refreshed, will set as beare token")
+		token = accessToken
 		tokenExpireAt = time.Now().Local().Add(time.Second * time.Duration(token.ExpiresIn))
 	}
-	var authHeaders map[string]string
-	if !IsEmptyString(wrapToken) {
-		authHeaders = map[string]string{
-			"Authorization": "Bearer " + wrapToken,
-		}
-	}
-	if len(authHeaders) <= 0 {
-		return fmt.Errorf("no authorized token found! Please use login command first to get login token first")
-	} else {
-		for key, val := range authHeaders {
-			request.Header.Add(key, val)
-		}
-	}
+	request.Header.Add("Authorization", "Bearer "+token.Token)
 	return nil
 }
 
@@ -69,12 +63,11 @@ func auth() (*AccessToken, error) {
 	kcRes := os.Getenv(KeycloakResource)
 	kcSecret := os.Getenv(KeycloakCredential)
 	if IsEmptyString(kcServer) || IsEmptyString(kcRealm) || IsEmptyString(kcRes) || IsEmptyString(kcSecret) {
-		fmt.Printf("Missing needed Keycloak configurations, no authentication needed.")
+		fmt.Printf("Missing needed Keycloak configurations.\n")
 		return nil, nil
 	}
 	kcAuthURL := fmt.Sprintf("%s/auth/realms/%s/protocol/openid-connect/token", kcServer, kcRealm)
 	fmt.Printf("Will do authentication to %s with id %s\n", kcAuthURL, kcRes)
-	client := &http.Client{}
 	values := url.Values{
 		"grant_type": {"client_credentials"},
 	}
@@ -84,28 +77,17 @@ func auth() (*AccessToken, error) {
 	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.SetBasicAuth(kcRes, kcSecret)
-	resp, err := client.Do(req)
+	resp, err := DefaultIndyClient().send(req)
 	if err != nil {
 		if strings.Contains(err.Error(), "x509") || strings.Contains(err.Error(), "certificate") {
-			fmt.Printf("Warning: ssl enabled for %s but your client does not have valid certificate. This client will bypass ssl checking.\n", kcServer)
-			// WARNING: This is not a good practice which bypass ssl checking.
-			// Better way is import valid ssl certificate in system level
-			tr := &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			}
-			client := &http.Client{Transport: tr}
-			resp, err = client.Do(req)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
+			return nil, fmt.Errorf("%s, the certificate of %s can be trusted by %s or skipped by %s", err, kcServer, ENVAR_CA_CERT, ENVAR_INSECURE_SKIP_VERIFY)
 		}
+		return nil, err
 	}
+	defer closeBody(resp)
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		return nil, fmt.Errorf("authentication failed: %s", resp.Status)
 	}
-	defer resp.Body.Close()
 	content, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,92 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func setKeycloakEnv(server string) func() {
+	envs := map[string]string{KeycloakServer: server, KeycloakRealm: "pnc", KeycloakResource: "indy-tests", KeycloakCredential: "secret"}
+	for k, v := range envs {
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k := range envs {
+			os.Unsetenv(k)
+		}
+		tokenMu.Lock()
+		token = nil
+		tokenMu.Unlock()
+	}
+}
+
+func TestKeycloakAuthenticator(t *testing.T) {
+	Convey("KeycloakAuthenticator", t, func() {
+		var tokenRequests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&tokenRequests, 1)
+			if user, pass, _ := r.BasicAuth(); r.URL.Path != "/auth/realms/pnc/protocol/openid-connect/token" || user != "indy-tests" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"access_token":"abc","expires_in":300,"token_type":"Bearer"}`))
+		}))
+		defer server.Close()
+
+		Convey("The token should be got once and shared by concurrent requests", func() {
+			defer setKeycloakEnv(server.URL)()
+			var wg sync.WaitGroup
+			reqs := make([]*http.Request, 8)
+			errs := make([]error, len(reqs))
+			for i := range reqs {
+				reqs[i], _ = http.NewRequest(MethodGet, "http://indy/api/stats/version-info", nil)
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs[i] = KeycloakAuthenticator(reqs[i])
+				}(i)
+			}
+			wg.Wait()
+			for i := range reqs {
+				So(errs[i], ShouldBeNil)
+				So(reqs[i].Header.Get("Authorization"), ShouldEqual, "Bearer abc")
+			}
+			So(atomic.LoadInt32(&tokenRequests), ShouldEqual, 1)
+		})
+		Convey("An error should be returned without the keycloak configurations", func() {
+			defer setKeycloakEnv(server.URL)()
+			os.Unsetenv(KeycloakCredential)
+			req, _ := http.NewRequest(MethodGet, "http://indy/api/stats/version-info", nil)
+			So(KeycloakAuthenticator(req), ShouldNotBeNil)
+			So(req.Header.Get("Authorization"), ShouldEqual, "")
+		})
+		Convey("An error should be returned if keycloak rejects the credential", func() {
+			defer setKeycloakEnv(server.URL)()
+			os.Setenv(KeycloakCredential, "wrong")
+			req, _ := http.NewRequest(MethodGet, "http://indy/api/stats/version-info", nil)
+			So(KeycloakAuthenticator(req), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,217 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	ENVAR_RETRIES       = "INDY_RETRIES"
+	ENVAR_RETRY_BACKOFF = "INDY_RETRY_BACKOFF"
+)
+
+// RetryPolicy decides if and when a failed request is sent again.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts of a request, 1 means no retry
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, it grows by Multiplier for each following retry
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomizes each wait by +/- this fraction, so parallel workers do not retry at the same moment
+	Jitter float64
+	// RetryableStatus are the response codes considered transient
+	RetryableStatus []int
+	// RetryUploads allows retrying PUT requests. They are retried only if the body can be sent again.
+	RetryUploads bool
+}
+
+// DefaultRetryPolicy retries transient failures twice
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     3,
+		InitialBackoff:  1 * time.Second,
+		MaxBackoff:      30 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+		RetryableStatus: []int{StatusBadGateway, StatusServiceUnavailable, StatusGatewayTimeout},
+		RetryUploads:    true,
+	}
+}
+
+// Backoff returns the wait before the retry following the given (1-based) attempt
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d = d * (1 + p.Jitter*(2*rand.Float64()-1))
+	}
+	return time.Duration(d)
+}
+
+// IsIdempotent tells if sending the request again can not cause a different result on the server. GET-like
+// requests always are; PUT uploads are only if allowed by the policy and the body can be replayed; POST
+// requests (promote, seal, rollback) never are.
+func (p RetryPolicy) IsIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case MethodGet, MethodHead, MethodOptions, MethodDelete:
+		return true
+	case MethodPut:
+		return p.RetryUploads && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+	}
+	return false
+}
+
+// ClassifyRetry returns the reason why the response or error is transient, or "" if it is not
+func (p RetryPolicy) ClassifyRetry(resp *http.Response, err error) string {
+	if err != nil {
+		return transientErrorReason(err)
+	}
+	for _, status := range p.RetryableStatus {
+		if resp.StatusCode == status {
+			return resp.Status
+		}
+	}
+	return ""
+}
+
+func transientErrorReason(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return ""
+	}
+	if errors.Is(err, syscall.ECONNRESET) {
+		return "connection reset"
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return "connection refused"
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return "connection closed"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	if strings.Contains(err.Error(), "connection reset by peer") {
+		return "connection reset"
+	}
+	return ""
+}
+
+// RetryStats counts the requests which needed retries during the run.
+type RetryStats struct {
+	mu sync.Mutex
+	// attempts by "METHOD url" of the requests which needed at least one retry
+	attempts  map[string]int
+	recovered int
+	exhausted int
+}
+
+var retryStats = &RetryStats{attempts: make(map[string]int)}
+
+func (s *RetryStats) record(req *http.Request, attempts int, recovered bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts[req.Method+" "+req.URL.String()] += attempts
+	if recovered {
+		s.recovered++
+	} else {
+		s.exhausted++
+	}
+}
+
+// GetRetryCounts returns the number of requests which needed retries, how many of them succeeded in the end,
+// and the total number of retries
+func GetRetryCounts() (requests, recovered, retries int) {
+	retryStats.mu.Lock()
+	defer retryStats.mu.Unlock()
+	for _, n := range retryStats.attempts {
+		retries += n - 1
+	}
+	return retryStats.recovered + retryStats.exhausted, retryStats.recovered, retries
+}
+
+// PrintRetryReport prints the requests which needed retries in this run, so retries do not hide regressions
+func PrintRetryReport() {
+	requests, recovered, retries := GetRetryCounts()
+	if requests == 0 {
+		fmt.Printf("Retry report: no request needed retries.\n")
+		return
+	}
+	fmt.Printf("Retry report: %d requests needed %d retries, %d recovered, %d still failed.\n", requests, retries, recovered, requests-recovered)
+	retryStats.mu.Lock()
+	defer retryStats.mu.Unlock()
+	keys := make([]string, 0, len(retryStats.attempts))
+	for k := range retryStats.attempts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("  [RETRIED] %s, attempts: %d\n", k, retryStats.attempts[k])
+	}
+}
+
+// doWithRetry sends the request and retries it by the policy when it fails with a transient error
+func doWithRetry(client *http.Client, req *http.Request, policy RetryPolicy) (*http.Response, error) {
+	idempotent := policy.IsIdempotent(req)
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		resp, err := client.Do(req)
+		reason := policy.ClassifyRetry(resp, err)
+		if reason == "" || !idempotent || attempt >= policy.MaxAttempts {
+			if attempt > 1 {
+				recovered := reason == ""
+				retryStats.record(req, attempt, recovered)
+				if !recovered {
+					fmt.Printf("[RETRY] %s %s still failed (%s) after %d attempts\n", req.Method, req.URL, reason, attempt)
+				}
+			}
+			return resp, err
+		}
+		if resp != nil {
+			closeBody(resp)
+		}
+		wait := policy.Backoff(attempt)
+		fmt.Printf("[RETRY] %s %s failed (%s), attempt %d/%d, retry in %s\n", req.Method, req.URL, reason, attempt, policy.MaxAttempts, wait.Round(time.Millisecond))
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// flakyServer fails the first n requests with the status, then stores/returns the content
+func flakyServer(n int32, status int) (*httptest.Server, *int32, *string) {
+	var calls int32
+	var content string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= n {
+			w.WriteHeader(status)
+			return
+		}
+		if r.Method == MethodPut {
+			b, _ := ioutil.ReadAll(r.Body)
+			content = string(b)
+			w.WriteHeader(StatusCreated)
+			return
+		}
+		io.WriteString(w, "content")
+	}))
+	return server, &calls, &content
+}
+
+func fastRetryClient() *IndyClient {
+	config := DefaultClientConfig()
+	config.Retry.InitialBackoff = time.Millisecond
+	client, _ := NewIndyClient(config)
+	return client
+}
+
+func TestRetry(t *testing.T) {
+	Convey("Retry", t, func() {
+		Convey("GET should be retried for 503", func() {
+			server, calls, _ := flakyServer(2, StatusServiceUnavailable)
+			defer server.Close()
+			requests, recovered, _ := GetRetryCounts()
+			withDefaultIndyClient(fastRetryClient(), func() {
+				content, status, ok := HTTPRequest(server.URL, MethodGet, nil, true, nil, nil, "", false)
+				So(ok, ShouldBeTrue)
+				So(status, ShouldEqual, StatusOK)
+				So(content, ShouldEqual, "content")
+			})
+			So(atomic.LoadInt32(calls), ShouldEqual, 3)
+			requests2, recovered2, _ := GetRetryCounts()
+			So(requests2-requests, ShouldEqual, 1)
+			So(recovered2-recovered, ShouldEqual, 1)
+		})
+		Convey("GET should fail after max attempts", func() {
+			server, calls, _ := flakyServer(10, StatusBadGateway)
+			defer server.Close()
+			withDefaultIndyClient(fastRetryClient(), func() {
+				_, status, ok := HTTPRequest(server.URL, MethodGet, nil, false, nil, nil, "", false)
+				So(ok, ShouldBeFalse)
+				So(status, ShouldEqual, StatusBadGateway)
+			})
+			So(atomic.LoadInt32(calls), ShouldEqual, 3)
+		})
+		Convey("Not transient status should not be retried", func() {
+			server, calls, _ := flakyServer(10, StatusNotFound)
+			defer server.Close()
+			withDefaultIndyClient(fastRetryClient(), func() {
+				HTTPRequest(server.URL, MethodGet, nil, false, nil, nil, "", false)
+			})
+			So(atomic.LoadInt32(calls), ShouldEqual, 1)
+		})
+		Convey("POST should not be retried", func() {
+			server, calls, _ := flakyServer(1, StatusServiceUnavailable)
+			defer server.Close()
+			withDefaultIndyClient(fastRetryClient(), func() {
+				_, _, ok := HTTPRequest(server.URL, MethodPost, nil, false, strings.NewReader("{}"), nil, "", false)
+				So(ok, ShouldBeFalse)
+			})
+			So(atomic.LoadInt32(calls), ShouldEqual, 1)
+		})
+		Convey("PUT of a file should be retried with the whole content", func() {
+			server, calls, content := flakyServer(1, StatusGatewayTimeout)
+			defer server.Close()
+			f, _ := ioutil.TempFile("", "upload")
+			defer os.Remove(f.Name())
+			f.WriteString("uploaded content")
+			f.Close()
+			withDefaultIndyClient(fastRetryClient(), func() {
+				ok, status := UploadFile(server.URL+"/foo.jar", f.Name())
+				So(ok, ShouldBeTrue)
+				So(status, ShouldEqual, StatusCreated)
+			})
+			So(atomic.LoadInt32(calls), ShouldEqual, 2)
+			So(*content, ShouldEqual, "uploaded content")
+		})
+		Convey("PUT should not be retried if the body can not be replayed", func() {
+			policy := DefaultRetryPolicy()
+			req, _ := http.NewRequest(MethodPut, "http://indy/foo.jar", ioutil.NopCloser(strings.NewReader("x")))
+			So(policy.IsIdempotent(req), ShouldBeFalse)
+			policy.RetryUploads = false
+			req, _ = http.NewRequest(MethodPut, "http://indy/foo.jar", strings.NewReader("x"))
+			So(policy.IsIdempotent(req), ShouldBeFalse)
+		})
+		Convey("Backoff should grow and stay in bounds", func() {
+			policy := DefaultRetryPolicy()
+			policy.Jitter = 0
+			So(policy.Backoff(1), ShouldEqual, time.Second)
+			So(policy.Backoff(2), ShouldEqual, 2*time.Second)
+			So(policy.Backoff(10), ShouldEqual, policy.MaxBackoff)
+			policy.Jitter = 0.2
+			for i := 0; i < 20; i++ {
+				d := policy.Backoff(2)
+				So(d, ShouldBeBetweenOrEqual, 1600*time.Millisecond, 2400*time.Millisecond)
+			}
+		})
+	})
+}
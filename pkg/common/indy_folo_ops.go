@@ -17,8 +17,15 @@ package common
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
 type TrackingKey struct {
@@ -45,46 +52,257 @@ type TrackedContentEntry struct {
 	StoreKey      string  `json:"storeKey"`
 }
 
+// Types of the folo record ids listed by FoloClient.ListRecordIds
+const (
+	FOLO_SEALED      = "sealed"
+	FOLO_IN_PROGRESS = "in_progress"
+	FOLO_ALL         = "all"
+)
+
+var (
+	// ErrFoloRecordNotFound is wrapped by the FoloError of a request for a tracking id which has no record
+	ErrFoloRecordNotFound = errors.New("folo record not found")
+	// ErrFoloRecordNotSealed is wrapped by the FoloError of CheckSealed when the record is still in progress
+	ErrFoloRecordNotSealed = errors.New("folo record not sealed")
+)
+
+// TrackingIds are the tracking ids of the sealed and in progress folo records
+type TrackingIds struct {
+	Sealed     []string `json:"sealed,omitempty"`
+	InProgress []string `json:"in_progress,omitempty"`
+}
+
+// FoloError is returned by FoloClient when a request fails. It wraps ErrFoloRecordNotFound for the response 404.
+type FoloError struct {
+	Op         string
+	Id         string
+	StatusCode int
+	Message    string
+	Err        error
+}
+
+func (e *FoloError) Error() string {
+	msg := fmt.Sprintf("%s folo record %s failed", e.Op, e.Id)
+	if e.StatusCode > 0 {
+		msg = fmt.Sprintf("%s, status: %d", msg, e.StatusCode)
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s, %s", msg, e.Err)
+	}
+	if !IsEmptyString(e.Message) {
+		msg = fmt.Sprintf("%s, %s", msg, e.Message)
+	}
+	return msg
+}
+
+func (e *FoloError) Unwrap() error {
+	return e.Err
+}
+
+// FoloClient reads and manages the folo tracking records through the indy api /api/folo/admin
+type FoloClient struct {
+	IndyURL string
+	// Authenticate is applied to the requests, e.g., KeycloakAuthenticator. nil means no authentication.
+	Authenticate Authenticate
+	// Client sends the requests, DefaultIndyClient is used if it is nil
+	Client *IndyClient
+}
+
+// NewFoloClient creates a folo client for the indy base url (see NormIndyURL)
+func NewFoloClient(indyURL string, auth Authenticate) *FoloClient {
+	return &FoloClient{IndyURL: NormIndyURL(indyURL), Authenticate: auth}
+}
+
+func (c *FoloClient) url(format string, a ...interface{}) string {
+	return c.IndyURL + "/api/folo/admin/" + fmt.Sprintf(format, a...)
+}
+
+// GetRecord gets the sealed record of the tracking id
+func (c *FoloClient) GetRecord(id string) (TrackedContent, error) {
+	record := TrackedContent{}
+	err := c.send("get", id, MethodGet, c.url("%s/record", url.PathEscape(id)), &record)
+	return record, err
+}
+
+// GetReport gets the report of the tracking id, which is the sealed record with the urls resolved by indy
+func (c *FoloClient) GetReport(id string) (TrackedContent, error) {
+	record := TrackedContent{}
+	err := c.send("report", id, MethodGet, c.url("%s/report", url.PathEscape(id)), &record)
+	return record, err
+}
+
+// Seal seals the record of the tracking id. An id with nothing tracked is sealed as an empty record.
+func (c *FoloClient) Seal(id string) (TrackedContent, error) {
+	record := TrackedContent{}
+	err := c.send("seal", id, MethodPost, c.url("%s/record", url.PathEscape(id)), &record)
+	return record, err
+}
+
+// Delete deletes the record of the tracking id, sealed or in progress
+func (c *FoloClient) Delete(id string) error {
+	return c.send("delete", id, MethodDelete, c.url("%s/record", url.PathEscape(id)), nil)
+}
+
+// Recalculate makes indy recalculate the checksums and sizes of the sealed record from the stored content, and
+// returns the updated record
+func (c *FoloClient) Recalculate(id string) (TrackedContent, error) {
+	record := TrackedContent{}
+	err := c.send("recalculate", id, MethodGet, c.url("%s/record/recalculate", url.PathEscape(id)), &record)
+	return record, err
+}
+
+// ListRecordIds lists the tracking ids of the records by type, FOLO_SEALED, FOLO_IN_PROGRESS or FOLO_ALL
+func (c *FoloClient) ListRecordIds(recordType string) (TrackingIds, error) {
+	ids := TrackingIds{}
+	err := c.send("list", recordType, MethodGet, c.url("report/ids/%s", recordType), &ids)
+	return ids, err
+}
+
+// Status returns FOLO_SEALED or FOLO_IN_PROGRESS for the tracking id, or an error wrapping ErrFoloRecordNotFound
+// if indy tracks nothing for it
+func (c *FoloClient) Status(id string) (string, error) {
+	ids, err := c.ListRecordIds(FOLO_ALL)
+	if err != nil {
+		return "", err
+	}
+	if Contains(ids.Sealed, id) {
+		return FOLO_SEALED, nil
+	}
+	if Contains(ids.InProgress, id) {
+		return FOLO_IN_PROGRESS, nil
+	}
+	return "", &FoloError{Op: "check", Id: id, Err: ErrFoloRecordNotFound}
+}
+
+// CheckSealed returns nil if the record of the tracking id exists and is sealed. It is meant as a pre-flight
+// check before a long test which replays the record.
+func (c *FoloClient) CheckSealed(id string) error {
+	status, err := c.Status(id)
+	if err != nil {
+		return err
+	}
+	if status != FOLO_SEALED {
+		return &FoloError{Op: "check", Id: id, Err: ErrFoloRecordNotSealed}
+	}
+	return nil
+}
+
+// ExportRecords writes all the sealed records to w as the zip indy exports
+func (c *FoloClient) ExportRecords(w io.Writer) error {
+	req, err := http.NewRequest(MethodGet, c.url("report/export"), nil)
+	if err != nil {
+		return &FoloError{Op: "export", Err: err}
+	}
+	resp, err := doRequest(c.Client, c.Authenticate, req)
+	if err != nil {
+		return &FoloError{Op: "export", Err: err}
+	}
+	defer closeBody(resp)
+	if resp.StatusCode >= 400 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &FoloError{Op: "export", StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return &FoloError{Op: "export", Err: err}
+	}
+	return nil
+}
+
+// ImportRecords imports the sealed records from a zip written by ExportRecords, e.g., to copy the records of
+// the original builds from production to a test indy
+func (c *FoloClient) ImportRecords(zip io.ReadSeeker) error {
+	req, err := newReplayableRequest(MethodPut, c.url("report/import"), zip)
+	if err != nil {
+		return &FoloError{Op: "import", Err: err}
+	}
+	req.Header.Set("Content-Type", ContentTypeZip)
+	resp, err := doRequest(c.Client, c.Authenticate, req)
+	if err != nil {
+		return &FoloError{Op: "import", Err: err}
+	}
+	defer closeBody(resp)
+	if resp.StatusCode >= 400 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &FoloError{Op: "import", StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return nil
+}
+
+func (c *FoloClient) send(op, id, method, URL string, out interface{}) error {
+	err := doJSON(c.Client, c.Authenticate, method, URL, nil, out)
+	if err == nil {
+		return nil
+	}
+	foloErr := &FoloError{Op: op, Id: id, Err: err}
+	if httpErr, ok := err.(HTTPError); ok {
+		foloErr.StatusCode, foloErr.Message, foloErr.Err = httpErr.StatusCode, httpErr.Message, nil
+		if httpErr.StatusCode == StatusNotFound {
+			foloErr.Err = ErrFoloRecordNotFound
+		}
+	}
+	return foloErr
+}
+
+// GetFoloRecord gets the sealed record, and exits if it fails
 func GetFoloRecord(indyURL, foloRecordId string) TrackedContent {
-	URL := fmt.Sprintf("%s/api/folo/admin/%s/record", indyURL, foloRecordId)
-	fmt.Printf("Start to get folo tracking record through: %s\n", URL)
-	trackContent := &TrackedContent{}
-	err := GetRespAsJSONType(URL, trackContent)
+	fmt.Printf("Start to get folo tracking record %s from %s\n", foloRecordId, indyURL)
+	folo := NewFoloClient(indyURL, nil)
+	trackContent, err := folo.GetRecord(foloRecordId)
 	if err != nil {
 		fmt.Printf("Error: cannot get folo record %s at indy instance %s, error is: %s\n", foloRecordId, indyURL, err.Error())
-		os.Exit(1)
+		if status, _ := folo.Status(foloRecordId); status == FOLO_IN_PROGRESS {
+			fmt.Printf("The folo record %s is still in progress, it needs to be sealed first\n", foloRecordId)
+		}
+		report.Exit(1)
 	}
-	return *trackContent
+	return trackContent
 }
-
 func GetFoloRecordAsString(indyURL, foloRecordId string) string {
 	URL := fmt.Sprintf("%s/api/folo/admin/%s/record", indyURL, foloRecordId)
 	fmt.Printf("Start to get folo tracking record through: %s\n", URL)
 	s, err := GetRespAsPlaintext(URL)
 	if err != nil {
 		fmt.Printf("Error: cannot get folo record %s at indy instance %s, error is: %s\n", foloRecordId, indyURL, err.Error())
-		os.Exit(1)
+		report.Exit(1)
 	}
 	return s
 }
 
+// GetFoloRecordFromFile reads a record saved as json, e.g., the tracking.json of a dataset. It panics if the
+// file can not be read or parsed.
 func GetFoloRecordFromFile(fileLoc string) TrackedContent {
-	trackContent := &TrackedContent{}
-	b := ReadByteFromFile(fileLoc)
-	json.Unmarshal(b, trackContent)
-	return *trackContent
+	trackContent, err := LoadFoloRecordFromFile(fileLoc)
+	RePanic(err)
+	return trackContent
+}
+
+// LoadFoloRecordFromFile reads a record saved as json
+func LoadFoloRecordFromFile(fileLoc string) (TrackedContent, error) {
+	trackContent := TrackedContent{}
+	b, err := ioutil.ReadFile(fileLoc)
+	if err != nil {
+		return trackContent, err
+	}
+	if err := json.Unmarshal(b, &trackContent); err != nil {
+		return trackContent, fmt.Errorf("invalid folo record %s, %s", fileLoc, err)
+	}
+	return trackContent, nil
 }
 
 func SealFoloRecord(indyURL, foloRecordId string) bool {
-	URL := fmt.Sprintf("%s/api/folo/admin/%s/record", indyURL, foloRecordId)
-	fmt.Printf("Start to seal folo tracking record through: %s\n", URL)
-	_, _, result := HTTPRequest(URL, MethodPost, nil, false, nil, nil, "", false)
-	return result
+	fmt.Printf("Start to seal folo tracking record %s in %s\n", foloRecordId, indyURL)
+	_, err := NewFoloClient(indyURL, nil).Seal(foloRecordId)
+	if err != nil {
+		fmt.Printf("Seal failed, %s\n", err)
+	}
+	return err == nil
 }
 
 func DeleteFoloRecord(indyURL, foloRecordId string) bool {
-	URL := fmt.Sprintf("%s/api/folo/admin/%s/record", indyURL, foloRecordId)
-	fmt.Printf("Start to delete folo tracking record through: %s\n", URL)
-	_, _, result := HTTPRequest(URL, MethodDelete, nil, false, nil, nil, "", false)
-	return result
+	fmt.Printf("Start to delete folo tracking record %s in %s\n", foloRecordId, indyURL)
+	err := NewFoloClient(indyURL, nil).Delete(foloRecordId)
+	if err != nil {
+		fmt.Printf("Delete failed, %s\n", err)
+	}
+	return err == nil
 }
@@ -0,0 +1,86 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/indymock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFoloClient(t *testing.T) {
+	Convey("FoloClient", t, func() {
+		mock, server := indymock.Start()
+		defer server.Close()
+		folo := NewFoloClient(server.URL, nil)
+		pom := []byte("<project><version>1.0</version></project>")
+		mock.PutContent("maven:remote:central", "org/foo/foo/1.0/foo-1.0.pom", pom)
+		_, status, ok := HTTPRequest(server.URL+"/api/folo/track/build-1/maven/remote/central/org/foo/foo/1.0/foo-1.0.pom",
+			MethodGet, nil, false, nil, nil, "", false)
+		So(ok, ShouldBeTrue)
+		So(status, ShouldEqual, StatusOK)
+
+		Convey("Records can be checked before and after sealing", func() {
+			_, err := folo.GetRecord("build-1")
+			So(errors.Is(err, ErrFoloRecordNotFound), ShouldBeTrue)
+			So(errors.Is(folo.CheckSealed("build-1"), ErrFoloRecordNotSealed), ShouldBeTrue)
+			So(errors.Is(folo.CheckSealed("build-2"), ErrFoloRecordNotFound), ShouldBeTrue)
+			ids, err := folo.ListRecordIds(FOLO_IN_PROGRESS)
+			So(err, ShouldBeNil)
+			So(ids.InProgress, ShouldResemble, []string{"build-1"})
+
+			sealed, err := folo.Seal("build-1")
+			So(err, ShouldBeNil)
+			So(len(sealed.Downloads), ShouldEqual, 1)
+			So(folo.CheckSealed("build-1"), ShouldBeNil)
+			record, err := folo.GetRecord("build-1")
+			So(err, ShouldBeNil)
+			So(record.TrackingKey.Id, ShouldEqual, "build-1")
+			reported, err := folo.GetReport("build-1")
+			So(err, ShouldBeNil)
+			So(reported.Downloads[0].Md5, ShouldEqual, record.Downloads[0].Md5)
+
+			So(folo.Delete("build-1"), ShouldBeNil)
+			_, err = folo.Status("build-1")
+			So(errors.Is(err, ErrFoloRecordNotFound), ShouldBeTrue)
+		})
+		Convey("Recalculate should update the checksums", func() {
+			folo.Seal("build-1")
+			changed := []byte("<project><version>1.0</version><!-- changed --></project>")
+			mock.PutContent("maven:remote:central", "org/foo/foo/1.0/foo-1.0.pom", changed)
+			record, err := folo.Recalculate("build-1")
+			So(err, ShouldBeNil)
+			So(record.Downloads[0].Size, ShouldEqual, len(changed))
+		})
+		Convey("Records can be exported and imported", func() {
+			folo.Seal("build-1")
+			var zip bytes.Buffer
+			So(folo.ExportRecords(&zip), ShouldBeNil)
+
+			_, other := indymock.Start()
+			defer other.Close()
+			target := NewFoloClient(other.URL, nil)
+			So(target.ImportRecords(bytes.NewReader(zip.Bytes())), ShouldBeNil)
+			record, err := target.GetRecord("build-1")
+			So(err, ShouldBeNil)
+			So(record.Downloads[0].Path, ShouldEqual, "/org/foo/foo/1.0/foo-1.0.pom")
+		})
+	})
+}
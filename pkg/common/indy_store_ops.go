@@ -0,0 +1,320 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	STORE_TYPE_HOSTED = "hosted"
+	STORE_TYPE_REMOTE = "remote"
+	STORE_TYPE_GROUP  = "group"
+)
+
+var (
+	// ErrStoreNotFound is wrapped by the StoreError of a request to a store which does not exist
+	ErrStoreNotFound = errors.New("store not found")
+	// ErrStoreExists is wrapped by the StoreError of a Create for a store which already exists
+	ErrStoreExists = errors.New("store already exists")
+)
+
+// StoreKey identifies an indy store, e.g., "maven:hosted:build-1"
+type StoreKey struct {
+	PackageType string
+	Type        string
+	Name        string
+}
+
+// ParseStoreKey parses "packageType:type:name"
+func ParseStoreKey(key string) (StoreKey, error) {
+	toks := strings.SplitN(key, ":", 3)
+	if len(toks) != 3 || toks[0] == "" || toks[2] == "" {
+		return StoreKey{}, fmt.Errorf("invalid store key %q", key)
+	}
+	switch toks[1] {
+	case STORE_TYPE_HOSTED, STORE_TYPE_REMOTE, STORE_TYPE_GROUP:
+	default:
+		return StoreKey{}, fmt.Errorf("invalid store type in store key %q", key)
+	}
+	return StoreKey{PackageType: toks[0], Type: toks[1], Name: toks[2]}, nil
+}
+
+func (k StoreKey) String() string {
+	return fmt.Sprintf("%s:%s:%s", k.PackageType, k.Type, k.Name)
+}
+
+// adminPath is the path of the store under /api/admin/stores, the name is escaped
+func (k StoreKey) adminPath() string {
+	return fmt.Sprintf("%s/%s/%s", k.PackageType, k.Type, url.PathEscape(k.Name))
+}
+
+// Store is implemented by HostedRepository, RemoteRepository and Group
+type Store interface {
+	StoreKey() StoreKey
+}
+
+// ArtifactStore has the fields shared by all the store types. It is also the item type of List.
+type ArtifactStore struct {
+	Key                string            `json:"key"`
+	Name               string            `json:"name"`
+	PackageType        string            `json:"packageType"`
+	Type               string            `json:"type"`
+	Description        string            `json:"description,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	Disabled           bool              `json:"disabled"`
+	DisableTimeout     int               `json:"disable_timeout"`
+	PathStyle          string            `json:"path_style,omitempty"`
+	AuthoritativeIndex bool              `json:"authoritative_index"`
+}
+
+func newArtifactStore(packageType, storeType, name string) ArtifactStore {
+	return ArtifactStore{
+		Key:         StoreKey{PackageType: packageType, Type: storeType, Name: name}.String(),
+		Name:        name,
+		PackageType: packageType,
+		Type:        storeType,
+		Metadata:    map[string]string{"changelog": fmt.Sprintf("init %s %s", storeType, name)},
+		PathStyle:   "plain",
+	}
+}
+
+// StoreKey returns the key built from the package type, type and name, which are what indy checks the key against
+func (s *ArtifactStore) StoreKey() StoreKey {
+	return StoreKey{PackageType: s.PackageType, Type: s.Type, Name: s.Name}
+}
+
+// HostedRepository ...
+type HostedRepository struct {
+	ArtifactStore
+	SnapshotTimeoutSeconds int  `json:"snapshotTimeoutSeconds"`
+	Readonly               bool `json:"readonly"`
+	AllowSnapshots         bool `json:"allow_snapshots"`
+	AllowReleases          bool `json:"allow_releases"`
+}
+
+// NewHostedRepository creates a hosted repo which accepts snapshots and releases, like the build repos of PNC
+func NewHostedRepository(packageType, name string) *HostedRepository {
+	hosted := &HostedRepository{
+		ArtifactStore:  newArtifactStore(packageType, STORE_TYPE_HOSTED, name),
+		AllowSnapshots: true,
+		AllowReleases:  true,
+	}
+	hosted.Description = name
+	hosted.AuthoritativeIndex = true
+	return hosted
+}
+
+// RemoteRepository ...
+type RemoteRepository struct {
+	ArtifactStore
+	URL            string `json:"url"`
+	AllowSnapshots bool   `json:"allow_snapshots"`
+	AllowReleases  bool   `json:"allow_releases"`
+}
+
+// NewRemoteRepository creates a remote repo proxying the url
+func NewRemoteRepository(packageType, name, remoteURL string) *RemoteRepository {
+	remote := &RemoteRepository{
+		ArtifactStore:  newArtifactStore(packageType, STORE_TYPE_REMOTE, name),
+		URL:            remoteURL,
+		AllowSnapshots: true,
+		AllowReleases:  true,
+	}
+	remote.Description = name
+	remote.AuthoritativeIndex = true
+	return remote
+}
+
+// Group ...
+type Group struct {
+	ArtifactStore
+	Constituents       []string `json:"constituents"`
+	PrependConstituent bool     `json:"prepend_constituent"`
+}
+
+// NewGroup creates a group with the constituents in order, e.g., "maven:hosted:build-1"
+func NewGroup(packageType, name string, constituents ...string) *Group {
+	return &Group{
+		ArtifactStore: newArtifactStore(packageType, STORE_TYPE_GROUP, name),
+		Constituents:  append([]string{}, constituents...),
+	}
+}
+
+// StoreError is returned by StoreClient when a request fails. It wraps ErrStoreNotFound or ErrStoreExists for
+// the responses 404 and 409, so callers can check them by errors.Is.
+type StoreError struct {
+	Op         string
+	Key        string
+	StatusCode int
+	Message    string
+	Err        error
+}
+
+func (e *StoreError) Error() string {
+	msg := fmt.Sprintf("%s store %s failed", e.Op, e.Key)
+	if e.StatusCode > 0 {
+		msg = fmt.Sprintf("%s, status: %d", msg, e.StatusCode)
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s, %s", msg, e.Err)
+	}
+	if !IsEmptyString(e.Message) {
+		msg = fmt.Sprintf("%s, %s", msg, strings.TrimSpace(e.Message))
+	}
+	return msg
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// StoreClient manages the store definitions through the indy store admin api /api/admin/stores
+type StoreClient struct {
+	IndyURL string
+	// Authenticate is applied to the requests, e.g., KeycloakAuthenticator. nil means no authentication.
+	Authenticate Authenticate
+	// Client sends the requests, DefaultIndyClient is used if it is nil
+	Client *IndyClient
+}
+
+// NewStoreClient creates a store client for the indy base url (see NormIndyURL)
+func NewStoreClient(indyURL string, auth Authenticate) *StoreClient {
+	return &StoreClient{IndyURL: NormIndyURL(indyURL), Authenticate: auth}
+}
+
+func (c *StoreClient) url(p string) string {
+	return fmt.Sprintf("%s/api/admin/stores/%s", c.IndyURL, p)
+}
+
+// Get gets the store definition into store, which is usually a *HostedRepository, *RemoteRepository or *Group
+func (c *StoreClient) Get(key StoreKey, store interface{}) error {
+	return c.send("get", key.String(), MethodGet, c.url(key.adminPath()), nil, store)
+}
+
+// GetHosted gets a hosted repo
+func (c *StoreClient) GetHosted(packageType, name string) (*HostedRepository, error) {
+	hosted := &HostedRepository{}
+	err := c.Get(StoreKey{PackageType: packageType, Type: STORE_TYPE_HOSTED, Name: name}, hosted)
+	if err != nil {
+		return nil, err
+	}
+	return hosted, nil
+}
+
+// GetRemote gets a remote repo
+func (c *StoreClient) GetRemote(packageType, name string) (*RemoteRepository, error) {
+	remote := &RemoteRepository{}
+	err := c.Get(StoreKey{PackageType: packageType, Type: STORE_TYPE_REMOTE, Name: name}, remote)
+	if err != nil {
+		return nil, err
+	}
+	return remote, nil
+}
+
+// GetGroup gets a group
+func (c *StoreClient) GetGroup(packageType, name string) (*Group, error) {
+	group := &Group{}
+	err := c.Get(StoreKey{PackageType: packageType, Type: STORE_TYPE_GROUP, Name: name}, group)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// List lists the stores of the package type and store type
+func (c *StoreClient) List(packageType, storeType string) ([]ArtifactStore, error) {
+	listing := struct {
+		Items []ArtifactStore `json:"items"`
+	}{}
+	p := fmt.Sprintf("%s/%s", packageType, storeType)
+	if err := c.send("list", p, MethodGet, c.url(p), nil, &listing); err != nil {
+		return nil, err
+	}
+	return listing.Items, nil
+}
+
+// Exists checks the store by a HEAD request
+func (c *StoreClient) Exists(key StoreKey) (bool, error) {
+	err := c.send("check", key.String(), MethodHead, c.url(key.adminPath()), nil, nil)
+	if errors.Is(err, ErrStoreNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Create creates the store, it fails with ErrStoreExists if the store exists
+func (c *StoreClient) Create(store Store) error {
+	key := store.StoreKey()
+	return c.send("create", key.String(), MethodPost, c.url(fmt.Sprintf("%s/%s", key.PackageType, key.Type)), store, nil)
+}
+
+// Update creates or replaces the store
+func (c *StoreClient) Update(store Store) error {
+	key := store.StoreKey()
+	return c.send("update", key.String(), MethodPut, c.url(key.adminPath()), store, nil)
+}
+
+// Delete deletes the store, with deleteContent the content of a hosted or remote repo is deleted as well
+func (c *StoreClient) Delete(key StoreKey, deleteContent bool) error {
+	URL := c.url(key.adminPath())
+	if deleteContent {
+		URL += "?deleteContent=true"
+	}
+	return c.send("delete", key.String(), MethodDelete, URL, nil, nil)
+}
+
+// Disable disables the store. The definition is updated as it is on the server, so the fields which are not
+// known by this client are kept.
+func (c *StoreClient) Disable(key StoreKey) error {
+	return c.setDisabled(key, true)
+}
+
+// Enable enables a disabled store
+func (c *StoreClient) Enable(key StoreKey) error {
+	return c.setDisabled(key, false)
+}
+
+func (c *StoreClient) setDisabled(key StoreKey, disabled bool) error {
+	definition := map[string]interface{}{}
+	if err := c.Get(key, &definition); err != nil {
+		return err
+	}
+	definition["disabled"] = disabled
+	return c.send("update", key.String(), MethodPut, c.url(key.adminPath()), definition, nil)
+}
+
+func (c *StoreClient) send(op, key, method, URL string, in, out interface{}) error {
+	err := doJSON(c.Client, c.Authenticate, method, URL, in, out)
+	if err == nil {
+		return nil
+	}
+	storeErr := &StoreError{Op: op, Key: key, Err: err}
+	if httpErr, ok := err.(HTTPError); ok {
+		storeErr.StatusCode, storeErr.Message, storeErr.Err = httpErr.StatusCode, httpErr.Message, nil
+		switch httpErr.StatusCode {
+		case StatusNotFound:
+			storeErr.Err = ErrStoreNotFound
+		case StatusConflict:
+			storeErr.Err = ErrStoreExists
+		}
+	}
+	return storeErr
+}
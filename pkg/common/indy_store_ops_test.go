@@ -0,0 +1,103 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/indymock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStoreClient(t *testing.T) {
+	Convey("StoreClient", t, func() {
+		mock, server := indymock.Start()
+		defer server.Close()
+		stores := NewStoreClient(server.URL, nil)
+
+		Convey("Special characters should be serialized as json", func() {
+			hosted := NewHostedRepository("maven", "build-1")
+			hosted.Description = `a "quoted" <build> & more`
+			So(stores.Create(hosted), ShouldBeNil)
+			group := NewGroup("maven", "build-1", "maven:hosted:build-1", `maven:hosted:we"ird`)
+			So(stores.Update(group), ShouldBeNil)
+
+			got, err := stores.GetHosted("maven", "build-1")
+			So(err, ShouldBeNil)
+			So(got.Description, ShouldEqual, hosted.Description)
+			So(got.AllowReleases, ShouldBeTrue)
+			gotGroup, err := stores.GetGroup("maven", "build-1")
+			So(err, ShouldBeNil)
+			So(gotGroup.Constituents, ShouldResemble, group.Constituents)
+			stored, _ := mock.GetStore("maven:group:build-1")
+			So(stored.Constituents(), ShouldResemble, group.Constituents)
+
+			b, _ := json.Marshal(hosted)
+			So(string(b), ShouldContainSubstring, `"key":"maven:hosted:build-1"`)
+			So(string(b), ShouldContainSubstring, `"authoritative_index":true`)
+		})
+		Convey("Errors should be classified", func() {
+			key := StoreKey{PackageType: "maven", Type: STORE_TYPE_HOSTED, Name: "missing"}
+			_, err := stores.GetHosted("maven", "missing")
+			So(errors.Is(err, ErrStoreNotFound), ShouldBeTrue)
+			var storeErr *StoreError
+			So(errors.As(err, &storeErr), ShouldBeTrue)
+			So(storeErr.StatusCode, ShouldEqual, StatusNotFound)
+			So(errors.Is(stores.Delete(key, true), ErrStoreNotFound), ShouldBeTrue)
+
+			exists, err := stores.Exists(key)
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+
+			So(errors.Is(stores.Create(NewHostedRepository("maven", "pnc-builds")), ErrStoreExists), ShouldBeTrue)
+		})
+		Convey("Stores can be listed, disabled and deleted", func() {
+			So(stores.Update(NewRemoteRepository("npm", "r-1", "https://registry.npmjs.org/")), ShouldBeNil)
+			remotes, err := stores.List("npm", STORE_TYPE_REMOTE)
+			So(err, ShouldBeNil)
+			names := []string{}
+			for _, r := range remotes {
+				names = append(names, r.Name)
+			}
+			So(names, ShouldResemble, []string{"npmjs", "r-1"})
+
+			key := StoreKey{PackageType: "npm", Type: STORE_TYPE_REMOTE, Name: "r-1"}
+			So(stores.Disable(key), ShouldBeNil)
+			remote, _ := stores.GetRemote("npm", "r-1")
+			So(remote.Disabled, ShouldBeTrue)
+			So(remote.URL, ShouldEqual, "https://registry.npmjs.org/")
+			So(stores.Enable(key), ShouldBeNil)
+			remote, _ = stores.GetRemote("npm", "r-1")
+			So(remote.Disabled, ShouldBeFalse)
+
+			So(stores.Delete(key, true), ShouldBeNil)
+			exists, err := stores.Exists(key)
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+		})
+		Convey("Store keys should be parsed", func() {
+			key, err := ParseStoreKey("maven:group:builds-untested+shared-imports+public")
+			So(err, ShouldBeNil)
+			So(key.Name, ShouldEqual, "builds-untested+shared-imports+public")
+			So(key.String(), ShouldEqual, "maven:group:builds-untested+shared-imports+public")
+			_, err = ParseStoreKey("maven:foo:bar")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
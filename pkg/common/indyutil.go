@@ -2,72 +2,83 @@ package common
 
 import (
 	"fmt"
-	"net/http"
 	"net/url"
-	"os"
 	"path"
 	"strings"
+
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
 const (
 	TRACKING_SUFFIX = "+tracking"
 )
 
+// ValidateTargetIndyOrExit is ValidateTargetIndy which exits when the validation fails
 func ValidateTargetIndyOrExit(targetIndy string) (string, bool) {
-	targetIndyHost, validated := ValidateTargetIndy(targetIndy)
+	targetIndyURL, validated := ValidateTargetIndy(targetIndy)
 	if !validated {
-		os.Exit(1)
+		report.Exit(1)
 	}
-	return targetIndyHost, validated
+	return targetIndyURL, validated
 }
 
+// ValidateTargetIndy checks the indy server is reachable, and returns its normalized base url (see NormIndyURL)
 func ValidateTargetIndy(targetIndy string) (string, bool) {
-	indyHost := targetIndy
-	if strings.HasPrefix(targetIndy, "http") {
-		host := GetHost(targetIndy)
-		port := GetPort(targetIndy)
-		if IsEmptyString(port) || port == "80" {
-			indyHost = host
-		} else {
-			indyHost = fmt.Sprintf("%s:%s", host, port)
-		}
-	} else {
-		indyHost = strings.Split(targetIndy, "/")[0]
-	}
-
-	indyTest := ""
-	var indyAPIBase string
-	if strings.HasPrefix(indyHost, "http") {
-		indyAPIBase = indyHost + "/api"
-	} else {
-		indyAPIBase = "http://" + indyHost + "/api"
-	}
+	indyURL := NormIndyURL(targetIndy)
+	fmt.Printf("Start testing target indy server %s\n", indyURL)
 
-	fmt.Printf("Start testing target indy server %s\n", indyHost)
-	_, err := url.ParseRequestURI(indyAPIBase)
-	if err == nil {
-		testPath := "/admin/stores/maven/remote/central"
-		indyTest = indyAPIBase + testPath
-		_, err = url.ParseRequestURI(indyTest)
-		if err != nil {
-			fmt.Printf("Error: not a valid indy server: %s because %s does not exist\n", targetIndy, testPath)
-			return "", false
-		}
-	} else {
+	testPath := "/api/admin/stores/maven/remote/central"
+	indyTest := indyURL + testPath
+	if _, err := url.ParseRequestURI(indyTest); err != nil {
 		fmt.Printf("Error: not a valid indy server: %s\n", targetIndy)
 		return "", false
 	}
-	resp, err2 := http.Get(indyTest)
+	resp, err2 := DefaultIndyClient().Get(indyTest, nil)
 	if err2 != nil {
 		fmt.Printf("Error: %s is not a valid indy server. Cause: %s\n", targetIndy, err2)
 		return "", false
 	}
+	defer closeBody(resp)
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
 		fmt.Printf("Error: %s returned bad status. Cause: %s\n", targetIndy, resp.Status)
 		return "", false
 	}
-	resp.Body.Close()
-	return indyHost, true
+	return indyURL, true
+}
+
+// NormIndyURL normalizes an indy server address to the base url which the api paths are appended to, e.g.,
+// "indy.example.com" => "http://indy.example.com", "https://indy.example.com:8443/indy/" =>
+// "https://indy.example.com:8443/indy". The scheme is only added when missing, so https is kept. The custom port
+// and the context path (indy behind a reverse proxy) are kept, the default port of the scheme is dropped.
+func NormIndyURL(indyURL string) string {
+	raw := strings.TrimSpace(indyURL)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return strings.TrimRight(raw, "/")
+	}
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+		if strings.Contains(u.Host, ":") {
+			u.Host = "[" + u.Host + "]"
+		}
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// GetIndyBaseURL gets the indy base url from an indy api url, e.g., the localUrl of a folo record entry like
+// "https://indy.example.com/indy/api/content/maven/hosted/build-1/foo.pom" => "https://indy.example.com/indy"
+func GetIndyBaseURL(apiURL string) string {
+	if i := strings.Index(apiURL, "/api/"); i > 0 {
+		return NormIndyURL(apiURL[:i])
+	}
+	return NormIndyURL(apiURL)
 }
 
 func StoreKeyToPath(storeKey string) string {
@@ -1,6 +1,11 @@
 package common
 
 import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -11,3 +16,74 @@ func TestStoreKeyToPath(t *testing.T) {
 		So(StoreKeyToPath("maven:hosted:shared-imports"), ShouldEqual, "maven/hosted/shared-imports")
 	})
 }
+
+func TestNormIndyURL(t *testing.T) {
+	Convey("TestNormIndyURL", t, func() {
+		cases := map[string]string{
+			"indy.example.com":                     "http://indy.example.com",
+			"indy.example.com:8080":                "http://indy.example.com:8080",
+			"http://indy.example.com/":             "http://indy.example.com",
+			"http://indy.example.com:80":           "http://indy.example.com",
+			"https://indy.example.com":             "https://indy.example.com",
+			"https://indy.example.com:443/":        "https://indy.example.com",
+			"https://indy.example.com:8443":        "https://indy.example.com:8443",
+			"https://indy.example.com:8443/indy/":  "https://indy.example.com:8443/indy",
+			" https://proxy.example.com/a/indy// ": "https://proxy.example.com/a/indy",
+			"http://[::1]:80/indy":                 "http://[::1]/indy",
+		}
+		for in, expected := range cases {
+			So(NormIndyURL(in), ShouldEqual, expected)
+		}
+	})
+}
+
+func TestGetIndyBaseURL(t *testing.T) {
+	Convey("TestGetIndyBaseURL", t, func() {
+		So(GetIndyBaseURL("http://indy.example.com/api/content/maven/hosted/build-1/foo.pom"), ShouldEqual, "http://indy.example.com")
+		So(GetIndyBaseURL("https://indy.example.com:8443/indy/api/content/npm/hosted/build-1/foo"), ShouldEqual, "https://indy.example.com:8443/indy")
+		So(GetIndyBaseURL("https://indy.example.com/"), ShouldEqual, "https://indy.example.com")
+	})
+}
+
+func TestValidateTargetIndy(t *testing.T) {
+	Convey("TestValidateTargetIndy", t, func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/indy/api/admin/stores/maven/remote/central" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		caFile := path.Join(t.TempDir(), "ca.pem")
+		caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		So(os.WriteFile(caFile, caPem, 0644), ShouldBeNil)
+
+		config := DefaultClientConfig()
+		config.Retry.MaxAttempts = 1
+		Convey("Should fail without the CA of the server", func() {
+			withDefaultIndyClient(mustNewIndyClient(config), func() {
+				_, validated := ValidateTargetIndy(server.URL + "/indy")
+				So(validated, ShouldBeFalse)
+			})
+		})
+		Convey("Should keep https and the context path with the CA bundle", func() {
+			config.CACertFile = caFile
+			client, err := NewIndyClient(config)
+			So(err, ShouldBeNil)
+			withDefaultIndyClient(client, func() {
+				indyURL, validated := ValidateTargetIndy(server.URL + "/indy/")
+				So(validated, ShouldBeTrue)
+				So(indyURL, ShouldEqual, server.URL+"/indy")
+			})
+		})
+		Convey("Should reject a bad CA bundle", func() {
+			config.CACertFile = path.Join(t.TempDir(), "missing.pem")
+			_, err := NewIndyClient(config)
+			So(err, ShouldNotBeNil)
+			config.CACertFile = ""
+			config.ClientCertFile = caFile
+			_, err = NewIndyClient(config)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
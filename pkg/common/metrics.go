@@ -0,0 +1,549 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+// The classes of the requested paths, the latency of each class is summarized separately
+const (
+	PATH_CLASS_ARTIFACT       = "artifact"
+	PATH_CLASS_POM            = "pom"
+	PATH_CLASS_MAVEN_METADATA = "maven-metadata"
+	PATH_CLASS_NPM_METADATA   = "npm-metadata"
+	PATH_CLASS_CHECKSUM       = "checksum"
+	// PATH_CLASS_API is any request which is not for content, e.g., the store admin, folo or promote api
+	PATH_CLASS_API = "api"
+)
+
+// ENVAR_METRICS_FILE is the file to write the MetricsSnapshot of the run to
+const ENVAR_METRICS_FILE = "INDY_METRICS_FILE"
+
+// STORE_TYPE_NONE is the store type of the requests which are not for the content of a store
+const STORE_TYPE_NONE = "-"
+
+var contentPathRegexp = regexp.MustCompile(`/api/(?:folo/track/[^/]+/|content/)([^/]+)/(hosted|remote|group)/[^/]+(/.*)?$`)
+
+// RequestSample is the measurement of one request. The latency lasts until the response body is read, so it
+// includes the transfer of the content.
+type RequestSample struct {
+	// Phase is the phase of the command when the request is sent, see MetricsCollector.SetPhase
+	Phase      string
+	Method     string
+	StoreType  string
+	PathClass  string
+	StatusCode int
+	Bytes      int64
+	Start      time.Time
+	Latency    time.Duration
+	// Failed is true for a transport error or an error status (>= 400) but 404. A 404 is an expected answer to
+	// many requests of the tests, e.g., the missing checksum files and the waits for removed content, so it is
+	// counted separately, see ClassStats.NotFound.
+	Failed bool
+}
+
+// ClassifyRequest returns the store type and the path class of the request url
+func ClassifyRequest(URL string) (string, string) {
+	p := URL
+	if i := strings.Index(p, "?"); i >= 0 {
+		p = p[:i]
+	}
+	m := contentPathRegexp.FindStringSubmatch(p)
+	if m == nil {
+		return STORE_TYPE_NONE, PATH_CLASS_API
+	}
+	packageType, storeType, artiPath := m[1], m[2], m[3]
+	for _, algorithm := range ALL_CHECKSUMS {
+		if strings.HasSuffix(artiPath, "."+algorithm) {
+			return storeType, PATH_CLASS_CHECKSUM
+		}
+	}
+	switch {
+	case strings.HasSuffix(artiPath, MAVEN_METADATA_XML):
+		return storeType, PATH_CLASS_MAVEN_METADATA
+	case packageType == "npm" && !strings.HasSuffix(artiPath, ".tgz"):
+		return storeType, PATH_CLASS_NPM_METADATA
+	case strings.HasSuffix(artiPath, ".pom"):
+		return storeType, PATH_CLASS_POM
+	}
+	return storeType, PATH_CLASS_ARTIFACT
+}
+
+// Propagation is the time indy took to handle an event, e.g., to merge a promoted version into the metadata,
+// as observed by WaitForPropagation
+type Propagation struct {
+	Name    string
+	Elapsed time.Duration
+	// Completed is false if the wait timed out
+	Completed bool
+}
+
+// MetricsCollector accumulates the requests sent by IndyClient during the run by their classes, see classSeries
+type MetricsCollector struct {
+	mu           sync.Mutex
+	phase        string
+	phasePinned  bool
+	classes      map[string]*classSeries
+	propagations []Propagation
+}
+
+// NewMetricsCollector creates an empty collector
+func NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{classes: make(map[string]*classSeries)}
+}
+
+// classSeries accumulates the requests of a class when they are recorded, so the samples are not kept. Only the
+// latencies are kept for the percentiles of the summary, the prometheus series are counted in prom.
+type classSeries struct {
+	phase, method, storeType, pathClass string
+	count, errors, notFound             int
+	bytes                               int64
+	start, end                          time.Time
+	latencies                           []time.Duration
+	prom                                *promSeries
+}
+
+func newClassSeries(s RequestSample) *classSeries {
+	return &classSeries{phase: s.Phase, method: s.Method, storeType: s.StoreType, pathClass: s.PathClass, prom: newPromSeries(s)}
+}
+
+func (c *classSeries) add(s RequestSample) {
+	c.count++
+	c.bytes += s.Bytes
+	if s.Failed {
+		c.errors++
+	}
+	if s.StatusCode == StatusNotFound {
+		c.notFound++
+	}
+	if c.start.IsZero() || s.Start.Before(c.start) {
+		c.start = s.Start
+	}
+	if e := s.Start.Add(s.Latency); e.After(c.end) {
+		c.end = e
+	}
+	c.latencies = append(c.latencies, s.Latency)
+	if c.prom != nil {
+		c.prom.observe(s)
+	}
+}
+
+// merge adds the requests of other, e.g., to the total of all classes. The prometheus series are not merged.
+func (c *classSeries) merge(other *classSeries) {
+	c.count += other.count
+	c.errors += other.errors
+	c.notFound += other.notFound
+	c.bytes += other.bytes
+	if c.start.IsZero() || other.start.Before(c.start) {
+		c.start = other.start
+	}
+	if other.end.After(c.end) {
+		c.end = other.end
+	}
+	c.latencies = append(c.latencies, other.latencies...)
+}
+
+var defaultMetrics = NewMetricsCollector()
+
+// DefaultMetrics returns the collector of the requests sent by all IndyClients
+func DefaultMetrics() *MetricsCollector {
+	return defaultMetrics
+}
+
+// Record adds a sample to the series of its class
+func (m *MetricsCollector) Record(s RequestSample) {
+	k := s.Phase + "\x00" + className("", s.Method, s.StoreType, s.PathClass)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.classes[k]
+	if c == nil {
+		c = newClassSeries(s)
+		m.classes[k] = c
+	}
+	c.add(s)
+}
+
+// SetPhase labels the requests sent from now on, e.g., "downloads" and "uploads" of a build replay, so they
+// are summarized separately. It has no effect while the phase is pinned.
+func (m *MetricsCollector) SetPhase(phase string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.phasePinned {
+		m.phase = phase
+	}
+}
+
+// PinPhase labels the requests sent from now on by phase until UnpinPhase, the SetPhase calls in between are
+// ignored. The phase is shared by all goroutines, so it is pinned when several runs are sent in parallel, e.g.,
+// the builds of a group, whose phases would overwrite each other.
+func (m *MetricsCollector) PinPhase(phase string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.phase, m.phasePinned = phase, true
+}
+
+// UnpinPhase lets SetPhase take effect again
+func (m *MetricsCollector) UnpinPhase() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.phasePinned = false
+}
+
+func (m *MetricsCollector) currentPhase() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.phase
+}
+
+// classSnapshot copies the series of all classes ordered by phase and name, so they can be summarized without
+// blocking the requests. The latencies are only copied for the percentiles, a scrape does not need them.
+func (m *MetricsCollector) classSnapshot(latencies bool) []*classSeries {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.classes))
+	for k := range m.classes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	classes := make([]*classSeries, len(keys))
+	for i, k := range keys {
+		c := *m.classes[k]
+		c.latencies = nil
+		if latencies {
+			c.latencies = append([]time.Duration{}, m.classes[k].latencies...)
+		}
+		c.prom = c.prom.copy()
+		classes[i] = &c
+	}
+	return classes
+}
+
+// Reset drops all requests and propagations, e.g., between the phases of a command which are summarized separately
+func (m *MetricsCollector) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.classes = make(map[string]*classSeries)
+	m.propagations = nil
+}
+
+// RecordPropagation adds the observed propagation time of an event
+func (m *MetricsCollector) RecordPropagation(name string, elapsed time.Duration, completed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.propagations = append(m.propagations, Propagation{Name: name, Elapsed: elapsed, Completed: completed})
+}
+
+// Propagations returns a copy of the propagations in the order they are recorded
+func (m *MetricsCollector) Propagations() []Propagation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Propagation{}, m.propagations...)
+}
+
+// ClassStats summarizes the requests of the same phase, method, store type and path class
+type ClassStats struct {
+	Phase     string
+	Method    string
+	StoreType string
+	PathClass string
+	Count     int
+	Errors    int
+	// NotFound are the 404 responses, which are not errors
+	NotFound int
+	Bytes    int64
+	P50      time.Duration
+	P90      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+	// Elapsed is the wall time from the start of the first request to the end of the last one
+	Elapsed time.Duration
+}
+
+// ErrorRate is the fraction of the failed requests
+func (s ClassStats) ErrorRate() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Count)
+}
+
+// RequestsPerSecond is the throughput of the requests during Elapsed
+func (s ClassStats) RequestsPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Count) / s.Elapsed.Seconds()
+}
+
+// BytesPerSecond is the throughput of the content during Elapsed
+func (s ClassStats) BytesPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Elapsed.Seconds()
+}
+
+// Name is like "downloads: GET group pom"
+func (s ClassStats) Name() string {
+	return className(s.Phase, s.Method, s.StoreType, s.PathClass)
+}
+
+func className(phase, method, storeType, pathClass string) string {
+	name := fmt.Sprintf("%s %s %s", method, storeType, pathClass)
+	if phase != "" {
+		name = phase + ": " + name
+	}
+	return name
+}
+
+// Summary computes the stats of each class, ordered by phase and name. The last one is the total of all
+// requests, with "*" as its phase, method, store type and path class.
+func (m *MetricsCollector) Summary() []ClassStats {
+	classes := m.classSnapshot(true)
+	if len(classes) == 0 {
+		return nil
+	}
+	total := &classSeries{phase: "*", method: "*", storeType: "*", pathClass: "*"}
+	stats := make([]ClassStats, 0, len(classes)+1)
+	for _, c := range classes {
+		stats = append(stats, c.summarize())
+		total.merge(c)
+	}
+	return append(stats, total.summarize())
+}
+
+func (c *classSeries) summarize() ClassStats {
+	stats := ClassStats{Phase: c.phase, Method: c.method, StoreType: c.storeType, PathClass: c.pathClass,
+		Count: c.count, Errors: c.errors, NotFound: c.notFound, Bytes: c.bytes, Elapsed: c.end.Sub(c.start)}
+	latencies := c.latencies
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.P50, stats.P90, stats.P95 = percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 95)
+	stats.P99 = percentile(latencies, 99)
+	stats.Max = latencies[len(latencies)-1]
+	return stats
+}
+
+// percentile of the sorted durations by the nearest rank
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// PrintSummary prints the stats of each class, the total throughput and the propagation times
+func (m *MetricsCollector) PrintSummary() {
+	m.printRequests()
+	if propagations := m.Propagations(); len(propagations) > 0 {
+		fmt.Printf("Propagation times:\n")
+		for _, p := range propagations {
+			state := ""
+			if !p.Completed {
+				state = " (timed out)"
+			}
+			fmt.Printf("  %-48s %10s%s\n", p.Name, p.Elapsed.Round(time.Millisecond), state)
+		}
+	}
+}
+
+func (m *MetricsCollector) printRequests() {
+	stats := m.Summary()
+	if len(stats) == 0 {
+		fmt.Printf("Request metrics: no request was sent.\n")
+		return
+	}
+	fmt.Printf("Request metrics:\n")
+	fmt.Printf("  %-48s %7s %7s %7s %10s %10s %10s %10s %10s %12s\n", "CLASS", "COUNT", "ERRORS", "404", "P50", "P90", "P99", "MAX", "REQ/S", "BYTES/S")
+	for _, s := range stats {
+		name := s.Name()
+		if s.Method == "*" {
+			name = "TOTAL"
+		}
+		fmt.Printf("  %-48s %7d %6.1f%% %7d %10s %10s %10s %10s %10.1f %12s\n", name, s.Count, s.ErrorRate()*100, s.NotFound,
+			roundLatency(s.P50), roundLatency(s.P90), roundLatency(s.P99), roundLatency(s.Max), s.RequestsPerSecond(),
+			ByteCountSI(int64(s.BytesPerSecond()))+"/s")
+	}
+	total := stats[len(stats)-1]
+	fmt.Printf("Throughput: %d requests, %s in %s\n", total.Count, ByteCountSI(total.Bytes), total.Elapsed.Round(time.Millisecond))
+}
+
+func roundLatency(d time.Duration) string {
+	return d.Round(100 * time.Microsecond).String()
+}
+
+// Report adds a case for each class and each propagation to the "metrics" suite of the run report
+func (m *MetricsCollector) Report() {
+	suite := report.GetSuite("metrics")
+	for _, s := range m.Summary() {
+		c := suite.Add(s.Name(), report.StatusPassed, s.Elapsed, "")
+		c.Set("count", s.Count).Set("errors", s.Errors).Set("notFound", s.NotFound).Set("bytes", s.Bytes)
+		c.Set("p50Ms", durationMs(s.P50)).Set("p90Ms", durationMs(s.P90)).Set("p95Ms", durationMs(s.P95))
+		c.Set("p99Ms", durationMs(s.P99)).Set("maxMs", durationMs(s.Max))
+		c.Set("requestsPerSecond", fmt.Sprintf("%.2f", s.RequestsPerSecond())).Set("bytesPerSecond", fmt.Sprintf("%.0f", s.BytesPerSecond()))
+	}
+	for _, p := range m.Propagations() {
+		if p.Completed {
+			suite.Add("propagation: "+p.Name, report.StatusPassed, p.Elapsed, "")
+		} else {
+			suite.Add("propagation: "+p.Name, report.StatusFailed, p.Elapsed, "timed out")
+		}
+	}
+}
+
+func durationMs(d time.Duration) string {
+	return fmt.Sprintf("%.3f", float64(d)/float64(time.Millisecond))
+}
+
+// METRICS_SCHEMA_VERSION is the version of the MetricsSnapshot json. It is only increased by incompatible
+// changes, so the baselines committed to the dataset repo can still be read.
+const METRICS_SCHEMA_VERSION = 1
+
+// MetricsSnapshot is the json of the request metrics of a run, used as the baseline of later runs
+type MetricsSnapshot struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	Command       string         `json:"command"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	Classes       []ClassMetrics `json:"classes"`
+}
+
+// ClassMetrics is the json of ClassStats, the latencies are in milliseconds
+type ClassMetrics struct {
+	Phase             string  `json:"phase"`
+	Method            string  `json:"method"`
+	StoreType         string  `json:"storeType"`
+	PathClass         string  `json:"pathClass"`
+	Count             int     `json:"count"`
+	Errors            int     `json:"errors"`
+	NotFound          int     `json:"notFound"`
+	ErrorRate         float64 `json:"errorRate"`
+	Bytes             int64   `json:"bytes"`
+	P50Ms             float64 `json:"p50Ms"`
+	P90Ms             float64 `json:"p90Ms"`
+	P95Ms             float64 `json:"p95Ms"`
+	P99Ms             float64 `json:"p99Ms"`
+	MaxMs             float64 `json:"maxMs"`
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	BytesPerSecond    float64 `json:"bytesPerSecond"`
+}
+
+// Key identifies the class across snapshots, like ClassStats.Name
+func (c ClassMetrics) Key() string {
+	return className(c.Phase, c.Method, c.StoreType, c.PathClass)
+}
+
+// Snapshot converts the summary to the json schema
+func (m *MetricsCollector) Snapshot(command string) MetricsSnapshot {
+	snapshot := MetricsSnapshot{SchemaVersion: METRICS_SCHEMA_VERSION, Command: command, CreatedAt: time.Now().UTC(), Classes: []ClassMetrics{}}
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	for _, s := range m.Summary() {
+		snapshot.Classes = append(snapshot.Classes, ClassMetrics{
+			Phase: s.Phase, Method: s.Method, StoreType: s.StoreType, PathClass: s.PathClass,
+			Count: s.Count, Errors: s.Errors, NotFound: s.NotFound, ErrorRate: s.ErrorRate(), Bytes: s.Bytes,
+			P50Ms: ms(s.P50), P90Ms: ms(s.P90), P95Ms: ms(s.P95), P99Ms: ms(s.P99), MaxMs: ms(s.Max),
+			RequestsPerSecond: s.RequestsPerSecond(), BytesPerSecond: s.BytesPerSecond(),
+		})
+	}
+	return snapshot
+}
+
+// WriteMetricsSnapshot writes the snapshot as indented json
+func WriteMetricsSnapshot(snapshot MetricsSnapshot, file string) error {
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(b, '\n'), 0644)
+}
+
+// LoadMetricsSnapshot reads a snapshot written by WriteMetricsSnapshot
+func LoadMetricsSnapshot(file string) (MetricsSnapshot, error) {
+	snapshot := MetricsSnapshot{}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return snapshot, err
+	}
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("invalid metrics json %s, %s", file, err)
+	}
+	if snapshot.SchemaVersion != METRICS_SCHEMA_VERSION {
+		return snapshot, fmt.Errorf("unsupported schema version %d of metrics json %s, expected %d", snapshot.SchemaVersion, file, METRICS_SCHEMA_VERSION)
+	}
+	return snapshot, nil
+}
+
+// record measures the request sent by IndyClient. The sample of a response is recorded when its body is read to
+// the end or closed, so the latency and bytes include the content.
+func (m *MetricsCollector) record(req *http.Request, start time.Time, resp *http.Response, err error) *http.Response {
+	storeType, pathClass := ClassifyRequest(req.URL.String())
+	sample := RequestSample{Phase: m.currentPhase(), Method: req.Method, StoreType: storeType, PathClass: pathClass, Start: start}
+	if err != nil || resp == nil {
+		sample.Latency, sample.Failed = time.Since(start), true
+		m.Record(sample)
+		return resp
+	}
+	sample.StatusCode, sample.Failed = resp.StatusCode, resp.StatusCode >= 400 && resp.StatusCode != StatusNotFound
+	if req.ContentLength > 0 {
+		sample.Bytes = req.ContentLength
+	}
+	resp.Body = &meteredBody{ReadCloser: resp.Body, metrics: m, sample: sample}
+	return resp
+}
+
+type meteredBody struct {
+	io.ReadCloser
+	metrics *MetricsCollector
+	sample  RequestSample
+	once    sync.Once
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.sample.Bytes += int64(n)
+	if err != nil {
+		b.done(err != io.EOF)
+	}
+	return n, err
+}
+
+func (b *meteredBody) Close() error {
+	b.done(false)
+	return b.ReadCloser.Close()
+}
+
+func (b *meteredBody) done(failed bool) {
+	b.once.Do(func() {
+		b.sample.Latency = time.Since(b.sample.Start)
+		b.sample.Failed = b.sample.Failed || failed
+		b.metrics.Record(b.sample)
+	})
+}
@@ -0,0 +1,198 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables of the live metrics, the command flags take precedence over them
+const (
+	ENVAR_METRICS_LISTEN = "INDY_METRICS_LISTEN"
+	ENVAR_METRICS_PUSH   = "INDY_METRICS_PUSH"
+)
+
+// PROMETHEUS_CONTENT_TYPE is the content type of the prometheus text exposition format
+const PROMETHEUS_CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// LatencyBuckets are the upper bounds in seconds of the latency histogram
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// promSeries are the prometheus series of a class, counted when the requests are recorded so a scrape does not
+// depend on the number of requests
+type promSeries struct {
+	labels   string
+	count    int64
+	bytes    int64
+	sum      float64
+	buckets  []int64
+	statuses map[string]int64
+}
+
+func newPromSeries(s RequestSample) *promSeries {
+	labels := fmt.Sprintf(`phase="%s",method="%s",store_type="%s",path_class="%s"`,
+		escapeLabel(s.Phase), escapeLabel(s.Method), escapeLabel(s.StoreType), escapeLabel(s.PathClass))
+	return &promSeries{labels: labels, buckets: make([]int64, len(LatencyBuckets)), statuses: make(map[string]int64)}
+}
+
+func (p *promSeries) observe(s RequestSample) {
+	status := "error"
+	if s.StatusCode > 0 {
+		status = strconv.Itoa(s.StatusCode)
+	}
+	p.statuses[status]++
+	p.count++
+	p.bytes += s.Bytes
+	p.sum += s.Latency.Seconds()
+	for i, le := range LatencyBuckets {
+		if s.Latency.Seconds() <= le {
+			p.buckets[i]++
+		}
+	}
+}
+
+func (p *promSeries) copy() *promSeries {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	c.buckets = append([]int64{}, p.buckets...)
+	c.statuses = make(map[string]int64, len(p.statuses))
+	for status, count := range p.statuses {
+		c.statuses[status] = count
+	}
+	return &c
+}
+
+// WritePrometheus writes the metrics of all requests so far in the prometheus text exposition format:
+// indy_test_requests_total by phase, method, store type, path class and status, indy_test_request_bytes_total
+// and the indy_test_request_duration_seconds histogram by phase, method, store type and path class, and the
+// indy_test_propagation_seconds of each propagation so far.
+func (m *MetricsCollector) WritePrometheus(w io.Writer) error {
+	var series []*promSeries
+	for _, c := range m.classSnapshot(false) {
+		series = append(series, c.prom)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].labels < series[j].labels })
+
+	var b bytes.Buffer
+	b.WriteString("# HELP indy_test_requests_total Requests sent to indy.\n# TYPE indy_test_requests_total counter\n")
+	for _, s := range series {
+		statuses := make([]string, 0, len(s.statuses))
+		for status := range s.statuses {
+			statuses = append(statuses, status)
+		}
+		sort.Strings(statuses)
+		for _, status := range statuses {
+			fmt.Fprintf(&b, "indy_test_requests_total{%s,status=\"%s\"} %d\n", s.labels, status, s.statuses[status])
+		}
+	}
+	b.WriteString("# HELP indy_test_request_bytes_total Bytes sent and received by the requests.\n# TYPE indy_test_request_bytes_total counter\n")
+	for _, s := range series {
+		fmt.Fprintf(&b, "indy_test_request_bytes_total{%s} %d\n", s.labels, s.bytes)
+	}
+	b.WriteString("# HELP indy_test_request_duration_seconds Latency of the requests including the content transfer.\n# TYPE indy_test_request_duration_seconds histogram\n")
+	for _, s := range series {
+		for i, le := range LatencyBuckets {
+			fmt.Fprintf(&b, "indy_test_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", s.labels, strconv.FormatFloat(le, 'g', -1, 64), s.buckets[i])
+		}
+		fmt.Fprintf(&b, "indy_test_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", s.labels, s.count)
+		fmt.Fprintf(&b, "indy_test_request_duration_seconds_sum{%s} %s\n", s.labels, strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "indy_test_request_duration_seconds_count{%s} %d\n", s.labels, s.count)
+	}
+	if propagations := m.Propagations(); len(propagations) > 0 {
+		b.WriteString("# HELP indy_test_propagation_seconds Time indy took to handle an event, e.g., to merge a promoted version into the metadata.\n# TYPE indy_test_propagation_seconds gauge\n")
+		// a series can only be written once, the latest propagation of the same name wins
+		var order []string
+		latest := make(map[string]float64)
+		for _, p := range propagations {
+			labels := fmt.Sprintf(`name="%s",completed="%t"`, escapeLabel(p.Name), p.Completed)
+			if _, ok := latest[labels]; !ok {
+				order = append(order, labels)
+			}
+			latest[labels] = p.Elapsed.Seconds()
+		}
+		for _, labels := range order {
+			fmt.Fprintf(&b, "indy_test_propagation_seconds{%s} %s\n", labels, strconv.FormatFloat(latest[labels], 'g', -1, 64))
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// ServeMetrics exposes the metrics of m on http://addr/metrics, e.g., ":9100", until the server is closed. The
+// Addr of the returned server is the bound address, e.g., for the port 0.
+func ServeMetrics(addr string, m *MetricsCollector) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %s for metrics, %s", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", PROMETHEUS_CONTENT_TYPE)
+		m.WritePrometheus(w)
+	})
+	server := &http.Server{Addr: listener.Addr().String(), Handler: mux}
+	go server.Serve(listener)
+	fmt.Printf("Metrics are exposed on http://%s/metrics\n", server.Addr)
+	return server, nil
+}
+
+// PushMetrics pushes the metrics of m to a pushgateway, replacing the metrics of the job pushed before. pushURL
+// is the pushgateway base url, e.g., http://pushgateway:9091, or a full push url with /metrics/job/.
+func PushMetrics(pushURL, job string, m *MetricsCollector) error {
+	URL := strings.TrimRight(pushURL, "/")
+	if !strings.Contains(URL, "/metrics/job/") {
+		URL = fmt.Sprintf("%s/metrics/job/%s", URL, job)
+	}
+	var body bytes.Buffer
+	if err := m.WritePrometheus(&body); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, MethodPut, URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", PROMETHEUS_CONTENT_TYPE)
+	// the push is not a request to measure
+	resp, err := DefaultIndyClient().send(req)
+	if err != nil {
+		return fmt.Errorf("cannot push metrics to %s, %s", URL, err)
+	}
+	defer closeBody(resp)
+	if resp.StatusCode >= 400 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("cannot push metrics to %s, status: %d, %s", URL, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
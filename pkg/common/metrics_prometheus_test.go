@@ -0,0 +1,130 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	Convey("Metrics should be written in the prometheus text format", t, func() {
+		m := NewMetricsCollector()
+		start := time.Now()
+		m.Record(RequestSample{Phase: "downloads", Method: MethodGet, StoreType: STORE_TYPE_GROUP, PathClass: PATH_CLASS_POM,
+			StatusCode: StatusOK, Bytes: 100, Start: start, Latency: 20 * time.Millisecond})
+		m.Record(RequestSample{Phase: "downloads", Method: MethodGet, StoreType: STORE_TYPE_GROUP, PathClass: PATH_CLASS_POM,
+			StatusCode: StatusOK, Bytes: 50, Start: start, Latency: 2 * time.Second})
+		m.Record(RequestSample{Phase: "downloads", Method: MethodGet, StoreType: STORE_TYPE_GROUP, PathClass: PATH_CLASS_POM,
+			Start: start, Latency: time.Second, Failed: true})
+
+		var b bytes.Buffer
+		So(m.WritePrometheus(&b), ShouldBeNil)
+		text := b.String()
+		labels := `phase="downloads",method="GET",store_type="group",path_class="pom"`
+		So(text, ShouldContainSubstring, "# TYPE indy_test_requests_total counter\n")
+		So(text, ShouldContainSubstring, "indy_test_requests_total{"+labels+`,status="200"} 2`+"\n")
+		So(text, ShouldContainSubstring, "indy_test_requests_total{"+labels+`,status="error"} 1`+"\n")
+		So(text, ShouldContainSubstring, "indy_test_request_bytes_total{"+labels+"} 150\n")
+		So(text, ShouldContainSubstring, "# TYPE indy_test_request_duration_seconds histogram\n")
+		So(text, ShouldContainSubstring, "indy_test_request_duration_seconds_bucket{"+labels+`,le="0.025"} 1`+"\n")
+		So(text, ShouldContainSubstring, "indy_test_request_duration_seconds_bucket{"+labels+`,le="1"} 2`+"\n")
+		So(text, ShouldContainSubstring, "indy_test_request_duration_seconds_bucket{"+labels+`,le="+Inf"} 3`+"\n")
+		So(text, ShouldContainSubstring, "indy_test_request_duration_seconds_sum{"+labels+"} 3.02\n")
+		So(text, ShouldContainSubstring, "indy_test_request_duration_seconds_count{"+labels+"} 3\n")
+
+		// the series go on counting after a scrape
+		m.Record(RequestSample{Phase: "downloads", Method: MethodGet, StoreType: STORE_TYPE_GROUP, PathClass: PATH_CLASS_POM,
+			StatusCode: StatusOK, Bytes: 10, Start: start, Latency: 20 * time.Millisecond})
+		b.Reset()
+		So(m.WritePrometheus(&b), ShouldBeNil)
+		So(b.String(), ShouldContainSubstring, "indy_test_requests_total{"+labels+`,status="200"} 3`+"\n")
+		So(b.String(), ShouldContainSubstring, "indy_test_request_bytes_total{"+labels+"} 160\n")
+		So(b.String(), ShouldContainSubstring, "indy_test_request_duration_seconds_bucket{"+labels+`,le="0.025"} 2`+"\n")
+	})
+	Convey("The latest propagation of each name should be written", t, func() {
+		m := NewMetricsCollector()
+		m.RecordPropagation("metadata merged", 3*time.Second, true)
+		m.RecordPropagation("metadata merged", 1500*time.Millisecond, true)
+		m.RecordPropagation("content removed", time.Minute, false)
+
+		var b bytes.Buffer
+		So(m.WritePrometheus(&b), ShouldBeNil)
+		text := b.String()
+		So(text, ShouldContainSubstring, "# TYPE indy_test_propagation_seconds gauge\n")
+		So(text, ShouldContainSubstring, `indy_test_propagation_seconds{name="metadata merged",completed="true"} 1.5`+"\n")
+		So(text, ShouldContainSubstring, `indy_test_propagation_seconds{name="content removed",completed="false"} 60`+"\n")
+		So(strings.Count(text, `name="metadata merged"`), ShouldEqual, 1)
+	})
+	Convey("Label values should be escaped", t, func() {
+		So(escapeLabel(`a"b\c`+"\n"), ShouldEqual, `a\"b\\c\n`)
+	})
+}
+
+func TestServeAndPushMetrics(t *testing.T) {
+	m := NewMetricsCollector()
+	m.Record(RequestSample{Phase: "uploads", Method: MethodPut, StoreType: STORE_TYPE_HOSTED, PathClass: PATH_CLASS_ARTIFACT,
+		StatusCode: StatusCreated, Bytes: 10, Start: time.Now(), Latency: time.Millisecond})
+
+	Convey("Metrics should be scraped from the listen address", t, func() {
+		server, err := ServeMetrics("127.0.0.1:0", m)
+		So(err, ShouldBeNil)
+		defer server.Close()
+		resp, err := http.Get("http://" + server.Addr + "/metrics")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, StatusOK)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, PROMETHEUS_CONTENT_TYPE)
+		text, _ := ioutil.ReadAll(resp.Body)
+		So(string(text), ShouldContainSubstring, `indy_test_requests_total{phase="uploads",method="PUT",store_type="hosted",path_class="artifact",status="201"} 1`)
+	})
+
+	Convey("Metrics should be pushed to a pushgateway", t, func() {
+		var method, path, body string
+		gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, path = r.Method, r.URL.Path
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			if strings.HasSuffix(path, "/broken") {
+				w.WriteHeader(StatusBadRequest)
+				w.Write([]byte("text format parsing error"))
+				return
+			}
+			w.WriteHeader(StatusOK)
+		}))
+		defer gateway.Close()
+
+		So(PushMetrics(gateway.URL+"/", "indy-test-build", m), ShouldBeNil)
+		So(method, ShouldEqual, MethodPut)
+		So(path, ShouldEqual, "/metrics/job/indy-test-build")
+		So(body, ShouldContainSubstring, "indy_test_request_bytes_total{")
+
+		So(PushMetrics(gateway.URL+"/metrics/job/custom/instance/ci", "indy-test-build", m), ShouldBeNil)
+		So(path, ShouldEqual, "/metrics/job/custom/instance/ci")
+
+		err := PushMetrics(gateway.URL+"/metrics/job/broken", "indy-test-build", m)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "status: 400, text format parsing error")
+	})
+}
@@ -0,0 +1,110 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/indymock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClassifyRequest(t *testing.T) {
+	Convey("Requests should be classified by store type and path", t, func() {
+		for URL, expected := range map[string][]string{
+			"http://indy/api/folo/track/build-1/maven/group/build-1/org/foo/1.0/foo-1.0.pom": {STORE_TYPE_GROUP, PATH_CLASS_POM},
+			"http://indy/api/content/maven/hosted/build-1/org/foo/1.0/foo-1.0.jar":           {STORE_TYPE_HOSTED, PATH_CLASS_ARTIFACT},
+			"http://indy/api/content/maven/group/public/org/foo/maven-metadata.xml":          {STORE_TYPE_GROUP, PATH_CLASS_MAVEN_METADATA},
+			"http://indy/api/content/maven/remote/central/org/foo/1.0/foo-1.0.jar.sha1":      {STORE_TYPE_REMOTE, PATH_CLASS_CHECKSUM},
+			"http://indy/api/content/npm/group/build-1/@redhat%2fopossum":                    {STORE_TYPE_GROUP, PATH_CLASS_NPM_METADATA},
+			"http://indy/api/content/npm/group/build-1/lodash/-/lodash-4.17.21.tgz":          {STORE_TYPE_GROUP, PATH_CLASS_ARTIFACT},
+			"http://indy/api/admin/stores/maven/hosted/build-1":                              {STORE_TYPE_NONE, PATH_CLASS_API},
+			"http://indy/api/folo/admin/build-1/record":                                      {STORE_TYPE_NONE, PATH_CLASS_API},
+		} {
+			storeType, pathClass := ClassifyRequest(URL)
+			So([]string{storeType, pathClass}, ShouldResemble, expected)
+		}
+	})
+}
+
+func TestMetricsCollector(t *testing.T) {
+	Convey("MetricsCollector", t, func() {
+		Convey("Percentiles, errors and throughput should be summarized per class", func() {
+			m := NewMetricsCollector()
+			start := time.Now()
+			for i := 1; i <= 100; i++ {
+				m.Record(RequestSample{Phase: "downloads", Method: MethodGet, StoreType: STORE_TYPE_GROUP, PathClass: PATH_CLASS_POM,
+					StatusCode: StatusOK, Bytes: 10, Start: start, Latency: time.Duration(i) * time.Millisecond})
+			}
+			m.Record(RequestSample{Phase: "uploads", Method: MethodPut, StoreType: STORE_TYPE_HOSTED, PathClass: PATH_CLASS_ARTIFACT,
+				StatusCode: StatusInternalServerError, Start: start, Latency: time.Second, Failed: true})
+
+			stats := m.Summary()
+			So(len(stats), ShouldEqual, 3)
+			pom := stats[0]
+			So(pom.Name(), ShouldEqual, "downloads: GET group pom")
+			So(pom.Count, ShouldEqual, 100)
+			So(pom.P50, ShouldEqual, 50*time.Millisecond)
+			So(pom.P90, ShouldEqual, 90*time.Millisecond)
+			So(pom.P99, ShouldEqual, 99*time.Millisecond)
+			So(pom.Max, ShouldEqual, 100*time.Millisecond)
+			So(pom.Elapsed, ShouldEqual, 100*time.Millisecond)
+			So(pom.RequestsPerSecond(), ShouldAlmostEqual, 1000, 0.001)
+			So(pom.BytesPerSecond(), ShouldAlmostEqual, 10000, 0.001)
+			So(stats[1].ErrorRate(), ShouldEqual, 1)
+			total := stats[2]
+			So(total.Method, ShouldEqual, "*")
+			So(total.Count, ShouldEqual, 101)
+			So(total.Errors, ShouldEqual, 1)
+			So(total.Max, ShouldEqual, time.Second)
+		})
+		Convey("Requests of IndyClient should be recorded with their content", func() {
+			mock, server := indymock.Start()
+			defer server.Close()
+			data := []byte("<project><version>2.0</version></project>")
+			mock.PutContent("maven:remote:central", "/org/bar/bar/2.0/bar-2.0.pom", data)
+			DefaultMetrics().Reset()
+			defer DefaultMetrics().Reset()
+			DefaultMetrics().SetPhase("test")
+			defer DefaultMetrics().SetPhase("")
+
+			_, ok := DownloadStream(server.URL + "/api/content/maven/remote/central/org/bar/bar/2.0/bar-2.0.pom")
+			So(ok, ShouldBeTrue)
+			DownloadStream(server.URL + "/api/content/maven/remote/central/org/missing.jar")
+			stats := DefaultMetrics().Summary()
+			So(len(stats), ShouldEqual, 3)
+			// a 404 is counted, but not as an error
+			So(stats[0].Name(), ShouldEqual, "test: GET remote artifact")
+			So(stats[0].Errors, ShouldEqual, 0)
+			So(stats[0].NotFound, ShouldEqual, 1)
+			So(stats[1].Name(), ShouldEqual, "test: GET remote pom")
+			So(stats[1].Count, ShouldEqual, 1)
+			So(stats[1].Bytes, ShouldEqual, len(data))
+			So(stats[1].Errors, ShouldEqual, 0)
+		})
+		Convey("A pinned phase should not be overwritten by SetPhase", func() {
+			m := NewMetricsCollector()
+			m.PinPhase("group")
+			m.SetPhase("downloads")
+			So(m.currentPhase(), ShouldEqual, "group")
+			m.UnpinPhase()
+			m.SetPhase("uploads")
+			So(m.currentPhase(), ShouldEqual, "uploads")
+		})
+	})
+}
@@ -0,0 +1,103 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const NPM_TARBALL_SEPARATOR = "/-/"
+
+// Packument is the npm package metadata indy serves for a package, e.g., GET /api/content/npm/group/DA/@redhat%2fopossum
+type Packument struct {
+	Name     string                      `json:"name"`
+	DistTags map[string]string           `json:"dist-tags"`
+	Versions map[string]PackumentVersion `json:"versions"`
+}
+
+// PackumentVersion is a version of a packument
+type PackumentVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Dist    struct {
+		Tarball   string `json:"tarball"`
+		Shasum    string `json:"shasum,omitempty"`
+		Integrity string `json:"integrity,omitempty"`
+	} `json:"dist"`
+}
+
+// ParsePackument decodes the package metadata, which should have a name
+func ParsePackument(b []byte) (Packument, error) {
+	p := Packument{}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, fmt.Errorf("invalid npm package metadata, %s", err)
+	}
+	if p.Name == "" {
+		return p, fmt.Errorf("invalid npm package metadata, no name")
+	}
+	return p, nil
+}
+
+// CheckVersion checks the version is in the versions, with the tarball url under tarballPrefix if it is not
+// empty, and that no dist-tag points to a missing version. If exist is false the version should be gone, from
+// the versions and from the dist-tags.
+func (p Packument) CheckVersion(version, tarballPrefix string, exist bool) error {
+	v, found := p.Versions[version]
+	for tag, tagged := range p.DistTags {
+		if _, ok := p.Versions[tagged]; !ok {
+			return fmt.Errorf("%s: dist-tag %s points to the missing version %s", p.Name, tag, tagged)
+		}
+	}
+	if !exist {
+		if found {
+			return fmt.Errorf("%s: version %s still exists", p.Name, version)
+		}
+		return nil
+	}
+	if !found {
+		return fmt.Errorf("%s: version %s not found", p.Name, version)
+	}
+	if tarballPrefix != "" && !strings.HasPrefix(v.Dist.Tarball, tarballPrefix) {
+		return fmt.Errorf("%s: tarball of version %s is %s, not under %s", p.Name, version, v.Dist.Tarball, tarballPrefix)
+	}
+	return nil
+}
+
+// NpmMetadataPath is the path of the metadata of the package in an indy npm repo, a scoped package "@scope/name"
+// is encoded as "@scope%2fname" like the npm clients request it
+func NpmMetadataPath(name string) string {
+	return strings.Replace(strings.TrimPrefix(name, "/"), "/", "%2f", 1)
+}
+
+// NpmPackageOfTarball gets the package name and version of a tarball path, e.g., "/@redhat/opossum/-/opossum-6.2.1.tgz"
+// is "@redhat/opossum" 6.2.1
+func NpmPackageOfTarball(tarballPath string) (string, string, bool) {
+	i := strings.Index(tarballPath, NPM_TARBALL_SEPARATOR)
+	if i < 0 || !strings.HasSuffix(tarballPath, ".tgz") {
+		return "", "", false
+	}
+	name := strings.TrimPrefix(tarballPath[:i], "/")
+	file := strings.TrimSuffix(tarballPath[i+len(NPM_TARBALL_SEPARATOR):], ".tgz")
+	prefix := path.Base(name) + "-"
+	if name == "" || !strings.HasPrefix(file, prefix) || len(file) == len(prefix) {
+		return "", "", false
+	}
+	return name, file[len(prefix):], true
+}
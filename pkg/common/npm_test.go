@@ -0,0 +1,61 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNpm(t *testing.T) {
+	Convey("Npm tarball paths", t, func() {
+		name, version, ok := NpmPackageOfTarball("/@redhat/opossum/-/opossum-6.2.1-94465.tgz")
+		So(ok, ShouldBeTrue)
+		So(name, ShouldEqual, "@redhat/opossum")
+		So(version, ShouldEqual, "6.2.1-94465")
+		name, version, ok = NpmPackageOfTarball("left-pad/-/left-pad-1.3.0.tgz")
+		So(ok, ShouldBeTrue)
+		So(name+"@"+version, ShouldEqual, "left-pad@1.3.0")
+		_, _, ok = NpmPackageOfTarball("/@redhat/opossum")
+		So(ok, ShouldBeFalse)
+		_, _, ok = NpmPackageOfTarball("/foo/-/bar-1.0.tgz")
+		So(ok, ShouldBeFalse)
+
+		So(NpmMetadataPath("/@redhat/opossum"), ShouldEqual, "@redhat%2fopossum")
+		So(NpmMetadataPath("left-pad"), ShouldEqual, "left-pad")
+	})
+	Convey("Packument versions", t, func() {
+		p, err := ParsePackument([]byte(`{"name": "@redhat/opossum", "dist-tags": {"latest": "6.2.1-94465"}, "versions": {
+			"6.2.1": {"dist": {"tarball": "http://indy/api/content/npm/group/DA/@redhat/opossum/-/opossum-6.2.1.tgz"}},
+			"6.2.1-94465": {"dist": {"tarball": "http://indy/api/content/npm/group/builds/@redhat/opossum/-/opossum-6.2.1-94465.tgz"}}}}`))
+		So(err, ShouldBeNil)
+		So(p.CheckVersion("6.2.1-94465", "http://indy/api/content/npm/group/builds/", true), ShouldBeNil)
+		So(p.CheckVersion("6.2.1", "http://indy/api/content/npm/group/builds/", true).Error(), ShouldContainSubstring, "not under")
+		So(p.CheckVersion("6.2.2", "", true).Error(), ShouldContainSubstring, "not found")
+		So(p.CheckVersion("6.2.1-94465", "", false).Error(), ShouldContainSubstring, "still exists")
+		So(p.CheckVersion("6.2.2", "", false), ShouldBeNil)
+
+		delete(p.Versions, "6.2.1-94465")
+		So(p.CheckVersion("6.2.1-94465", "", false).Error(), ShouldContainSubstring, "dist-tag latest points to the missing version")
+
+		_, err = ParsePackument([]byte(`<metadata/>`))
+		So(err, ShouldNotBeNil)
+		_, err = ParsePackument([]byte(`{}`))
+		So(err, ShouldNotBeNil)
+	})
+}
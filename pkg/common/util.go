@@ -17,12 +17,8 @@
 package common
 
 import (
-	"crypto/md5"
 	"fmt"
-	"io"
-	"log"
 	"math/rand"
-	"os"
 	"regexp"
 	"strings"
 	"time"
@@ -86,27 +82,3 @@ func IsMetadata(path, storeKey string) bool {
 func IsRegularFile(fileLoc string) bool {
 	return regularFileRegexp.MatchString(fileLoc)
 }
-
-func Md5Check(fileLoc, md5str string) bool {
-	// Skip non-regular (i.e, metadata) files
-	if IsRegularFile(fileLoc) {
-		f, err := os.Open(fileLoc)
-		if err != nil {
-			log.Fatal(err)
-			return false
-		}
-		defer f.Close()
-		h := md5.New()
-		if _, err := io.Copy(h, f); err != nil {
-			log.Fatal(err)
-			return false
-		}
-		calculated := fmt.Sprintf("%x", h.Sum(nil))
-		match := strings.EqualFold(md5str, calculated)
-		if !match {
-			log.Fatal(fmt.Sprintf("Md5 not match, expected: %s, calculated: %s", md5str, calculated))
-			return false
-		}
-	}
-	return true
-}
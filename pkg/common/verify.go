@@ -0,0 +1,276 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The checksum algorithms, which are also the suffixes of the checksum files indy serves next to an artifact
+const (
+	CHECKSUM_MD5    = "md5"
+	CHECKSUM_SHA1   = "sha1"
+	CHECKSUM_SHA256 = "sha256"
+)
+
+// ALL_CHECKSUMS are the algorithms in the order they are checked
+var ALL_CHECKSUMS = []string{CHECKSUM_MD5, CHECKSUM_SHA1, CHECKSUM_SHA256}
+
+// Where the expected checksum of a Mismatch comes from
+const (
+	SOURCE_RECORD  = "record"
+	SOURCE_SIDECAR = "sidecar"
+)
+
+var foloTrackPathRegexp = regexp.MustCompile(`/api/folo/track/[^/]+/`)
+
+// Checksums of a file, an empty one is unknown
+type Checksums struct {
+	Md5    string
+	Sha1   string
+	Sha256 string
+}
+
+// EntryChecksums are the checksums of a folo record entry
+func EntryChecksums(e TrackedContentEntry) Checksums {
+	return Checksums{Md5: e.Md5, Sha1: e.Sha1, Sha256: e.Sha256}
+}
+
+// Get returns the checksum of the algorithm
+func (c Checksums) Get(algorithm string) string {
+	switch algorithm {
+	case CHECKSUM_MD5:
+		return c.Md5
+	case CHECKSUM_SHA1:
+		return c.Sha1
+	case CHECKSUM_SHA256:
+		return c.Sha256
+	}
+	return ""
+}
+
+// FileChecksums calculates all checksums of the file in one read
+func FileChecksums(fileLoc string) (Checksums, error) {
+	f, err := os.Open(fileLoc)
+	if err != nil {
+		return Checksums{}, err
+	}
+	defer f.Close()
+	w := NewChecksumWriter()
+	if _, err := io.Copy(w, f); err != nil {
+		return Checksums{}, err
+	}
+	return w.Checksums(), nil
+}
+
+// ChecksumWriter calculates all checksums and the size of what is written to it, so a download can be verified
+// without storing it
+type ChecksumWriter struct {
+	hashes []hash.Hash
+	size   int64
+}
+
+// NewChecksumWriter creates a writer for the algorithms of ALL_CHECKSUMS
+func NewChecksumWriter() *ChecksumWriter {
+	return &ChecksumWriter{hashes: []hash.Hash{md5.New(), sha1.New(), sha256.New()}}
+}
+
+func (w *ChecksumWriter) Write(p []byte) (int, error) {
+	for _, h := range w.hashes {
+		h.Write(p)
+	}
+	w.size += int64(len(p))
+	return len(p), nil
+}
+
+// Size is the number of bytes written
+func (w *ChecksumWriter) Size() int64 {
+	return w.size
+}
+
+// Checksums of the bytes written
+func (w *ChecksumWriter) Checksums() Checksums {
+	return Checksums{
+		Md5:    hex.EncodeToString(w.hashes[0].Sum(nil)),
+		Sha1:   hex.EncodeToString(w.hashes[1].Sum(nil)),
+		Sha256: hex.EncodeToString(w.hashes[2].Sum(nil)),
+	}
+}
+
+// Mismatch is a checksum of an artifact which differs from the expected one
+type Mismatch struct {
+	Path      string `json:"path"`
+	Algorithm string `json:"algorithm"`
+	// Source is SOURCE_RECORD for the checksum in the folo record, SOURCE_SIDECAR for the checksum file served by indy
+	Source   string `json:"source"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s %s mismatch, expected: %s, calculated: %s", m.Source, m.Algorithm, m.Expected, m.Actual)
+}
+
+// ChecksumError is returned by a Verifier when some checksums of the artifact do not match
+type ChecksumError struct {
+	Path       string
+	Mismatches []Mismatch
+}
+
+func (e *ChecksumError) Error() string {
+	msgs := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		msgs[i] = m.String()
+	}
+	return fmt.Sprintf("checksum of %s not match: %s", e.Path, strings.Join(msgs, "; "))
+}
+
+// Verifier checks the downloaded file of an artifact. path is the artifact path the job handles, fileLoc is where
+// the file is downloaded, and URL is where it is downloaded from. A *ChecksumError is returned if the file is
+// corrupted, any other error means it cannot be checked. VerifyChecksums is the same check for a download which
+// is not stored, see DownloadStream.
+type Verifier interface {
+	Verify(path, fileLoc, URL string) error
+	VerifyChecksums(path string, actual Checksums, URL string) error
+}
+
+// ChecksumVerifier checks the file against the checksums of the folo record entry of the path, and against the
+// checksum files (.md5, .sha1, .sha256) served by indy next to the URL if Sidecars is set and the URL is not empty,
+// e.g., a download through the generic proxy has no indy url to get the checksum files from. The maven and npm
+// metadata files are not checked, indy regenerates them so the checksums in the record are outdated.
+type ChecksumVerifier struct {
+	// Entries are the folo record entries by path. A path without an entry is only checked by the sidecars.
+	Entries map[string]TrackedContentEntry
+	// Sidecars enables the check against the checksum files. A missing checksum file is ignored.
+	Sidecars bool
+	// Client gets the checksum files, DefaultIndyClient is used if it is nil
+	Client *IndyClient
+}
+
+// NewChecksumVerifier creates a verifier for the entries, usually the downloads or uploads of a folo record
+func NewChecksumVerifier(entries []TrackedContentEntry, sidecars bool) *ChecksumVerifier {
+	byPath := make(map[string]TrackedContentEntry, len(entries))
+	for _, e := range entries {
+		byPath[e.Path] = e
+	}
+	return &ChecksumVerifier{Entries: byPath, Sidecars: sidecars}
+}
+
+// Verify implements Verifier
+func (v *ChecksumVerifier) Verify(path, fileLoc, URL string) error {
+	if v.skip(path) {
+		return nil
+	}
+	actual, err := FileChecksums(fileLoc)
+	if err != nil {
+		return fmt.Errorf("cannot calculate checksums of %s, %s", fileLoc, err)
+	}
+	return v.VerifyChecksums(path, actual, URL)
+}
+
+// VerifyChecksums implements Verifier
+func (v *ChecksumVerifier) VerifyChecksums(path string, actual Checksums, URL string) error {
+	if v.skip(path) {
+		return nil
+	}
+	expected := EntryChecksums(v.Entries[path])
+	var mismatches []Mismatch
+	for _, algorithm := range ALL_CHECKSUMS {
+		if e := expected.Get(algorithm); e != "" && !strings.EqualFold(e, actual.Get(algorithm)) {
+			mismatches = append(mismatches, Mismatch{Path: path, Algorithm: algorithm, Source: SOURCE_RECORD, Expected: e, Actual: actual.Get(algorithm)})
+		}
+	}
+	if v.Sidecars && URL != "" {
+		for _, algorithm := range ALL_CHECKSUMS {
+			e, err := v.getSidecar(URL, algorithm)
+			if err != nil {
+				return err
+			}
+			if e != "" && !strings.EqualFold(e, actual.Get(algorithm)) {
+				mismatches = append(mismatches, Mismatch{Path: path, Algorithm: algorithm, Source: SOURCE_SIDECAR, Expected: e, Actual: actual.Get(algorithm)})
+			}
+		}
+	}
+	if len(mismatches) > 0 {
+		return &ChecksumError{Path: path, Mismatches: mismatches}
+	}
+	return nil
+}
+
+// skip is true for the metadata files, and the paths with nothing to check, e.g., the entries parsed from a log
+func (v *ChecksumVerifier) skip(path string) bool {
+	entry := v.Entries[path]
+	if IsMetadata(path, entry.StoreKey) {
+		return true
+	}
+	return EntryChecksums(entry) == (Checksums{}) && !v.Sidecars
+}
+
+// getSidecar gets the checksum file of the algorithm for the artifact URL, or "" if indy does not have it. A folo
+// url is turned into a content url, so the checksum files are not added to the folo record.
+func (v *ChecksumVerifier) getSidecar(URL, algorithm string) (string, error) {
+	sidecarURL := foloTrackPathRegexp.ReplaceAllString(URL, "/api/content/") + "." + algorithm
+	req, err := http.NewRequest(MethodGet, sidecarURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := doRequest(v.Client, nil, req)
+	if err != nil {
+		return "", fmt.Errorf("cannot get checksum file %s, %s", sidecarURL, err)
+	}
+	defer closeBody(resp)
+	if resp.StatusCode == StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("cannot get checksum file %s, status: %d", sidecarURL, resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("cannot read checksum file %s, %s", sidecarURL, err)
+	}
+	// the file may be like "<checksum>  <file name>"
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], nil
+}
+
+// Mismatches collects the checksum mismatches of the failed jobs
+func (rs JobResults) Mismatches() []Mismatch {
+	var mismatches []Mismatch
+	for _, r := range rs {
+		var checksumErr *ChecksumError
+		if errors.As(r.Err, &checksumErr) {
+			mismatches = append(mismatches, checksumErr.Mismatches...)
+		}
+	}
+	return mismatches
+}
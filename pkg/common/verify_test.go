@@ -0,0 +1,105 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/indymock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChecksumVerifier(t *testing.T) {
+	Convey("ChecksumVerifier", t, func() {
+		mock, server := indymock.Start()
+		defer server.Close()
+		data := []byte("<project><version>2.0</version></project>")
+		p := "/org/bar/bar/2.0/bar-2.0.pom"
+		fileLoc := filepath.Join(t.TempDir(), "bar-2.0.pom")
+		So(ioutil.WriteFile(fileLoc, data, 0644), ShouldBeNil)
+		mock.PutContent("maven:remote:central", p, data)
+		URL := server.URL + "/api/folo/track/build-1/maven/remote/central" + p
+		checksums, err := FileChecksums(fileLoc)
+		So(err, ShouldBeNil)
+		entry := TrackedContentEntry{Path: p, StoreKey: "maven:remote:central", Md5: checksums.Md5, Sha1: checksums.Sha1, Sha256: checksums.Sha256}
+
+		Convey("Matched checksums should pass", func() {
+			verifier := NewChecksumVerifier([]TrackedContentEntry{entry}, true)
+			So(verifier.Verify(p, fileLoc, URL), ShouldBeNil)
+			// the checksum files are got through the content api, not tracked by folo
+			_, _, found := mock.GetFoloRecord("build-1")
+			So(found, ShouldBeFalse)
+		})
+		Convey("All mismatches of the record and the sidecars should be returned", func() {
+			entry.Sha1 = "0000"
+			entry.Sha256 = ""
+			mock.PutContent("maven:remote:central", p+".md5", []byte("1111  bar-2.0.pom\n"))
+			verifier := NewChecksumVerifier([]TrackedContentEntry{entry}, true)
+			err := verifier.Verify(p, fileLoc, URL)
+			var checksumErr *ChecksumError
+			So(errors.As(err, &checksumErr), ShouldBeTrue)
+			So(checksumErr.Mismatches, ShouldResemble, []Mismatch{
+				{Path: p, Algorithm: CHECKSUM_SHA1, Source: SOURCE_RECORD, Expected: "0000", Actual: checksums.Sha1},
+				{Path: p, Algorithm: CHECKSUM_MD5, Source: SOURCE_SIDECAR, Expected: "1111", Actual: checksums.Md5},
+			})
+
+			results := JobResults{{Path: p}, {Path: p, Err: err}}
+			So(len(results.Mismatches()), ShouldEqual, 2)
+		})
+		Convey("The sidecars should not be checked without an indy url, e.g., for a generic proxy download", func() {
+			mock.PutContent("maven:remote:central", p+".md5", []byte("1111  bar-2.0.pom\n"))
+			verifier := NewChecksumVerifier([]TrackedContentEntry{entry}, true)
+			So(verifier.Verify(p, fileLoc, ""), ShouldBeNil)
+			So(verifier.Verify(p, fileLoc, URL), ShouldNotBeNil)
+		})
+		Convey("Missing sidecars and metadata should be skipped", func() {
+			verifier := NewChecksumVerifier(nil, true)
+			So(verifier.Verify("/org/foo/foo.jar", fileLoc, server.URL+"/api/content/maven/remote/central/org/foo/foo.jar"), ShouldBeNil)
+			metadata := TrackedContentEntry{Path: "/org/bar/bar/maven-metadata.xml", StoreKey: "maven:remote:central", Md5: "1111"}
+			verifier = NewChecksumVerifier([]TrackedContentEntry{metadata}, false)
+			So(verifier.Verify(metadata.Path, fileLoc, URL), ShouldBeNil)
+		})
+	})
+}
+
+func TestDownloadStream(t *testing.T) {
+	Convey("DownloadStream should verify a download without storing it", t, func() {
+		mock, server := indymock.Start()
+		defer server.Close()
+		data := []byte("<project><version>2.0</version></project>")
+		p := "/org/bar/bar/2.0/bar-2.0.pom"
+		mock.PutContent("maven:remote:central", p, data)
+		w := NewChecksumWriter()
+		w.Write(data)
+
+		downloaded, ok := DownloadStream(server.URL + "/api/content/maven/remote/central" + p)
+		So(ok, ShouldBeTrue)
+		So(downloaded.StatusCode, ShouldEqual, StatusOK)
+		So(downloaded.Size, ShouldEqual, len(data))
+		So(downloaded.Checksums, ShouldResemble, w.Checksums())
+		entry := TrackedContentEntry{Path: p, StoreKey: "maven:remote:central", Md5: w.Checksums().Md5}
+		verifier := NewChecksumVerifier([]TrackedContentEntry{entry}, true)
+		So(verifier.VerifyChecksums(p, downloaded.Checksums, server.URL+"/api/content/maven/remote/central"+p), ShouldBeNil)
+
+		downloaded, ok = DownloadStream(server.URL + "/api/content/maven/remote/central/org/missing.pom")
+		So(ok, ShouldBeFalse)
+		So(downloaded.StatusCode, ShouldEqual, StatusNotFound)
+	})
+}
@@ -0,0 +1,106 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Defaults of the waits for indy to handle an event, e.g., to merge the metadata of a promoted version
+const (
+	DEFAULT_WAIT_TIMEOUT  = 5 * time.Minute
+	DEFAULT_WAIT_INTERVAL = 2 * time.Second
+	// MIN_WAIT_INTERVAL is used by WaitUntil instead of an interval which is not positive
+	MIN_WAIT_INTERVAL = 100 * time.Millisecond
+)
+
+// WaitOptions are the max time to wait for a condition and the interval to check it
+type WaitOptions struct {
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+// Validate checks the timeout is not negative and the interval is positive, so the waits do not poll indy in a
+// tight loop
+func (o WaitOptions) Validate() error {
+	if o.Timeout < 0 {
+		return fmt.Errorf("waitTimeout should not be negative, got %s", o.Timeout)
+	}
+	if o.Interval <= 0 {
+		return fmt.Errorf("waitInterval should be positive, got %s", o.Interval)
+	}
+	return nil
+}
+
+// DEFAULT_WAIT are the wait options used when none are specified
+var DEFAULT_WAIT = WaitOptions{Timeout: DEFAULT_WAIT_TIMEOUT, Interval: DEFAULT_WAIT_INTERVAL}
+
+// WaitTimeoutError is returned by WaitUntil when the condition is not met in time
+type WaitTimeoutError struct {
+	Timeout  time.Duration
+	Attempts int
+}
+
+func (e *WaitTimeoutError) Error() string {
+	return fmt.Sprintf("condition not met in %s after %d attempts", e.Timeout, e.Attempts)
+}
+
+// WaitUntil checks the condition right away and then every interval until it is met, and returns the time it
+// took. It fails with a WaitTimeoutError after the timeout, or with the error of ctx when ctx is done. An interval
+// which is not positive is replaced by MIN_WAIT_INTERVAL.
+func WaitUntil(ctx context.Context, condition func() bool, timeout, interval time.Duration) (time.Duration, error) {
+	if interval <= 0 {
+		interval = MIN_WAIT_INTERVAL
+	}
+	start := time.Now()
+	deadline := start.Add(timeout)
+	for attempts := 1; ; attempts++ {
+		if condition() {
+			return time.Since(start), nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return time.Since(start), &WaitTimeoutError{Timeout: timeout, Attempts: attempts}
+		}
+		wait := interval
+		if remaining < wait {
+			// check once more right at the deadline
+			wait = remaining
+		}
+		select {
+		case <-ctx.Done():
+			return time.Since(start), ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// WaitForPropagation waits until indy has handled an event, e.g., the metadata of a group contains a promoted
+// version, and records the observed propagation time in the default metrics under the name
+func WaitForPropagation(name string, condition func() bool, options WaitOptions) bool {
+	fmt.Printf("Waiting for %s, at most %s...\n", name, options.Timeout)
+	elapsed, err := WaitUntil(context.Background(), condition, options.Timeout, options.Interval)
+	DefaultMetrics().RecordPropagation(name, elapsed, err == nil)
+	if err != nil {
+		fmt.Printf("Waiting for %s failed, %s\n", name, err)
+		return false
+	}
+	fmt.Printf("Waited for %s %s\n", name, elapsed.Round(time.Millisecond))
+	return true
+}
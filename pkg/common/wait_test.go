@@ -0,0 +1,105 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWaitUntil(t *testing.T) {
+	Convey("WaitUntil", t, func() {
+		Convey("Should return right away if the condition is met", func() {
+			elapsed, err := WaitUntil(context.Background(), func() bool { return true }, time.Second, time.Second)
+			So(err, ShouldBeNil)
+			So(elapsed, ShouldBeLessThan, 100*time.Millisecond)
+		})
+		Convey("Should poll until the condition is met", func() {
+			attempts := 0
+			elapsed, err := WaitUntil(context.Background(), func() bool {
+				attempts++
+				return attempts == 3
+			}, time.Second, 10*time.Millisecond)
+			So(err, ShouldBeNil)
+			So(attempts, ShouldEqual, 3)
+			So(elapsed, ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+		})
+		Convey("Should check once more at the deadline and time out", func() {
+			attempts := 0
+			elapsed, err := WaitUntil(context.Background(), func() bool {
+				attempts++
+				return false
+			}, 50*time.Millisecond, 30*time.Millisecond)
+			So(err, ShouldHaveSameTypeAs, &WaitTimeoutError{})
+			So(err.(*WaitTimeoutError).Attempts, ShouldEqual, 3)
+			So(attempts, ShouldEqual, 3)
+			So(elapsed, ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+		})
+		Convey("Should not poll in a tight loop if the interval is not positive", func() {
+			for _, interval := range []time.Duration{0, -time.Second} {
+				attempts := 0
+				_, err := WaitUntil(context.Background(), func() bool {
+					attempts++
+					return false
+				}, 3*MIN_WAIT_INTERVAL/2, interval)
+				So(err, ShouldHaveSameTypeAs, &WaitTimeoutError{})
+				So(attempts, ShouldEqual, 3)
+			}
+		})
+		Convey("Should stop when the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				cancel()
+			}()
+			elapsed, err := WaitUntil(ctx, func() bool { return false }, time.Minute, 5*time.Millisecond)
+			So(err, ShouldEqual, context.Canceled)
+			So(elapsed, ShouldBeLessThan, time.Second)
+		})
+	})
+}
+
+func TestWaitOptionsValidate(t *testing.T) {
+	Convey("WaitOptions should reject an interval which is not positive", t, func() {
+		So(DEFAULT_WAIT.Validate(), ShouldBeNil)
+		So(WaitOptions{Timeout: time.Minute}.Validate(), ShouldNotBeNil)
+		So(WaitOptions{Timeout: time.Minute, Interval: -time.Second}.Validate(), ShouldNotBeNil)
+		So(WaitOptions{Timeout: -time.Minute, Interval: time.Second}.Validate(), ShouldNotBeNil)
+	})
+}
+
+func TestWaitForPropagation(t *testing.T) {
+	Convey("The propagation time should be recorded in the default metrics", t, func() {
+		DefaultMetrics().Reset()
+		defer DefaultMetrics().Reset()
+
+		options := WaitOptions{Timeout: 30 * time.Millisecond, Interval: 10 * time.Millisecond}
+		So(WaitForPropagation("metadata merged", func() bool { return true }, options), ShouldBeTrue)
+		So(WaitForPropagation("content removed", func() bool { return false }, options), ShouldBeFalse)
+
+		propagations := DefaultMetrics().Propagations()
+		So(len(propagations), ShouldEqual, 2)
+		So(propagations[0].Name, ShouldEqual, "metadata merged")
+		So(propagations[0].Completed, ShouldBeTrue)
+		So(propagations[1].Name, ShouldEqual, "content removed")
+		So(propagations[1].Completed, ShouldBeFalse)
+		So(propagations[1].Elapsed, ShouldBeGreaterThanOrEqualTo, 30*time.Millisecond)
+	})
+}
@@ -0,0 +1,267 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The formats to write a DAG in. YAML and JSON write the build queue, DOT writes the graph for Graphviz.
+const (
+	FORMAT_YAML = "yaml"
+	FORMAT_JSON = "json"
+	FORMAT_DOT  = "dot"
+)
+
+// DAG is the dependency graph of the builds of a group build. An edge from a build to another means the first
+// depends on the second, so the second is built before.
+type DAG struct {
+	vertices map[string]bool
+	deps     map[string]map[string]bool
+}
+
+// NewDAG creates an empty graph
+func NewDAG() *DAG {
+	return &DAG{vertices: make(map[string]bool), deps: make(map[string]map[string]bool)}
+}
+
+// NewDAGFromDepGraph creates the graph of the dependency-graph.json of a group build, including the vertices
+// without any edge
+func NewDAGFromDepGraph(graph DepGraph) *DAG {
+	g := NewDAG()
+	for v := range graph.Vertices {
+		g.AddVertex(v)
+	}
+	for _, e := range graph.Edges {
+		g.AddEdge(e.Source, e.Target)
+	}
+	return g
+}
+
+// AddVertex adds a build, it is a no-op if the build exists
+func (g *DAG) AddVertex(v string) {
+	if !g.vertices[v] {
+		g.vertices[v] = true
+		g.deps[v] = make(map[string]bool)
+	}
+}
+
+// AddEdge adds the dependency of from on to, the builds are added if they do not exist
+func (g *DAG) AddEdge(from, to string) {
+	g.AddVertex(from)
+	g.AddVertex(to)
+	g.deps[from][to] = true
+}
+
+// Vertices returns the builds in sorted order
+func (g *DAG) Vertices() []string {
+	return sortedKeys(g.vertices)
+}
+
+// Dependencies returns the builds v depends on in sorted order
+func (g *DAG) Dependencies(v string) []string {
+	return sortedKeys(g.deps[v])
+}
+
+// CycleError is returned when the builds cannot be ordered. Each cycle is the sorted builds of a strongly
+// connected component, i.e., each of them depends on all the others through the component.
+type CycleError struct {
+	Cycles [][]string
+}
+
+func (e *CycleError) Error() string {
+	cycles := make([]string, len(e.Cycles))
+	for i, c := range e.Cycles {
+		cycles[i] = "[" + strings.Join(c, ", ") + "]"
+	}
+	return "dependency cycles among the builds: " + strings.Join(cycles, ", ")
+}
+
+// Levels orders the builds by Kahn's algorithm. The builds of a level only depend on the builds of the levels
+// before it, and each build is in the earliest level it can be. The builds of a level are sorted, so the levels
+// are the same for the same graph. It fails with a CycleError if some builds depend on each other.
+func (g *DAG) Levels() ([][]string, error) {
+	remaining := make(map[string]int, len(g.vertices))
+	dependents := make(map[string][]string)
+	for v := range g.vertices {
+		remaining[v] = len(g.deps[v])
+		for d := range g.deps[v] {
+			dependents[d] = append(dependents[d], v)
+		}
+	}
+	var current []string
+	for v, n := range remaining {
+		if n == 0 {
+			current = append(current, v)
+		}
+	}
+	var levels [][]string
+	done := 0
+	for len(current) > 0 {
+		sort.Strings(current)
+		levels = append(levels, current)
+		done += len(current)
+		var next []string
+		for _, v := range current {
+			for _, dependent := range dependents[v] {
+				remaining[dependent]--
+				if remaining[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
+		}
+		current = next
+	}
+	if done < len(g.vertices) {
+		return levels, &CycleError{Cycles: g.cycles()}
+	}
+	return levels, nil
+}
+
+// cycles finds the strongly connected components which have a cycle by Tarjan's algorithm, so the builds which
+// only depend on a cycle are not reported
+func (g *DAG) cycles() [][]string {
+	index := make(map[string]int)
+	lowLink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+	var connect func(v string)
+	connect = func(v string) {
+		index[v] = len(index)
+		lowLink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, d := range g.Dependencies(v) {
+			if _, visited := index[d]; !visited {
+				connect(d)
+				if lowLink[d] < lowLink[v] {
+					lowLink[v] = lowLink[d]
+				}
+			} else if onStack[d] && index[d] < lowLink[v] {
+				lowLink[v] = index[d]
+			}
+		}
+		if lowLink[v] != index[v] {
+			return
+		}
+		var component []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component = append(component, w)
+			if w == v {
+				break
+			}
+		}
+		if len(component) > 1 || g.deps[v][v] {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+	for _, v := range g.Vertices() {
+		if _, visited := index[v]; !visited {
+			connect(v)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// BuildQueue converts the levels to the builds of build-queue.yaml, with the ids "id1", "id2", ...
+func (g *DAG) BuildQueue() (BuildQueue, error) {
+	var bQueue BuildQueue
+	levels, err := g.Levels()
+	if err != nil {
+		return bQueue, err
+	}
+	for i, level := range levels {
+		bQueue.append(Build{Id: "id" + fmt.Sprint(i+1), Items: level})
+	}
+	return bQueue, nil
+}
+
+// Write writes the build queue as yaml or json, or the graph as dot with the builds of each level in the same
+// rank. The dot of a graph with cycles is still written with the builds of the cycles in red, to debug it.
+func (g *DAG) Write(w io.Writer, format string) error {
+	switch format {
+	case FORMAT_DOT:
+		return g.writeDOT(w)
+	case FORMAT_YAML, FORMAT_JSON:
+	default:
+		return fmt.Errorf("unknown format '%s', should be %s, %s or %s", format, FORMAT_YAML, FORMAT_JSON, FORMAT_DOT)
+	}
+	bQueue, err := g.BuildQueue()
+	if err != nil {
+		return err
+	}
+	if format == FORMAT_JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(bQueue.Builds)
+	}
+	d, err := yaml.Marshal(&bQueue.Builds)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(d)
+	return err
+}
+
+func (g *DAG) writeDOT(w io.Writer) error {
+	levels, err := g.Levels()
+	var b strings.Builder
+	b.WriteString("digraph builds {\n  rankdir=BT;\n")
+	for i, level := range levels {
+		fmt.Fprintf(&b, "  subgraph level%d {\n    rank=same;\n", i+1)
+		for _, v := range level {
+			fmt.Fprintf(&b, "    %q;\n", v)
+		}
+		b.WriteString("  }\n")
+	}
+	if cycleErr, ok := err.(*CycleError); ok {
+		for _, cycle := range cycleErr.Cycles {
+			for _, v := range cycle {
+				fmt.Fprintf(&b, "  %q [color=red];\n", v)
+			}
+		}
+	}
+	for _, v := range g.Vertices() {
+		for _, d := range g.Dependencies(v) {
+			fmt.Fprintf(&b, "  %q -> %q;\n", v, d)
+		}
+	}
+	b.WriteString("}\n")
+	_, werr := io.WriteString(w, b.String())
+	return werr
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
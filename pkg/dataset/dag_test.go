@@ -0,0 +1,129 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package dataset
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDAGLevels(t *testing.T) {
+	g := NewDAGFromDepGraph(DepGraph{
+		Vertices: map[string]interface{}{"a": nil, "b": nil, "c": nil, "isolated": nil},
+		Edges:    []Edge{{Source: "a", Target: "b"}, {Source: "a", Target: "c"}, {Source: "b", Target: "c"}},
+	})
+	levels, err := g.Levels()
+	if err != nil {
+		t.Fatalf("Levels() error: %s", err)
+	}
+	want := [][]string{{"c", "isolated"}, {"b"}, {"a"}}
+	if !reflect.DeepEqual(levels, want) {
+		t.Errorf("Levels() = %v, want %v", levels, want)
+	}
+}
+
+func TestDAGLevelsOrderDependencies(t *testing.T) {
+	g := NewDAGFromDepGraph(DepGraph{Edges: edges})
+	levels, err := g.Levels()
+	if err != nil {
+		t.Fatalf("Levels() error: %s", err)
+	}
+	levelOf := make(map[string]int)
+	for i, level := range levels {
+		for _, v := range level {
+			levelOf[v] = i
+		}
+	}
+	for _, e := range edges {
+		if levelOf[e.Source] <= levelOf[e.Target] {
+			t.Errorf("%s (level %d) should be after its dependency %s (level %d)", e.Source, levelOf[e.Source], e.Target, levelOf[e.Target])
+		}
+	}
+	for i := 0; i < 10; i++ {
+		again, _ := NewDAGFromDepGraph(DepGraph{Edges: edges}).Levels()
+		if !reflect.DeepEqual(again, levels) {
+			t.Fatalf("Levels() is not deterministic, %v != %v", again, levels)
+		}
+	}
+}
+
+func TestDAGCycles(t *testing.T) {
+	g := NewDAG()
+	g.AddEdge("x", "y")
+	g.AddEdge("y", "z")
+	g.AddEdge("z", "x")
+	g.AddEdge("w", "x") // depends on the cycle, but is not in it
+	g.AddEdge("s", "s")
+	g.AddEdge("x", "base")
+	levels, err := g.Levels()
+	cycleErr, ok := err.(*CycleError)
+	if !ok {
+		t.Fatalf("Levels() error = %v, want a CycleError", err)
+	}
+	want := [][]string{{"s"}, {"x", "y", "z"}}
+	if !reflect.DeepEqual(cycleErr.Cycles, want) {
+		t.Errorf("Cycles = %v, want %v", cycleErr.Cycles, want)
+	}
+	if cycleErr.Error() != "dependency cycles among the builds: [s], [x, y, z]" {
+		t.Errorf("Error() = %s", cycleErr.Error())
+	}
+	if !reflect.DeepEqual(levels, [][]string{{"base"}}) {
+		t.Errorf("Levels() before the cycles = %v", levels)
+	}
+	if _, err := g.BuildQueue(); err == nil {
+		t.Errorf("BuildQueue() of a graph with cycles should fail")
+	}
+}
+
+func TestDAGWrite(t *testing.T) {
+	g := NewDAG()
+	g.AddEdge("90440", "90447")
+	g.AddVertex("90450")
+
+	var b bytes.Buffer
+	if err := g.Write(&b, FORMAT_YAML); err != nil {
+		t.Fatal(err)
+	}
+	wantYaml := "- id: id1\n  build:\n  - \"90447\"\n  - \"90450\"\n- id: id2\n  build:\n  - \"90440\"\n"
+	if b.String() != wantYaml {
+		t.Errorf("yaml = %q, want %q", b.String(), wantYaml)
+	}
+
+	b.Reset()
+	if err := g.Write(&b, FORMAT_JSON); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"id": "id2",`) || !strings.Contains(b.String(), `"build": [`) {
+		t.Errorf("json = %s", b.String())
+	}
+
+	g.AddEdge("90447", "90440")
+	b.Reset()
+	if err := g.Write(&b, FORMAT_DOT); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"digraph builds {", "subgraph level1 {", `"90450";`, `"90440" [color=red];`, `"90440" -> "90447";`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("dot should contain %s, got:\n%s", want, b.String())
+		}
+	}
+	if err := g.Write(&b, "xml"); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("Write() of an unknown format should fail, got %v", err)
+	}
+}
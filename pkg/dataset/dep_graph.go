@@ -18,6 +18,7 @@ package dataset
 
 import (
 	"fmt"
+	"io/ioutil"
 
 	"gopkg.in/yaml.v2"
 )
@@ -40,91 +41,20 @@ func (bq *BuildQueue) append(b Build) {
 }
 
 type Build struct {
-	Id    string
-	Items []string `yaml:"build"`
+	Id    string   `json:"id"`
+	Items []string `yaml:"build" json:"build"`
 }
 
-func (b *Build) append(item string) {
-	b.Items = append(b.Items, item)
-}
-
-func getBuildQueueAsYaml(edges []Edge) string {
-	fmt.Printf("Make build queue, edges.len: %d\n", len(edges))
-	bQueue := getBuildQueue(edges)
-	d, _ := yaml.Marshal(&bQueue.Builds)
-	var s = string(d)
-	fmt.Println(s)
-	return s
-}
-
-func getBuildQueue(edges []Edge) BuildQueue {
-	var bQueue BuildQueue
-	level := 1
-	roots := make(map[string]bool)
-	for ok := true; ok; ok = (len(edges) > 0) {
-		keys, values := getKeysAndValues(edges)
-		s := make(map[string]bool)
-		//fmt.Printf("Keys: %s\n", strings.Join(keys, " "))
-		//fmt.Printf("level %d:\n", level)
-		for index, v := range edges {
-			if !contains(keys, v.Target) {
-				s[v.Target] = true
-				if isRoot(v.Source, values) {
-					roots[v.Source] = true
-				}
-				edges[index].Target = "" // mark it
-			}
-		}
-		bQueue.append(makeBuild(level, s))
-		edges = cleanUp(edges)
-		//fmt.Printf("After clean up, len: %d\n", len(edges))
-		level += 1
+// LoadBuildQueue reads the levels of a build-queue.yaml or build-queue.json, the builds of a level only depend
+// on the builds of the levels before it
+func LoadBuildQueue(fileLoc string) ([]Build, error) {
+	b, err := ioutil.ReadFile(fileLoc)
+	if err != nil {
+		return nil, err
 	}
-	//fmt.Printf("level %d:\n", level)
-	bQueue.append(makeBuild(level, roots))
-	return bQueue
-}
-
-func makeBuild(level int, m map[string]bool) Build {
-	var rb Build
-	rb.Id = "id" + fmt.Sprint(level)
-	for k := range m {
-		rb.append(k)
-	}
-	return rb
-}
-
-// A source is root if it is not in targets
-func isRoot(source string, targets []string) bool {
-	return !contains(targets, source)
-}
-
-func contains(s []string, e string) bool {
-	for _, a := range s {
-		if a == e {
-			return true
-		}
-	}
-	return false
-}
-
-func getKeysAndValues(edges []Edge) ([]string, []string) {
-	var keys []string
-	var values []string
-	for _, v := range edges {
-		keys = append(keys, v.Source)
-		values = append(values, v.Target)
-	}
-	return keys, values
-}
-
-// Remove edges with empty target
-func cleanUp(edges []Edge) []Edge {
-	var ret []Edge
-	for _, v := range edges {
-		if v.Target != "" {
-			ret = append(ret, v)
-		}
+	var builds []Build
+	if err := yaml.Unmarshal(b, &builds); err != nil {
+		return nil, fmt.Errorf("cannot parse build queue %s, %s", fileLoc, err)
 	}
-	return ret
+	return builds, nil
 }
@@ -17,6 +17,10 @@
 package dataset
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
 	"testing"
 )
 
@@ -30,27 +34,52 @@ func Test_getBuildQueue(t *testing.T) {
 		args args
 		want string
 	}{
-		// TODO: Add test cases.
 		{name: "test", args: args{edges}, want: "ok"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := getBuildQueue(tt.args.edges)
+			got, err := NewDAGFromDepGraph(DepGraph{Edges: tt.args.edges}).BuildQueue()
+			if err != nil {
+				t.Fatalf("BuildQueue() error: %s", err)
+			}
 			size := len(got.Builds)
 			if len(got.Builds) != 5 {
-				t.Errorf("getBuildQueue(), size: %d, want: %d", size, 5)
+				t.Errorf("BuildQueue(), size: %d, want: %d", size, 5)
 			}
 			var total int
 			for _, b := range got.Builds {
 				total += len(b.Items)
 			}
 			if total != 23 {
-				t.Errorf("getBuildQueue(), total: %d, want: %d", total, 23)
+				t.Errorf("BuildQueue(), total: %d, want: %d", total, 23)
 			}
 		})
 	}
 }
 
+func TestLoadBuildQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileLoc := path.Join(dir, BUILD_QUEUE_YAML)
+	queue := []Build{{Id: "id1", Items: []string{"90446", "90447"}}, {Id: "id2", Items: []string{"90439"}}}
+	if err := ioutil.WriteFile(fileLoc, []byte("- id: id1\n  build:\n  - \"90446\"\n  - \"90447\"\n- id: id2\n  build:\n  - \"90439\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadBuildQueue(fileLoc)
+	if err != nil {
+		t.Fatalf("LoadBuildQueue() error: %s", err)
+	}
+	if !reflect.DeepEqual(got, queue) {
+		t.Errorf("LoadBuildQueue() = %v, want %v", got, queue)
+	}
+	if _, err := LoadBuildQueue(path.Join(dir, "missing.yaml")); err == nil {
+		t.Errorf("LoadBuildQueue() of a missing file should fail")
+	}
+}
+
 var edges = []Edge{
 	{
 		Source: "90440",
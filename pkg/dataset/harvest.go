@@ -0,0 +1,331 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/pnc"
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+const (
+	// HARVEST_JSON keeps the sampled builds and the ones done in the dataset dir, so a harvest can be resumed
+	HARVEST_JSON         = ".harvest.json"
+	HARVEST_REPORT_SUITE = "dataset-harvest"
+
+	DEFAULT_HARVEST_DAYS           = 30
+	DEFAULT_HARVEST_SAMPLE         = 20
+	DEFAULT_HARVEST_MAX_CANDIDATES = 500
+	DEFAULT_HARVEST_PARALLEL       = 4
+
+	// The builds are stratified by the number of their artifacts, below ARTIFACTS_SMALL is small, from
+	// ARTIFACTS_LARGE on is large and medium in between
+	ARTIFACTS_SMALL = 10
+	ARTIFACTS_LARGE = 100
+)
+
+// HarvestOptions are the PNC query of the candidate builds and how to sample them
+type HarvestOptions struct {
+	// Days takes the builds ended in the last days, if no MilestoneId
+	Days        int    `json:"days,omitempty"`
+	MilestoneId string `json:"milestoneId,omitempty"`
+	// BuildTypes are the build types to harvest, BUILD_MVN and BUILD_NPM
+	BuildTypes    []string `json:"buildTypes"`
+	Temporary     bool     `json:"temporary,omitempty"`
+	MaxCandidates int      `json:"maxCandidates"`
+	Sample        int      `json:"sample"`
+	Seed          int64    `json:"seed"`
+	Parallel      int      `json:"-"`
+	Resume        bool     `json:"-"`
+}
+
+// Candidate is a build which can be sampled
+type Candidate struct {
+	Id        string `json:"id"`
+	BuildType string `json:"buildType"`
+	Artifacts int    `json:"artifacts"`
+}
+
+// Stratum is the group of the candidate to sample from, e.g., "MVN/small"
+func (c Candidate) Stratum() string {
+	size := "medium"
+	if c.Artifacts < ARTIFACTS_SMALL {
+		size = "small"
+	} else if c.Artifacts >= ARTIFACTS_LARGE {
+		size = "large"
+	}
+	return c.BuildType + "/" + size
+}
+
+// HarvestState is persisted as HARVEST_JSON after the sampling and after each generated build
+type HarvestState struct {
+	Options HarvestOptions `json:"options"`
+	Builds  []Candidate    `json:"builds"`
+	Done    []string       `json:"done"`
+}
+
+// HarvestResult is the result of a sampled build
+type HarvestResult struct {
+	Candidate
+	// Resumed is true if the build was done by a previous run
+	Resumed bool
+	Err     error
+}
+
+// ValidateHarvestOptions checks the options before any request to PNC. A resumed harvest uses the options of
+// the previous one, so only its state file is checked.
+func ValidateHarvestOptions(options HarvestOptions) error {
+	if options.Resume {
+		return checkHarvestState(path.Join(DATASET_DIR, HARVEST_JSON))
+	}
+	if options.MilestoneId == "" && options.Days <= 0 {
+		return fmt.Errorf("either the milestone or a positive number of days is required")
+	}
+	if options.Sample <= 0 {
+		return fmt.Errorf("the sample size should be positive, got %d", options.Sample)
+	}
+	if len(options.BuildTypes) == 0 {
+		return fmt.Errorf("no build type to harvest")
+	}
+	for _, t := range options.BuildTypes {
+		if t != BUILD_MVN && t != BUILD_NPM {
+			return fmt.Errorf("unknown build type '%s', should be %s or %s", t, BUILD_MVN, BUILD_NPM)
+		}
+	}
+	return nil
+}
+
+// Harvest queries the candidate builds from PNC, samples them stratified by build type and artifact count,
+// and generates the dataset of each sampled build as Run does, in parallel. With options.Resume the builds
+// sampled by the previous harvest are used, and the ones done are skipped.
+func Harvest(client *pnc.Client, indyBaseUrl string, options HarvestOptions) ([]HarvestResult, error) {
+	if err := os.MkdirAll(DATASET_DIR, 0755); err != nil {
+		return nil, err
+	}
+	stateFileLoc := path.Join(DATASET_DIR, HARVEST_JSON)
+	state := &HarvestState{}
+	if options.Resume {
+		if err := checkHarvestState(stateFileLoc); err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadFile(stateFileLoc)
+		if err == nil {
+			err = json.Unmarshal(b, state)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot resume the harvest from %s, %s", stateFileLoc, err)
+		}
+		fmt.Printf("Resume the harvest of %d builds, %d done\n", len(state.Builds), len(state.Done))
+	} else {
+		if options.Seed == 0 {
+			options.Seed = time.Now().UnixNano()
+		}
+		candidates, err := QueryCandidates(client, options)
+		if err != nil {
+			return nil, err
+		}
+		state.Options = options
+		state.Builds = SampleCandidates(candidates, options.Sample, rand.New(rand.NewSource(options.Seed)))
+		fmt.Printf("Sampled %d of %d candidate builds, seed: %d\n", len(state.Builds), len(candidates), options.Seed)
+		if err := saveHarvestState(stateFileLoc, state); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]HarvestResult, len(state.Builds))
+	var todo []int
+	for i, c := range state.Builds {
+		results[i].Candidate = c
+		if common.Contains(state.Done, c.Id) {
+			results[i].Resumed = true
+		} else {
+			todo = append(todo, i)
+		}
+	}
+	var mu sync.Mutex
+	errs := common.RunParallel(len(todo), options.Parallel, func(i int) error {
+		c := state.Builds[todo[i]]
+		if err := Run(client, indyBaseUrl, c.Id, false, FORMAT_YAML); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		state.Done = append(state.Done, c.Id)
+		if err := saveHarvestState(stateFileLoc, state); err != nil {
+			fmt.Printf("Warning: %s\n", err)
+		}
+		return nil
+	})
+	for i, err := range errs {
+		results[todo[i]].Err = err
+	}
+	return results, nil
+}
+
+// QueryCandidates lists the successful builds of the milestone, or ended in the last days, and counts the
+// artifacts of the ones of the build types
+func QueryCandidates(client *pnc.Client, options HarvestOptions) ([]Candidate, error) {
+	query := "status==" + pnc.STATUS_SUCCESS
+	if !options.Temporary {
+		query = pnc.And(query, "temporaryBuild==false")
+	}
+	listOptions := pnc.ListOptions{Sort: "=desc=endTime", Limit: options.MaxCandidates}
+	var builds []pnc.Build
+	var err error
+	if options.MilestoneId != "" {
+		listOptions.Query = query
+		builds, err = client.ListMilestoneBuilds(options.MilestoneId, listOptions)
+	} else {
+		listOptions.Query = pnc.And(query, pnc.EndTimeBetween(time.Now().AddDate(0, 0, -options.Days), time.Time{}))
+		builds, err = client.ListBuilds(listOptions)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []Candidate
+	for _, b := range builds {
+		if b.Succeeded() && (options.Temporary || !b.TemporaryBuild) && common.Contains(options.BuildTypes, b.BuildType()) {
+			candidates = append(candidates, Candidate{Id: b.Id, BuildType: b.BuildType()})
+		}
+	}
+	errs := common.RunParallel(len(candidates), options.Parallel, func(i int) error {
+		n, err := client.CountBuiltArtifacts(candidates[i].Id)
+		candidates[i].Artifacts = n
+		return err
+	})
+	counted := candidates[:0]
+	for i, err := range errs {
+		if err != nil {
+			fmt.Printf("Warning: skip build %s, %s\n", candidates[i].Id, err)
+			continue
+		}
+		counted = append(counted, candidates[i])
+	}
+	fmt.Printf("Get %d candidate builds of %d builds from PNC\n", len(counted), len(builds))
+	return counted, nil
+}
+
+// SampleCandidates samples n candidates, at least one of each stratum if n allows, and the rest in proportion
+// to the sizes of the strata. The result is sorted by the build id.
+func SampleCandidates(candidates []Candidate, n int, rng *rand.Rand) []Candidate {
+	strata := make(map[string][]Candidate)
+	for _, c := range candidates {
+		strata[c.Stratum()] = append(strata[c.Stratum()], c)
+	}
+	keys := make([]string, 0, len(strata))
+	for k := range strata {
+		keys = append(keys, k)
+	}
+	// shuffled in a fixed order, so the same seed samples the same builds
+	sort.Strings(keys)
+	for _, k := range keys {
+		members := strata[k]
+		sort.Slice(members, func(i, j int) bool { return members[i].Id < members[j].Id })
+		rng.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	}
+	// the largest strata first, so they get the one sample each if n is less than the strata
+	sort.Slice(keys, func(i, j int) bool {
+		if len(strata[keys[i]]) != len(strata[keys[j]]) {
+			return len(strata[keys[i]]) > len(strata[keys[j]])
+		}
+		return keys[i] < keys[j]
+	})
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	quota := make(map[string]int)
+	for i := 0; i < n && i < len(keys); i++ {
+		quota[keys[i]] = 1
+	}
+	for left := n - len(quota); left > 0; left-- {
+		// the next sample goes to the stratum with the most candidates per sample, like the D'Hondt method
+		best := ""
+		for _, k := range keys {
+			if quota[k] < len(strata[k]) && (best == "" ||
+				len(strata[k])*(quota[best]+1) > len(strata[best])*(quota[k]+1)) {
+				best = k
+			}
+		}
+		quota[best]++
+	}
+
+	var sampled []Candidate
+	for _, k := range keys {
+		sampled = append(sampled, strata[k][:quota[k]]...)
+	}
+	sort.Slice(sampled, func(i, j int) bool { return sampled[i].Id < sampled[j].Id })
+	return sampled
+}
+
+func saveHarvestState(fileLoc string, state *HarvestState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileLoc, b, 0644)
+}
+
+func checkHarvestState(stateFileLoc string) error {
+	if !common.FileOrDirExists(stateFileLoc) {
+		return fmt.Errorf("cannot resume the harvest, no previous harvest found in %s", stateFileLoc)
+	}
+	return nil
+}
+
+// PrintHarvest prints a table of the sampled builds and their results
+func PrintHarvest(w io.Writer, results []HarvestResult) {
+	fmt.Fprintf(w, "%-20s %-5s %-8s %9s  %s\n", "BUILD", "TYPE", "STRATUM", "ARTIFACTS", "RESULT")
+	for _, r := range results {
+		result := "OK"
+		if r.Resumed {
+			result = "OK (done before)"
+		} else if r.Err != nil {
+			result = "FAIL: " + r.Err.Error()
+		}
+		fmt.Fprintf(w, "%-20s %-5s %-8s %9d  %s\n", r.Id, r.BuildType, strings.TrimPrefix(r.Stratum(), r.BuildType+"/"), r.Artifacts, result)
+	}
+}
+
+// ReportHarvest adds a case per sampled build to the run report and returns whether all builds are done
+func ReportHarvest(results []HarvestResult) bool {
+	suite := report.GetSuite(HARVEST_REPORT_SUITE)
+	succeeded := true
+	for _, r := range results {
+		var c *report.Case
+		if r.Err != nil {
+			c = suite.Add(r.Id, report.StatusFailed, 0, r.Err.Error())
+			succeeded = false
+		} else {
+			c = suite.Add(r.Id, report.StatusPassed, 0, "")
+		}
+		c.Set("buildType", r.BuildType).Set("artifacts", r.Artifacts).Set("stratum", r.Stratum())
+	}
+	return succeeded
+}
@@ -0,0 +1,170 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package dataset
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/pnc"
+)
+
+func TestSampleCandidates(t *testing.T) {
+	var candidates []Candidate
+	add := func(n int, buildType string, artifacts int) {
+		for i := 0; i < n; i++ {
+			candidates = append(candidates, Candidate{Id: fmt.Sprintf("%s-%d-%d", buildType, artifacts, i), BuildType: buildType, Artifacts: artifacts})
+		}
+	}
+	add(60, BUILD_MVN, 1)
+	add(20, BUILD_MVN, 50)
+	add(10, BUILD_NPM, 1)
+	add(1, BUILD_MVN, 500)
+
+	sampled := SampleCandidates(candidates, 10, rand.New(rand.NewSource(1)))
+	counts := make(map[string]int)
+	for _, c := range sampled {
+		counts[c.Stratum()]++
+	}
+	want := map[string]int{"MVN/small": 6, "MVN/medium": 2, "NPM/small": 1, "MVN/large": 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("SampleCandidates() strata = %v, want %v", counts, want)
+	}
+	again := SampleCandidates(candidates, 10, rand.New(rand.NewSource(1)))
+	if !reflect.DeepEqual(again, sampled) {
+		t.Errorf("SampleCandidates() with the same seed = %v, want %v", again, sampled)
+	}
+
+	if n := len(SampleCandidates(candidates, 2, rand.New(rand.NewSource(1)))); n != 2 {
+		t.Errorf("SampleCandidates() of 2 = %d builds", n)
+	}
+	if n := len(SampleCandidates(candidates, 1000, rand.New(rand.NewSource(1)))); n != len(candidates) {
+		t.Errorf("SampleCandidates() of more than the candidates = %d builds, want %d", n, len(candidates))
+	}
+}
+
+func TestValidateHarvestOptions(t *testing.T) {
+	valid := HarvestOptions{Days: 7, BuildTypes: []string{BUILD_MVN}, Sample: 5}
+	if err := ValidateHarvestOptions(valid); err != nil {
+		t.Errorf("ValidateHarvestOptions() error: %s", err)
+	}
+	for _, options := range []HarvestOptions{
+		{BuildTypes: []string{BUILD_MVN}, Sample: 5},
+		{Days: 7, BuildTypes: []string{BUILD_MVN}},
+		{Days: 7, BuildTypes: []string{"GRADLE"}, Sample: 5},
+	} {
+		if err := ValidateHarvestOptions(options); err == nil {
+			t.Errorf("ValidateHarvestOptions(%+v) should fail", options)
+		}
+	}
+}
+
+func TestHarvest(t *testing.T) {
+	var mu sync.Mutex
+	generated := make(map[string]int)
+	failing := map[string]bool{"b3": true}
+	mux := http.NewServeMux()
+	mux.HandleFunc(pnc.API_PATH+"/product-milestones/9/builds", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"pageIndex": 0, "totalPages": 1, "content": [
+			{"id": "b1", "status": "SUCCESS", "buildConfigRevision": {"buildType": "MVN"}},
+			{"id": "b2", "status": "SUCCESS", "buildConfigRevision": {"buildType": "NPM"}},
+			{"id": "b3", "status": "SUCCESS", "buildConfigRevision": {"buildType": "MVN"}},
+			{"id": "b4", "status": "SUCCESS", "buildConfigRevision": {"buildType": "GRADLE"}},
+			{"id": "b5", "status": "SUCCESS", "temporaryBuild": true, "buildConfigRevision": {"buildType": "MVN"}}]}`)
+	})
+	mux.HandleFunc(pnc.API_PATH+"/builds/", func(w http.ResponseWriter, r *http.Request) {
+		toks := strings.Split(strings.TrimPrefix(r.URL.Path, pnc.API_PATH+"/builds/"), "/")
+		id := toks[0]
+		switch {
+		case len(toks) == 1:
+			fmt.Fprintf(w, `{"id": "%s", "status": "SUCCESS", "buildConfigRevision": {"buildType": "MVN"}}`, id)
+		case toks[1] == "artifacts":
+			fmt.Fprint(w, `{"totalHits": 12, "content": []}`)
+		case failing[id]:
+			http.Error(w, "log is gone", http.StatusInternalServerError)
+		default:
+			mu.Lock()
+			generated[id]++
+			mu.Unlock()
+			fmt.Fprint(w, "REST Client returned: {junit:junit:4.13.1=4.13.1}")
+		}
+	})
+	mux.HandleFunc("/api/folo/admin/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, validTracking)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	client := pnc.NewClient(server.URL, nil)
+	if err := ValidateHarvestOptions(HarvestOptions{Resume: true}); err == nil {
+		t.Errorf("ValidateHarvestOptions() should fail to resume without a previous harvest")
+	}
+	if _, err := Harvest(client, server.URL, HarvestOptions{Resume: true}); err == nil {
+		t.Errorf("Harvest() should fail to resume without a previous harvest")
+	}
+	options := HarvestOptions{MilestoneId: "9", BuildTypes: []string{BUILD_MVN, BUILD_NPM}, Sample: 10, Seed: 1, Parallel: 2}
+	results, err := Harvest(client, server.URL, options)
+	if err != nil {
+		t.Fatalf("Harvest() error: %s", err)
+	}
+	var ids []string
+	for _, r := range results {
+		ids = append(ids, r.Id)
+		if r.Artifacts != 12 || r.Stratum() != r.BuildType+"/medium" {
+			t.Errorf("%s = %+v, want 12 artifacts", r.Id, r)
+		}
+		if (r.Err != nil) != failing[r.Id] {
+			t.Errorf("%s error = %v", r.Id, r.Err)
+		}
+	}
+	if strings.Join(ids, " ") != "b1 b2 b3" {
+		t.Errorf("Harvest() builds = %v, want the non temporary MVN and NPM builds", ids)
+	}
+	if ReportHarvest(results) {
+		t.Errorf("ReportHarvest() = true, want false as b3 failed")
+	}
+
+	delete(failing, "b3")
+	if err := ValidateHarvestOptions(HarvestOptions{Resume: true}); err != nil {
+		t.Errorf("ValidateHarvestOptions() resume error: %s", err)
+	}
+	results, err = Harvest(client, server.URL, HarvestOptions{Resume: true, Parallel: 2})
+	if err != nil {
+		t.Fatalf("Harvest() resume error: %s", err)
+	}
+	for _, r := range results {
+		if r.Err != nil || r.Resumed == (r.Id == "b3") {
+			t.Errorf("resumed %s = %+v", r.Id, r)
+		}
+	}
+	if !reflect.DeepEqual(generated, map[string]int{"b1": 1, "b2": 1, "b3": 1}) {
+		t.Errorf("generated builds = %v, want each once", generated)
+	}
+}
@@ -23,11 +23,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
-	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/pnc"
 )
 
 type Info struct {
@@ -38,11 +39,18 @@ type Info struct {
 }
 
 const (
-	DATASET_DIR      = "dataset"
-	DA_JSON          = "da.json"
-	TRACKING_JSON    = "tracking.json"
-	INFO_JSON        = "info.json"
-	ADDITIONAL_REPOS = "additional-repos.json"
+	DATASET_DIR           = "dataset"
+	DA_JSON               = "da.json"
+	TRACKING_JSON         = "tracking.json"
+	INFO_JSON             = "info.json"
+	ADDITIONAL_REPOS      = "additional-repos.json"
+	BUILD_QUEUE_YAML      = "build-queue.yaml"
+	BUILD_QUEUE_JSON      = "build-queue.json"
+	BUILD_JSON            = "build.json"
+	GROUP_BUILD_JSON      = "group-build.json"
+	DEPENDENCY_GRAPH_JSON = "dependency-graph.json"
+	DEPENDENCY_GRAPH_DOT  = "dependency-graph.dot"
+	BUILDS_DIR            = "builds"
 
 	BUILD_MVN = "MVN"
 	BUILD_NPM = "NPM"
@@ -57,6 +65,8 @@ const (
  *     |-- info.json => info about this test dataset, e.g, pnc base url, which is useful to orchestrator
  *     |-- group-build.json => Get by "/pnc-rest/v2/group-builds/2836"
  *     |-- dependency-graph.json => Get by "/pnc-rest/v2/group-builds/2836/dependency-graph"
+ *     |-- dependency-graph.dot => the graph for graphviz, to debug the group build
+ *     |-- build-queue.yaml => the builds leveled by their dependencies, see DAG.Levels, or build-queue.json by --queueFormat json
  *     |-- builds
  *           |-- ...
  *           |-- AMJMVSDA5EAAE
@@ -69,157 +79,188 @@ const (
  *     |-- build.json => Get by "/pnc-rest/v2/builds/AMJMVSDA5EAAA"
  *     |-- da.json => same as above
  *     |-- tracking.json => same as above
+ *
+ * # for the builds sampled by Harvest
+ * |-- .harvest.json => the sampled builds and the ones done, to resume the harvest
  */
-func Run(pncBaseUrl, indyBaseUrl, buildId string, isGroupBuild bool) {
+func Run(client *pnc.Client, indyBaseUrl, buildId string, isGroupBuild bool, queueFormat string) error {
+	indyBaseUrl = common.NormIndyURL(indyBaseUrl)
 	//Create folder, e.g, 'dataset/2836'
 	dirLoc := path.Join(DATASET_DIR, buildId)
-	err := os.MkdirAll(dirLoc, 0755)
-	common.RePanic(err)
-
-	buildURL := ""
-	buildType := ""
-	//Download group-build.json or build.json
-	var buildJsonFileLoc string
-	if isGroupBuild {
-		buildURL = pncBaseUrl + "/pnc-rest/v2/group-builds/" + buildId
-		buildJsonFileLoc = path.Join(dirLoc, "group-build.json")
-	} else {
-		buildURL = pncBaseUrl + "/pnc-rest/v2/builds/" + buildId
-		buildJsonFileLoc = path.Join(dirLoc, "build.json")
+	if err := os.MkdirAll(dirLoc, 0755); err != nil {
+		return err
 	}
 
-	if downloadFileIfNotExist(buildURL, buildJsonFileLoc) {
-		formatJsonFile(buildJsonFileLoc)
+	if !isGroupBuild {
+		build := pnc.Build{}
+		if err := getJSONFile(client, "/builds/"+buildId, path.Join(dirLoc, BUILD_JSON), &build); err != nil {
+			return err
+		}
+		if err := createInfoFile(client.PncURL, buildId, build.TemporaryBuild, build.BuildType(), path.Join(dirLoc, INFO_JSON)); err != nil {
+			return err
+		}
+		return generateFiles(client, indyBaseUrl, dirLoc, buildId, build.BuildType())
 	}
 
-	//Create info.json
-	infoFileLoc := path.Join(dirLoc, INFO_JSON)
-	if !common.FileOrDirExists(infoFileLoc) {
-		buildType = createInfoFile(pncBaseUrl, buildId, buildJsonFileLoc, infoFileLoc)
-	} else {
-		_, buildType = parseBuildJson(buildJsonFileLoc)
+	groupBuild := pnc.GroupBuild{}
+	if err := getJSONFile(client, "/group-builds/"+buildId, path.Join(dirLoc, GROUP_BUILD_JSON), &groupBuild); err != nil {
+		return err
+	}
+	graph := pnc.Graph{}
+	if err := getJSONFile(client, "/group-builds/"+buildId+"/dependency-graph", path.Join(dirLoc, DEPENDENCY_GRAPH_JSON), &graph); err != nil {
+		return err
+	}
+	// a group build has no build type, the type of its builds is used
+	buildType := groupBuildType(graph)
+	if err := createInfoFile(client.PncURL, buildId, groupBuild.TemporaryBuild, buildType, path.Join(dirLoc, INFO_JSON)); err != nil {
+		return err
 	}
 
-	if isGroupBuild {
-		//Download dependency-graph.json
-		dependencyGraphURL := buildURL + "/dependency-graph"
-		dependencyGraphFileLoc := path.Join(dirLoc, "dependency-graph.json")
-		if !common.FileOrDirExists(dependencyGraphFileLoc) {
-			success, _ := common.DownloadFile(dependencyGraphURL, dependencyGraphFileLoc)
-			if !success {
-				fmt.Println("Download dependency-graph.json failed.")
-				return
-			}
-			formatJsonFile(dependencyGraphFileLoc)
+	// Iterate through builds and generate files
+	buildsDir := path.Join(dirLoc, BUILDS_DIR)
+	ids := make(map[string]bool)
+	for id := range graph.Vertices {
+		ids[id] = true
+	}
+	for _, id := range sortedKeys(ids) {
+		vertexBuildType := graph.Vertices[id].Data.BuildType()
+		if vertexBuildType == "" {
+			vertexBuildType = buildType
 		}
-
-		//Create 'builds' dir if not exist
-		buildsDir := path.Join(dirLoc, "builds")
-		os.MkdirAll(buildsDir, 0755)
-
-		//Parse dependency-graph.json to generate data for each bc
-		result := parseDependency(pncBaseUrl, indyBaseUrl, buildsDir, dependencyGraphFileLoc)
-
-		// Iterate through builds and generate files
-		for k := range result.Vertices {
-			buildId := k
-			buildDir := path.Join(buildsDir, buildId)
-			generateFiles(pncBaseUrl, indyBaseUrl, buildDir, buildId, buildType)
+		if err := generateFiles(client, indyBaseUrl, path.Join(buildsDir, id), id, vertexBuildType); err != nil {
+			return err
 		}
-
-		buildQueueFileLoc := path.Join(dirLoc, "build-queue.yaml")
-		generateBuildQueueFile(buildQueueFileLoc, result.Edges)
-	} else {
-		generateFiles(pncBaseUrl, indyBaseUrl, dirLoc, buildId, buildType)
 	}
+
+	return generateBuildQueueFile(dirLoc, queueFormat, toDepGraph(graph))
 }
 
-func generateBuildQueueFile(fileLoc string, edges []Edge) {
-	if !common.FileOrDirExists(fileLoc) {
-		err := ioutil.WriteFile(fileLoc, []byte(getBuildQueueAsYaml(edges)), 0644)
-		common.RePanic(err)
+// ValidateQueueFormat checks the format of the build queue file is yaml or json
+func ValidateQueueFormat(queueFormat string) error {
+	if queueFormat != FORMAT_YAML && queueFormat != FORMAT_JSON {
+		return fmt.Errorf("queueFormat should be '%s' or '%s'", FORMAT_YAML, FORMAT_JSON)
 	}
+	return nil
 }
 
-func downloadFileIfNotExist(url, fileLoc string) bool {
-	if !common.FileOrDirExists(fileLoc) {
-		success, _ := common.DownloadFile(url, fileLoc)
-		if !success {
-			fmt.Printf("Download file %s failed\n", fileLoc)
-			return false
-		}
+// BuildQueueFile is the build queue file of the group build dir, build-queue.json if it exists, otherwise
+// build-queue.yaml
+func BuildQueueFile(groupDir string) string {
+	if jsonFileLoc := path.Join(groupDir, BUILD_QUEUE_JSON); common.FileOrDirExists(jsonFileLoc) {
+		return jsonFileLoc
 	}
-	return true
+	return path.Join(groupDir, BUILD_QUEUE_YAML)
 }
 
-// Read a json file, format and override it
-func formatJsonFile(fileLoc string) {
-	var prettyJSON bytes.Buffer
-	err := json.Indent(&prettyJSON, common.ReadByteFromFile(fileLoc), "", "  ")
-	common.RePanic(err)
-	err = ioutil.WriteFile(fileLoc, prettyJSON.Bytes(), 0644)
-	common.RePanic(err)
+// groupBuildType is the build type of most builds of the graph
+func groupBuildType(graph pnc.Graph) string {
+	counts := make(map[string]int)
+	buildType := ""
+	for _, v := range graph.Vertices {
+		t := v.Data.BuildType()
+		counts[t]++
+		if t != "" && (counts[t] > counts[buildType] || (counts[t] == counts[buildType] && t < buildType)) {
+			buildType = t
+		}
+	}
+	if len(counts) > 1 {
+		fmt.Printf("Warning: the builds of the group have different build types %v, use %s\n", counts, buildType)
+	}
+	return buildType
 }
 
-func createInfoFile(pncBaseUrl, buildId string, buildJsonLoc, fileLoc string) string {
-	tempB, bType := parseBuildJson(buildJsonLoc)
-	info := &Info{PncBaseUrl: pncBaseUrl, BuildId: buildId, TemporaryBuild: tempB, BuildType: bType}
-	fmt.Printf("Get %s, %s\n", info.PncBaseUrl, info.BuildId)
-	b, _ := json.MarshalIndent(info, "", " ")
-	err := ioutil.WriteFile(fileLoc, b, 0644)
-	common.RePanic(err)
-	return bType
+func toDepGraph(graph pnc.Graph) DepGraph {
+	depGraph := DepGraph{Vertices: make(map[string]interface{})}
+	for id, v := range graph.Vertices {
+		depGraph.Vertices[id] = v
+	}
+	for _, e := range graph.Edges {
+		depGraph.Edges = append(depGraph.Edges, Edge{Source: e.Source, Target: e.Target})
+	}
+	return depGraph
 }
 
-func parseBuildJson(fileLoc string) (bool, string) {
-	// Read jsonFile
-	byteValue := common.ReadByteFromFile(fileLoc)
-
-	// Parse it
-	var result map[string]interface{}
-	json.Unmarshal([]byte(byteValue), &result)
-
-	// Find temporaryBuild
-	var temporaryBuild bool
-	v := reflect.ValueOf(result["temporaryBuild"])
-	if v.Kind() == reflect.Bool {
-		temporaryBuild = v.Bool()
+// generateBuildQueueFile writes the build queue in the format into the group build dir, and the graph as dot
+// next to it to debug the group build, e.g., by 'dot -Tsvg dependency-graph.dot'. The dot is written even if the
+// graph has cycles, then the *CycleError is returned.
+func generateBuildQueueFile(dirLoc, queueFormat string, graph DepGraph) error {
+	if common.FileOrDirExists(BuildQueueFile(dirLoc)) {
+		return nil
 	}
+	fileLoc := path.Join(dirLoc, BUILD_QUEUE_YAML)
+	if queueFormat == FORMAT_JSON {
+		fileLoc = path.Join(dirLoc, BUILD_QUEUE_JSON)
+	}
+	fmt.Printf("Make build queue, vertices: %d, edges: %d\n", len(graph.Vertices), len(graph.Edges))
+	dag := NewDAGFromDepGraph(graph)
+	var dot bytes.Buffer
+	dag.Write(&dot, FORMAT_DOT)
+	if err := ioutil.WriteFile(path.Join(dirLoc, DEPENDENCY_GRAPH_DOT), dot.Bytes(), 0644); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := dag.Write(&b, queueFormat); err != nil {
+		return err
+	}
+	fmt.Println(b.String())
+	return ioutil.WriteFile(fileLoc, b.Bytes(), 0644)
+}
 
-	// Find buildType
-	var buildType string
-	v = reflect.ValueOf(result["buildConfigRevision"])
-	if v.Kind() == reflect.Map {
-		for _, key := range v.MapKeys() {
-			if key.String() == "buildType" {
-				buildTypeValue := v.MapIndex(key)
-				buildType = buildTypeValue.Elem().String()
-				break
-			}
+// getJSONFile gets the json of the pnc api path into the file, formatted, if the file does not exist yet, and
+// decodes the file into out
+func getJSONFile(client *pnc.Client, apiPath, fileLoc string, out interface{}) error {
+	if !common.FileOrDirExists(fileLoc) {
+		b, err := client.GetRaw(apiPath)
+		if err != nil {
+			return err
+		}
+		var prettyJSON bytes.Buffer
+		if err := json.Indent(&prettyJSON, b, "", "  "); err != nil {
+			return fmt.Errorf("invalid json of %s, %s", apiPath, err)
+		}
+		if err := ioutil.WriteFile(fileLoc, prettyJSON.Bytes(), 0644); err != nil {
+			return err
 		}
 	}
-	return temporaryBuild, buildType
+	b, err := ioutil.ReadFile(fileLoc)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("invalid json in %s, %s", fileLoc, err)
+	}
+	return nil
 }
 
-func parseDependency(pncBaseUrl, indyBaseUrl, buildsDir, fileLoc string) DepGraph {
-	// Read jsonFile
-	byteValue := common.ReadByteFromFile(fileLoc)
-
-	var result DepGraph
-	json.Unmarshal([]byte(byteValue), &result)
-	return result
+func createInfoFile(pncBaseUrl, buildId string, temporaryBuild bool, buildType, fileLoc string) error {
+	if common.FileOrDirExists(fileLoc) {
+		return nil
+	}
+	info := &Info{PncBaseUrl: pncBaseUrl, BuildId: buildId, TemporaryBuild: temporaryBuild, BuildType: buildType}
+	fmt.Printf("Get %s, %s\n", info.PncBaseUrl, info.BuildId)
+	b, _ := json.MarshalIndent(info, "", " ")
+	return ioutil.WriteFile(fileLoc, b, 0644)
 }
 
-func generateFiles(pncBaseUrl, indyBaseUrl, buildDir, buildId, buildType string) {
+func generateFiles(client *pnc.Client, indyBaseUrl, buildDir, buildId, buildType string) error {
+	if buildType != BUILD_MVN && buildType != BUILD_NPM {
+		return fmt.Errorf("build %s has an unsupported build type '%s'", buildId, buildType)
+	}
 	alignLogFile := path.Join(buildDir, "align.log")
 	daFile := path.Join(buildDir, DA_JSON)
 	trackingFile := path.Join(buildDir, TRACKING_JSON)
-	os.MkdirAll(buildDir, 0755)
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
+		return err
+	}
 	alignLog := ""
 	if !common.FileOrDirExists(alignLogFile) {
-		alignLog = common.GetAlignLog(pncBaseUrl, buildId)
-		err := ioutil.WriteFile(alignLogFile, []byte(alignLog), 0644)
-		common.RePanic(err)
+		var err error
+		if alignLog, err = client.GetAlignLog(buildId); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(alignLogFile, []byte(alignLog), 0644); err != nil {
+			return err
+		}
 	}
 	if !common.FileOrDirExists(daFile) {
 		if alignLog == "" {
@@ -228,13 +269,17 @@ func generateFiles(pncBaseUrl, indyBaseUrl, buildDir, buildId, buildType string)
 		}
 		paths := getMetadataPaths(alignLog, buildType)
 		pathsJson, _ := json.MarshalIndent(paths, "", " ")
-		err := ioutil.WriteFile(daFile, pathsJson, 0644)
-		common.RePanic(err)
+		if err := ioutil.WriteFile(daFile, pathsJson, 0644); err != nil {
+			return err
+		}
 	}
 	if !common.FileOrDirExists(trackingFile) {
 		url := indyBaseUrl + "/api/folo/admin/build-" + buildId + "/report"
-		common.DownloadFile(url, trackingFile)
+		if success, _ := common.DownloadFile(url, trackingFile); !success {
+			return fmt.Errorf("download the tracking record of build %s failed, %s", buildId, url)
+		}
 	}
+	return nil
 }
 
 func getMetadataPaths(alignLog, buildType string) []string {
@@ -247,26 +292,48 @@ func getMetadataPaths(alignLog, buildType string) []string {
 	}
 }
 
+var (
+	mavenAlignRegexp = regexp.MustCompile(`(?s)REST Client returned.*?\{(.*?)\}`)
+	mavenIdRegexp    = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+	// npmNameRegexp is a valid npm package name, scoped or not
+	npmNameRegexp = regexp.MustCompile(`^(@[a-z0-9\-~][a-z0-9\-._~]*/)?[a-z0-9\-~][a-z0-9\-._~]*$`)
+)
+
+const NPM_ALIGN_MARKER = "Got project manipulator result data"
+
+// getMavenMetadataPaths extracts the metadata paths of the GAs DA returned for the alignment, e.g.,
+// "REST Client returned: {org.sonatype.oss:oss-parent:9=9.0.0.redhat-2, junit:junit:4.13.1=4.13.1}". The
+// entries can be wrapped over lines, and have the type and classifier, e.g., "org.foo:bar:jar:tests:1.0=...".
 func getMavenMetadataPaths(alignLog string) []string {
-	// extract the gav list from alignment log
-	// (?s) means single-line (hence the s) or DOTALL mode - it takes the whole alignlog as one string
-	var re = regexp.MustCompile(`(?s)REST Client returned.*?\}`)
 	var paths []string
-	for _, match := range re.FindAllString(alignLog, -1) {
-		i := strings.Index(match, "{")
-		gavs := match[i+1 : len(match)-1]
+	seen := make(map[string]bool)
+	for _, match := range mavenAlignRegexp.FindAllStringSubmatch(alignLog, -1) {
+		gavs := strings.TrimSpace(match[1])
 		if gavs == "" {
 			continue
 		}
 		gavArray := strings.Split(gavs, ",")
 		for _, gav := range gavArray {
+			gav = strings.TrimSpace(gav)
+			if i := strings.Index(gav, "="); i >= 0 {
+				gav = gav[:i] // the aligned version
+			}
 			s := strings.Split(gav, ":")
-			groupId := strings.Trim(s[0], " ")
-			artifactId := s[1]
-			//fmt.Println("GroupID: ", groupId, " ArtifactId: ", artifactId)
+			if len(s) < 2 {
+				fmt.Printf("Warning: skip invalid GAV '%s' in alignment log\n", gav)
+				continue
+			}
+			groupId, artifactId := strings.TrimSpace(s[0]), strings.TrimSpace(s[1])
+			if !mavenIdRegexp.MatchString(groupId) || !mavenIdRegexp.MatchString(artifactId) {
+				fmt.Printf("Warning: skip invalid GAV '%s' in alignment log\n", gav)
+				continue
+			}
 			groupIdPath := strings.ReplaceAll(groupId, ".", "/")
-			p := fmt.Sprintf("%s/%s/maven-metadata.xml", groupIdPath, artifactId)
-			paths = append(paths, p)
+			p := fmt.Sprintf("%s/%s/%s", groupIdPath, artifactId, common.MAVEN_METADATA_XML)
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
 		}
 		fmt.Println("Get metadata paths: ", len(gavArray))
 	}
@@ -274,28 +341,91 @@ func getMavenMetadataPaths(alignLog string) []string {
 	return paths
 }
 
+// getNPMMetadataPaths extracts the metadata paths of the packages in the results of the project manipulator,
+// logged as a json object after NPM_ALIGN_MARKER, quoted as a json string or not. The paths are the package
+// names, a scoped "@scope/name" is encoded as "@scope%2fname" like the npm clients request it from indy.
 func getNPMMetadataPaths(alignLog string) []string {
-	var re = regexp.MustCompile(`(?s)Got project manipulator result data.*?\}\"`)
 	var paths []string
-	for _, match := range re.FindAllString(alignLog, -1) {
-		fmt.Println(">>> " + match)
-		i := strings.Index(match, "{")
-		jtems := match[i+1 : len(match)-2]
-		if jtems == "" {
-			continue
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !npmNameRegexp.MatchString(name) {
+			return
 		}
-		arr := strings.Split(jtems, ",")
-		for _, jtem := range arr {
-			s := strings.Split(jtem, ":")
-			k := strings.Trim(strings.TrimSpace(s[0]), "\"")
-			v := strings.Trim(strings.TrimSpace(s[1]), "\"")
-			if k == "name" {
-				fmt.Println("Get metadata path: ", v)
-				paths = append(paths, v)
-				break
-			}
+		p := common.NpmMetadataPath(name)
+		if !seen[p] {
+			seen[p] = true
+			fmt.Println("Get metadata path: ", p)
+			paths = append(paths, p)
+		}
+	}
+	for rest := alignLog; ; {
+		i := strings.Index(rest, NPM_ALIGN_MARKER)
+		if i < 0 {
+			break
+		}
+		rest = rest[i+len(NPM_ALIGN_MARKER):]
+		payload, err := decodeNPMResult(rest)
+		if err != nil {
+			fmt.Printf("Warning: skip invalid project manipulator result in alignment log, %s\n", err)
+			continue
 		}
+		collectNPMNames(payload, add)
 	}
 	fmt.Println("Get metadata paths (Total): ", len(paths))
 	return paths
 }
+
+// decodeNPMResult decodes the json object at the start of the text, which may be quoted as a json string
+func decodeNPMResult(text string) (interface{}, error) {
+	text = strings.TrimLeft(text, ": \t")
+	if strings.HasPrefix(text, "\"") {
+		var quoted string
+		if err := json.NewDecoder(strings.NewReader(text)).Decode(&quoted); err == nil {
+			var payload interface{}
+			if err := json.Unmarshal([]byte(quoted), &payload); err == nil {
+				return payload, nil
+			}
+		}
+	}
+	// not a valid json string, e.g., the object is quoted without escaping its quotes
+	i := strings.Index(text, "{")
+	if i < 0 || strings.TrimSpace(strings.TrimPrefix(text[:i], "\"")) != "" {
+		return nil, fmt.Errorf("no json object found")
+	}
+	var payload interface{}
+	err := json.NewDecoder(strings.NewReader(text[i:])).Decode(&payload)
+	return payload, err
+}
+
+// collectNPMNames adds the "name" of the objects of the payload, and the packages of the "dependencies",
+// "devDependencies" and the like
+func collectNPMNames(payload interface{}, add func(name string)) {
+	switch v := payload.(type) {
+	case map[string]interface{}:
+		if name, ok := v["name"].(string); ok {
+			add(name)
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if deps, ok := v[k].(map[string]interface{}); ok && strings.HasSuffix(strings.ToLower(k), "dependencies") {
+				names := make([]string, 0, len(deps))
+				for name := range deps {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					add(name)
+				}
+			}
+			collectNPMNames(v[k], add)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectNPMNames(item, add)
+		}
+	}
+}
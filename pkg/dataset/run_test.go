@@ -17,10 +17,113 @@
 package dataset
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
 	"reflect"
 	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/pnc"
 )
 
+func TestRunGroupBuild(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pnc.API_PATH+"/group-builds/2836", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "2836", "status": "SUCCESS", "temporaryBuild": true}`)
+	})
+	mux.HandleFunc(pnc.API_PATH+"/group-builds/2836/dependency-graph", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"vertices": {
+			"a": {"name": "a", "data": {"id": "a", "buildConfigRevision": {"buildType": "MVN"}}},
+			"b": {"name": "b", "data": {"id": "b", "buildConfigRevision": {"buildType": "MVN"}}}},
+			"edges": [{"source": "a", "target": "b"}]}`)
+	})
+	mux.HandleFunc(pnc.API_PATH+"/builds/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "REST Client returned: {junit:junit:4.13.1=4.13.1}")
+	})
+	mux.HandleFunc("/api/folo/admin/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, validTracking)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	if err := Run(pnc.NewClient(server.URL, nil), server.URL, "2836", true, FORMAT_YAML); err != nil {
+		t.Fatalf("Run() error: %s", err)
+	}
+	results, err := ValidateDataset(path.Join(dir, DATASET_DIR))
+	if err != nil {
+		t.Fatalf("ValidateDataset() error: %s", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("ValidateDataset() = %v, want the group and its 2 builds", results)
+	}
+	for _, h := range results {
+		if !h.Healthy(true) || h.BuildType != BUILD_MVN {
+			t.Errorf("%s = %+v, want a healthy MVN build", h.BuildId, h)
+		}
+	}
+	queue, err := LoadBuildQueue(path.Join(dir, DATASET_DIR, "2836", BUILD_QUEUE_YAML))
+	if err != nil || !reflect.DeepEqual(queue, []Build{{Id: "id1", Items: []string{"b"}}, {Id: "id2", Items: []string{"a"}}}) {
+		t.Errorf("build queue = %v, error: %v", queue, err)
+	}
+
+	if err := Run(pnc.NewClient(server.URL, nil), server.URL, "404", true, FORMAT_YAML); err == nil {
+		t.Errorf("Run() of a missing group build should fail")
+	}
+}
+
+func TestGenerateBuildQueueFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	graph := DepGraph{Vertices: map[string]interface{}{"a": nil, "b": nil, "c": nil},
+		Edges: []Edge{{Source: "a", Target: "b"}}}
+
+	jsonDir := path.Join(dir, "json")
+	os.MkdirAll(jsonDir, 0755)
+	if err := generateBuildQueueFile(jsonDir, FORMAT_JSON, graph); err != nil {
+		t.Fatalf("generateBuildQueueFile() error: %s", err)
+	}
+	if got := BuildQueueFile(jsonDir); got != path.Join(jsonDir, BUILD_QUEUE_JSON) {
+		t.Errorf("BuildQueueFile() = %s, want the json file", got)
+	}
+	queue, err := LoadBuildQueue(BuildQueueFile(jsonDir))
+	if err != nil || !reflect.DeepEqual(queue, []Build{{Id: "id1", Items: []string{"b", "c"}}, {Id: "id2", Items: []string{"a"}}}) {
+		t.Errorf("json build queue = %v, error: %v", queue, err)
+	}
+
+	cycleDir := path.Join(dir, "cycle")
+	os.MkdirAll(cycleDir, 0755)
+	graph.Edges = append(graph.Edges, Edge{Source: "b", Target: "a"})
+	err = generateBuildQueueFile(cycleDir, FORMAT_YAML, graph)
+	if _, ok := err.(*CycleError); !ok {
+		t.Fatalf("generateBuildQueueFile() of a graph with cycles = %v, want a *CycleError", err)
+	}
+	if _, err := os.Stat(path.Join(cycleDir, DEPENDENCY_GRAPH_DOT)); err != nil {
+		t.Errorf("the dot should be written for a graph with cycles, %s", err)
+	}
+	if _, err := os.Stat(BuildQueueFile(cycleDir)); err == nil {
+		t.Errorf("no build queue should be written for a graph with cycles")
+	}
+}
+
+func TestValidateQueueFormat(t *testing.T) {
+	for _, format := range []string{FORMAT_YAML, FORMAT_JSON} {
+		if err := ValidateQueueFormat(format); err != nil {
+			t.Errorf("ValidateQueueFormat(%s) error: %s", format, err)
+		}
+	}
+	if err := ValidateQueueFormat(FORMAT_DOT); err == nil {
+		t.Errorf("ValidateQueueFormat(%s) should fail", FORMAT_DOT)
+	}
+}
+
 func Test_getMetadataPaths(t *testing.T) {
 	type args struct {
 		alignLog string
@@ -41,6 +144,12 @@ func Test_getMetadataPaths(t *testing.T) {
 			args: args{alignLog: "REST Client returned for project versions: {}"},
 			want: nil,
 		},
+		{
+			name: "wrapped with type and classifier",
+			args: args{alignLog: mavenAlignLog},
+			want: []string{"org/sonatype/oss/oss-parent/maven-metadata.xml", "junit/junit/maven-metadata.xml",
+				"org/apache/commons/commons-lang3/maven-metadata.xml", "io/netty/netty-transport-native-epoll/maven-metadata.xml"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -50,3 +159,46 @@ func Test_getMetadataPaths(t *testing.T) {
 		})
 	}
 }
+
+const mavenAlignLog = `[2021-05-27T09:11:40.567Z] INFO  org.commonjava.maven.ext.core.state.RESTState - REST Client returned: {
+  org.sonatype.oss:oss-parent:9=9.0.0.redhat-2,
+  junit:junit:4.13.1=4.13.1 ,org.apache.commons:commons-lang3:jar:3.9=3.9.0.redhat-1,
+  io.netty:netty-transport-native-epoll:jar:linux-x86_64:4.1.48.Final=4.1.48.Final-redhat-00001,
+  junit:junit:jar:tests:4.13.1=4.13.1, not-a-gav}
+[2021-05-27T09:11:41.002Z] INFO  REST Client returned for project versions: {}`
+
+// npmAlignLog has the result of the project manipulator quoted as a json string, with a scoped name and
+// values containing commas and colons
+const npmAlignLog = `[2021-06-01T10:00:00.000Z] INFO  Running project manipulator
+[2021-06-01T10:00:05.000Z] INFO  Got project manipulator result data: "{\"name\":\"@redhat/opossum\",\"version\":\"5.0.1-redhat-00001\",\"repository\":\"git+https://github.com/nodeshift/opossum.git\",\"description\":\"A fail-fast circuit breaker, for promises: and callbacks\"}"
+[2021-06-01T10:00:05.100Z] INFO  Alignment done`
+
+// npmAlignLogRaw has the result pretty printed and quoted without escaping, with dependencies
+const npmAlignLogRaw = `[2021-06-01T10:00:05.000Z] INFO  Got project manipulator result data: "{
+  "name" : "my-app",
+  "version" : "1.0.0-redhat-00002",
+  "dependencies" : { "@redhat/opossum" : "5.0.1-redhat-00001", "left-pad" : "1.3.0" },
+  "devDependencies" : { "mocha" : "^8.0.0" },
+  "config" : { "url" : "http://registry:8080/a,b" }
+}"
+[2021-06-01T10:00:06.000Z] INFO  Got project manipulator result data: "{"name":"left-pad"}"
+[2021-06-01T10:00:07.000Z] INFO  Got project manipulator result data: not json`
+
+func Test_getNPMMetadataPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		alignLog string
+		want     []string
+	}{
+		{"quoted", npmAlignLog, []string{"@redhat%2fopossum"}},
+		{"raw with dependencies", npmAlignLogRaw, []string{"my-app", "@redhat%2fopossum", "left-pad", "mocha"}},
+		{"none", "Got project manipulator result data: {}", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getNPMMetadataPaths(tt.alignLog); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getNPMMetadataPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+const VALIDATE_REPORT_SUITE = "dataset-validate"
+
+// The severities of the problems found by the validation, only errors make a build unhealthy by default
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+)
+
+var checksumRegexps = map[string]*regexp.Regexp{
+	common.CHECKSUM_MD5:    regexp.MustCompile(`^[0-9a-fA-F]{32}$`),
+	common.CHECKSUM_SHA1:   regexp.MustCompile(`^[0-9a-fA-F]{40}$`),
+	common.CHECKSUM_SHA256: regexp.MustCompile(`^[0-9a-fA-F]{64}$`),
+}
+
+// Problem is something wrong in a file of a build
+type Problem struct {
+	File     string `json:"file"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// BuildHealth is the result of the validation of a build of the dataset
+type BuildHealth struct {
+	// BuildId is the path of the build in the dataset, e.g., "2836" or "2836/builds/AMJMVSDA5EAAE" in a group
+	BuildId   string    `json:"buildId"`
+	BuildType string    `json:"buildType"`
+	Group     bool      `json:"group,omitempty"`
+	Uploads   int       `json:"uploads"`
+	Downloads int       `json:"downloads"`
+	Metadata  int       `json:"metadata"`
+	Problems  []Problem `json:"problems"`
+}
+
+func (h *BuildHealth) problem(file, severity, format string, a ...interface{}) {
+	h.Problems = append(h.Problems, Problem{File: file, Severity: severity, Message: fmt.Sprintf(format, a...)})
+}
+
+// Count returns the number of problems of the severity
+func (h *BuildHealth) Count(severity string) int {
+	n := 0
+	for _, p := range h.Problems {
+		if p.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// Healthy is true if the build has no errors, and no warnings either if strict
+func (h *BuildHealth) Healthy(strict bool) bool {
+	return h.Count(SEVERITY_ERROR) == 0 && (!strict || h.Count(SEVERITY_WARNING) == 0)
+}
+
+// datasetFiles are the files of a build or a group build in the dataset, see Run
+var datasetFiles = []string{INFO_JSON, BUILD_JSON, GROUP_BUILD_JSON, DA_JSON, TRACKING_JSON, ADDITIONAL_REPOS,
+	DEPENDENCY_GRAPH_JSON, BUILD_QUEUE_YAML, BUILD_QUEUE_JSON, BUILDS_DIR}
+
+// ValidateDataset walks the dataset repo layout documented in Run. Each directory with any of the dataset files
+// is a normal build or, with a dependency-graph.json, a group build whose builds are validated too. The other
+// directories are skipped.
+func ValidateDataset(dir string) ([]BuildHealth, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var results []BuildHealth
+	for _, f := range files {
+		if !f.IsDir() || strings.HasPrefix(f.Name(), ".") || !hasDatasetFiles(path.Join(dir, f.Name())) {
+			continue
+		}
+		if common.FileOrDirExists(path.Join(dir, f.Name(), DEPENDENCY_GRAPH_JSON)) {
+			results = append(results, validateGroup(dir, f.Name())...)
+		} else {
+			results = append(results, ValidateBuild(dir, f.Name()))
+		}
+	}
+	return results, nil
+}
+
+func hasDatasetFiles(buildDir string) bool {
+	for _, file := range datasetFiles {
+		if common.FileOrDirExists(path.Join(buildDir, file)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateBuild validates a normal build, or a build of a group, e.g., "2836/builds/AMJMVSDA5EAAE", whose type
+// is in the info.json of the group
+func ValidateBuild(dir, buildId string) BuildHealth {
+	infoDir := path.Join(dir, buildId)
+	if toks := strings.Split(buildId, "/"); len(toks) == 3 && toks[1] == BUILDS_DIR {
+		infoDir = path.Join(dir, toks[0])
+	}
+	health := BuildHealth{BuildId: buildId, Problems: []Problem{}}
+	if info, ok := validateInfo(&health, path.Join(infoDir, INFO_JSON)); ok {
+		health.BuildType = info.BuildType
+	}
+	validateBuildFiles(&health, path.Join(dir, buildId))
+	return health
+}
+
+func validateBuildFiles(health *BuildHealth, buildDir string) {
+	validateMetadataPaths(health, path.Join(buildDir, DA_JSON))
+	validateTracking(health, path.Join(buildDir, TRACKING_JSON))
+	if fileLoc := path.Join(buildDir, ADDITIONAL_REPOS); common.FileOrDirExists(fileLoc) {
+		var repos []string
+		if readJSON(health, fileLoc, &repos) {
+			for _, repo := range repos {
+				if _, err := common.ParseStoreKey(repo); err != nil {
+					health.problem(ADDITIONAL_REPOS, SEVERITY_ERROR, "%s", err)
+				}
+			}
+		}
+	}
+}
+
+func validateGroup(dir, groupId string) []BuildHealth {
+	groupDir := path.Join(dir, groupId)
+	health := BuildHealth{BuildId: groupId, Group: true, Problems: []Problem{}}
+	if info, ok := validateInfo(&health, path.Join(groupDir, INFO_JSON)); ok {
+		health.BuildType = info.BuildType
+	}
+	var graph DepGraph
+	if !readJSON(&health, path.Join(groupDir, DEPENDENCY_GRAPH_JSON), &graph) {
+		return []BuildHealth{health}
+	}
+	dag := NewDAGFromDepGraph(graph)
+	if _, err := dag.Levels(); err != nil {
+		health.problem(DEPENDENCY_GRAPH_JSON, SEVERITY_ERROR, "%s", err)
+	}
+	for _, v := range dag.Vertices() {
+		if _, ok := graph.Vertices[v]; !ok {
+			health.problem(DEPENDENCY_GRAPH_JSON, SEVERITY_WARNING, "build %s of the edges is not a vertex", v)
+		}
+	}
+	queueFileLoc := BuildQueueFile(groupDir)
+	queueFile := path.Base(queueFileLoc)
+	if !common.FileOrDirExists(queueFileLoc) {
+		health.problem(queueFile, SEVERITY_ERROR, "file not found")
+	} else if queue, err := LoadBuildQueue(queueFileLoc); err != nil {
+		health.problem(queueFile, SEVERITY_ERROR, "%s", err)
+	} else {
+		queued := make(map[string]bool)
+		for _, level := range queue {
+			for _, b := range level.Items {
+				queued[b] = true
+			}
+		}
+		for _, v := range dag.Vertices() {
+			if !queued[v] {
+				health.problem(queueFile, SEVERITY_ERROR, "build %s of the dependency graph is not queued", v)
+			}
+		}
+		for _, b := range sortedKeys(queued) {
+			if _, ok := dag.vertices[b]; !ok {
+				health.problem(queueFile, SEVERITY_ERROR, "build %s is not in the dependency graph", b)
+			}
+		}
+	}
+
+	results := []BuildHealth{health}
+	for _, v := range dag.Vertices() {
+		build := BuildHealth{BuildId: path.Join(groupId, BUILDS_DIR, v), BuildType: health.BuildType, Problems: []Problem{}}
+		if common.FileOrDirExists(path.Join(dir, build.BuildId)) {
+			validateBuildFiles(&build, path.Join(dir, build.BuildId))
+		} else {
+			build.problem(BUILDS_DIR, SEVERITY_ERROR, "directory of the build not found")
+		}
+		results = append(results, build)
+	}
+	return results
+}
+
+func validateInfo(health *BuildHealth, fileLoc string) (Info, bool) {
+	var info Info
+	if !readJSON(health, fileLoc, &info) {
+		return info, false
+	}
+	if info.PncBaseUrl == "" {
+		health.problem(INFO_JSON, SEVERITY_ERROR, "pncBaseUrl is empty")
+	}
+	if info.BuildId == "" {
+		health.problem(INFO_JSON, SEVERITY_ERROR, "buildId is empty")
+	}
+	if info.BuildType != BUILD_MVN && info.BuildType != BUILD_NPM {
+		health.problem(INFO_JSON, SEVERITY_ERROR, "buildType should be %s or %s, got %q", BUILD_MVN, BUILD_NPM, info.BuildType)
+	}
+	return info, true
+}
+
+func validateMetadataPaths(health *BuildHealth, fileLoc string) {
+	var paths []string
+	if !readJSON(health, fileLoc, &paths) {
+		return
+	}
+	health.Metadata = len(paths)
+	for _, p := range paths {
+		switch {
+		case strings.TrimSpace(p) == "":
+			health.problem(DA_JSON, SEVERITY_ERROR, "empty metadata path")
+		case strings.HasPrefix(p, "/"):
+			health.problem(DA_JSON, SEVERITY_ERROR, "metadata path %s should be relative", p)
+		case health.BuildType == BUILD_MVN && !strings.HasSuffix(p, common.MAVEN_METADATA_XML):
+			health.problem(DA_JSON, SEVERITY_ERROR, "metadata path %s is not a %s", p, common.MAVEN_METADATA_XML)
+		case health.BuildType == BUILD_NPM && strings.Contains(p, "/"):
+			health.problem(DA_JSON, SEVERITY_ERROR, "metadata path %s should be a package name, with the scope encoded as %s", p, common.NpmMetadataPath("@scope/name"))
+		}
+	}
+}
+
+// validateTracking checks the record can be replayed. The uploads should be in one hosted repo of the package
+// type of the build, which is promoted by the integration test, and the checksums should be well-formed.
+func validateTracking(health *BuildHealth, fileLoc string) {
+	var record common.TrackedContent
+	if !readJSON(health, fileLoc, &record) {
+		return
+	}
+	health.Uploads, health.Downloads = len(record.Uploads), len(record.Downloads)
+	if record.TrackingKey.Id == "" {
+		health.problem(TRACKING_JSON, SEVERITY_ERROR, "the tracking key id is empty")
+	}
+	if len(record.Uploads) == 0 {
+		health.problem(TRACKING_JSON, SEVERITY_ERROR, "no uploads")
+	}
+	packageType := "maven"
+	if health.BuildType == BUILD_NPM {
+		packageType = "npm"
+	}
+	uploadStores := make(map[string]bool)
+	for _, e := range record.Uploads {
+		validateEntry(health, "upload", e)
+		if key, err := common.ParseStoreKey(e.StoreKey); err == nil {
+			uploadStores[e.StoreKey] = true
+			if key.Type != common.STORE_TYPE_HOSTED {
+				health.problem(TRACKING_JSON, SEVERITY_ERROR, "upload %s is not in a hosted repo, %s", e.Path, e.StoreKey)
+			}
+			if health.BuildType != "" && key.PackageType != packageType {
+				health.problem(TRACKING_JSON, SEVERITY_ERROR, "upload %s is not in a %s repo, %s", e.Path, packageType, e.StoreKey)
+			}
+		}
+	}
+	if len(uploadStores) > 1 {
+		health.problem(TRACKING_JSON, SEVERITY_ERROR, "uploads are in more than one repo: %s", strings.Join(sortedKeys(uploadStores), ", "))
+	}
+	for _, e := range record.Downloads {
+		validateEntry(health, "download", e)
+	}
+	for _, section := range []struct {
+		name    string
+		entries []common.TrackedContentEntry
+	}{{"upload", record.Uploads}, {"download", record.Downloads}} {
+		seen := make(map[string]bool)
+		var duplicated []string
+		for _, e := range section.entries {
+			key := e.StoreKey + ":" + e.Path
+			if seen[key] {
+				duplicated = append(duplicated, e.Path)
+			}
+			seen[key] = true
+		}
+		if len(duplicated) > 0 {
+			sort.Strings(duplicated)
+			health.problem(TRACKING_JSON, SEVERITY_WARNING, "duplicated %ss: %s", section.name, strings.Join(duplicated, ", "))
+		}
+	}
+}
+
+func validateEntry(health *BuildHealth, kind string, e common.TrackedContentEntry) {
+	if e.Path == "" {
+		health.problem(TRACKING_JSON, SEVERITY_ERROR, "%s without path in %s", kind, e.StoreKey)
+		return
+	}
+	if _, err := common.ParseStoreKey(e.StoreKey); err != nil {
+		health.problem(TRACKING_JSON, SEVERITY_ERROR, "%s %s: %s", kind, e.Path, err)
+	}
+	checksums := map[string]string{common.CHECKSUM_MD5: e.Md5, common.CHECKSUM_SHA1: e.Sha1, common.CHECKSUM_SHA256: e.Sha256}
+	for _, algorithm := range common.ALL_CHECKSUMS {
+		if v := checksums[algorithm]; v != "" && !checksumRegexps[algorithm].MatchString(v) {
+			health.problem(TRACKING_JSON, SEVERITY_ERROR, "%s %s: invalid %s %q", kind, e.Path, algorithm, v)
+		}
+	}
+	if e.Md5 == "" && e.Sha1 == "" && e.Sha256 == "" && !common.IsMetadata(e.Path, e.StoreKey) {
+		health.problem(TRACKING_JSON, SEVERITY_WARNING, "%s %s has no checksum to verify", kind, e.Path)
+	}
+}
+
+// readJSON decodes the file into v. An unknown field is a warning only, the file may come from a newer version.
+func readJSON(health *BuildHealth, fileLoc string, v interface{}) bool {
+	file := path.Base(fileLoc)
+	b, err := ioutil.ReadFile(fileLoc)
+	if os.IsNotExist(err) {
+		health.problem(file, SEVERITY_ERROR, "file not found")
+		return false
+	} else if err != nil {
+		health.problem(file, SEVERITY_ERROR, "%s", err)
+		return false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if lenient := json.Unmarshal(b, v); lenient != nil {
+			health.problem(file, SEVERITY_ERROR, "invalid json, %s", lenient)
+			return false
+		}
+		health.problem(file, SEVERITY_WARNING, "%s", err)
+	}
+	return true
+}
+
+// PrintHealth prints a table of the builds and their problems
+func PrintHealth(w io.Writer, results []BuildHealth) {
+	fmt.Fprintf(w, "%-40s %-5s %8s %10s %9s %7s %9s  %s\n", "BUILD", "TYPE", "UPLOADS", "DOWNLOADS", "METADATA", "ERRORS", "WARNINGS", "STATUS")
+	for _, h := range results {
+		status := "OK"
+		if h.Count(SEVERITY_ERROR) > 0 {
+			status = "FAIL"
+		} else if h.Count(SEVERITY_WARNING) > 0 {
+			status = "WARN"
+		}
+		buildType := h.BuildType
+		if h.Group {
+			buildType += "*"
+		}
+		fmt.Fprintf(w, "%-40s %-5s %8d %10d %9d %7d %9d  %s\n", h.BuildId, buildType, h.Uploads, h.Downloads, h.Metadata,
+			h.Count(SEVERITY_ERROR), h.Count(SEVERITY_WARNING), status)
+	}
+	for _, h := range results {
+		for _, p := range h.Problems {
+			fmt.Fprintf(w, "  [%s] %s/%s: %s\n", strings.ToUpper(p.Severity), h.BuildId, p.File, p.Message)
+		}
+	}
+	fmt.Fprintf(w, "(* group build)\n")
+}
+
+// ReportHealth adds a case per build to the run report and returns whether all builds are healthy
+func ReportHealth(results []BuildHealth, strict bool) bool {
+	suite := report.GetSuite(VALIDATE_REPORT_SUITE)
+	healthy := true
+	for _, h := range results {
+		var messages []string
+		for _, p := range h.Problems {
+			messages = append(messages, fmt.Sprintf("[%s] %s: %s", p.Severity, p.File, p.Message))
+		}
+		status := report.StatusPassed
+		if !h.Healthy(strict) {
+			status = report.StatusFailed
+			healthy = false
+		}
+		suite.Add(h.BuildId, status, 0, strings.Join(messages, "; ")).
+			Set("buildType", h.BuildType).Set("uploads", h.Uploads).Set("downloads", h.Downloads).Set("metadata", h.Metadata)
+	}
+	return healthy
+}
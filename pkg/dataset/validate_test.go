@@ -0,0 +1,245 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package dataset
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const validTracking = `{
+  "key": {"id": "build-AMJMVSDA5EAAA"},
+  "uploads": [
+    {"storeKey": "maven:hosted:build-AMJMVSDA5EAAA", "path": "/org/foo/foo/1.0/foo-1.0.jar",
+     "md5": "d41d8cd98f00b204e9800998ecf8427e", "sha1": "da39a3ee5e6b4b0d3255bfef95601890afd80709"}
+  ],
+  "downloads": [
+    {"storeKey": "maven:remote:central", "path": "/org/bar/bar/2.0/bar-2.0.jar",
+     "sha256": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}
+  ]
+}`
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		fileLoc := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(fileLoc), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fileLoc, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func hasProblem(h BuildHealth, severity, file, message string) bool {
+	for _, p := range h.Problems {
+		if p.Severity == severity && p.File == file && strings.Contains(p.Message, message) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateBuild(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"AMJMVSDA5EAAA/info.json":             `{"pncBaseUrl": "http://orch", "buildId": "AMJMVSDA5EAAA", "buildType": "MVN", "temporaryBuild": false}`,
+		"AMJMVSDA5EAAA/da.json":               `["org/foo/foo/maven-metadata.xml"]`,
+		"AMJMVSDA5EAAA/tracking.json":         validTracking,
+		"AMJMVSDA5EAAA/additional-repos.json": `["maven:remote:central"]`,
+	})
+	h := ValidateBuild(dir, "AMJMVSDA5EAAA")
+	if len(h.Problems) != 0 {
+		t.Errorf("ValidateBuild() problems = %v, want none", h.Problems)
+	}
+	if h.BuildType != BUILD_MVN || h.Uploads != 1 || h.Downloads != 1 || h.Metadata != 1 {
+		t.Errorf("ValidateBuild() = %+v", h)
+	}
+	if !h.Healthy(true) {
+		t.Errorf("Healthy(true) = false, want true")
+	}
+}
+
+func TestValidateBuildProblems(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"1/info.json": `{"pncBaseUrl": "http://orch", "buildId": "1", "buildType": "MVN", "extra": true}`,
+		"1/da.json":   `["org/foo/foo/1.0/foo-1.0.pom", "/org/bar/maven-metadata.xml"]`,
+		"1/tracking.json": `{
+  "key": {"id": "build-1"},
+  "uploads": [
+    {"storeKey": "maven:hosted:build-1", "path": "/a.jar", "md5": "xyz"},
+    {"storeKey": "maven:hosted:build-2", "path": "/b.jar", "sha1": "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+    {"storeKey": "npm:remote:npmjs", "path": "/c.tgz", "sha1": "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+    {"storeKey": "maven:hosted:build-1", "path": "/a.jar", "md5": "xyz"}
+  ],
+  "downloads": [{"storeKey": "bad", "path": "/d.jar"}]
+}`,
+		"1/additional-repos.json": `["maven:unknown:x"]`,
+	})
+	h := ValidateBuild(dir, "1")
+	for _, want := range []struct{ severity, file, message string }{
+		{SEVERITY_WARNING, INFO_JSON, "extra"},
+		{SEVERITY_ERROR, DA_JSON, "is not a maven-metadata.xml"},
+		{SEVERITY_ERROR, DA_JSON, "should be relative"},
+		{SEVERITY_ERROR, TRACKING_JSON, "invalid md5"},
+		{SEVERITY_ERROR, TRACKING_JSON, "more than one repo"},
+		{SEVERITY_ERROR, TRACKING_JSON, "not in a hosted repo"},
+		{SEVERITY_ERROR, TRACKING_JSON, "not in a maven repo"},
+		{SEVERITY_ERROR, TRACKING_JSON, "download /d.jar"},
+		{SEVERITY_WARNING, TRACKING_JSON, "duplicated uploads: /a.jar"},
+		{SEVERITY_WARNING, TRACKING_JSON, "/d.jar has no checksum"},
+		{SEVERITY_ERROR, ADDITIONAL_REPOS, "maven:unknown:x"},
+	} {
+		if !hasProblem(h, want.severity, want.file, want.message) {
+			t.Errorf("ValidateBuild() misses the %s in %s: %s, got %v", want.severity, want.file, want.message, h.Problems)
+		}
+	}
+	if h.Healthy(false) {
+		t.Errorf("Healthy(false) = true, want false")
+	}
+}
+
+func TestValidateBuildMissingFiles(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{"1/info.json": `{"pncBaseUrl": "http://orch", "buildId": "1", "buildType": "GRADLE"}`, "1/da.json": `{`})
+	h := ValidateBuild(dir, "1")
+	for _, want := range []struct{ file, message string }{
+		{INFO_JSON, "buildType"}, {DA_JSON, "invalid json"}, {TRACKING_JSON, "file not found"},
+	} {
+		if !hasProblem(h, SEVERITY_ERROR, want.file, want.message) {
+			t.Errorf("ValidateBuild() misses the error in %s: %s, got %v", want.file, want.message, h.Problems)
+		}
+	}
+}
+
+func TestValidateBuildNPM(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"1/info.json":     `{"pncBaseUrl": "http://orch", "buildId": "1", "buildType": "NPM"}`,
+		"1/da.json":       `["@redhat%2fopossum", "@redhat/my-app"]`,
+		"1/tracking.json": strings.Replace(validTracking, "maven:hosted:", "npm:hosted:", 1),
+	})
+	h := ValidateBuild(dir, "1")
+	if len(h.Problems) != 1 || !hasProblem(h, SEVERITY_ERROR, DA_JSON, "@redhat/my-app should be a package name") {
+		t.Errorf("ValidateBuild() problems = %v, want the unencoded scope only", h.Problems)
+	}
+}
+
+func TestValidateDatasetGroup(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		".git/info.json":              `{}`,
+		"2836/info.json":              `{"pncBaseUrl": "http://orch", "buildId": "2836", "buildType": "MVN"}`,
+		"2836/dependency-graph.json":  `{"vertices": {"a": {}, "b": {}, "c": {}}, "edges": [{"source": "a", "target": "b"}]}`,
+		"2836/build-queue.yaml":       "- id: id1\n  build:\n  - b\n  - x\n- id: id2\n  build:\n  - a\n",
+		"2836/builds/a/da.json":       `["org/foo/foo/maven-metadata.xml"]`,
+		"2836/builds/a/tracking.json": validTracking,
+		"2836/builds/b/da.json":       `[]`,
+		"2836/builds/b/tracking.json": validTracking,
+		"AMJMVSDA5EAAA/info.json":     `{"pncBaseUrl": "http://orch", "buildId": "AMJMVSDA5EAAA", "buildType": "MVN"}`,
+		"AMJMVSDA5EAAA/da.json":       `[]`,
+		"AMJMVSDA5EAAA/tracking.json": validTracking,
+		"not-a-build/README":          "",
+	})
+	results, err := ValidateDataset(dir)
+	if err != nil {
+		t.Fatalf("ValidateDataset() error: %s", err)
+	}
+	var ids []string
+	byId := make(map[string]BuildHealth)
+	for _, h := range results {
+		ids = append(ids, h.BuildId)
+		byId[h.BuildId] = h
+	}
+	want := "2836 2836/builds/a 2836/builds/b 2836/builds/c AMJMVSDA5EAAA"
+	if strings.Join(ids, " ") != want {
+		t.Fatalf("ValidateDataset() builds = %v, want %s", ids, want)
+	}
+	group := byId["2836"]
+	if !group.Group || !hasProblem(group, SEVERITY_ERROR, BUILD_QUEUE_YAML, "c of the dependency graph is not queued") ||
+		!hasProblem(group, SEVERITY_ERROR, BUILD_QUEUE_YAML, "x is not in the dependency graph") {
+		t.Errorf("group problems = %v", group.Problems)
+	}
+	if c := byId["2836/builds/c"]; !hasProblem(c, SEVERITY_ERROR, BUILDS_DIR, "not found") {
+		t.Errorf("missing build problems = %v", c.Problems)
+	}
+	for _, id := range []string{"2836/builds/a", "2836/builds/b", "AMJMVSDA5EAAA"} {
+		if h := byId[id]; !h.Healthy(true) || h.BuildType != BUILD_MVN {
+			t.Errorf("%s = %+v, want healthy", id, h)
+		}
+	}
+
+	var out bytes.Buffer
+	PrintHealth(&out, results)
+	if !strings.Contains(out.String(), "2836/builds/c") || !strings.Contains(out.String(), "FAIL") {
+		t.Errorf("PrintHealth() = %s", out.String())
+	}
+}
+
+func TestValidateDatasetMissingInfo(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"1/da.json":       `[]`,
+		"1/tracking.json": validTracking,
+		"docs/README":     "",
+	})
+	results, err := ValidateDataset(dir)
+	if err != nil {
+		t.Fatalf("ValidateDataset() error: %s", err)
+	}
+	if len(results) != 1 || results[0].BuildId != "1" {
+		t.Fatalf("ValidateDataset() = %v, want only the build without info.json", results)
+	}
+	if !hasProblem(results[0], SEVERITY_ERROR, INFO_JSON, "file not found") || results[0].Healthy(false) {
+		t.Errorf("build problems = %v", results[0].Problems)
+	}
+}
+
+func TestValidateDatasetCycle(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"1/info.json":             `{"pncBaseUrl": "http://orch", "buildId": "1", "buildType": "NPM"}`,
+		"1/dependency-graph.json": `{"vertices": {"a": {}, "b": {}}, "edges": [{"source": "a", "target": "b"}, {"source": "b", "target": "a"}]}`,
+	})
+	results, err := ValidateDataset(dir)
+	if err != nil {
+		t.Fatalf("ValidateDataset() error: %s", err)
+	}
+	if !hasProblem(results[0], SEVERITY_ERROR, DEPENDENCY_GRAPH_JSON, "cycle") {
+		t.Errorf("group problems = %v", results[0].Problems)
+	}
+}
@@ -5,12 +5,19 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"path"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+const (
+	PACKAGE_TYPE_MAVEN = "maven"
+	PACKAGE_TYPE_NPM   = "npm"
 )
 
 type Report struct {
@@ -40,41 +47,51 @@ type Report struct {
 	} `json:"modules"`
 }
 
-func lookupMetadata(url string) {
+// lookupMetadata gets the metadata, and checks an npm one is a valid packument
+func lookupMetadata(url, packageType string) (int, error) {
 	fmt.Println(url)
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		panic(err)
+		return 0, err
+	}
+	if packageType == PACKAGE_TYPE_NPM {
+		req.Header.Set("Accept", common.ContentTypeJSON)
+	} else {
+		req.Header.Set("Accept", "application/xml")
 	}
-	req.Header.Set("Accept", "application/xml")
 
-	var c http.Client
-	resp, err := c.Do(req)
+	resp, err := common.DefaultIndyClient().Do(req)
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 	defer resp.Body.Close()
 
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		panic(err)
+		return resp.StatusCode, err
 	}
 	bodyString := string(bodyBytes)
 
 	if strings.Contains(bodyString, "Message:") {
 		fmt.Print(bodyString)
 	}
+	if packageType == PACKAGE_TYPE_NPM && resp.StatusCode == common.StatusOK {
+		if _, err := common.ParsePackument(bodyBytes); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
 }
 
-func Run(targetIndy, daGroup string, dataDir string, processNum int) {
+// Run looks up the metadata of the files in dataDir from the DA group. A file is a da.json of a dataset, or a
+// PME report of a maven build.
+func Run(targetIndy, daGroup, dataDir, packageType string, processNum int) {
 
-	indyHost, validated := common.ValidateTargetIndy(targetIndy)
+	indyURL, validated := common.ValidateTargetIndy(targetIndy)
 	if !validated {
-		os.Exit(1)
+		report.Exit(1)
 	}
 
-	indyURL := "http://" + indyHost
-
 	routines := processNum
 
 	var urls []string
@@ -85,46 +102,74 @@ func Run(targetIndy, daGroup string, dataDir string, processNum int) {
 	}
 
 	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
 		fmt.Println(f.Name())
 
-		jsonFile, err := os.Open(dataDir + f.Name())
-
+		byteValue, err := ioutil.ReadFile(path.Join(dataDir, f.Name()))
 		if err != nil {
 			panic(err)
 		}
 
-		byteValue, _ := ioutil.ReadAll(jsonFile)
+		paths, err := metadataPaths(byteValue, packageType)
+		if err != nil {
+			fmt.Printf("Warning: skip %s, %s\n", f.Name(), err)
+			continue
+		}
+		for _, p := range paths {
+			urls = append(urls, common.GetIndyContentUrl(indyURL, packageType, "group", daGroup, p))
+		}
+	}
 
-		var report Report
+	if !LookupMetadataByRoutines(urls, routines, packageType) {
+		report.Exit(1)
+	}
+}
 
-		json.Unmarshal(byteValue, &report)
+// metadataPaths gets the paths of a da.json, or of the managed dependencies of a maven PME report
+func metadataPaths(byteValue []byte, packageType string) ([]string, error) {
+	var paths []string
+	if err := json.Unmarshal(byteValue, &paths); err == nil {
+		fmt.Println("Metadata paths: ", len(paths))
+		return paths, nil
+	}
+	if packageType != PACKAGE_TYPE_MAVEN {
+		return nil, fmt.Errorf("not a json array of %s metadata paths", packageType)
+	}
 
-		fmt.Println("Modules length: ", len(report.Modules))
+	var report Report
+	if err := json.Unmarshal(byteValue, &report); err != nil {
+		return nil, err
+	}
 
-		for _, module := range report.Modules {
-			for _, element := range module.ManagedDependencies.Dependencies {
+	fmt.Println("Modules length: ", len(report.Modules))
 
-				groupId := element.GroupID
-				artifactId := element.ArtifactID
+	for _, module := range report.Modules {
+		for _, element := range module.ManagedDependencies.Dependencies {
 
-				fmt.Println("GroupID: ", groupId, " ArtifactId: ", artifactId)
+			groupId := element.GroupID
+			artifactId := element.ArtifactID
 
-				groupIdPath := strings.ReplaceAll(groupId, ".", "/")
+			fmt.Println("GroupID: ", groupId, " ArtifactId: ", artifactId)
 
-				url := fmt.Sprintf("%s/api/content/maven/group/%s/%s/%s/maven-metadata.xml", indyURL, daGroup, groupIdPath, artifactId)
+			groupIdPath := strings.ReplaceAll(groupId, ".", "/")
 
-				urls = append(urls, url)
-			}
+			paths = append(paths, path.Join(groupIdPath, artifactId, common.MAVEN_METADATA_XML))
 		}
 	}
-
-	LookupMetadataByRoutines(urls, routines)
+	return paths, nil
 }
 
-func LookupMetadataByRoutines(urls []string, routines int) {
+// LookupMetadataByRoutines requests the metadata urls of the package type in parallel and adds each of them to the "metadata" suite
+// of the run report. It returns false if any request failed.
+func LookupMetadataByRoutines(urls []string, routines int, packageType string) bool {
 	fmt.Println("Total requests: ", len(urls), "with routines:", routines)
+	common.DefaultMetrics().SetPhase("metadata")
 	concurrentGoroutines := make(chan struct{}, routines)
 	var wg sync.WaitGroup
+	var failed int32
+	suite := report.GetSuite("metadata")
 
 	for i := 0; i < len(urls); i++ {
 		concurrentGoroutines <- struct{}{}
@@ -133,7 +178,16 @@ func LookupMetadataByRoutines(urls []string, routines int) {
 			defer wg.Done()
 			fmt.Println("Doing", i)
 			start := time.Now()
-			lookupMetadata(urls[i])
+			c := suite.Start(urls[i])
+			status, err := lookupMetadata(urls[i], packageType)
+			if status != 0 {
+				c.Set("status", status)
+			}
+			c.Done(err)
+			if err != nil {
+				fmt.Printf("Lookup %s failed, error: %s\n", urls[i], err)
+				atomic.AddInt32(&failed, 1)
+			}
 			elapsed := time.Since(start)
 			fmt.Println("Finished #", i, " in ", elapsed)
 			<-concurrentGoroutines
@@ -141,4 +195,5 @@ func LookupMetadataByRoutines(urls []string, routines int) {
 	}
 
 	wg.Wait()
+	return failed == 0
 }
@@ -1,14 +1,13 @@
 package event
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
-	"os"
+	"sort"
 	"strings"
-	"time"
 
 	common "github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
 const (
@@ -23,6 +22,7 @@ const (
 	MERGED_MAVEN_METADATA_PATH = "org/apache/apache/maven-metadata.xml"
 	REMOTE_VERSION_TAG         = "<version>2</version>"
 	LATEST_HOSTED_VERSION_TAG  = "<latest>666</latest>"
+	MAVEN_CENTRAL_URL          = "https://repo.maven.apache.org/maven2/"
 	HOSTED_POM_CONTENT         = "<project><modelVersion>4.0.0</modelVersion><groupId>org.apache</groupId><artifactId>apache</artifactId><version>666</version><packaging>pom</packaging></project>"
 )
 
@@ -49,31 +49,26 @@ func decideMeta(buildType string) *BuildMetadata {
 	return nil
 }
 
-func prepareIndyRepos(indyURL, buildName string, buildMeta BuildMetadata, additionalRepos []string, dryRun bool) {
+func prepareIndyRepos(indyURL, buildName string, buildMeta BuildMetadata, additionalRepos []string, dryRun bool, wait common.WaitOptions) {
 	if dryRun {
 		fmt.Printf("Dry run prepareIndyRepos\n")
 		return
 	}
 	prepareIndyHosted(indyURL, buildMeta.buildType, buildName, false)
 	prepareIndyHostedUploadContent(indyURL, buildMeta.buildType, buildName)
-	prepareIndyRemote(indyURL, buildMeta.buildType, buildName)
-	prepareIndyGroup(indyURL, buildName, buildMeta, additionalRepos)
+	prepareIndyRemote(indyURL, buildMeta.buildType, buildName, wait)
+	prepareIndyGroup(indyURL, buildName, buildMeta, additionalRepos, wait)
 }
 
 func prepareIndyHosted(indyURL, buildType, buildName string, disabled bool) {
-	hostedVars := IndyHostedVars{
-		Name:     buildName,
-		Type:     buildType,
-		Disabled: disabled,
-	}
-	URL := fmt.Sprintf("%s/api/admin/stores/%s/hosted/%s", indyURL, buildType, buildName)
+	hosted := common.NewHostedRepository(buildType, buildName)
+	hosted.Disabled = disabled
 
-	hosted := IndyHostedTemplate(&hostedVars)
 	fmt.Printf("Start creating/updating hosted repo %s, disabled: %v\n", buildName, disabled)
-	result := putRequest(URL, strings.NewReader(hosted))
-	if !result {
-		fmt.Printf("Error: Failed to create/update hosted repo %s, disabled: %v.\n\n", buildName, disabled)
-		os.Exit(1)
+	err := newStoreClient(indyURL).Update(hosted)
+	if err != nil {
+		fmt.Printf("Error: Failed to create/update hosted repo %s, disabled: %v. Cause: %s\n\n", buildName, disabled, err)
+		report.Exit(1)
 	}
 	fmt.Printf("Create/Update hosted repo %s successfully, disabled: %v\n", buildName, disabled)
 }
@@ -85,46 +80,40 @@ func prepareIndyHostedUploadContent(indyURL, buildType, buildName string) {
 	result := putRequest(URL, strings.NewReader(HOSTED_POM_CONTENT))
 	if !result {
 		fmt.Printf("Error: Failed to upload content to hosted repo %s.\n\n", buildName)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	fmt.Printf("Upload content to hosted repo %s successfully\n", buildName)
 }
 
-func prepareIndyRemote(indyURL, buildType, buildName string) {
+func prepareIndyRemote(indyURL, buildType, buildName string, wait common.WaitOptions) {
 	fmt.Println("Start remote repo creation validation.")
 	fmt.Printf("==========================================\n\n")
 
-	remoteVars := IndyRemoteVars{
-		Name: buildName,
-		Type: buildType,
-	}
-	URL := fmt.Sprintf("%s/api/admin/stores/%s/remote/%s", indyURL, buildType, buildName)
-
-	remote := IndyRemoteTemplate(&remoteVars)
+	remote := common.NewRemoteRepository(buildType, buildName, MAVEN_CENTRAL_URL)
 	fmt.Printf("Start creating remote repo %s\n", buildName)
-	result := putRequest(URL, strings.NewReader(remote))
-	if !result {
-		fmt.Printf("Error: Failed to create remote repo %s.\n\n", buildName)
-		os.Exit(1)
+	err := newStoreClient(indyURL).Update(remote)
+	if err != nil {
+		fmt.Printf("Error: Failed to create remote repo %s. Cause: %s\n\n", buildName, err)
+		report.Exit(1)
 	}
 	fmt.Printf("Create remote repo %s successfully\n", buildName)
 
-	fmt.Printf("Waiting 60s...\n")
-	time.Sleep(60 * time.Second)
-
 	// Verify the remote content path after repo creation
 	remoteContentURL := fmt.Sprintf("%s/api/content/%s/remote/%s/%s", indyURL, buildType, buildName, ACCESSIBLE_REMOTE_PATH)
+	waitFor("remote content of new remote repo", func() bool {
+		return available(remoteContentURL)
+	}, wait)
 	_, _, contentResult := getRequest(remoteContentURL)
 	if !contentResult {
 		fmt.Printf("Error: Failed to get content %s in remote %s.\n\n", remoteContentURL, buildName)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	fmt.Printf("Get remote content %s successfully\n", remoteContentURL)
 	fmt.Println("==========================================")
 	fmt.Printf("Finish remote repo creation validation.\n\n")
 }
 
-func prepareIndyGroup(indyURL, buildName string, buildMeta BuildMetadata, additionalRepos []string) {
+func prepareIndyGroup(indyURL, buildName string, buildMeta BuildMetadata, additionalRepos []string, wait common.WaitOptions) {
 	fmt.Println("Start group repo creation validation.")
 	fmt.Printf("==========================================\n\n")
 
@@ -134,53 +123,51 @@ func prepareIndyGroup(indyURL, buildName string, buildMeta BuildMetadata, additi
 	remoteChild := fmt.Sprintf("%s:remote:%s", buildType, buildName)
 	constituents = append(constituents, hostedChild)
 
-	URL := fmt.Sprintf("%s/api/admin/stores/%s/group/%s", indyURL, buildType, buildName)
-
-	created := createOrUpdateGroupRepo(URL, buildName, buildMeta, additionalRepos, constituents)
-	if !created {
-		fmt.Printf("Error: Failed to create group repo %s.\n\n", buildName)
-		os.Exit(1)
+	err := createOrUpdateGroupRepo(indyURL, buildName, buildMeta, additionalRepos, constituents)
+	if err != nil {
+		fmt.Printf("Error: Failed to create group repo %s. Cause: %s\n\n", buildName, err)
+		report.Exit(1)
 	}
 	fmt.Printf("Create group repo %s successfully\n", buildName)
 
 	// Update group to add remote constituent
 	constituents = append(constituents, remoteChild)
-	updated := createOrUpdateGroupRepo(URL, buildName, buildMeta, additionalRepos, constituents)
-	if !updated {
-		fmt.Printf("Error: Failed to update group repo %s.\n\n", buildName)
-		os.Exit(1)
+	err = createOrUpdateGroupRepo(indyURL, buildName, buildMeta, additionalRepos, constituents)
+	if err != nil {
+		fmt.Printf("Error: Failed to update group repo %s. Cause: %s\n\n", buildName, err)
+		report.Exit(1)
 	}
 	fmt.Printf("Update group repo %s successfully\n", buildName)
 
-	fmt.Printf("Waiting 60s...\n")
-	time.Sleep(60 * time.Second)
-
 	// Verify the merged path and metadata after remote constituent update
 	grpContentURL := fmt.Sprintf("%s/api/content/%s/group/%s/%s", indyURL, buildType, buildName, ACCESSIBLE_REMOTE_PATH)
+	grpMetadataURL := fmt.Sprintf("%s/api/content/%s/group/%s/%s", indyURL, buildType, buildName, MERGED_MAVEN_METADATA_PATH)
+	waitFor("remote constituent merged into group", func() bool {
+		return available(grpContentURL) && contains(grpMetadataURL, REMOTE_VERSION_TAG)
+	}, wait)
 	_, _, result := getRequest(grpContentURL)
 	if !result {
 		fmt.Printf("Error: Failed to get merged path %s in group %s.", grpContentURL, buildName)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	fmt.Printf("Get affected group merged path %s successfully\n", grpContentURL)
 
-	grpMetadataURL := fmt.Sprintf("%s/api/content/%s/group/%s/%s", indyURL, buildType, buildName, MERGED_MAVEN_METADATA_PATH)
 	metadata, _, mergedResult := getRequest(grpMetadataURL)
 	if !mergedResult {
 		fmt.Printf("Error: Failed to get group metadata, path: %s.\n\n", grpMetadataURL)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	index := strings.Index(metadata, REMOTE_VERSION_TAG)
 	if index < 0 {
 		fmt.Printf("Error: Failed to get correct merged metadata content, path: %s.\n\n", grpMetadataURL)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	fmt.Printf("Get correct merged metadata content successfully, path: %s\n", grpMetadataURL)
 	fmt.Println("==========================================")
 	fmt.Printf("Finish group repo creation validation.\n\n")
 }
 
-func createOrUpdateGroupRepo(URL, buildName string, buildMeta BuildMetadata, additionalRepos, childRepos []string) bool {
+func createOrUpdateGroupRepo(indyURL, buildName string, buildMeta BuildMetadata, additionalRepos, childRepos []string) error {
 	var constituents []string
 	if childRepos != nil {
 		constituents = append(constituents, childRepos...)
@@ -189,23 +176,19 @@ func createOrUpdateGroupRepo(URL, buildName string, buildMeta BuildMetadata, add
 		constituents = append(constituents, additionalRepos...)
 	}
 
-	groupVars := IndyGroupVars{
-		Name:         buildName,
-		Type:         buildMeta.buildType,
-		Constituents: constituents,
-	}
-	group := IndyGroupTemplate(&groupVars)
+	group := common.NewGroup(buildMeta.buildType, buildName, constituents...)
+	group.Metadata["metadata-timeout"] = "30"
 
 	fmt.Printf("Start creating/updating group repo %s\n", buildName)
-	return putRequest(URL, strings.NewReader(group))
+	return newStoreClient(indyURL).Update(group)
 }
 
-func DeleteIndyRepos(indyURL, packageType, buildName string, uploads map[string][]string) {
+func DeleteIndyRepos(indyURL, packageType, buildName string, uploads map[string][]string, wait common.WaitOptions) {
 	if !delAllowed(buildName) {
 		return
 	}
-	deleteIndyHosted(indyURL, packageType, buildName, uploads)
-	deleteIndyRemote(indyURL, packageType, buildName)
+	deleteIndyHosted(indyURL, packageType, buildName, uploads, wait)
+	deleteIndyRemote(indyURL, packageType, buildName, wait)
 	deleteIndyGroup(indyURL, packageType, buildName)
 }
 
@@ -218,110 +201,108 @@ func delAllowed(buildName string) bool {
 }
 
 // Verify cleanup for the hosted repo deleting
-func deleteIndyHosted(indyURL, buildType, repoName string, uploads map[string][]string) {
+func deleteIndyHosted(indyURL, buildType, repoName string, uploads map[string][]string, wait common.WaitOptions) {
 	fmt.Println("Start hosted repo cleanup.")
 	fmt.Printf("==========================================\n\n")
 	storePath := fmt.Sprintf("%s/%s/%s", buildType, "hosted", repoName)
-	hostedRepo := fmt.Sprintf("%s/api/admin/stores/%s", indyURL, storePath)
-	_, _, result := getRequest(hostedRepo)
-	if !result {
-		fmt.Printf("Error: Failed to get hosted repo %s.\n\n", repoName)
-		os.Exit(1)
+	hostedKey := common.StoreKey{PackageType: buildType, Type: common.STORE_TYPE_HOSTED, Name: repoName}
+	stores := newStoreClient(indyURL)
+	if _, err := stores.GetHosted(buildType, repoName); err != nil {
+		fmt.Printf("Error: Failed to get hosted repo %s. Cause: %s\n\n", repoName, err)
+		report.Exit(1)
 	}
 
-	fmt.Printf("Waiting 60s...\n")
-	time.Sleep(60 * time.Second)
 	// Verify the contents, merged paths and metadata before deleting hosted repo
+	grpMetadataURL := fmt.Sprintf("%s/api/content/%s/group/%s/%s", indyURL, buildType, repoName, MERGED_MAVEN_METADATA_PATH)
+	// Only a sample of the uploads is polled, all of them are checked after the wait
+	samplePath := sampleUploadPath(uploads, storePath)
+	waitFor("hosted uploads merged into group", func() bool {
+		if samplePath != "" && !available(fmt.Sprintf("%s/api/content/%s/group/%s%s", indyURL, buildType, repoName, samplePath)) {
+			return false
+		}
+		return contains(grpMetadataURL, LATEST_HOSTED_VERSION_TAG)
+	}, wait)
 	for _, upload := range uploads {
 		targetPath := strings.Split(upload[2], storePath)[1]
 		contentURL := fmt.Sprintf("%s/api/content/%s%s", indyURL, storePath, targetPath)
 		_, _, result := getRequest(contentURL)
 		if !result {
 			fmt.Printf("Error: Failed to get hosted content %s.\n\n", contentURL)
-			os.Exit(1)
+			report.Exit(1)
 			break
 		}
 		grpContentURL := fmt.Sprintf("%s/api/content/%s/group/%s%s", indyURL, buildType, repoName, targetPath)
 		_, _, result = getRequest(grpContentURL)
 		if !result {
 			fmt.Printf("Error: Failed to get merged path %s in group %s.\n\n", grpContentURL, repoName)
-			os.Exit(1)
+			report.Exit(1)
 			break
 		}
 	}
 	fmt.Printf("Get all hosted contents and affected group merged paths successfully\n")
 
-	grpMetadataURL := fmt.Sprintf("%s/api/content/%s/group/%s/%s", indyURL, buildType, repoName, MERGED_MAVEN_METADATA_PATH)
 	metadata, _, mergedResult := getRequest(grpMetadataURL)
 	if !mergedResult {
 		fmt.Printf("Error: Failed to get group metadata, path: %s.\n\n", grpMetadataURL)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	index := strings.Index(metadata, LATEST_HOSTED_VERSION_TAG)
 	if index < 0 {
 		fmt.Printf("Error: Failed to get correct merged metadata content, path: %s.\n\n", grpMetadataURL)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	fmt.Printf("Get correct merged metadata content successfully, path: %s\n", grpMetadataURL)
 
 	// Delete hosted repo
-	deleteURL := fmt.Sprintf("%s/api/admin/stores/%s/hosted/%s?deleteContent=true", indyURL, buildType, repoName)
-	fmt.Printf("Start deleting hosted repo %s\n", repoName)
-	result = delRequest(deleteURL)
-	if result {
-		fmt.Printf("Delete hosted repo %s successfully\n", repoName)
-	}
+	deleteStore(stores, hostedKey, true)
 
 	// Recreate hosted repo
 	prepareIndyHosted(indyURL, buildType, repoName, false)
 
-	_, _, result = getRequest(hostedRepo)
-	if !result {
-		fmt.Printf("Error: Failed to get hosted repo %s after recreating.\n\n", repoName)
-		os.Exit(1)
+	if _, err := stores.GetHosted(buildType, repoName); err != nil {
+		fmt.Printf("Error: Failed to get hosted repo %s after recreating. Cause: %s\n\n", repoName, err)
+		report.Exit(1)
 	}
 
-	fmt.Printf("Waiting 60s...\n")
-	time.Sleep(60 * time.Second)
-
 	// Verify the contents after deleting
+	waitFor("hosted contents removed with the repo", func() bool {
+		return samplePath == "" || !available(fmt.Sprintf("%s/api/content/%s%s", indyURL, storePath, samplePath))
+	}, wait)
 	for _, upload := range uploads {
 		targetPath := strings.Split(upload[2], storePath)[1]
 		contentURL := fmt.Sprintf("%s/api/content/%s%s", indyURL, storePath, targetPath)
 		_, _, result := getRequest(contentURL)
 		if result {
 			fmt.Printf("Error: Content %s is still existed after repo %s is removed.\n\n", contentURL, repoName)
-			os.Exit(1)
+			report.Exit(1)
 			break
 		}
 	}
 	fmt.Printf("Remove all hosted contents successfully\n")
 
 	// Remove hosted repo
-	fmt.Printf("Start deleting hosted repo %s\n", repoName)
-	result = delRequest(deleteURL)
-	if result {
-		fmt.Printf("Delete hosted repo %s successfully\n", repoName)
-	}
-
-	fmt.Printf("Waiting 60s...\n")
-	time.Sleep(60 * time.Second)
+	deleteStore(stores, hostedKey, true)
 
 	// Verify affected group cleanup
+	waitFor("hosted contents removed from group", func() bool {
+		if samplePath != "" && available(fmt.Sprintf("%s/api/content/%s/group/%s%s", indyURL, buildType, repoName, samplePath)) {
+			return false
+		}
+		return !contains(grpMetadataURL, LATEST_HOSTED_VERSION_TAG)
+	}, wait)
 	verifyHostedAffectedGroupCleanup(indyURL, buildType, repoName, uploads)
 	fmt.Println("==========================================")
 	fmt.Printf("Finish hosted repo cleanup.\n\n")
 }
 
 // Verify cleanup for the remote repo deleting
-func deleteIndyRemote(indyURL, buildType, repoName string) {
+func deleteIndyRemote(indyURL, buildType, repoName string, wait common.WaitOptions) {
 	fmt.Println("Start remote repo cleanup.")
 	fmt.Printf("==========================================\n\n")
-	remotedRepo := fmt.Sprintf("%s/api/admin/stores/%s/remote/%s", indyURL, buildType, repoName)
-	_, _, result := getRequest(remotedRepo)
-	if !result {
-		fmt.Printf("Error: Failed to get remote repo %s.\n\n", repoName)
-		os.Exit(1)
+	stores := newStoreClient(indyURL)
+	if _, err := stores.GetRemote(buildType, repoName); err != nil {
+		fmt.Printf("Error: Failed to get remote repo %s. Cause: %s\n\n", repoName, err)
+		report.Exit(1)
 	}
 
 	// Verify NFC creation
@@ -333,28 +314,25 @@ func deleteIndyRemote(indyURL, buildType, repoName string) {
 		isCached := isNFCCached(indyURL, buildType, "remote", repoName)
 		if !isCached {
 			fmt.Printf("Error: Failed to cache NFC for remote repo %s.\n\n", repoName)
-			os.Exit(1)
+			report.Exit(1)
 		}
 		fmt.Printf("Remote repo %s NFC caches successfully\n", repoName)
 	}
 
 	// Delete remote repo
-	URL := fmt.Sprintf("%s/api/admin/stores/%s/remote/%s?deleteContent=true", indyURL, buildType, repoName)
-	fmt.Printf("Start deleting remote repo %s\n", repoName)
-	result = delRequest(URL)
-	if result {
-		fmt.Printf("Delete remote repo %s successfully\n", repoName)
-	}
+	deleteStore(stores, common.StoreKey{PackageType: buildType, Type: common.STORE_TYPE_REMOTE, Name: repoName}, true)
 
-	fmt.Printf("Waiting 60s...\n")
-	time.Sleep(60 * time.Second)
+	grpContentURL := fmt.Sprintf("%s/api/content/%s/group/%s/%s", indyURL, buildType, repoName, ACCESSIBLE_REMOTE_PATH)
+	waitFor("remote content removed from group", func() bool {
+		return !available(grpContentURL)
+	}, wait)
 
 	// Verify NFC cleanup
 	// 	if nfcVerified {
 	// 		isCached := isNFCCached(indyURL, buildType, "remote", repoName)
 	// 		if isCached {
 	// 			fmt.Printf("Error: Failed to remove NFC cache for remote repo %s.\n\n", repoName)
-	// 			os.Exit(1)
+	// 			report.Exit(1)
 	// 		}
 	// 		fmt.Printf("Remove NFC for remote repo %s successfully\n", repoName)
 	// 	}
@@ -367,12 +345,16 @@ func deleteIndyRemote(indyURL, buildType, repoName string) {
 
 // Verify cleanup for the group repo deleting
 func deleteIndyGroup(indyURL, buildType, repoName string) {
-	URL := fmt.Sprintf("%s/api/admin/stores/%s/group/%s", indyURL, buildType, repoName)
-	fmt.Printf("Start deleting group repo %s\n", repoName)
-	result := delRequest(URL)
-	if result {
-		fmt.Printf("Delete group repo %s successfully\n", repoName)
+	deleteStore(newStoreClient(indyURL), common.StoreKey{PackageType: buildType, Type: common.STORE_TYPE_GROUP, Name: repoName}, false)
+}
+
+func deleteStore(stores *common.StoreClient, key common.StoreKey, deleteContent bool) {
+	fmt.Printf("Start deleting %s repo %s\n", key.Type, key.Name)
+	if err := stores.Delete(key, deleteContent); err != nil {
+		fmt.Printf("Debug for delete failure: %s\n", err)
+		return
 	}
+	fmt.Printf("Delete %s repo %s successfully\n", key.Type, key.Name)
 }
 
 func verifyHostedAffectedGroupCleanup(indyURL, buildType, repoName string, uploads map[string][]string) {
@@ -387,7 +369,7 @@ func verifyHostedAffectedGroupCleanup(indyURL, buildType, repoName string, uploa
 		_, _, result := getRequest(grpContentURL)
 		if result {
 			fmt.Printf("Error: Content %s is still existed in group %s.\n\n", grpContentURL, repoName)
-			os.Exit(1)
+			report.Exit(1)
 			break
 		}
 	}
@@ -397,12 +379,12 @@ func verifyHostedAffectedGroupCleanup(indyURL, buildType, repoName string, uploa
 	metadata, _, mergedResult := getRequest(grpMetadataURL)
 	if !mergedResult {
 		fmt.Printf("Error: Failed to get group metadata, path: %s.\n\n", grpMetadataURL)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	index := strings.Index(metadata, LATEST_HOSTED_VERSION_TAG)
 	if index >= 0 {
 		fmt.Printf("Error: Failed to remove version from the merged metadata content, path: %s.\n\n", grpMetadataURL)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	fmt.Printf("Remove version from the merged metadata content successfully, path: %s\n", grpMetadataURL)
 }
@@ -416,30 +398,21 @@ func verifyRemoteAffectedGroupCleanup(indyURL, buildType, repoName string) {
 	_, _, result := getRequest(grpContentURL)
 	if result {
 		fmt.Printf("Error: Content %s is still existed in group %s.\n\n", grpContentURL, repoName)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	fmt.Printf("Remove remote content from the affected group successfully\n")
 }
 
 func verifyGroupConstituents(indyURL, buildType, storeType, repoName string) {
-	groupURL := fmt.Sprintf("%s/api/admin/stores/%s/group/%s", indyURL, buildType, repoName)
-	groupBody, _, result := getRequest(groupURL)
-	if !result {
-		fmt.Printf("Error: Failed to get group repo %s.\n\n", repoName)
-		os.Exit(1)
-	}
-
-	var group map[string]interface{}
-	err := json.Unmarshal([]byte(groupBody), &group)
+	group, err := newStoreClient(indyURL).GetGroup(buildType, repoName)
 	if err != nil {
-		fmt.Printf("Error: Group %s parse failed! Error message: %s.\n\n", repoName, err.Error())
-		os.Exit(1)
+		fmt.Printf("Error: Failed to get group repo %s. Cause: %s\n\n", repoName, err)
+		report.Exit(1)
 	}
-	constituents := []string{fmt.Sprint(group["constituents"])}
 	repoKey := strings.Join([]string{buildType, storeType, repoName}, ":")
-	if common.Contains(constituents, repoKey) {
+	if common.Contains(group.Constituents, repoKey) {
 		fmt.Printf("Error: Failed to remove %s repo %s from group repo %s.\n\n", storeType, repoName, repoName)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	fmt.Printf("%s repo %s is removed from Group repo %s\n", storeType, repoName, repoName)
 }
@@ -460,38 +433,48 @@ func isNFCCached(indyURL, buildType, storeType, repoName string) bool {
 	return true
 }
 
-func updateIndyReposEnablement(indyURL, packageType, buildName string) {
+func updateIndyReposEnablement(indyURL, packageType, buildName string, wait common.WaitOptions) {
 	fmt.Println("Start repo enablement/disablement cleanup.")
 	fmt.Printf("==========================================\n\n")
 
 	grpContentURL := fmt.Sprintf("%s/api/content/%s/group/%s/%s", indyURL, packageType, buildName, GOING_MERGED_HOSTED_PATH)
 	grpMetadataURL := fmt.Sprintf("%s/api/content/%s/group/%s/%s", indyURL, packageType, buildName, MERGED_MAVEN_METADATA_PATH)
 
+	stores := newStoreClient(indyURL)
+	hostedKey := common.StoreKey{PackageType: packageType, Type: common.STORE_TYPE_HOSTED, Name: buildName}
+
 	// Disable the hosted repo
-	prepareIndyHosted(indyURL, packageType, buildName, true)
+	if err := stores.Disable(hostedKey); err != nil {
+		fmt.Printf("Error: Failed to disable hosted repo %s. Cause: %s\n\n", buildName, err)
+		report.Exit(1)
+	}
 
-	fmt.Printf("Waiting 60s...\n")
-	time.Sleep(60 * time.Second)
+	waitFor("disabled hosted version removed from group metadata", func() bool {
+		return !contains(grpMetadataURL, LATEST_HOSTED_VERSION_TAG)
+	}, wait)
 
 	metadata, _, _ := getRequest(grpMetadataURL)
 	index := strings.Index(metadata, LATEST_HOSTED_VERSION_TAG)
 	if index >= 0 {
 		fmt.Printf("Error: Failed to remove version from the merged metadata content, path: %s.\n\n", grpMetadataURL)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	fmt.Printf("Remove version from the merged metadata content successfully, path: %s\n", grpMetadataURL)
 
 	// Enable the hosted repo
-	prepareIndyHosted(indyURL, packageType, buildName, false)
-
-	fmt.Printf("Waiting 60s...\n")
-	time.Sleep(60 * time.Second)
+	if err := stores.Enable(hostedKey); err != nil {
+		fmt.Printf("Error: Failed to enable hosted repo %s. Cause: %s\n\n", buildName, err)
+		report.Exit(1)
+	}
 
 	// Verify the merged path and metadata after hosted enabled
+	waitFor("enabled hosted merged into group", func() bool {
+		return available(grpContentURL) && contains(grpMetadataURL, LATEST_HOSTED_VERSION_TAG)
+	}, wait)
 	_, _, result := getRequest(grpContentURL)
 	if !result {
 		fmt.Printf("Error: Failed to merge content into group, path: %s.\n\n", grpContentURL)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	fmt.Printf("Merge content into group successfully, path: %s\n", grpContentURL)
 
@@ -499,21 +482,61 @@ func updateIndyReposEnablement(indyURL, packageType, buildName string) {
 	index = strings.Index(metadata, LATEST_HOSTED_VERSION_TAG)
 	if index < 0 {
 		fmt.Printf("Error: Failed to merge version into metadata content, path: %s.\n\n", grpMetadataURL)
-		os.Exit(1)
+		report.Exit(1)
 	}
 	fmt.Printf("Merge version into metadata content successfully, path: %s\n", grpMetadataURL)
 	fmt.Println("==========================================")
 	fmt.Printf("Finish repo enablement/disablement cleanup.\n\n")
 }
 
+// waitFor waits until indy has handled the event, and fails the test if it is not handled in time
+func waitFor(name string, condition func() bool, wait common.WaitOptions) {
+	if !common.WaitForPropagation(name, condition, wait) {
+		fmt.Printf("Error: Timed out waiting for %s.\n\n", name)
+		report.Exit(1)
+	}
+}
+
+// sampleUploadPath is the path of one of the uploads in the store, which is polled while waiting for the event
+// of all uploads. The same upload is picked every time, and it is empty if there is no upload.
+func sampleUploadPath(uploads map[string][]string, storePath string) string {
+	keys := make([]string, 0, len(uploads))
+	for key := range uploads {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if parts := strings.Split(uploads[key][2], storePath); len(parts) > 1 {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
 func getRequest(url string) (string, int, bool) {
 	content, code, succeeded := common.HTTPRequest(url, common.MethodGet, nil, true, nil, nil, "", false)
 	debugFailureRequest(succeeded, content)
 	return content, code, succeeded
 }
 
+// available is true if the content of the url can be retrieved, used as the condition of the waits
+func available(url string) bool {
+	_, _, succeeded := common.HTTPRequest(url, common.MethodGet, nil, false, nil, nil, "", false)
+	return succeeded
+}
+
+// contains is true if the content of the url can be retrieved and contains s
+func contains(url, s string) bool {
+	content, _, succeeded := common.HTTPRequest(url, common.MethodGet, nil, true, nil, nil, "", false)
+	return succeeded && strings.Contains(content, s)
+}
+
 var authenticator = common.DecideAuthenticator()
 
+func newStoreClient(indyURL string) *common.StoreClient {
+	return common.NewStoreClient(indyURL, authenticator)
+}
+
 func postRequest(url string, data io.Reader) (string, bool) {
 	content, _, succeeded := common.HTTPRequest(url, common.MethodPost, authenticator, true, data, nil, "", false)
 	debugFailureRequest(succeeded, content)
@@ -526,12 +549,6 @@ func putRequest(url string, data io.Reader) bool {
 	return succeeded
 }
 
-func delRequest(url string) bool {
-	content, _, succeeded := common.HTTPRequest(url, common.MethodDelete, authenticator, false, nil, nil, "", false)
-	debugFailureRequest(succeeded, content)
-	return succeeded
-}
-
 func debugFailureRequest(succeeded bool, respText string) {
 	if !succeeded {
 		fmt.Printf("Debug for respText: %s\n", respText)
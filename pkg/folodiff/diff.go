@@ -0,0 +1,234 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Package folodiff compares two folo tracking records, usually the record of an original build and the record
+// of its replay, entry by entry.
+package folodiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+// The fields of an entry which are compared
+const (
+	FIELD_MD5            = "md5"
+	FIELD_SHA1           = "sha1"
+	FIELD_SHA256         = "sha256"
+	FIELD_SIZE           = "size"
+	FIELD_STORE_KEY      = "storeKey"
+	FIELD_ACCESS_CHANNEL = "accessChannel"
+	FIELD_EFFECT         = "effect"
+)
+
+// ALL_FIELDS are the compared fields in the order they are reported
+var ALL_FIELDS = []string{FIELD_MD5, FIELD_SHA1, FIELD_SHA256, FIELD_SIZE, FIELD_STORE_KEY, FIELD_ACCESS_CHANNEL, FIELD_EFFECT}
+
+// Options are the rules to match the entries of the original record to the replayed ones
+type Options struct {
+	// ReleaseNumber rewrites the upload paths of the original record by common.AlterUploadPath, e.g., "90001"
+	// for a replay in build-test-90001. Empty means the paths are compared as they are.
+	ReleaseNumber string
+	// StoreKeys rewrites the store keys of the original record before comparing, e.g.,
+	// "maven:hosted:build-1234" => "maven:hosted:build-test-90001"
+	StoreKeys map[string]string
+	// IgnoreFields are not compared, e.g., FIELD_ACCESS_CHANNEL
+	IgnoreFields []string
+	// Filter selects the paths to compare, all paths are compared if it is nil
+	Filter func(path, storeKey string) bool
+}
+
+// SkipMetadata is a Filter which skips the maven-metadata.xml and npm package metadata files, which folo does
+// not track when they are downloaded through a group
+func SkipMetadata(path, storeKey string) bool {
+	return !common.IsMetadata(path, storeKey)
+}
+
+// Change is a field which differs between the original and the replayed entry
+type Change struct {
+	Field    string `json:"field"`
+	Original string `json:"original"`
+	Replayed string `json:"replayed"`
+}
+
+// EntryDiff is an entry which is added, missing or changed in the replayed record
+type EntryDiff struct {
+	// Path is the path in the replayed record, i.e., after the rewriting of the original path
+	Path         string `json:"path"`
+	OriginalPath string `json:"originalPath,omitempty"`
+	// Changes are set for a changed entry only
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// SectionDiff is the diff of the uploads or the downloads
+type SectionDiff struct {
+	Added     []EntryDiff `json:"added"`
+	Missing   []EntryDiff `json:"missing"`
+	Changed   []EntryDiff `json:"changed"`
+	Unchanged int         `json:"unchanged"`
+}
+
+// Empty is true if no entry is added, missing or changed
+func (s *SectionDiff) Empty() bool {
+	return len(s.Added) == 0 && len(s.Missing) == 0 && len(s.Changed) == 0
+}
+
+// Result is the diff of two records
+type Result struct {
+	Original  string      `json:"original"`
+	Replayed  string      `json:"replayed"`
+	Uploads   SectionDiff `json:"uploads"`
+	Downloads SectionDiff `json:"downloads"`
+}
+
+// Empty is true if the records match
+func (r *Result) Empty() bool {
+	return r.Uploads.Empty() && r.Downloads.Empty()
+}
+
+// Diff compares the replayed record to the original one
+func Diff(original, replayed common.TrackedContent, options Options) *Result {
+	return &Result{
+		Original:  original.TrackingKey.Id,
+		Replayed:  replayed.TrackingKey.Id,
+		Uploads:   diffEntries(original.Uploads, replayed.Uploads, options, true),
+		Downloads: diffEntries(original.Downloads, replayed.Downloads, options, false),
+	}
+}
+
+func diffEntries(original, replayed []common.TrackedContentEntry, options Options, uploads bool) SectionDiff {
+	ignored := make(map[string]bool)
+	for _, f := range options.IgnoreFields {
+		ignored[f] = true
+	}
+	replayedByPath := make(map[string]common.TrackedContentEntry)
+	for _, e := range replayed {
+		if options.Filter == nil || options.Filter(e.Path, e.StoreKey) {
+			replayedByPath[e.Path] = e
+		}
+	}
+
+	diff := SectionDiff{Added: []EntryDiff{}, Missing: []EntryDiff{}, Changed: []EntryDiff{}}
+	matched := make(map[string]bool)
+	for _, orig := range original {
+		if options.Filter != nil && !options.Filter(orig.Path, orig.StoreKey) {
+			continue
+		}
+		p := orig.Path
+		if uploads && options.ReleaseNumber != "" {
+			p = common.AlterUploadPath(orig.Path, orig.StoreKey, options.ReleaseNumber)
+		}
+		entry := EntryDiff{Path: p}
+		if p != orig.Path {
+			entry.OriginalPath = orig.Path
+		}
+		rep, ok := replayedByPath[p]
+		if !ok {
+			diff.Missing = append(diff.Missing, entry)
+			continue
+		}
+		matched[p] = true
+		if storeKey, ok := options.StoreKeys[orig.StoreKey]; ok {
+			orig.StoreKey = storeKey
+		}
+		entry.Changes = compare(orig, rep, ignored)
+		if len(entry.Changes) > 0 {
+			diff.Changed = append(diff.Changed, entry)
+		} else {
+			diff.Unchanged++
+		}
+	}
+	for p := range replayedByPath {
+		if !matched[p] {
+			diff.Added = append(diff.Added, EntryDiff{Path: p})
+		}
+	}
+	for _, entries := range [][]EntryDiff{diff.Added, diff.Missing, diff.Changed} {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	}
+	return diff
+}
+
+// compare returns the changed fields. A checksum or size is only compared if both entries have it, the records
+// of older indy versions do not have sha256 or size.
+func compare(orig, rep common.TrackedContentEntry, ignored map[string]bool) []Change {
+	var changes []Change
+	check := func(field, o, r string, optional bool) {
+		if ignored[field] || (optional && (o == "" || r == "")) {
+			return
+		}
+		if !strings.EqualFold(o, r) {
+			changes = append(changes, Change{Field: field, Original: o, Replayed: r})
+		}
+	}
+	size := func(s int64) string {
+		if s <= 0 {
+			return ""
+		}
+		return fmt.Sprint(s)
+	}
+	check(FIELD_MD5, orig.Md5, rep.Md5, true)
+	check(FIELD_SHA1, orig.Sha1, rep.Sha1, true)
+	check(FIELD_SHA256, orig.Sha256, rep.Sha256, true)
+	check(FIELD_SIZE, size(orig.Size), size(rep.Size), true)
+	check(FIELD_STORE_KEY, orig.StoreKey, rep.StoreKey, false)
+	check(FIELD_ACCESS_CHANNEL, orig.AccessChannel, rep.AccessChannel, true)
+	check(FIELD_EFFECT, orig.Effect, rep.Effect, true)
+	return changes
+}
+
+// WriteText writes the diff for people to read
+func (r *Result) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Folo record diff, original: %s, replayed: %s\n", r.Original, r.Replayed)
+	for _, section := range []struct {
+		title string
+		diff  SectionDiff
+	}{{"Uploads", r.Uploads}, {"Downloads", r.Downloads}} {
+		d := section.diff
+		fmt.Fprintf(w, "%s: %d added, %d missing, %d changed, %d unchanged\n", section.title, len(d.Added), len(d.Missing), len(d.Changed), d.Unchanged)
+		for _, e := range d.Missing {
+			fmt.Fprintf(w, "  [Missing] %s%s\n", e.Path, originalPathNote(e))
+		}
+		for _, e := range d.Added {
+			fmt.Fprintf(w, "  [Added] %s\n", e.Path)
+		}
+		for _, e := range d.Changed {
+			fmt.Fprintf(w, "  [Changed] %s%s\n", e.Path, originalPathNote(e))
+			for _, c := range e.Changes {
+				fmt.Fprintf(w, "      %s: %s => %s\n", c.Field, c.Original, c.Replayed)
+			}
+		}
+	}
+}
+
+func originalPathNote(e EntryDiff) string {
+	if e.OriginalPath == "" {
+		return ""
+	}
+	return " (original: " + e.OriginalPath + ")"
+}
+
+// WriteJSON writes the diff for pipelines
+func (r *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
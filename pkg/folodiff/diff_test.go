@@ -0,0 +1,125 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package folodiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/indymock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func entry(p, storeKey, md5 string) common.TrackedContentEntry {
+	return common.TrackedContentEntry{Path: p, StoreKey: storeKey, Md5: md5, AccessChannel: "NATIVE"}
+}
+
+func TestDiff(t *testing.T) {
+	Convey("Diff", t, func() {
+		original := common.TrackedContent{
+			TrackingKey: common.TrackingKey{Id: "build-1"},
+			Uploads: []common.TrackedContentEntry{
+				entry("/org/foo/foo/1.0.redhat-00001/foo-1.0.redhat-00001.pom", "maven:hosted:build-1", "a"),
+				entry("/org/foo/foo/1.0.redhat-00001/foo-1.0.redhat-00001.jar", "maven:hosted:build-1", "b"),
+			},
+			Downloads: []common.TrackedContentEntry{
+				entry("/org/bar/bar/2.0/bar-2.0.jar", "maven:remote:central", "c"),
+				entry("/org/baz/baz/1.0/baz-1.0.jar", "maven:remote:central", "d"),
+				entry("/org/bar/bar/maven-metadata.xml", "maven:remote:central", "e"),
+			},
+		}
+		replayed := common.TrackedContent{
+			TrackingKey: common.TrackingKey{Id: "build-test-90001"},
+			Uploads: []common.TrackedContentEntry{
+				entry("/org/foo/foo/1.0.redhat-90001/foo-1.0.redhat-90001.pom", "maven:hosted:build-test-90001", "a"),
+				entry("/org/foo/foo/1.0.redhat-90001/foo-1.0.redhat-90001.jar", "maven:hosted:build-test-90001", "x"),
+			},
+			Downloads: []common.TrackedContentEntry{
+				entry("/org/bar/bar/2.0/bar-2.0.jar", "maven:remote:central", "c"),
+				entry("/org/new/new/1.0/new-1.0.jar", "maven:remote:central", "f"),
+			},
+		}
+		options := Options{
+			ReleaseNumber: "90001",
+			StoreKeys:     map[string]string{"maven:hosted:build-1": "maven:hosted:build-test-90001"},
+			Filter:        SkipMetadata,
+		}
+
+		Convey("Should report added, missing and changed entries with the rewriting rules", func() {
+			result := Diff(original, replayed, options)
+			So(result.Empty(), ShouldBeFalse)
+			So(result.Uploads.Unchanged, ShouldEqual, 1)
+			So(len(result.Uploads.Changed), ShouldEqual, 1)
+			changed := result.Uploads.Changed[0]
+			So(changed.Path, ShouldEqual, "/org/foo/foo/1.0.redhat-90001/foo-1.0.redhat-90001.jar")
+			So(changed.OriginalPath, ShouldEqual, "/org/foo/foo/1.0.redhat-00001/foo-1.0.redhat-00001.jar")
+			So(changed.Changes, ShouldResemble, []Change{{Field: FIELD_MD5, Original: "b", Replayed: "x"}})
+
+			So(result.Downloads.Unchanged, ShouldEqual, 1)
+			So(len(result.Downloads.Missing), ShouldEqual, 1)
+			So(result.Downloads.Missing[0].Path, ShouldEqual, "/org/baz/baz/1.0/baz-1.0.jar")
+			So(len(result.Downloads.Added), ShouldEqual, 1)
+			So(result.Downloads.Added[0].Path, ShouldEqual, "/org/new/new/1.0/new-1.0.jar")
+
+			var text bytes.Buffer
+			result.WriteText(&text)
+			So(text.String(), ShouldContainSubstring, "[Missing] /org/baz/baz/1.0/baz-1.0.jar")
+			So(text.String(), ShouldContainSubstring, "md5: b => x")
+			var decoded Result
+			var js bytes.Buffer
+			So(result.WriteJSON(&js), ShouldBeNil)
+			So(json.Unmarshal(js.Bytes(), &decoded), ShouldBeNil)
+			So(decoded.Downloads.Added[0].Path, ShouldEqual, "/org/new/new/1.0/new-1.0.jar")
+		})
+		Convey("Store keys should be compared unless rewritten or ignored", func() {
+			options.StoreKeys = nil
+			result := Diff(original, replayed, options)
+			So(len(result.Uploads.Changed), ShouldEqual, 2)
+			options.IgnoreFields = []string{FIELD_STORE_KEY, FIELD_MD5}
+			result = Diff(original, replayed, options)
+			So(result.Uploads.Empty(), ShouldBeTrue)
+		})
+		Convey("Records can be loaded from a file, an url or a tracking id", func() {
+			mock, server := indymock.Start()
+			defer server.Close()
+			record := indymock.TrackedContent{Uploads: []indymock.TrackedContentEntry{{Path: "/a.jar", StoreKey: "maven:hosted:build-1"}}}
+			record.Key.Id = "build-1"
+			mock.PutFoloRecord(record)
+
+			byId, err := Load("build-1", server.URL)
+			So(err, ShouldBeNil)
+			So(byId.Uploads[0].Path, ShouldEqual, "/a.jar")
+			byURL, err := Load(server.URL+"/api/folo/admin/build-1/record", "")
+			So(err, ShouldBeNil)
+			So(byURL.TrackingKey.Id, ShouldEqual, "build-1")
+
+			fileLoc := path.Join(t.TempDir(), "tracking.json")
+			b, _ := json.Marshal(original)
+			os.WriteFile(fileLoc, b, 0644)
+			byFile, err := Load(fileLoc, "")
+			So(err, ShouldBeNil)
+			So(byFile.TrackingKey.Id, ShouldEqual, "build-1")
+
+			_, err = Load("build-2", "")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,45 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package folodiff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+// Load gets a record from a source, which is one of:
+//   - an url of the record json, e.g., "http://indy.xyz.com/api/folo/admin/build-1234/record"
+//   - a file of the record json, e.g., the tracking.json of a dataset
+//   - a tracking id, which is read from the indy at indyURL
+func Load(source, indyURL string) (common.TrackedContent, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		record := common.TrackedContent{}
+		if err := common.GetRespAsJSONType(source, &record); err != nil {
+			return record, fmt.Errorf("cannot get folo record from %s, %s", source, err)
+		}
+		return record, nil
+	}
+	if common.FileOrDirExists(source) {
+		return common.LoadFoloRecordFromFile(source)
+	}
+	if common.IsEmptyString(indyURL) {
+		return common.TrackedContent{}, fmt.Errorf("%s is neither an url nor a file, an indy url is needed to get it as a tracking id", source)
+	}
+	return common.NewFoloClient(indyURL, nil).GetRecord(source)
+}
@@ -0,0 +1,84 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package folodiff
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+const (
+	FORMAT_TEXT  = "text"
+	FORMAT_JSON  = "json"
+	REPORT_SUITE = "folo-diff"
+)
+
+// Run compares the records and prints the diff in the format. The json diff is also written to jsonFile if it
+// is not empty. It exits with 1 if the records differ.
+func Run(originalSource, replayedSource, indyURL string, options Options, format, jsonFile string) {
+	original, err := Load(originalSource, indyURL)
+	if err != nil {
+		fmt.Printf("Error: cannot load the original record, %s\n", err)
+		report.Exit(1)
+	}
+	replayed, err := Load(replayedSource, indyURL)
+	if err != nil {
+		fmt.Printf("Error: cannot load the replayed record, %s\n", err)
+		report.Exit(1)
+	}
+
+	result := Diff(original, replayed, options)
+	if format == FORMAT_JSON {
+		result.WriteJSON(os.Stdout)
+	} else {
+		result.WriteText(os.Stdout)
+	}
+	if jsonFile != "" {
+		if err := writeJSONFile(result, jsonFile); err != nil {
+			fmt.Printf("Error: cannot write %s, %s\n", jsonFile, err)
+			report.Exit(1)
+		}
+		fmt.Printf("Diff (json) is written to %s\n", jsonFile)
+	}
+
+	reportSection("uploads", result.Uploads)
+	reportSection("downloads", result.Downloads)
+	if !result.Empty() {
+		report.Exit(1)
+	}
+}
+
+func reportSection(name string, diff SectionDiff) {
+	c := report.GetSuite(REPORT_SUITE).Start(name)
+	c.Set("added", len(diff.Added)).Set("missing", len(diff.Missing)).Set("changed", len(diff.Changed)).Set("unchanged", diff.Unchanged)
+	if diff.Empty() {
+		c.Pass()
+		return
+	}
+	c.Fail("%d added, %d missing, %d changed", len(diff.Added), len(diff.Missing), len(diff.Changed))
+}
+
+func writeJSONFile(result *Result, jsonFile string) error {
+	f, err := os.Create(jsonFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return result.WriteJSON(f)
+}
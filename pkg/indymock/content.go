@@ -0,0 +1,275 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package indymock
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var checksumSuffixes = map[string]func() hash.Hash{
+	".md5":    md5.New,
+	".sha1":   sha1.New,
+	".sha256": sha256.New,
+}
+
+// PutContent stores the content in a store directly, e.g., to seed a remote repo with the files it would proxy
+func (s *Server) PutContent(storeKey, path string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putContent(storeKey, strings.TrimPrefix(path, "/"), data)
+}
+
+// GetContent returns the content of the path as a GET through the store would, including group merging
+func (s *Server) GetContent(storeKey, path string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, _, ok := s.resolve(storeKey, strings.TrimPrefix(path, "/"), map[string]bool{})
+	return data, ok
+}
+
+// Paths returns the sorted paths stored in a hosted or remote repo
+func (s *Server) Paths(storeKey string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths := []string{}
+	for p := range s.content[storeKey] {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *Server) putContent(storeKey, path string, data []byte) {
+	if s.content[storeKey] == nil {
+		s.content[storeKey] = make(map[string][]byte)
+	}
+	s.content[storeKey][path] = data
+	if missing := s.nfc[storeKey]; missing != nil {
+		delete(missing, path)
+	}
+}
+
+// handleContent serves /api/content/{packageType}/{type}/{name}/{path}
+func (s *Server) handleContent(w http.ResponseWriter, r *http.Request, segs []string) {
+	if len(segs) < 4 {
+		http.NotFound(w, r)
+		return
+	}
+	key := strings.Join(segs[:3], ":")
+	path := strings.Join(segs[3:], "/")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.mu.Lock()
+		data, _, ok := s.resolve(key, path, map[string]bool{})
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "%s not found in %s", path, key)
+			return
+		}
+		writeContent(w, r, data)
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+		if _, status := s.upload(key, path, data); status != http.StatusCreated {
+			writeError(w, status, "cannot store %s in %s", path, key)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		s.mu.Lock()
+		_, ok := s.content[key][path]
+		delete(s.content[key], path)
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "%s not found in %s", path, key)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeContent(w http.ResponseWriter, r *http.Request, data []byte) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+// upload stores the content in a hosted repo, or in the first enabled hosted member of a group like indy does.
+// It returns the key of the store which got the content.
+func (s *Server) upload(key, path string, data []byte) (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	target, ok := s.uploadTarget(key, map[string]bool{})
+	if !ok {
+		if _, exists := s.stores[key]; !exists {
+			return "", http.StatusNotFound
+		}
+		return "", http.StatusMethodNotAllowed
+	}
+	s.putContent(target, path, data)
+	return target, http.StatusCreated
+}
+
+func (s *Server) uploadTarget(key string, visited map[string]bool) (string, bool) {
+	store, ok := s.stores[key]
+	if !ok || store.Disabled() || visited[key] {
+		return "", false
+	}
+	visited[key] = true
+	switch store.Type() {
+	case "hosted":
+		readonly, _ := store["readonly"].(bool)
+		return key, !readonly
+	case "group":
+		for _, member := range store.Constituents() {
+			if target, ok := s.uploadTarget(member, visited); ok {
+				return target, true
+			}
+		}
+	}
+	return "", false
+}
+
+// resolve finds the content of the path through the store and returns it with the key of the store which
+// provides it. The maven-metadata.xml of a group merges the metadata of all members, the one of a hosted repo is
+// generated from the versions it holds. The checksum files are generated if they are not stored.
+func (s *Server) resolve(key, path string, visited map[string]bool) ([]byte, string, bool) {
+	store, ok := s.stores[key]
+	if !ok || store.Disabled() || visited[key] {
+		return nil, "", false
+	}
+	if data, ok := s.content[key][path]; ok {
+		return data, key, true
+	}
+	for suffix, newHash := range checksumSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			if data, from, ok := s.resolve(key, strings.TrimSuffix(path, suffix), visited); ok {
+				h := newHash()
+				h.Write(data)
+				return []byte(hex.EncodeToString(h.Sum(nil))), from, true
+			}
+		}
+	}
+	visited[key] = true
+	defer delete(visited, key)
+
+	switch store.Type() {
+	case "hosted":
+		if isMavenMetadata(path) {
+			if m, ok := s.hostedMetadata(key, path); ok {
+				return m.bytes(), key, true
+			}
+		}
+	case "remote":
+		if s.nfc[key] == nil {
+			s.nfc[key] = make(map[string]bool)
+		}
+		s.nfc[key][path] = true
+	case "group":
+		if isMavenMetadata(path) {
+			return s.groupMetadata(store, path, visited)
+		}
+		for _, member := range store.Constituents() {
+			if data, from, ok := s.resolve(member, path, visited); ok {
+				return data, from, true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+func (s *Server) groupMetadata(group Store, path string, visited map[string]bool) ([]byte, string, bool) {
+	var merged *mavenMetadata
+	for _, member := range group.Constituents() {
+		data, _, ok := s.resolve(member, path, visited)
+		if !ok {
+			continue
+		}
+		m, err := parseMavenMetadata(data)
+		if err != nil {
+			continue
+		}
+		if merged == nil {
+			merged = m
+		} else {
+			merged.merge(m)
+		}
+	}
+	if merged == nil {
+		return nil, "", false
+	}
+	merged.update()
+	return merged.bytes(), group.Key(), true
+}
+
+// handleNFC serves /api/nfc/{packageType}/{type}/{name}, the paths which were not found in remote repos
+func (s *Server) handleNFC(w http.ResponseWriter, r *http.Request, segs []string) {
+	if len(segs) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	key := strings.Join(segs, ":")
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		paths := []string{}
+		for p := range s.nfc[key] {
+			paths = append(paths, p)
+		}
+		s.mu.Unlock()
+		sort.Strings(paths)
+		sections := []map[string]interface{}{}
+		if len(paths) > 0 {
+			sections = append(sections, map[string]interface{}{"key": key, "paths": paths})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"sections": sections})
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.nfc, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func checksums(data []byte) (string, string, string) {
+	sums := make([]string, 0, 3)
+	for _, suffix := range []string{".md5", ".sha1", ".sha256"} {
+		h := checksumSuffixes[suffix]()
+		h.Write(data)
+		sums = append(sums, fmt.Sprintf("%x", h.Sum(nil)))
+	}
+	return sums[0], sums[1], sums[2]
+}
@@ -0,0 +1,366 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package indymock
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TrackedContentEntry is the json of a folo record entry, the same as common.TrackedContentEntry
+type TrackedContentEntry struct {
+	AccessChannel string  `json:"accessChannel"`
+	Path          string  `json:"path"`
+	OriginUrl     string  `json:"originUrl"`
+	LocalUrl      string  `json:"localUrl"`
+	Effect        string  `json:"effect"`
+	Md5           string  `json:"md5"`
+	Sha256        string  `json:"sha256"`
+	Sha1          string  `json:"sha1"`
+	Size          int64   `json:"size"`
+	Timestamps    []int64 `json:"timestamps"`
+	StoreKey      string  `json:"storeKey"`
+}
+
+// TrackedContent is the json of a folo record
+type TrackedContent struct {
+	Key struct {
+		Id string `json:"id"`
+	} `json:"key"`
+	Uploads   []TrackedContentEntry `json:"uploads"`
+	Downloads []TrackedContentEntry `json:"downloads"`
+}
+
+type trackedContent struct {
+	id        string
+	uploads   map[string]*TrackedContentEntry // by store key and path
+	downloads map[string]*TrackedContentEntry
+}
+
+func newTrackedContent(id string) *trackedContent {
+	return &trackedContent{id: id, uploads: make(map[string]*TrackedContentEntry), downloads: make(map[string]*TrackedContentEntry)}
+}
+
+func (t *trackedContent) add(entry TrackedContentEntry) {
+	entries := t.downloads
+	if entry.Effect == "UPLOAD" {
+		entries = t.uploads
+	}
+	k := entry.StoreKey + ":" + entry.Path
+	if existing, ok := entries[k]; ok {
+		entry.Timestamps = append(existing.Timestamps, entry.Timestamps...)
+	}
+	entries[k] = &entry
+}
+
+func (t *trackedContent) dto() TrackedContent {
+	c := TrackedContent{Uploads: sortedEntries(t.uploads), Downloads: sortedEntries(t.downloads)}
+	c.Key.Id = t.id
+	return c
+}
+
+func sortedEntries(m map[string]*TrackedContentEntry) []TrackedContentEntry {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	entries := make([]TrackedContentEntry, 0, len(keys))
+	for _, k := range keys {
+		entries = append(entries, *m[k])
+	}
+	return entries
+}
+
+// PutFoloRecord adds a sealed folo record, e.g., the record of the original build a test replays
+func (s *Server) PutFoloRecord(record TrackedContent) {
+	t := newTrackedContent(record.Key.Id)
+	for _, e := range record.Uploads {
+		e.Effect = "UPLOAD"
+		t.add(e)
+	}
+	for _, e := range record.Downloads {
+		e.Effect = "DOWNLOAD"
+		t.add(e)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sealed[record.Key.Id] = t
+}
+
+// GetFoloRecord returns the folo record by tracking id, sealed or not
+func (s *Server) GetFoloRecord(id string) (TrackedContent, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.sealed[id]; ok {
+		return t.dto(), true, true
+	}
+	if t, ok := s.tracking[id]; ok {
+		return t.dto(), false, true
+	}
+	return TrackedContent{}, false, false
+}
+
+func (s *Server) track(id string, entry TrackedContentEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tracking[id]
+	if !ok {
+		t = newTrackedContent(id)
+		s.tracking[id] = t
+	}
+	t.add(entry)
+}
+
+func (s *Server) newEntry(r *http.Request, storeKey, path, effect string, data []byte) TrackedContentEntry {
+	md5sum, sha1sum, sha256sum := checksums(data)
+	entry := TrackedContentEntry{
+		AccessChannel: "NATIVE",
+		Path:          "/" + path,
+		LocalUrl:      fmt.Sprintf("%s/api/content/%s/%s", s.baseURL(r), strings.ReplaceAll(storeKey, ":", "/"), path),
+		Effect:        effect,
+		Md5:           md5sum,
+		Sha1:          sha1sum,
+		Sha256:        sha256sum,
+		Size:          int64(len(data)),
+		Timestamps:    []int64{time.Now().UnixNano() / int64(time.Millisecond)},
+		StoreKey:      storeKey,
+	}
+	s.mu.Lock()
+	if store, ok := s.stores[storeKey]; ok && store.Type() == "remote" {
+		entry.OriginUrl = strings.TrimRight(store.URL(), "/") + "/" + path
+	}
+	s.mu.Unlock()
+	return entry
+}
+
+// handleFoloTrack serves /api/folo/track/{id}/{packageType}/{type}/{name}/{path}, the content api which records
+// the downloads and uploads in the folo record of the tracking id
+func (s *Server) handleFoloTrack(w http.ResponseWriter, r *http.Request, segs []string) {
+	if len(segs) < 5 {
+		http.NotFound(w, r)
+		return
+	}
+	id := segs[0]
+	key := strings.Join(segs[1:4], ":")
+	path := strings.Join(segs[4:], "/")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.mu.Lock()
+		data, from, ok := s.resolve(key, path, map[string]bool{})
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "%s not found in %s", path, key)
+			return
+		}
+		if r.Method == http.MethodGet && !isMavenMetadata(path) {
+			s.track(id, s.newEntry(r, from, path, "DOWNLOAD", data))
+		}
+		writeContent(w, r, data)
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+		target, status := s.upload(key, path, data)
+		if status != http.StatusCreated {
+			writeError(w, status, "cannot store %s in %s", path, key)
+			return
+		}
+		s.track(id, s.newEntry(r, target, path, "UPLOAD", data))
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleFoloAdmin serves /api/folo/admin/{id}/record, /api/folo/admin/{id}/report,
+// /api/folo/admin/{id}/record/recalculate and /api/folo/admin/report/{ids/{type}|export|import}
+func (s *Server) handleFoloAdmin(w http.ResponseWriter, r *http.Request, segs []string) {
+	if len(segs) >= 2 && segs[0] == "report" {
+		s.handleFoloReports(w, r, segs[1:])
+		return
+	}
+	if len(segs) == 3 && segs[1] == "record" && segs[2] == "recalculate" {
+		s.recalculate(w, r, segs[0])
+		return
+	}
+	if len(segs) != 2 || (segs[1] != "record" && segs[1] != "report") {
+		http.NotFound(w, r)
+		return
+	}
+	id := segs[0]
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		t, ok := s.sealed[id]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "folo record %s not found", id)
+			return
+		}
+		writeJSON(w, http.StatusOK, t.dto())
+	case http.MethodPost:
+		if segs[1] != "record" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		// seal the record, a record with no content is sealed empty like indy does
+		s.mu.Lock()
+		t, ok := s.tracking[id]
+		if !ok {
+			t = newTrackedContent(id)
+			if sealed, ok := s.sealed[id]; ok {
+				t = sealed
+			}
+		}
+		delete(s.tracking, id)
+		s.sealed[id] = t
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, t.dto())
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.tracking, id)
+		delete(s.sealed, id)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// recalculate updates the checksums and sizes of a sealed record from the content stored now
+func (s *Server) recalculate(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	t, ok := s.sealed[id]
+	if ok {
+		for _, entries := range []map[string]*TrackedContentEntry{t.uploads, t.downloads} {
+			for _, e := range entries {
+				if data, ok := s.content[e.StoreKey][strings.TrimPrefix(e.Path, "/")]; ok {
+					e.Md5, e.Sha1, e.Sha256 = checksums(data)
+					e.Size = int64(len(data))
+				}
+			}
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "folo record %s not found", id)
+		return
+	}
+	writeJSON(w, http.StatusOK, t.dto())
+}
+
+func (s *Server) handleFoloReports(w http.ResponseWriter, r *http.Request, segs []string) {
+	switch {
+	case len(segs) == 2 && segs[0] == "ids" && r.Method == http.MethodGet:
+		ids := map[string][]string{}
+		s.mu.Lock()
+		if segs[1] == "sealed" || segs[1] == "all" {
+			ids["sealed"] = sortedIds(s.sealed)
+		}
+		if segs[1] == "in_progress" || segs[1] == "all" {
+			ids["in_progress"] = sortedIds(s.tracking)
+		}
+		s.mu.Unlock()
+		if len(ids) == 0 {
+			writeError(w, http.StatusBadRequest, "invalid record type %s", segs[1])
+			return
+		}
+		writeJSON(w, http.StatusOK, ids)
+	case len(segs) == 1 && segs[0] == "export" && r.Method == http.MethodGet:
+		s.exportRecords(w)
+	case len(segs) == 1 && segs[0] == "import" && r.Method == http.MethodPut:
+		s.importRecords(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func sortedIds(records map[string]*trackedContent) []string {
+	ids := make([]string, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// exportRecords writes the sealed records as a zip with one json file per tracking id
+func (s *Server) exportRecords(w http.ResponseWriter) {
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	s.mu.Lock()
+	for _, id := range sortedIds(s.sealed) {
+		b, _ := json.Marshal(s.sealed[id].dto())
+		f, _ := z.Create(id)
+		f.Write(b)
+	}
+	s.mu.Unlock()
+	if err := z.Close(); err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// importRecords adds the sealed records of a zip written by exportRecords
+func (s *Server) importRecords(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+	z, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid zip: %s", err)
+		return
+	}
+	for _, f := range z.File {
+		rc, err := f.Open()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+		var record TrackedContent
+		err = json.NewDecoder(rc).Decode(&record)
+		rc.Close()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid record %s: %s", f.Name, err)
+			return
+		}
+		if record.Key.Id == "" {
+			record.Key.Id = f.Name
+		}
+		s.PutFoloRecord(record)
+	}
+	w.WriteHeader(http.StatusCreated)
+}
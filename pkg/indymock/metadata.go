@@ -0,0 +1,144 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package indymock
+
+import (
+	"encoding/xml"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const MAVEN_METADATA_XML = "maven-metadata.xml"
+
+type mavenMetadata struct {
+	XMLName    xml.Name `xml:"metadata"`
+	GroupID    string   `xml:"groupId"`
+	ArtifactID string   `xml:"artifactId"`
+	Versioning struct {
+		Latest      string   `xml:"latest,omitempty"`
+		Release     string   `xml:"release,omitempty"`
+		Versions    []string `xml:"versions>version"`
+		LastUpdated string   `xml:"lastUpdated,omitempty"`
+	} `xml:"versioning"`
+}
+
+func isMavenMetadata(p string) bool {
+	return path.Base(p) == MAVEN_METADATA_XML
+}
+
+func parseMavenMetadata(data []byte) (*mavenMetadata, error) {
+	m := &mavenMetadata{}
+	if err := xml.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// hostedMetadata generates the metadata of an artifact from the version directories holding files, like indy
+// does for hosted repos
+func (s *Server) hostedMetadata(key, metadataPath string) (*mavenMetadata, bool) {
+	artifactDir := path.Dir(metadataPath)
+	versions := []string{}
+	seen := map[string]bool{}
+	for p := range s.content[key] {
+		if path.Dir(path.Dir(p)) != artifactDir || isMavenMetadata(p) {
+			continue
+		}
+		v := path.Base(path.Dir(p))
+		if !seen[v] {
+			seen[v] = true
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, false
+	}
+	m := &mavenMetadata{
+		GroupID:    strings.ReplaceAll(path.Dir(artifactDir), "/", "."),
+		ArtifactID: path.Base(artifactDir),
+	}
+	m.Versioning.Versions = versions
+	m.update()
+	return m, true
+}
+
+// merge adds the versions of the other metadata
+func (m *mavenMetadata) merge(other *mavenMetadata) {
+	m.Versioning.Versions = append(m.Versioning.Versions, other.Versioning.Versions...)
+	m.update()
+}
+
+// update sorts and dedups the versions, and sets the latest and release by them
+func (m *mavenMetadata) update() {
+	seen := map[string]bool{}
+	versions := []string{}
+	for _, v := range m.Versioning.Versions {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return compareVersions(versions[i], versions[j]) < 0 })
+	m.Versioning.Versions = versions
+	m.Versioning.Latest, m.Versioning.Release = "", ""
+	for _, v := range versions {
+		m.Versioning.Latest = v
+		if !strings.HasSuffix(v, "-SNAPSHOT") {
+			m.Versioning.Release = v
+		}
+	}
+	m.Versioning.LastUpdated = time.Now().UTC().Format("20060102150405")
+}
+
+func (m *mavenMetadata) bytes() []byte {
+	b, _ := xml.MarshalIndent(m, "", "  ")
+	return append([]byte(xml.Header), b...)
+}
+
+var versionSeparators = regexp.MustCompile(`[.\-_]`)
+
+// compareVersions compares the versions token by token, numbers by value and the others as strings, which is
+// good enough to order the versions of the tests, e.g., 1.0 < 1.0.redhat-00001 < 1.0.redhat-00002 < 2
+func compareVersions(a, b string) int {
+	ta, tb := versionSeparators.Split(a, -1), versionSeparators.Split(b, -1)
+	for i := 0; i < len(ta) && i < len(tb); i++ {
+		na, errA := strconv.Atoi(ta[i])
+		nb, errB := strconv.Atoi(tb[i])
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1
+			}
+		case errA == nil:
+			return 1 // a number is newer than a qualifier
+		case errB == nil:
+			return -1
+		default:
+			if c := strings.Compare(ta[i], tb[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(ta) - len(tb)
+}
@@ -0,0 +1,155 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package indymock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// PathsPromoteRequest is the json of an indy paths promotion request
+type PathsPromoteRequest struct {
+	TrackingId     string   `json:"trackingId,omitempty"`
+	Async          bool     `json:"async"`
+	Source         string   `json:"source"`
+	Target         string   `json:"target"`
+	Paths          []string `json:"paths,omitempty"`
+	PurgeSource    bool     `json:"purgeSource"`
+	DryRun         bool     `json:"dryRun"`
+	FireEvents     bool     `json:"fireEvents"`
+	FailWhenExists bool     `json:"failWhenExists"`
+}
+
+// PathsPromoteResult is the json of an indy paths promotion result, which is also the rollback request
+type PathsPromoteResult struct {
+	Request        PathsPromoteRequest `json:"request"`
+	PendingPaths   []string            `json:"pendingPaths"`
+	CompletedPaths []string            `json:"completedPaths"`
+	SkippedPaths   []string            `json:"skippedPaths"`
+	Error          *string             `json:"error"`
+}
+
+// handlePromotion serves /api/promotion/paths/promote and /api/promotion/paths/rollback. Like indy, a failed
+// promotion is answered with 200 and the error in the result, and nothing is promoted.
+func (s *Server) handlePromotion(w http.ResponseWriter, r *http.Request, action string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	switch action {
+	case "promote":
+		var req PathsPromoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid promote request: %s", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.promote(req))
+	case "rollback":
+		var result PathsPromoteResult
+		if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid rollback request: %s", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.rollback(result))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) promote(req PathsPromoteRequest) PathsPromoteResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := PathsPromoteResult{Request: req, PendingPaths: []string{}, CompletedPaths: []string{}, SkippedPaths: []string{}}
+	fail := func(format string, a ...interface{}) PathsPromoteResult {
+		msg := fmt.Sprintf(format, a...)
+		result.Error = &msg
+		result.PendingPaths = append(result.PendingPaths, result.CompletedPaths...)
+		result.CompletedPaths = []string{}
+		return result
+	}
+	if err := s.checkHosted(req.Source); err != "" {
+		return fail("%s", err)
+	}
+	if err := s.checkHosted(req.Target); err != "" {
+		return fail("%s", err)
+	}
+
+	paths := req.Paths
+	if len(paths) == 0 {
+		for p := range s.content[req.Source] {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+	}
+	for _, p := range paths {
+		p = strings.TrimPrefix(p, "/")
+		if _, ok := s.content[req.Source][p]; !ok {
+			result.SkippedPaths = append(result.SkippedPaths, "/"+p)
+			continue
+		}
+		if _, exists := s.content[req.Target][p]; exists && req.FailWhenExists {
+			return fail("path /%s already exists in %s", p, req.Target)
+		}
+		result.CompletedPaths = append(result.CompletedPaths, "/"+p)
+	}
+	if req.DryRun {
+		return result
+	}
+	for _, p := range result.CompletedPaths {
+		p = strings.TrimPrefix(p, "/")
+		s.putContent(req.Target, p, s.content[req.Source][p])
+		if req.PurgeSource {
+			delete(s.content[req.Source], p)
+		}
+	}
+	return result
+}
+
+// rollback removes the completed paths from the target, and puts them back to the source if they were purged
+func (s *Server) rollback(result PathsPromoteResult) PathsPromoteResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req := result.Request
+	for _, p := range result.CompletedPaths {
+		p = strings.TrimPrefix(p, "/")
+		data, ok := s.content[req.Target][p]
+		if !ok {
+			continue
+		}
+		if req.PurgeSource {
+			s.putContent(req.Source, p, data)
+		}
+		delete(s.content[req.Target], p)
+	}
+	result.PendingPaths = append(result.PendingPaths, result.CompletedPaths...)
+	result.CompletedPaths = []string{}
+	return result
+}
+
+func (s *Server) checkHosted(key string) string {
+	store, ok := s.stores[key]
+	if !ok {
+		return fmt.Sprintf("store %s not found", key)
+	}
+	if store.Type() != "hosted" {
+		return fmt.Sprintf("store %s is not a hosted repo", key)
+	}
+	return ""
+}
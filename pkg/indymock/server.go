@@ -0,0 +1,169 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Package indymock is an in-memory fake of the indy REST api used by the tests in this repo: store admin,
+// content, folo tracking, promotion and nfc. It can be used by go tests through httptest (see Start), or run as
+// a local server by the mock-indy command.
+//
+// The package does not depend on pkg/common, so the tests of common can use it too.
+package indymock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const (
+	DEFAULT_SHARED_GROUP = "builds-untested+shared-imports+public"
+	MAVEN_CENTRAL_URL    = "https://repo.maven.apache.org/maven2/"
+	NPM_REGISTRY_URL     = "https://registry.npmjs.org/"
+)
+
+// Server is the fake indy. All the state is in memory and guarded by one lock.
+type Server struct {
+	// ContextPath is the path indy is served under, e.g., "/indy" for an indy behind a reverse proxy
+	ContextPath string
+	// Hook is called before every request is handled. If it returns true, the request is handled by the hook,
+	// e.g., to inject failures in tests.
+	Hook func(w http.ResponseWriter, r *http.Request) bool
+
+	mu       sync.Mutex
+	stores   map[string]Store             // by store key, e.g., maven:hosted:pnc-builds
+	content  map[string]map[string][]byte // by store key, then path
+	nfc      map[string]map[string]bool   // by store key, then missing path
+	tracking map[string]*trackedContent   // in progress folo records by tracking id
+	sealed   map[string]*trackedContent   // sealed folo records by tracking id
+	requests []string
+}
+
+// New creates a fake indy with the stores the tests expect on a real one: the maven central and npmjs remotes,
+// the pnc-builds and shared-imports hosted repos, and the shared, DA and static groups.
+func New() *Server {
+	s := &Server{
+		stores:   make(map[string]Store),
+		content:  make(map[string]map[string][]byte),
+		nfc:      make(map[string]map[string]bool),
+		tracking: make(map[string]*trackedContent),
+		sealed:   make(map[string]*trackedContent),
+	}
+	for _, pkg := range []string{"maven", "npm"} {
+		remote := "central"
+		remoteURL := MAVEN_CENTRAL_URL
+		if pkg == "npm" {
+			remote, remoteURL = "npmjs", NPM_REGISTRY_URL
+		}
+		s.PutStore(NewRemote(pkg, remote, remoteURL))
+		s.PutStore(NewHosted(pkg, "pnc-builds"))
+		s.PutStore(NewHosted(pkg, "shared-imports"))
+		members := []string{pkg + ":hosted:pnc-builds", pkg + ":hosted:shared-imports", pkg + ":remote:" + remote}
+		for _, group := range []string{DEFAULT_SHARED_GROUP, "DA", "DA-temporary-builds", "static"} {
+			s.PutStore(NewGroup(pkg, group, members...))
+		}
+	}
+	return s
+}
+
+// Start runs the fake indy on a local port for a go test, the caller should close the returned server
+func Start() (*Server, *httptest.Server) {
+	s := New()
+	return s, httptest.NewServer(s)
+}
+
+// Requests returns "METHOD path" of all requests handled so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Hook != nil && s.Hook(w, r) {
+		return
+	}
+	p := r.URL.Path
+	if s.ContextPath != "" {
+		contextPath := "/" + strings.Trim(s.ContextPath, "/")
+		if !strings.HasPrefix(p, contextPath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		p = strings.TrimPrefix(p, contextPath)
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+p)
+	s.mu.Unlock()
+
+	segs := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	if len(segs) < 2 || segs[0] != "api" {
+		http.NotFound(w, r)
+		return
+	}
+	switch segs[1] {
+	case "admin":
+		if len(segs) >= 3 && segs[2] == "stores" {
+			s.handleStores(w, r, segs[3:])
+			return
+		}
+	case "content":
+		s.handleContent(w, r, segs[2:])
+		return
+	case "folo":
+		if len(segs) >= 3 && segs[2] == "track" {
+			s.handleFoloTrack(w, r, segs[3:])
+			return
+		}
+		if len(segs) >= 3 && segs[2] == "admin" {
+			s.handleFoloAdmin(w, r, segs[3:])
+			return
+		}
+	case "promotion":
+		if len(segs) == 4 && segs[2] == "paths" {
+			s.handlePromotion(w, r, segs[3])
+			return
+		}
+	case "nfc":
+		s.handleNFC(w, r, segs[2:])
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// baseURL is the url of the fake indy as seen by the client, used in the localUrl of folo entries
+func (s *Server) baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + strings.TrimRight(s.ContextPath, "/")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, a ...interface{}) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, format+"\n", a...)
+}
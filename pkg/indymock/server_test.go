@@ -0,0 +1,208 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package indymock
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func call(method, url, body string) (int, string) {
+	var req *http.Request
+	if body == "" {
+		req, _ = http.NewRequest(method, url, nil)
+	} else {
+		req, _ = http.NewRequest(method, url, strings.NewReader(body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	So(err, ShouldBeNil)
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+const pom = "<project><version>1.0</version></project>"
+
+func TestStores(t *testing.T) {
+	Convey("Store admin", t, func() {
+		mock, server := Start()
+		defer server.Close()
+		stores := server.URL + "/api/admin/stores"
+
+		code, _ := call(http.MethodGet, stores+"/maven/remote/central", "")
+		So(code, ShouldEqual, http.StatusOK)
+
+		code, _ = call(http.MethodPut, stores+"/maven/hosted/build-1", `{"key":"maven:hosted:build-1","description":"build-1"}`)
+		So(code, ShouldEqual, http.StatusCreated)
+		code, _ = call(http.MethodPut, stores+"/maven/hosted/build-1", `{"key":"maven:hosted:build-1","disabled":true}`)
+		So(code, ShouldEqual, http.StatusOK)
+		hosted, ok := mock.GetStore("maven:hosted:build-1")
+		So(ok, ShouldBeTrue)
+		So(hosted.Disabled(), ShouldBeTrue)
+
+		code, _ = call(http.MethodPost, stores+"/maven/hosted", `{"name":"build-1"}`)
+		So(code, ShouldEqual, http.StatusConflict)
+		code, _ = call(http.MethodPut, stores+"/maven/hosted/build-1", `{"key":"maven:hosted:other"}`)
+		So(code, ShouldEqual, http.StatusBadRequest)
+
+		code, body := call(http.MethodGet, stores+"/maven/hosted", "")
+		So(code, ShouldEqual, http.StatusOK)
+		So(body, ShouldContainSubstring, `"maven:hosted:build-1"`)
+
+		call(http.MethodPut, stores+"/maven/group/build-1", `{"constituents":["maven:hosted:build-1","maven:remote:central"]}`)
+		code, _ = call(http.MethodDelete, stores+"/maven/hosted/build-1?deleteContent=true", "")
+		So(code, ShouldEqual, http.StatusNoContent)
+		group, _ := mock.GetStore("maven:group:build-1")
+		So(group.Constituents(), ShouldResemble, []string{"maven:remote:central"})
+		code, _ = call(http.MethodGet, stores+"/maven/hosted/build-1", "")
+		So(code, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestContent(t *testing.T) {
+	Convey("Content", t, func() {
+		mock, server := Start()
+		defer server.Close()
+		content := server.URL + "/api/content"
+		mock.PutStore(NewHosted("maven", "build-1"))
+		mock.PutStore(NewGroup("maven", "build-1", "maven:hosted:build-1", "maven:group:"+DEFAULT_SHARED_GROUP))
+		mock.PutContent("maven:remote:central", "org/foo/foo/1.0/foo-1.0.pom", []byte(pom))
+		mock.PutContent("maven:remote:central", "org/foo/foo/maven-metadata.xml",
+			[]byte("<metadata><groupId>org.foo</groupId><artifactId>foo</artifactId><versioning><versions><version>1.0</version></versions></versioning></metadata>"))
+
+		Convey("Upload to a group goes to its hosted member", func() {
+			code, _ := call(http.MethodPut, content+"/maven/group/build-1/org/foo/foo/1.0.redhat-00001/foo-1.0.redhat-00001.pom", pom)
+			So(code, ShouldEqual, http.StatusCreated)
+			So(mock.Paths("maven:hosted:build-1"), ShouldResemble, []string{"org/foo/foo/1.0.redhat-00001/foo-1.0.redhat-00001.pom"})
+			code, _ = call(http.MethodPut, content+"/maven/remote/central/org/foo/bar.pom", pom)
+			So(code, ShouldEqual, http.StatusMethodNotAllowed)
+		})
+
+		Convey("Group resolves through the members and generates checksums", func() {
+			code, body := call(http.MethodGet, content+"/maven/group/build-1/org/foo/foo/1.0/foo-1.0.pom", "")
+			So(code, ShouldEqual, http.StatusOK)
+			So(body, ShouldEqual, pom)
+			_, md5sum := call(http.MethodGet, content+"/maven/group/build-1/org/foo/foo/1.0/foo-1.0.pom.md5", "")
+			expected, _, _ := checksums([]byte(pom))
+			So(md5sum, ShouldEqual, expected)
+			code, _ = call(http.MethodHead, content+"/maven/group/build-1/org/foo/foo/1.0/foo-1.0.pom", "")
+			So(code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("Group merges the maven metadata of hosted and remote members", func() {
+			call(http.MethodPut, content+"/maven/hosted/build-1/org/foo/foo/1.0.redhat-00001/foo-1.0.redhat-00001.pom", pom)
+			_, body := call(http.MethodGet, content+"/maven/group/build-1/org/foo/foo/maven-metadata.xml", "")
+			So(body, ShouldContainSubstring, "<version>1.0</version>")
+			So(body, ShouldContainSubstring, "<latest>1.0.redhat-00001</latest>")
+
+			hosted, _ := mock.GetStore("maven:hosted:build-1")
+			hosted["disabled"] = true
+			mock.PutStore(hosted)
+			_, body = call(http.MethodGet, content+"/maven/group/build-1/org/foo/foo/maven-metadata.xml", "")
+			So(body, ShouldNotContainSubstring, "redhat-00001")
+			So(body, ShouldContainSubstring, "<latest>1.0</latest>")
+		})
+
+		Convey("Missing remote paths are cached in nfc", func() {
+			code, _ := call(http.MethodGet, content+"/maven/remote/central/org/missing/1.0/missing-1.0.pom", "")
+			So(code, ShouldEqual, http.StatusNotFound)
+			_, body := call(http.MethodGet, server.URL+"/api/nfc/maven/remote/central", "")
+			So(body, ShouldContainSubstring, "org/missing/1.0/missing-1.0.pom")
+		})
+	})
+}
+
+func TestFoloAndPromotion(t *testing.T) {
+	Convey("Folo tracking and promotion", t, func() {
+		mock, server := Start()
+		defer server.Close()
+		mock.PutStore(NewHosted("maven", "build-1"))
+		mock.PutContent("maven:remote:central", "org/foo/foo/1.0/foo-1.0.pom", []byte(pom))
+		track := server.URL + "/api/folo/track/build-1"
+		record := server.URL + "/api/folo/admin/build-1/record"
+
+		code, _ := call(http.MethodGet, track+"/maven/group/"+DEFAULT_SHARED_GROUP+"/org/foo/foo/1.0/foo-1.0.pom", "")
+		So(code, ShouldEqual, http.StatusOK)
+		code, _ = call(http.MethodPut, track+"/maven/hosted/build-1/org/foo/bar/1.0/bar-1.0.pom", pom)
+		So(code, ShouldEqual, http.StatusCreated)
+
+		code, _ = call(http.MethodGet, record, "")
+		So(code, ShouldEqual, http.StatusNotFound)
+		code, _ = call(http.MethodPost, record, "")
+		So(code, ShouldEqual, http.StatusOK)
+		code, body := call(http.MethodGet, record, "")
+		So(code, ShouldEqual, http.StatusOK)
+		var sealed TrackedContent
+		So(json.Unmarshal([]byte(body), &sealed), ShouldBeNil)
+		So(sealed.Key.Id, ShouldEqual, "build-1")
+		So(len(sealed.Downloads), ShouldEqual, 1)
+		So(sealed.Downloads[0].StoreKey, ShouldEqual, "maven:remote:central")
+		So(sealed.Downloads[0].OriginUrl, ShouldEqual, MAVEN_CENTRAL_URL+"org/foo/foo/1.0/foo-1.0.pom")
+		So(len(sealed.Uploads), ShouldEqual, 1)
+		So(sealed.Uploads[0].Path, ShouldEqual, "/org/foo/bar/1.0/bar-1.0.pom")
+		So(sealed.Uploads[0].LocalUrl, ShouldEqual, server.URL+"/api/content/maven/hosted/build-1/org/foo/bar/1.0/bar-1.0.pom")
+
+		promote := `{"source":"maven:hosted:build-1","target":"maven:hosted:pnc-builds","paths":["/org/foo/bar/1.0/bar-1.0.pom"],"failWhenExists":true}`
+		code, body = call(http.MethodPost, server.URL+"/api/promotion/paths/promote", promote)
+		So(code, ShouldEqual, http.StatusOK)
+		var result PathsPromoteResult
+		So(json.Unmarshal([]byte(body), &result), ShouldBeNil)
+		So(result.Error, ShouldBeNil)
+		So(result.CompletedPaths, ShouldResemble, []string{"/org/foo/bar/1.0/bar-1.0.pom"})
+		So(mock.Paths("maven:hosted:pnc-builds"), ShouldResemble, []string{"org/foo/bar/1.0/bar-1.0.pom"})
+
+		_, again := call(http.MethodPost, server.URL+"/api/promotion/paths/promote", promote)
+		So(again, ShouldContainSubstring, "already exists")
+
+		code, _ = call(http.MethodPost, server.URL+"/api/promotion/paths/rollback", body)
+		So(code, ShouldEqual, http.StatusOK)
+		So(mock.Paths("maven:hosted:pnc-builds"), ShouldBeEmpty)
+		So(mock.Paths("maven:hosted:build-1"), ShouldResemble, []string{"org/foo/bar/1.0/bar-1.0.pom"})
+
+		code, _ = call(http.MethodDelete, record, "")
+		So(code, ShouldEqual, http.StatusNoContent)
+		_, _, found := mock.GetFoloRecord("build-1")
+		So(found, ShouldBeFalse)
+	})
+}
+
+func TestContextPath(t *testing.T) {
+	Convey("Indy behind a context path", t, func() {
+		mock, server := Start()
+		defer server.Close()
+		mock.ContextPath = "/indy"
+		code, _ := call(http.MethodGet, server.URL+"/indy/api/admin/stores/maven/remote/central", "")
+		So(code, ShouldEqual, http.StatusOK)
+		code, _ = call(http.MethodGet, server.URL+"/api/admin/stores/maven/remote/central", "")
+		So(code, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestCompareVersions(t *testing.T) {
+	Convey("TestCompareVersions", t, func() {
+		So(compareVersions("1.0", "1.0.redhat-00001"), ShouldBeLessThan, 0)
+		So(compareVersions("1.0.redhat-00002", "1.0.redhat-00001"), ShouldBeGreaterThan, 0)
+		So(compareVersions("2", "10"), ShouldBeLessThan, 0)
+		So(compareVersions("666", "2"), ShouldBeGreaterThan, 0)
+		So(compareVersions("1.0", "1.0"), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,266 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package indymock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Store is the json of an indy store definition. All the fields sent by the client are kept, so a GET returns
+// what was PUT.
+type Store map[string]interface{}
+
+// NewHosted creates the definition of a hosted repo
+func NewHosted(packageType, name string) Store {
+	return newStore(packageType, "hosted", name)
+}
+
+// NewRemote creates the definition of a remote repo proxying the url
+func NewRemote(packageType, name, url string) Store {
+	s := newStore(packageType, "remote", name)
+	s["url"] = url
+	return s
+}
+
+// NewGroup creates the definition of a group with the constituents, e.g., "maven:hosted:pnc-builds"
+func NewGroup(packageType, name string, constituents ...string) Store {
+	s := newStore(packageType, "group", name)
+	s.SetConstituents(constituents)
+	return s
+}
+
+func newStore(packageType, storeType, name string) Store {
+	return Store{
+		"key":         fmt.Sprintf("%s:%s:%s", packageType, storeType, name),
+		"packageType": packageType,
+		"type":        storeType,
+		"name":        name,
+		"disabled":    false,
+	}
+}
+
+func (s Store) str(field string) string {
+	v, _ := s[field].(string)
+	return v
+}
+
+func (s Store) Key() string         { return s.str("key") }
+func (s Store) Name() string        { return s.str("name") }
+func (s Store) Type() string        { return s.str("type") }
+func (s Store) PackageType() string { return s.str("packageType") }
+func (s Store) URL() string         { return s.str("url") }
+
+func (s Store) Disabled() bool {
+	v, _ := s["disabled"].(bool)
+	return v
+}
+
+// Constituents returns the member keys of a group in order
+func (s Store) Constituents() []string {
+	var keys []string
+	switch v := s["constituents"].(type) {
+	case []string:
+		keys = append(keys, v...)
+	case []interface{}:
+		for _, k := range v {
+			keys = append(keys, fmt.Sprint(k))
+		}
+	}
+	return keys
+}
+
+func (s Store) SetConstituents(keys []string) {
+	members := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		members = append(members, k)
+	}
+	s["constituents"] = members
+}
+
+func (s Store) copy() Store {
+	c := make(Store, len(s))
+	for k, v := range s {
+		c[k] = v
+	}
+	if s.Type() == "group" {
+		c.SetConstituents(s.Constituents())
+	}
+	return c
+}
+
+// PutStore creates or replaces a store
+func (s *Server) PutStore(store Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stores[store.Key()] = store.copy()
+}
+
+// GetStore returns a copy of the store definition
+func (s *Server) GetStore(key string) (Store, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	store, ok := s.stores[key]
+	if !ok {
+		return nil, false
+	}
+	return store.copy(), true
+}
+
+// handleStores serves /api/admin/stores/{packageType}/{type}[/{name}]
+func (s *Server) handleStores(w http.ResponseWriter, r *http.Request, segs []string) {
+	if len(segs) < 2 || len(segs) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+	packageType, storeType := segs[0], segs[1]
+	if storeType != "hosted" && storeType != "remote" && storeType != "group" {
+		writeError(w, http.StatusBadRequest, "invalid store type %s", storeType)
+		return
+	}
+	if len(segs) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			s.listStores(w, packageType, storeType)
+		case http.MethodPost:
+			s.saveStore(w, r, packageType, storeType, "", true)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	key := fmt.Sprintf("%s:%s:%s", packageType, storeType, segs[2])
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		store, ok := s.GetStore(key)
+		if !ok {
+			writeError(w, http.StatusNotFound, "store %s not found", key)
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		writeJSON(w, http.StatusOK, store)
+	case http.MethodPut:
+		s.saveStore(w, r, packageType, storeType, segs[2], false)
+	case http.MethodDelete:
+		if !s.deleteStore(key, r.URL.Query().Get("deleteContent") == "true") {
+			writeError(w, http.StatusNotFound, "store %s not found", key)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) listStores(w http.ResponseWriter, packageType, storeType string) {
+	s.mu.Lock()
+	items := []Store{}
+	for _, store := range s.stores {
+		if store.PackageType() == packageType && store.Type() == storeType {
+			items = append(items, store.copy())
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(items, func(i, j int) bool { return items[i].Key() < items[j].Key() })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+// saveStore creates (POST) or creates/updates (PUT) a store from the request body
+func (s *Server) saveStore(w http.ResponseWriter, r *http.Request, packageType, storeType, name string, create bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+	store := Store{}
+	if err := json.Unmarshal(body, &store); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid store json: %s", err)
+		return
+	}
+	if name == "" {
+		name = store.Name()
+		if name == "" {
+			if toks := strings.Split(store.Key(), ":"); len(toks) == 3 {
+				name = toks[2]
+			}
+		}
+	}
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "store name is missing")
+		return
+	}
+	key := fmt.Sprintf("%s:%s:%s", packageType, storeType, name)
+	if store.Key() != "" && store.Key() != key {
+		writeError(w, http.StatusBadRequest, "store key %s does not match %s", store.Key(), key)
+		return
+	}
+	store["key"], store["packageType"], store["type"], store["name"] = key, packageType, storeType, name
+	if _, ok := store["disabled"]; !ok {
+		store["disabled"] = false
+	}
+
+	s.mu.Lock()
+	_, exists := s.stores[key]
+	if exists && create {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, "store %s already exists", key)
+		return
+	}
+	s.stores[key] = store.copy()
+	s.mu.Unlock()
+
+	if exists {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	writeJSON(w, http.StatusCreated, store)
+}
+
+// deleteStore removes the store and removes it from the groups it is member of, like indy does
+func (s *Server) deleteStore(key string, deleteContent bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.stores[key]; !ok {
+		return false
+	}
+	delete(s.stores, key)
+	delete(s.nfc, key)
+	if deleteContent {
+		delete(s.content, key)
+	}
+	for _, store := range s.stores {
+		if store.Type() != "group" {
+			continue
+		}
+		members := []string{}
+		for _, m := range store.Constituents() {
+			if m != key {
+				members = append(members, m)
+			}
+		}
+		store.SetConstituents(members)
+	}
+	return true
+}
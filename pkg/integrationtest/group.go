@@ -0,0 +1,206 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package integrationtest
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/dataset"
+	"github.com/commonjava/indy-tests/pkg/report"
+)
+
+const GROUP_REPORT_SUITE = "integrationtest-group"
+
+// The steps of a group build which run level by level. The promotions are rolled back and the repos cleaned up
+// only after all levels, so the downstream builds can resolve the artifacts promoted by the upstream ones.
+var (
+	GROUP_BUILD_STEPS    = []string{STEP_ALIGNMENT, STEP_BUILD, STEP_VERIFY_FOLO, STEP_BEFORE_PROMOTE, STEP_PROMOTE, STEP_AFTER_PROMOTE}
+	GROUP_ROLLBACK_STEPS = []string{STEP_ROLLBACK, STEP_AFTER_ROLLBACK}
+)
+
+// GroupConfig is the input of a group run. Config.BuildId is the group build id, the config of each build is
+// derived from it.
+type GroupConfig struct {
+	Config
+	// Parallel is the max number of builds of a level which run at the same time, 0 for all of them
+	Parallel int
+}
+
+// BuildResult is the result of a build of the group
+type BuildResult struct {
+	BuildId   string
+	Level     string
+	BuildName string
+	// Skipped is true if the build did not run because a build of a previous level failed
+	Skipped bool
+	Err     error
+}
+
+/*
+ * RunGroup runs the builds of the build-queue.yaml (or build-queue.json) of a group build dataset through the integration pipeline.
+ * The builds of each level run in parallel, and each level starts after the builds of the previous level are
+ * promoted. The downloads of a build which were uploaded by a build of a previous level are rewritten to the
+ * paths of that promoted replay, and the promotion target is added to the build group, so the content flows
+ * between the builds as in the original group build. If a build fails, the following levels are skipped.
+ * At last, the promotions are rolled back level by level in reverse order and all repos are cleaned up.
+ */
+func RunGroup(config GroupConfig, wait common.WaitOptions) []BuildResult {
+	step := report.Step(GROUP_REPORT_SUITE, "Load build queue of "+config.BuildId)
+	datasetRepoDir := cloneRepo(config.DatasetRepoUrl)
+	queueFileLoc := dataset.BuildQueueFile(path.Join(datasetRepoDir, config.BuildId))
+	queue, err := dataset.LoadBuildQueue(queueFileLoc)
+	if err != nil {
+		step.Fail("%s", err)
+		fmt.Printf("Error: cannot load the build queue, %s\n", err)
+		report.Exit(1)
+	}
+	info, err := loadInfo(getInfoFileLoc(datasetRepoDir, config.BuildId))
+	if err != nil {
+		step.Fail("%s", err)
+		fmt.Printf("Error: cannot load the dataset info, %s\n", err)
+		report.Exit(1)
+	}
+	promoteTargetStore := config.PromoteTargetStore
+	if promoteTargetStore == "" {
+		promoteTargetStore = PROMOTE_TARGET_STORE
+	}
+	extraRepos := []string{getPackageType(info) + ":hosted:" + promoteTargetStore}
+	step.Set("levels", len(queue)).Pass()
+	if config.Parallel != 1 {
+		// the phases of the builds running in parallel would overwrite each other
+		common.DefaultMetrics().PinPhase("group")
+		defer common.DefaultMetrics().UnpinPhase()
+	}
+
+	var results []BuildResult
+	var levels [][]*pipeline
+	resultOf := make(map[*pipeline]int)
+	upstreamPaths := make(map[string]string)
+	names := make(map[string]bool)
+	failed := false
+	for _, level := range queue {
+		if failed || len(level.Items) == 0 {
+			for _, buildId := range level.Items {
+				results = append(results, BuildResult{BuildId: buildId, Level: level.Id, Skipped: true})
+			}
+			continue
+		}
+		fmt.Printf("Start level %s of group %s, builds: %v\n", level.Id, config.BuildId, level.Items)
+		pipelines := make([]*pipeline, len(level.Items))
+		for i, buildId := range level.Items {
+			buildConfig := config.Config
+			buildConfig.BuildId = path.Join(config.BuildId, dataset.BUILDS_DIR, buildId)
+			p, err := newPipeline(buildConfig, StepOptions{}, wait)
+			for err == nil && names[p.state.BuildName] {
+				p, err = newPipeline(buildConfig, StepOptions{}, wait)
+			}
+			if err != nil {
+				fmt.Printf("Error: %s\n", err)
+				report.Exit(1)
+			}
+			names[p.state.BuildName] = true
+			p.label, p.state.DatasetRepoDir = buildId, datasetRepoDir
+			p.upstreamPaths, p.extraRepos = copyPaths(upstreamPaths), extraRepos
+			pipelines[i] = p
+		}
+		errs := runParallel(pipelines, config.Parallel, func(p *pipeline) error {
+			if err := p.start(); err != nil {
+				return fmt.Errorf("load dataset failed, %s", err)
+			}
+			return p.runSteps(GROUP_BUILD_STEPS...)
+		})
+		for i, p := range pipelines {
+			resultOf[p] = len(results)
+			results = append(results, BuildResult{BuildId: level.Items[i], Level: level.Id, BuildName: p.state.BuildName, Err: errs[i]})
+			if errs[i] != nil {
+				failed = true
+				p.finish(false)
+				continue
+			}
+			for _, up := range p.foloTrackContent.Uploads {
+				upstreamPaths[up.Path] = common.AlterUploadPath(up.Path, up.StoreKey, p.newVersionNum())
+			}
+		}
+		levels = append(levels, pipelines)
+	}
+
+	// Roll back the downstream builds first, the failed builds are finished already
+	for i := len(levels) - 1; i >= 0; i-- {
+		errs := runParallel(levels[i], config.Parallel, func(p *pipeline) error {
+			if results[resultOf[p]].Err != nil {
+				return nil
+			}
+			err := p.runSteps(GROUP_ROLLBACK_STEPS...)
+			p.finish(err == nil)
+			return err
+		})
+		for j, p := range levels[i] {
+			if errs[j] != nil {
+				results[resultOf[p]].Err = errs[j]
+			}
+		}
+	}
+
+	reportGroup(results)
+	return results
+}
+
+// runParallel runs the pipelines, at most parallel at the same time if it is > 0, see common.RunParallel
+func runParallel(pipelines []*pipeline, parallel int, run func(p *pipeline) error) []error {
+	return common.RunParallel(len(pipelines), parallel, func(i int) error {
+		return run(pipelines[i])
+	})
+}
+
+func copyPaths(paths map[string]string) map[string]string {
+	c := make(map[string]string, len(paths))
+	for k, v := range paths {
+		c[k] = v
+	}
+	return c
+}
+
+func reportGroup(results []BuildResult) {
+	suite := report.GetSuite(GROUP_REPORT_SUITE)
+	fmt.Println("Group build results:")
+	for _, r := range results {
+		name := fmt.Sprintf("%s: %s", r.Level, r.BuildId)
+		switch {
+		case r.Skipped:
+			suite.Add(name, report.StatusSkipped, 0, "a build of a previous level failed")
+			fmt.Printf("  [SKIPPED] %s\n", name)
+		case r.Err != nil:
+			suite.Add(name, report.StatusFailed, 0, r.Err.Error()).Set("buildName", r.BuildName)
+			fmt.Printf("  [FAILED] %s (%s), %s\n", name, r.BuildName, r.Err)
+		default:
+			suite.Add(name, report.StatusPassed, 0, "").Set("buildName", r.BuildName)
+			fmt.Printf("  [PASSED] %s (%s)\n", name, r.BuildName)
+		}
+	}
+}
+
+// GroupSucceeded is true if all builds of the group passed
+func GroupSucceeded(results []BuildResult) bool {
+	for _, r := range results {
+		if r.Skipped || r.Err != nil {
+			return false
+		}
+	}
+	return true
+}
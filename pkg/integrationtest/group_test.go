@@ -0,0 +1,174 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package integrationtest
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/dataset"
+	"github.com/commonjava/indy-tests/pkg/indymock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRunParallel(t *testing.T) {
+	Convey("The pipelines of a level should run in parallel", t, func() {
+		pipelines := []*pipeline{{label: "1"}, {label: "2"}, {label: "3"}, {label: "4"}}
+
+		Convey("At most parallel at the same time, with a panic returned as the error", func() {
+			var mu sync.Mutex
+			running, maxRunning := 0, 0
+			errs := runParallel(pipelines, 2, func(p *pipeline) error {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				switch p.label {
+				case "2":
+					return errors.New("promote failed")
+				case "3":
+					panic("unexpected")
+				}
+				return nil
+			})
+			So(maxRunning, ShouldEqual, 2)
+			So(errs[0], ShouldBeNil)
+			So(errs[1].Error(), ShouldEqual, "promote failed")
+			So(errs[2].Error(), ShouldEqual, "panic: unexpected")
+			So(errs[3], ShouldBeNil)
+		})
+		Convey("All at the same time by default", func() {
+			start := time.Now()
+			runParallel(pipelines, 0, func(p *pipeline) error {
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			})
+			So(time.Since(start), ShouldBeLessThan, 150*time.Millisecond)
+		})
+	})
+}
+
+func TestGroupSucceeded(t *testing.T) {
+	Convey("A group should succeed only if all builds passed", t, func() {
+		So(GroupSucceeded([]BuildResult{{BuildId: "1"}, {BuildId: "2"}}), ShouldBeTrue)
+		So(GroupSucceeded([]BuildResult{{BuildId: "1"}, {BuildId: "2", Skipped: true}}), ShouldBeFalse)
+		So(GroupSucceeded([]BuildResult{{BuildId: "1", Err: errors.New("failed")}}), ShouldBeFalse)
+	})
+}
+
+func TestRunGroupWithMockIndy(t *testing.T) {
+	Convey("A failed build of a group should be returned as its result, and the next levels skipped", t, func() {
+		mock, server := indymock.Start()
+		defer server.Close()
+		os.Setenv(common.ENVAR_TEST_MOUNT_PATH, t.TempDir())
+		defer os.Unsetenv(common.ENVAR_TEST_MOUNT_PATH)
+
+		datasetDir := t.TempDir()
+		groupDir := path.Join(datasetDir, "100")
+		writeDatasetFile(groupDir, dataset.BUILD_QUEUE_YAML, "- id: \"1\"\n  build: [\"1\", \"2\"]\n- id: \"2\"\n  build: [\"3\"]\n")
+		writeDatasetJSON(groupDir, dataset.INFO_JSON, dataset.Info{BuildId: "100", BuildType: "MVN"})
+		for _, buildId := range []string{"1", "2", "3"} {
+			storeKey := "maven:hosted:build-" + buildId
+			uploadPath := fmt.Sprintf("/org/foo%s/foo%s/1.0.0.redhat-0000%s/foo%s-1.0.0.redhat-0000%s.pom", buildId, buildId, buildId, buildId, buildId)
+			pom := []byte("<project><version>1.0.0.redhat-0000" + buildId + "</version></project>")
+			mock.PutStore(indymock.NewHosted("maven", "build-"+buildId))
+			if buildId != "2" {
+				// the upload of build 2 is missing on the original indy, so its replay fails
+				mock.PutContent(storeKey, uploadPath, pom)
+			}
+			record := common.TrackedContent{
+				TrackingKey: common.TrackingKey{Id: "build-" + buildId},
+				Uploads: []common.TrackedContentEntry{{Path: uploadPath, StoreKey: storeKey, Md5: fmt.Sprintf("%x", md5.Sum(pom)),
+					LocalUrl: server.URL + "/api/content/maven/hosted/build-" + buildId + uploadPath}},
+			}
+			buildDir := path.Join(groupDir, dataset.BUILDS_DIR, buildId)
+			writeDatasetJSON(buildDir, dataset.TRACKING_JSON, record)
+			writeDatasetJSON(buildDir, dataset.DA_JSON, []string{})
+		}
+
+		config := GroupConfig{Config: Config{IndyBaseUrl: server.URL, DatasetRepoUrl: datasetDir, BuildId: "100"}}
+		results := RunGroup(config, common.WaitOptions{Timeout: time.Second, Interval: 50 * time.Millisecond})
+		So(len(results), ShouldEqual, 3)
+		So(results[0].BuildId, ShouldEqual, "1")
+		So(results[0].Err, ShouldBeNil)
+		So(results[1].BuildId, ShouldEqual, "2")
+		So(results[1].Err, ShouldNotBeNil)
+		So(results[1].Err.Error(), ShouldContainSubstring, STEP_BUILD)
+		So(results[2].BuildId, ShouldEqual, "3")
+		So(results[2].Skipped, ShouldBeTrue)
+		So(GroupSucceeded(results), ShouldBeFalse)
+
+		// both builds of the first level are cleaned up
+		for _, r := range results[:2] {
+			_, ok := mock.GetStore("maven:group:" + r.BuildName)
+			So(ok, ShouldBeFalse)
+		}
+	})
+}
+
+func TestLoadDataset(t *testing.T) {
+	Convey("A broken dataset should fail the steps instead of panicking", t, func() {
+		datasetDir := t.TempDir()
+		buildDir := path.Join(datasetDir, "200")
+		writeDatasetJSON(buildDir, dataset.TRACKING_JSON, common.TrackedContent{TrackingKey: common.TrackingKey{Id: "build-200"}})
+		p := &pipeline{state: &State{Config: Config{BuildId: "200"}, DatasetRepoDir: datasetDir}}
+
+		Convey("An invalid info.json should fail the load", func() {
+			writeDatasetFile(buildDir, dataset.INFO_JSON, "{")
+			err := p.loadDataset()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, dataset.INFO_JSON)
+		})
+		Convey("A missing info.json should fail the load", func() {
+			_, err := loadInfo(path.Join(buildDir, dataset.INFO_JSON))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("A folo record without uploads should fail the build", func() {
+			writeDatasetJSON(buildDir, dataset.INFO_JSON, dataset.Info{BuildId: "200", BuildType: "MVN"})
+			So(p.loadDataset(), ShouldBeNil)
+			err := p.build()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no uploads")
+		})
+	})
+}
+
+func writeDatasetFile(dir, name, content string) {
+	So(os.MkdirAll(dir, 0755), ShouldBeNil)
+	So(ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644), ShouldBeNil)
+}
+
+func writeDatasetJSON(dir, name string, v interface{}) {
+	b, err := json.Marshal(v)
+	So(err, ShouldBeNil)
+	writeDatasetFile(dir, name, string(b))
+}
@@ -0,0 +1,185 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package integrationtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// The steps of the pipeline in the order they run, the dataset is always loaded before them
+const (
+	STEP_ALIGNMENT      = "alignment"
+	STEP_BUILD          = "build"
+	STEP_VERIFY_FOLO    = "verify-folo"
+	STEP_BEFORE_PROMOTE = "before-promote"
+	STEP_PROMOTE        = "promote"
+	STEP_AFTER_PROMOTE  = "after-promote"
+	STEP_ROLLBACK       = "rollback"
+	STEP_AFTER_ROLLBACK = "after-rollback"
+	STEP_CLEANUP        = "cleanup"
+)
+
+// ALL_STEPS are the steps of the pipeline in order
+var ALL_STEPS = []string{STEP_ALIGNMENT, STEP_BUILD, STEP_VERIFY_FOLO, STEP_BEFORE_PROMOTE, STEP_PROMOTE,
+	STEP_AFTER_PROMOTE, STEP_ROLLBACK, STEP_AFTER_ROLLBACK, STEP_CLEANUP}
+
+const (
+	// TMP_RUN_DIR keeps the run dir of each build, TMP_RUN_DIR/build-test-NNNNN
+	TMP_RUN_DIR = "/tmp/integrationtest"
+	STATE_JSON  = "state.json"
+)
+
+// Config is the input of a run. It is kept in the state, so a resumed run uses the same.
+type Config struct {
+	IndyBaseUrl        string `json:"indyBaseUrl"`
+	DatasetRepoUrl     string `json:"datasetRepoUrl"`
+	BuildId            string `json:"buildId"`
+	PromoteTargetStore string `json:"promoteTargetStore"`
+	MetaCheckRepo      string `json:"metaCheckRepo,omitempty"`
+	IndyProxyUrl       string `json:"indyProxyUrl,omitempty"`
+	ClearCache         bool   `json:"clearCache,omitempty"`
+	DryRun             bool   `json:"dryRun,omitempty"`
+	KeepPod            bool   `json:"keepPod,omitempty"`
+	Sidecar            bool   `json:"sidecar,omitempty"`
+}
+
+// StepOptions select the steps to run and how a failed run ends
+type StepOptions struct {
+	// FromStep skips the steps before it
+	FromStep string
+	// OnlySteps runs these steps only if it is not empty
+	OnlySteps []string
+	SkipSteps []string
+	// RunDir keeps the state and the metadata snapshots of the run, TMP_RUN_DIR/<build name> by default
+	RunDir string
+	// Resume is the run dir of a failed run to continue against its build-test-NNNNN repos. Without a step
+	// selection, the steps which are not completed are run.
+	Resume string
+	// KeepOnFailure keeps the repos of a failed run so it can be resumed, they are cleaned up by default
+	KeepOnFailure bool
+}
+
+// ValidateStepOptions checks the step names
+func ValidateStepOptions(options StepOptions) error {
+	names := append(append([]string{}, options.OnlySteps...), options.SkipSteps...)
+	if options.FromStep != "" {
+		names = append(names, options.FromStep)
+	}
+	for _, name := range names {
+		if stepIndex(name) < 0 {
+			return fmt.Errorf("unknown step '%s', the steps are: %s", name, strings.Join(ALL_STEPS, ", "))
+		}
+	}
+	if options.FromStep != "" && len(options.OnlySteps) > 0 {
+		return fmt.Errorf("--fromStep and --onlySteps cannot be used together")
+	}
+	return nil
+}
+
+func stepIndex(name string) int {
+	for i, s := range ALL_STEPS {
+		if s == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Selected is true if the step is run. A step of a resumed run is run again only if it is selected explicitly.
+func (options StepOptions) Selected(step string, state *State) bool {
+	for _, s := range options.SkipSteps {
+		if s == step {
+			return false
+		}
+	}
+	if len(options.OnlySteps) > 0 {
+		for _, s := range options.OnlySteps {
+			if s == step {
+				return true
+			}
+		}
+		return false
+	}
+	if options.FromStep != "" {
+		return stepIndex(step) >= stepIndex(options.FromStep)
+	}
+	return options.Resume == "" || !state.IsCompleted(step)
+}
+
+// State is the progress of a run, saved in the run dir after each step
+type State struct {
+	Config         Config `json:"config"`
+	DatasetRepoDir string `json:"datasetRepoDir,omitempty"`
+	BuildName      string `json:"buildName"`
+	// ReposCreated is true once the build step started to create the repos, so they are cleaned up
+	ReposCreated bool `json:"reposCreated,omitempty"`
+	// PromoteResult is the response of the promotion, used to roll it back
+	PromoteResult string   `json:"promoteResult,omitempty"`
+	RolledBack    bool     `json:"rolledBack,omitempty"`
+	Completed     []string `json:"completed"`
+	CleanedUp     bool     `json:"cleanedUp,omitempty"`
+}
+
+// IsCompleted is true if the step succeeded in this or a previous run
+func (s *State) IsCompleted(step string) bool {
+	for _, c := range s.Completed {
+		if c == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete marks the step as succeeded
+func (s *State) Complete(step string) {
+	if !s.IsCompleted(step) {
+		s.Completed = append(s.Completed, step)
+	}
+}
+
+// SaveState writes the state to the run dir
+func SaveState(runDir string, state *State) error {
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(runDir, STATE_JSON), b, 0644)
+}
+
+// LoadState reads the state of the run dir
+func LoadState(runDir string) (*State, error) {
+	b, err := ioutil.ReadFile(path.Join(runDir, STATE_JSON))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the state of run %s, %s", runDir, err)
+	}
+	state := &State{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("cannot parse the state of run %s, %s", runDir, err)
+	}
+	if state.BuildName == "" {
+		return nil, fmt.Errorf("no build name in the state of run %s", runDir)
+	}
+	return state, nil
+}
@@ -0,0 +1,89 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package integrationtest
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStepOptions(t *testing.T) {
+	Convey("Step options", t, func() {
+		state := &State{BuildName: "build-test-91234", Completed: []string{STEP_ALIGNMENT, STEP_BUILD}}
+		selected := func(options StepOptions) []string {
+			var steps []string
+			for _, s := range ALL_STEPS {
+				if options.Selected(s, state) {
+					steps = append(steps, s)
+				}
+			}
+			return steps
+		}
+
+		Convey("All steps should be selected by default", func() {
+			So(selected(StepOptions{}), ShouldResemble, ALL_STEPS)
+		})
+		Convey("The steps before --fromStep should be skipped", func() {
+			So(selected(StepOptions{FromStep: STEP_ROLLBACK}), ShouldResemble, []string{STEP_ROLLBACK, STEP_AFTER_ROLLBACK, STEP_CLEANUP})
+		})
+		Convey("Only --onlySteps should be selected, except the --skipSteps", func() {
+			So(selected(StepOptions{OnlySteps: []string{STEP_PROMOTE, STEP_AFTER_PROMOTE}, SkipSteps: []string{STEP_AFTER_PROMOTE}}),
+				ShouldResemble, []string{STEP_PROMOTE})
+		})
+		Convey("A resumed run should run the steps which are not completed", func() {
+			So(selected(StepOptions{Resume: "/tmp/run", SkipSteps: []string{STEP_CLEANUP}}), ShouldResemble,
+				[]string{STEP_VERIFY_FOLO, STEP_BEFORE_PROMOTE, STEP_PROMOTE, STEP_AFTER_PROMOTE, STEP_ROLLBACK, STEP_AFTER_ROLLBACK})
+		})
+		Convey("A completed step of a resumed run should be run again if it is selected explicitly", func() {
+			So(selected(StepOptions{Resume: "/tmp/run", OnlySteps: []string{STEP_BUILD}}), ShouldResemble, []string{STEP_BUILD})
+		})
+		Convey("Unknown steps and conflicting options should be rejected", func() {
+			So(ValidateStepOptions(StepOptions{SkipSteps: []string{"h"}}), ShouldNotBeNil)
+			So(ValidateStepOptions(StepOptions{FromStep: STEP_PROMOTE, OnlySteps: []string{STEP_ROLLBACK}}), ShouldNotBeNil)
+			So(ValidateStepOptions(StepOptions{FromStep: STEP_PROMOTE, SkipSteps: []string{STEP_CLEANUP}}), ShouldBeNil)
+		})
+	})
+}
+
+func TestState(t *testing.T) {
+	Convey("The state should be saved to and loaded from the run dir", t, func() {
+		dir, err := ioutil.TempDir("", "integrationtest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		runDir := path.Join(dir, "build-test-91234")
+
+		state := &State{Config: Config{IndyBaseUrl: "http://indy", BuildId: "2836", PromoteTargetStore: "test-builds"},
+			BuildName: "build-test-91234", ReposCreated: true, Completed: []string{}}
+		state.Complete(STEP_BUILD)
+		state.Complete(STEP_BUILD)
+		state.PromoteResult = `{"pending":["org/foo/1.0/foo-1.0.pom"]}`
+		So(SaveState(runDir, state), ShouldBeNil)
+
+		loaded, err := LoadState(runDir)
+		So(err, ShouldBeNil)
+		So(loaded, ShouldResemble, state)
+		So(loaded.Completed, ShouldResemble, []string{STEP_BUILD})
+		So(loaded.IsCompleted(STEP_PROMOTE), ShouldBeFalse)
+
+		_, err = LoadState(dir)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -19,9 +19,11 @@ package integrationtest
 import (
 	"encoding/json"
 	"fmt"
-	"net/url"
+	"io/ioutil"
+	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	logger "github.com/sirupsen/logrus"
@@ -30,13 +32,15 @@ import (
 	"github.com/commonjava/indy-tests/pkg/common"
 	"github.com/commonjava/indy-tests/pkg/dataset"
 	"github.com/commonjava/indy-tests/pkg/datest"
+	"github.com/commonjava/indy-tests/pkg/folodiff"
 	"github.com/commonjava/indy-tests/pkg/promotetest"
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
 const (
 	DEFAULT_ROUTINES     = 4
-	TMP_METADATA_DIR     = "/tmp/metadata"
 	PROMOTE_TARGET_STORE = "pnc-builds"
+	REPORT_SUITE         = "integrationtest"
 )
 
 /*
@@ -55,111 +59,396 @@ const (
  * i. Rollback the promotion
  * j. Retrieve the metadata files from step #f again, check that the new version is gone
  * k. Clean up. Delete the build group G and the hosted repo A. Delete folo record.
+ *
+ * The checks of #h and #j are repeated until indy has handled the promotion or rollback, or the wait timeout.
+ * The steps b-k are the ALL_STEPS, which can be selected by the step options. The state of the run is saved in
+ * its run dir after each step, so a failed run can be resumed against the same repos. The clean up is done
+ * even if a step fails or panics, unless it is not selected or the repos are kept for resuming.
  */
-func Run(indyBaseUrl, datasetRepoUrl, buildId, promoteTargetStore, metaCheckRepo string, clearCache, dryRun, keepPod, sidecar bool, indyProxyUrl string) {
-	if indyProxyUrl != "" {
-		fmt.Println("Enable generic proxy: " + indyProxyUrl)
+func Run(config Config, steps StepOptions, wait common.WaitOptions) {
+	p, err := newPipeline(config, steps, wait)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		report.Exit(1)
+	}
+	p.run()
+}
+
+type pipeline struct {
+	state  *State
+	runDir string
+	steps  StepOptions
+	wait   common.WaitOptions
+
+	// loaded from the dataset
+	info             dataset.Info
+	additionalRepos  []string
+	foloTrackContent common.TrackedContent
+	packageType      string
+
+	// label prefixes the report cases, e.g., the build id in a group
+	label string
+	// upstreamPaths rewrites the download paths to the ones uploaded and promoted by the upstream builds of a group
+	upstreamPaths map[string]string
+	// extraRepos are added to the additional repos of the dataset, e.g., the promotion target of a group
+	extraRepos []string
+
+	finishOnce sync.Once
+}
+
+// pipelineStep is a step of ALL_STEPS but the clean up, which is done by finish
+type pipelineStep struct {
+	name, title string
+	run         func() error
+}
+
+func (p *pipeline) pipelineSteps() []pipelineStep {
+	return []pipelineStep{
+		{STEP_ALIGNMENT, "b. Retrieve alignment metadata", p.retrieveAlignmentMetadata},
+		{STEP_BUILD, "c-e. Create build group and hosted repo, download and upload " + p.state.BuildName, p.build},
+		{STEP_VERIFY_FOLO, "e. Verify folo record", p.verifyFoloRecord},
+		{STEP_BEFORE_PROMOTE, "f. Validate metadata before promotion", p.validateBeforePromotion},
+		{STEP_PROMOTE, "g. Promote", p.promote},
+		{STEP_AFTER_PROMOTE, "h. Validate metadata after promotion", p.validateAfterPromotion},
+		{STEP_ROLLBACK, "i. Rollback promotion", p.rollback},
+		{STEP_AFTER_ROLLBACK, "j. Validate metadata after rollback", p.validateAfterRollback},
 	}
+}
 
-	if sidecar {
+func (p *pipeline) title(title string) string {
+	if p.label == "" {
+		return title
+	}
+	return p.label + ": " + title
+}
+
+func newPipeline(config Config, steps StepOptions, wait common.WaitOptions) (*pipeline, error) {
+	if err := ValidateStepOptions(steps); err != nil {
+		return nil, err
+	}
+	p := &pipeline{steps: steps, wait: wait}
+	if steps.Resume != "" {
+		state, err := LoadState(steps.Resume)
+		if err != nil {
+			return nil, err
+		}
+		if state.CleanedUp {
+			return nil, fmt.Errorf("the repos of run %s are cleaned up, it cannot be resumed", steps.Resume)
+		}
+		p.state, p.runDir = state, steps.Resume
+		fmt.Printf("Resume run %s of build %s, completed steps: %s\n", p.runDir, state.BuildName, strings.Join(state.Completed, ", "))
+		return p, nil
+	}
+
+	if config.IndyProxyUrl != "" {
+		fmt.Println("Enable generic proxy: " + config.IndyProxyUrl)
+	}
+	if config.Sidecar {
 		fmt.Println("Enable sidecar")
-		indyBaseUrl = "http://localhost:8080"
+		config.IndyBaseUrl = "http://localhost:8080"
 	}
+	config.IndyBaseUrl = common.NormIndyURL(config.IndyBaseUrl)
+	p.state = &State{Config: config, BuildName: common.GenerateRandomBuildName(), Completed: []string{}}
+	p.runDir = steps.RunDir
+	if p.runDir == "" {
+		p.runDir = path.Join(TMP_RUN_DIR, p.state.BuildName)
+	}
+	fmt.Printf("Run dir of build %s: %s\n", p.state.BuildName, p.runDir)
+	return p, p.save()
+}
 
-	//a. Clone dataset repo
-	datasetRepoDir := cloneRepo(datasetRepoUrl)
-	fmt.Printf("Clone SUCCESS, dir: %s\n", datasetRepoDir)
+func (p *pipeline) save() error {
+	return SaveState(p.runDir, p.state)
+}
 
-	//Load the info.json
-	var info dataset.Info
-	infoFileLoc := getInfoFileLoc(datasetRepoDir, buildId)
-	json.Unmarshal(common.ReadByteFromFile(infoFileLoc), &info)
+func (p *pipeline) run() {
+	defer p.finishOnPanic()
+	err := p.start()
+	if err == nil {
+		err = p.runSteps(ALL_STEPS...)
+	}
+	if err == nil && p.state.Config.KeepPod {
+		// Pause and keep pod for debugging
+		fmt.Printf("Waiting 30m...\n")
+		time.Sleep(30 * time.Minute)
+	}
+	p.finish(err == nil)
+	if err != nil {
+		report.Exit(1)
+	}
+}
 
-	//Load the additional-repos.json
-	additionalRepos := getAdditionalRepos(datasetRepoDir, buildId)
+// start loads the dataset. The run is finished by a report.Exit in a step too, which skips the deferred functions.
+func (p *pipeline) start() error {
+	report.OnExit(func(exitCode int) {
+		p.finish(exitCode == 0)
+	})
+	return p.loadDataset()
+}
 
-	start := time.Now()
+// finishOnPanic should be deferred, it finishes the run and goes on panicking
+func (p *pipeline) finishOnPanic() {
+	if r := recover(); r != nil {
+		p.finish(false)
+		panic(r)
+	}
+}
+
+// runSteps runs the selected steps of the names in order, and stops at the first failed one
+func (p *pipeline) runSteps(names ...string) error {
+	for _, step := range p.pipelineSteps() {
+		if !common.Contains(names, step.name) {
+			continue
+		}
+		if !p.steps.Selected(step.name, p.state) {
+			fmt.Printf("Skip step %s of %s\n", step.name, p.state.BuildName)
+			report.Step(REPORT_SUITE, p.title(step.title)).Skip("not selected")
+			continue
+		}
+		start := time.Now()
+		c := report.Step(REPORT_SUITE, p.title(step.title))
+		err := step.run()
+		c.Done(err)
+		if err != nil {
+			fmt.Printf("Step %s of %s FAILED, %s\n", step.name, p.state.BuildName, err)
+			return fmt.Errorf("step %s failed, %s", step.name, err)
+		}
+		p.state.Complete(step.name)
+		p.saveOrWarn()
+		fmt.Printf("Step %s of %s SUCCESS, elapsed(s): %f\n", step.name, p.state.BuildName, time.Since(start).Seconds())
+	}
+	return nil
+}
 
-	//b. Retrieve the metadata files in da.json
-	retrieveAlignmentMetadata(indyBaseUrl, datasetRepoDir, buildId, info)
-	t := time.Now()
-	fmt.Printf("Retrieve metadata SUCCESS, elapsed(s): %f\n", t.Sub(start).Seconds())
+func (p *pipeline) saveOrWarn() {
+	if err := p.save(); err != nil {
+		fmt.Printf("Warning: cannot save the state of run %s, %s\n", p.runDir, err)
+	}
+}
 
-	//c/d/e. Create a mock build group, download files, rename to-be-uploaded files
-	packageType := getPackageType(info)
-	foloFileLoc := path.Join(datasetRepoDir, buildId, dataset.TRACKING_JSON)
-	foloTrackContent := common.GetFoloRecordFromFile(foloFileLoc)
-	originalIndy := getOriginalIndyBaseUrl(foloTrackContent.Uploads[0].LocalUrl)
-	buildName := common.GenerateRandomBuildName()
-	prev := t
-	buildSuccess := buildtest.DoRun(originalIndy, indyBaseUrl, indyProxyUrl, packageType, buildName, foloTrackContent, additionalRepos, DEFAULT_ROUTINES, clearCache, dryRun)
-	t = time.Now()
-	fmt.Printf("Create mock group(%s) and download/upload SUCCESS, elapsed(s): %f\n", buildName, t.Sub(prev).Seconds())
-
-	//k. Delete the temp group and the hosted repo, and folo record
-	defer cleanUp(indyBaseUrl, packageType, buildName, dryRun)
-
-	// Advanced checks
-	if buildSuccess && !dryRun {
-		if !verifyFoloRecord(indyBaseUrl, buildName, foloTrackContent) {
+// finish cleans up once, when the run succeeded or failed
+func (p *pipeline) finish(succeeded bool) {
+	p.finishOnce.Do(func() {
+		defer p.saveOrWarn()
+		resumable := p.state.ReposCreated && !p.state.CleanedUp
+		if !p.steps.Selected(STEP_CLEANUP, p.state) {
+			report.Step(REPORT_SUITE, p.title("k. Clean up")).Skip("not selected")
+			if resumable {
+				fmt.Printf("The repos of %s are kept, resume by --resume %s\n", p.state.BuildName, p.runDir)
+			}
 			return
 		}
+		if !succeeded && p.steps.KeepOnFailure {
+			report.Step(REPORT_SUITE, p.title("k. Clean up")).Skip("kept for resuming")
+			fmt.Printf("The repos of %s are kept, resume by --resume %s\n", p.state.BuildName, p.runDir)
+			return
+		}
+		p.cleanUp()
+	})
+}
+
+func (p *pipeline) loadDataset() error {
+	config := p.state.Config
+	step := report.Step(REPORT_SUITE, p.title("a. Load dataset"))
+	err := p.readDataset()
+	step.Set("dir", p.state.DatasetRepoDir).Done(err)
+	if err != nil {
+		fmt.Printf("Load dataset of %s FAILED, %s\n", config.BuildId, err)
+	}
+	return err
+}
+
+func (p *pipeline) readDataset() error {
+	config := p.state.Config
+	//a. Clone dataset repo. A resumed run, or a build of a group, uses the one cloned before.
+	datasetRepoDir := p.state.DatasetRepoDir
+	if datasetRepoDir == "" || !common.FileOrDirExists(datasetRepoDir) {
+		datasetRepoDir = cloneRepo(config.DatasetRepoUrl)
+		fmt.Printf("Clone SUCCESS, dir: %s\n", datasetRepoDir)
+		p.state.DatasetRepoDir = datasetRepoDir
+	}
+
+	//Load the info.json
+	info, err := loadInfo(getInfoFileLoc(datasetRepoDir, config.BuildId))
+	if err != nil {
+		return err
+	}
+	p.info = info
+	p.packageType = getPackageType(p.info)
+
+	//Load the additional-repos.json
+	p.additionalRepos = getAdditionalRepos(datasetRepoDir, config.BuildId)
+	for _, repo := range p.extraRepos {
+		if !common.Contains(p.additionalRepos, repo) {
+			p.additionalRepos = append(p.additionalRepos, repo)
+		}
 	}
 
-	//f. Retrieve the metadata files which will be affected by promotion
-	metaFiles := calculateMetadataFiles(foloTrackContent)
-	metaFilesLoc := path.Join(TMP_METADATA_DIR, "before-promote")
-	newVersionNum := buildName[len(common.BUILD_TEST_):]
-	exists := true
-	passed, e := retrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, metaFiles, metaFilesLoc, newVersionNum, !exists)
+	foloFileLoc := path.Join(datasetRepoDir, config.BuildId, dataset.TRACKING_JSON)
+	if p.foloTrackContent, err = common.LoadFoloRecordFromFile(foloFileLoc); err != nil {
+		return err
+	}
+	for i, down := range p.foloTrackContent.Downloads {
+		if upstreamPath, ok := p.upstreamPaths[down.Path]; ok {
+			p.foloTrackContent.Downloads[i].Path = upstreamPath
+		}
+	}
+	return nil
+}
+
+// b. Retrieve the metadata files in da.json
+func (p *pipeline) retrieveAlignmentMetadata() error {
+	config := p.state.Config
+	if !retrieveAlignmentMetadata(config.IndyBaseUrl, p.state.DatasetRepoDir, config.BuildId, p.info) {
+		return fmt.Errorf("some metadata can not be retrieved, see the metadata suite")
+	}
+	return nil
+}
+
+// c/d/e. Create a mock build group, download files, rename to-be-uploaded files
+func (p *pipeline) build() error {
+	config := p.state.Config
+	if len(p.foloTrackContent.Uploads) == 0 {
+		return fmt.Errorf("the folo record of %s has no uploads to replay", config.BuildId)
+	}
+	originalIndy := common.GetIndyBaseURL(p.foloTrackContent.Uploads[0].LocalUrl)
+	p.state.ReposCreated = true
+	p.saveOrWarn()
+	return buildtest.DoRun(originalIndy, config.IndyBaseUrl, config.IndyProxyUrl, p.packageType, p.state.BuildName, p.foloTrackContent,
+		p.additionalRepos, DEFAULT_ROUTINES, false, config.ClearCache, config.DryRun, buildtest.DEFAULT_REPLAY)
+}
+
+func (p *pipeline) requireBuild() error {
+	if !p.state.IsCompleted(STEP_BUILD) {
+		return fmt.Errorf("build %s is not done, run the %s step first", p.state.BuildName, STEP_BUILD)
+	}
+	return nil
+}
+
+// Advanced checks
+func (p *pipeline) verifyFoloRecord() error {
+	if p.state.Config.DryRun {
+		fmt.Printf("Dry run verifyFoloRecord\n")
+		return nil
+	}
+	if err := p.requireBuild(); err != nil {
+		return err
+	}
+	if !verifyFoloRecord(p.state.Config.IndyBaseUrl, p.state.BuildName, p.foloTrackContent) {
+		return fmt.Errorf("folo record of %s does not match the original one", p.state.BuildName)
+	}
+	return nil
+}
+
+func (p *pipeline) newVersionNum() string {
+	return p.state.BuildName[len(common.BUILD_TEST_):]
+}
+
+// validateMetadata retrieves the metadata files which will be affected by promotion into a snapshot dir of the
+// run, and checks whether the new version exists
+func (p *pipeline) validateMetadata(snapshot string, exist bool) (bool, error) {
+	config := p.state.Config
+	checks := calculateMetadataFiles(p.packageType, p.foloTrackContent, p.newVersionNum())
+	metaFilesLoc := path.Join(p.runDir, "metadata", snapshot)
+	return retrieveMetadataAndValidate(config.IndyBaseUrl, p.packageType, config.MetaCheckRepo, checks, metaFilesLoc, exist)
+}
+
+// f. Retrieve the metadata files which will be affected by promotion
+func (p *pipeline) validateBeforePromotion() error {
+	passed, e := p.validateMetadata("before-promote", false)
 	if !passed {
 		logger.Infof("Metadata validate failed (before). Errors: %s", e.Error())
-		panic("Metadata validate failed")
+		return fmt.Errorf("new version found in %s", e.Error())
 	}
 	fmt.Printf("Metadata validate (before) SUCCESS\n")
+	return nil
+}
 
-	//g. Promote the files in hosted repo A to hosted repo pnc-builds
-	foloTrackId := buildName
-	sourceStore, targetStore := getPromotionSrcTargetStores(packageType, buildName, promoteTargetStore, foloTrackContent)
-	resp, _, success := promotetest.DoRun(indyBaseUrl, foloTrackId, sourceStore, targetStore, newVersionNum, foloTrackContent, dryRun)
+// g. Promote the files in hosted repo A to hosted repo pnc-builds
+func (p *pipeline) promote() error {
+	if err := p.requireBuild(); err != nil {
+		return err
+	}
+	config := p.state.Config
+	foloTrackId := p.state.BuildName
+	sourceStore, targetStore := getPromotionSrcTargetStores(p.packageType, p.state.BuildName, config.PromoteTargetStore, p.foloTrackContent)
+	resp, _, success := promotetest.DoRun(config.IndyBaseUrl, foloTrackId, sourceStore, targetStore, p.newVersionNum(), p.foloTrackContent, config.DryRun)
 	if !success {
 		fmt.Printf("Promote failed, %s\n", resp)
-		panic("Promote failed")
+		return fmt.Errorf("%s", resp)
 	}
+	p.state.PromoteResult, p.state.RolledBack = resp, false
+	return nil
+}
 
-	//h. Retrieve the metadata files again, check the new version
-	fmt.Printf("Waiting 30s...\n")
-	time.Sleep(30 * time.Second) // wait for Indy event handled
-
-	metaFilesLoc = path.Join(TMP_METADATA_DIR, "after-promote")
-	passed, e = retrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, metaFiles, metaFilesLoc, newVersionNum, exists)
+// h. Retrieve the metadata files again, check the new version
+func (p *pipeline) validateAfterPromotion() error {
+	var e error
+	passed := common.WaitForPropagation("promoted version in metadata", func() bool {
+		var ok bool
+		ok, e = p.validateMetadata("after-promote", true)
+		return ok
+	}, p.wait)
 	if !passed {
 		logger.Infof("Metadata validate failed (after promotion). Errors: %s", e.Error())
-		panic("Metadata validate failed")
+		return fmt.Errorf("new version not found in %s", e.Error())
 	}
 	fmt.Printf("Metadata validate (after promotion) SUCCESS\n")
+	return nil
+}
 
-	//i. Rollback the promotion
-	fmt.Printf("Rollback:\n%s\n", resp)
-	promotetest.Rollback(indyBaseUrl, resp, dryRun)
-
-	//h. Retrieve the metadata files again, check the new version is GONE
-	fmt.Printf("Waiting 30s...\n")
-	time.Sleep(30 * time.Second)
+// i. Rollback the promotion
+func (p *pipeline) rollback() error {
+	if p.state.PromoteResult == "" {
+		return fmt.Errorf("no promotion of %s to roll back, run the %s step first", p.state.BuildName, STEP_PROMOTE)
+	}
+	fmt.Printf("Rollback:\n%s\n", p.state.PromoteResult)
+	if _, _, success := promotetest.Rollback(p.state.Config.IndyBaseUrl, p.state.PromoteResult, p.state.Config.DryRun); !success {
+		return fmt.Errorf("rollback failed")
+	}
+	p.state.RolledBack = true
+	return nil
+}
 
-	metaFilesLoc = path.Join(TMP_METADATA_DIR, "rollback")
-	passed, e = retrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo, metaFiles, metaFilesLoc, newVersionNum, !exists)
+// j. Retrieve the metadata files again, check the new version is GONE
+func (p *pipeline) validateAfterRollback() error {
+	var e error
+	passed := common.WaitForPropagation("rolled back version removed from metadata", func() bool {
+		var ok bool
+		ok, e = p.validateMetadata("rollback", false)
+		return ok
+	}, p.wait)
 	if !passed {
 		logger.Infof("Metadata validate failed (rollback). Errors: %s", e.Error())
-		panic("Metadata validate failed")
+		return fmt.Errorf("new version still found in %s", e.Error())
 	}
 	fmt.Printf("Metadata validate (rollback) SUCCESS\n")
+	return nil
+}
 
-	// Pause and keep pod for debugging
-	if keepPod {
-		fmt.Printf("Waiting 30m...\n")
-		time.Sleep(30 * time.Minute)
+// k. Delete the temp group and the hosted repo, and folo record. A promotion which is not rolled back yet is
+// rolled back first, so it does not stay in the target store.
+func (p *pipeline) cleanUp() {
+	config := p.state.Config
+	if p.state.PromoteResult != "" && !p.state.RolledBack && !config.DryRun {
+		fmt.Printf("Rollback the promotion of %s before clean up\n", p.state.BuildName)
+		if _, _, success := promotetest.Rollback(config.IndyBaseUrl, p.state.PromoteResult, false); success {
+			p.state.RolledBack = true
+		}
+	}
+	step := report.Step(REPORT_SUITE, p.title("k. Clean up"))
+	if !p.state.ReposCreated {
+		step.Skip("no repos created")
+		return
+	}
+	if config.DryRun {
+		fmt.Printf("Dry run cleanUp\n")
+		step.Skip("dry run")
+		return
 	}
+	err := cleanUp(config.IndyBaseUrl, p.packageType, p.state.BuildName)
+	step.Done(err)
+	p.state.CleanedUp = err == nil
 }
 
 func verifyFoloRecord(indyBaseUrl, buildName string, originalTrackContent common.TrackedContent) bool {
@@ -173,51 +462,26 @@ func verifyFoloRecord(indyBaseUrl, buildName string, originalTrackContent common
 		return false
 	}
 
-	uploadErrors := checkFoloEntries("Uploads", common.AlterUploadPath, buildName, trackedContent.Uploads, originalTrackContent.Uploads)
-	downloadErrors := checkFoloEntries("Downloads", nil, "", trackedContent.Downloads, originalTrackContent.Downloads)
-
-	if len(uploadErrors) > 0 || len(downloadErrors) > 0 {
+	// Only the paths and md5 of the artifacts are checked, the replay uses other stores and is not expected to
+	// download the same metadata
+	options := folodiff.Options{
+		ReleaseNumber: buildName[len(common.BUILD_TEST_):],
+		IgnoreFields:  []string{folodiff.FIELD_SHA1, folodiff.FIELD_SHA256, folodiff.FIELD_SIZE, folodiff.FIELD_STORE_KEY, folodiff.FIELD_ACCESS_CHANNEL, folodiff.FIELD_EFFECT},
+		Filter: func(path, storeKey string) bool {
+			return common.IsRegularFile(path)
+		},
+	}
+	diff := folodiff.Diff(originalTrackContent, trackedContent, options)
+	diff.Uploads.Added, diff.Downloads.Added = nil, nil // the replay may fetch more, e.g., through the shared group
+	if !diff.Empty() {
+		logger.Info("Verify folo record FAILED! Errors:")
+		diff.WriteText(os.Stdout)
 		return false
 	}
 	logger.Info("Verify folo record SUCCESS!")
 	return true
 }
 
-func checkFoloEntries(title string, alterPath func(string, string, string) string, buildName string,
-	entries, originalEntries []common.TrackedContentEntry) []string {
-
-	logger.Infof("Verify folo records - %s", title)
-	m := make(map[string]string) // key: path, value: md5
-	for _, v := range entries {
-		m[v.Path] = v.Md5
-	}
-
-	var errors []string
-	// Check original paths are in the map and the md5 matches
-	for _, v := range originalEntries {
-		p := v.Path
-		if alterPath != nil {
-			p = alterPath(v.Path, v.StoreKey, buildName[len(common.BUILD_TEST_):])
-		}
-		// Not check metadata. e.g, when downloading a metadata through a group, folo will ingore it.
-		if common.IsRegularFile(p) {
-			if m[p] == "" {
-				errors = append(errors, "[Missing] "+v.Path)
-			} else if m[p] != v.Md5 {
-				errors = append(errors, "[Md5-Error] "+v.Path)
-			}
-		}
-	}
-
-	if len(errors) > 0 {
-		logger.Info("FAILED! Errors:")
-		for _, v := range errors {
-			fmt.Println(v)
-		}
-	}
-	return errors
-}
-
 func getAdditionalRepos(datasetRepoDir, buildId string) []string {
 	fileLoc := path.Join(datasetRepoDir, buildId, dataset.ADDITIONAL_REPOS)
 	if !common.FileOrDirExists(fileLoc) {
@@ -252,20 +516,33 @@ func getPromotionSrcTargetStores(packageType, buildName, targetStoreName string,
 	return sourceStore, targetStore
 }
 
-func calculateMetadataFiles(foloTrackContent common.TrackedContent) []string {
-	paths := []string{}
+// metadataCheck is a metadata file affected by the promotion, and the version the promotion adds to it
+type metadataCheck struct {
+	Path    string
+	Version string
+}
+
+// calculateMetadataFiles gets the metadata files of the uploads, the maven-metadata.xml of the artifacts of the
+// poms, or the package metadata of the npm tarballs, with the versions of the uploads altered for the new build
+func calculateMetadataFiles(packageType string, foloTrackContent common.TrackedContent, versionNumber string) []metadataCheck {
+	checks := []metadataCheck{}
 	for _, up := range foloTrackContent.Uploads {
-		if strings.HasSuffix(up.Path, ".pom") {
+		if packageType == datest.PACKAGE_TYPE_NPM {
+			name, version, ok := common.NpmPackageOfTarball(common.AlterUploadPath(up.Path, up.StoreKey, versionNumber))
+			if ok {
+				checks = append(checks, metadataCheck{Path: common.NpmMetadataPath(name), Version: version})
+			}
+		} else if strings.HasSuffix(up.Path, ".pom") {
 			versionsDir := path.Dir(up.Path)
 			artifactDir := path.Dir(versionsDir)
 			metadataPath := path.Join(artifactDir, common.MAVEN_METADATA_XML)
-			paths = append(paths, metadataPath)
+			checks = append(checks, metadataCheck{Path: metadataPath, Version: common.REDHAT_ + versionNumber})
 		}
 	}
-	return paths
+	return checks
 }
 
-func retrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo string, metaFiles []string, filesLoc, versionNumber string, exist bool) (bool, error) {
+func retrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo string, checks []metadataCheck, filesLoc string, exist bool) (bool, error) {
 	if metaCheckRepo == "" {
 		fmt.Printf("Skip metadata check, no metaCheckRepo specified.\n")
 		return true, nil
@@ -282,45 +559,58 @@ func retrieveMetadataAndValidate(indyBaseUrl, packageType, metaCheckRepo string,
 		repoName = toks[2]
 	}
 
-	// Download meta files
-	for _, p := range metaFiles {
-		url := common.GetIndyContentUrl(indyBaseUrl, packageType, repoType, repoName, p)
-		common.DownloadFile(url, path.Join(filesLoc, p))
+	// Download meta files, the files of a previous check are removed so a failed download is not hidden by them
+	os.RemoveAll(filesLoc)
+	for _, c := range checks {
+		url := common.GetIndyContentUrl(indyBaseUrl, packageType, repoType, repoName, c.Path)
+		common.DownloadFile(url, path.Join(filesLoc, c.Path))
 	}
 
-	// Check version
+	// Check version, the npm tarballs should be served by the checked repo
+	tarballPrefix := common.GetIndyContentUrl(indyBaseUrl, packageType, repoType, repoName, "") + "/"
 	success := true
 	var e common.MultiError
-	for _, p := range metaFiles {
-		file := path.Join(filesLoc, p)
+	for _, c := range checks {
+		file := path.Join(filesLoc, c.Path)
 		// read file and see if version exist
 		if !common.FileOrDirExists(file) {
 			fmt.Printf("Check metadata FAILED, file: %s, file not exists\n", file)
 			success = false
-			e.Append(p)
+			e.Append(c.Path)
 			continue
-		} else {
-			content := string(common.ReadByteFromFile(file))
-			fmt.Printf("Check metadata, file: %s, content:\n%s\n", file, content)
-			index := strings.Index(content, common.REDHAT_+versionNumber)
-			isExist := false
-			if index >= 0 {
-				isExist = true
+		}
+		content := common.ReadByteFromFile(file)
+		fmt.Printf("Check metadata, file: %s, content:\n%s\n", file, content)
+		if packageType == datest.PACKAGE_TYPE_NPM {
+			packument, err := common.ParsePackument(content)
+			if err == nil {
+				err = packument.CheckVersion(c.Version, tarballPrefix, exist)
 			}
-			if isExist != exist {
+			if err != nil {
+				fmt.Printf("Check metadata FAILED, file: %s, %s\n", file, err)
 				success = false
-				e.Append(p)
+				e.Append(c.Path)
 			}
+			continue
+		}
+		isExist := strings.Contains(string(content), c.Version)
+		if isExist != exist {
+			success = false
+			e.Append(c.Path)
 		}
 	}
 	return success, &e
 }
 
+// cloneRepo clones the dataset repo, or uses it as is if it is a local dir, e.g., a checkout of the dataset repo
 func cloneRepo(datasetRepoUrl string) string {
+	if info, err := os.Stat(datasetRepoUrl); err == nil && info.IsDir() {
+		return datasetRepoUrl
+	}
 	return common.DownloadRepo(datasetRepoUrl)
 }
 
-func retrieveAlignmentMetadata(indyBaseUrl, datasetRepoDir, buildId string, info dataset.Info) {
+func retrieveAlignmentMetadata(indyBaseUrl, datasetRepoDir, buildId string, info dataset.Info) bool {
 	fileLoc := path.Join(datasetRepoDir, buildId, dataset.DA_JSON)
 
 	// Read jsonFile
@@ -348,7 +638,20 @@ func retrieveAlignmentMetadata(indyBaseUrl, datasetRepoDir, buildId string, info
 		}
 	}
 
-	datest.LookupMetadataByRoutines(urls, DEFAULT_ROUTINES)
+	return datest.LookupMetadataByRoutines(urls, DEFAULT_ROUTINES, packageType)
+}
+
+// loadInfo reads the info.json of a build or a group build of the dataset
+func loadInfo(infoFileLoc string) (dataset.Info, error) {
+	var info dataset.Info
+	b, err := ioutil.ReadFile(infoFileLoc)
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(b, &info); err != nil {
+		return info, fmt.Errorf("invalid %s, %s", infoFileLoc, err)
+	}
+	return info, nil
 }
 
 func getPackageType(info dataset.Info) string {
@@ -359,25 +662,13 @@ func getPackageType(info dataset.Info) string {
 	return packageType
 }
 
-func getOriginalIndyBaseUrl(localUrl string) string {
-	u, err := url.Parse(localUrl)
-	if err != nil {
-		panic(err)
-	}
-	return u.Scheme + "://" + u.Host
-}
-
-func cleanUp(indyBaseUrl, packageType, buildName string, dryRun bool) {
-	if dryRun {
-		fmt.Printf("Dry run cleanUp\n")
-		return
-	}
-
+func cleanUp(indyBaseUrl, packageType, buildName string) error {
 	buildtest.DeleteIndyTestRepos(indyBaseUrl, packageType, buildName)
 
 	if common.DeleteFoloRecord(indyBaseUrl, buildName) {
 		fmt.Printf("Delete folo record %s SUCCESS\n", buildName)
-	} else {
-		fmt.Printf("Delete folo record %s FAILED\n", buildName)
+		return nil
 	}
+	fmt.Printf("Delete folo record %s FAILED\n", buildName)
+	return fmt.Errorf("delete folo record %s failed", buildName)
 }
@@ -0,0 +1,100 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package integrationtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCalculateMetadataFiles(t *testing.T) {
+	Convey("Metadata files affected by the promotion", t, func() {
+		Convey("Maven metadata of the poms", func() {
+			record := common.TrackedContent{Uploads: []common.TrackedContentEntry{
+				{StoreKey: "maven:hosted:build-1", Path: "/org/foo/foo/1.0.0.redhat-00001/foo-1.0.0.redhat-00001.pom"},
+				{StoreKey: "maven:hosted:build-1", Path: "/org/foo/foo/1.0.0.redhat-00001/foo-1.0.0.redhat-00001.jar"},
+			}}
+			So(calculateMetadataFiles("maven", record, "91234"), ShouldResemble,
+				[]metadataCheck{{Path: "/org/foo/foo/maven-metadata.xml", Version: "redhat-91234"}})
+		})
+		Convey("Npm package metadata of the tarballs", func() {
+			record := common.TrackedContent{Uploads: []common.TrackedContentEntry{
+				{StoreKey: "npm:hosted:build-1", Path: "/@redhat/opossum/-/opossum-6.2.1.tgz"},
+				{StoreKey: "npm:hosted:build-1", Path: "/@redhat/opossum"},
+				{StoreKey: "npm:hosted:build-1", Path: "/left-pad/-/left-pad-1.3.0-2.tgz"},
+			}}
+			So(calculateMetadataFiles("npm", record, "91234"), ShouldResemble, []metadataCheck{
+				{Path: "@redhat%2fopossum", Version: "6.2.1-91234"},
+				{Path: "left-pad", Version: "1.3.0-91234"},
+			})
+		})
+	})
+}
+
+func TestRetrieveNpmMetadataAndValidate(t *testing.T) {
+	Convey("Npm metadata validation", t, func() {
+		var server *httptest.Server
+		promoted := false
+		tarballGroup := "builds"
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.EscapedPath() != "/api/content/npm/group/builds/@redhat%2fopossum" {
+				http.NotFound(w, r)
+				return
+			}
+			tarball := server.URL + "/api/content/npm/group/" + tarballGroup + "/@redhat/opossum/-/opossum-"
+			versions := fmt.Sprintf(`"6.2.1": {"dist": {"tarball": "%s6.2.1.tgz"}}`, tarball)
+			latest := "6.2.1"
+			if promoted {
+				versions += fmt.Sprintf(`, "6.2.1-91234": {"dist": {"tarball": "%s6.2.1-91234.tgz"}}`, tarball)
+				latest = "6.2.1-91234"
+			}
+			fmt.Fprintf(w, `{"name": "@redhat/opossum", "dist-tags": {"latest": "%s"}, "versions": {%s}}`, latest, versions)
+		}))
+		defer server.Close()
+		dir, err := ioutil.TempDir("", "metadata")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		checks := []metadataCheck{{Path: "@redhat%2fopossum", Version: "6.2.1-91234"}}
+		validate := func(exist bool) bool {
+			ok, _ := retrieveMetadataAndValidate(server.URL, "npm", "builds", checks, dir, exist)
+			return ok
+		}
+
+		So(validate(false), ShouldBeTrue)
+		So(validate(true), ShouldBeFalse)
+		promoted = true
+		So(validate(true), ShouldBeTrue)
+		So(validate(false), ShouldBeFalse)
+
+		Convey("The tarballs should point at the checked group", func() {
+			tarballGroup = "DA"
+			So(validate(true), ShouldBeFalse)
+		})
+		Convey("A missing package metadata should fail", func() {
+			ok, e := retrieveMetadataAndValidate(server.URL, "npm", "builds", []metadataCheck{{Path: "left-pad", Version: "1.0.0"}}, dir, false)
+			So(ok, ShouldBeFalse)
+			So(e.Error(), ShouldEqual, "left-pad")
+		})
+	})
+}
@@ -0,0 +1,174 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Package perfcompare compares the request metrics of a run (see common.MetricsSnapshot) with a baseline, e.g.,
+// the run of the previous indy release, and tells if the latency or the error rate regressed.
+package perfcompare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+// Thresholds decide when a request class regressed
+type Thresholds struct {
+	// MaxP95Increase is the allowed relative increase of the p95 latency, e.g., 0.2 for 20%
+	MaxP95Increase float64
+	// MinP95DeltaMs ignores a p95 increase smaller than this, so sub-millisecond noise is not a regression
+	MinP95DeltaMs float64
+	// MaxErrorRateIncrease is the allowed absolute increase of the error rate, e.g., 0.01 for 1 percentage point
+	MaxErrorRateIncrease float64
+	// MinCount skips the classes with fewer requests in the baseline or the current run, their percentiles
+	// are not meaningful
+	MinCount int
+}
+
+// DefaultThresholds allow 20% p95 increase (at least 10ms) and 1 percentage point error rate increase
+func DefaultThresholds() Thresholds {
+	return Thresholds{MaxP95Increase: 0.2, MinP95DeltaMs: 10, MaxErrorRateIncrease: 0.01, MinCount: 10}
+}
+
+// ClassComparison is the comparison of one request class
+type ClassComparison struct {
+	Class             string  `json:"class"`
+	BaselineCount     int     `json:"baselineCount"`
+	CurrentCount      int     `json:"currentCount"`
+	BaselineP95Ms     float64 `json:"baselineP95Ms"`
+	CurrentP95Ms      float64 `json:"currentP95Ms"`
+	BaselineErrorRate float64 `json:"baselineErrorRate"`
+	CurrentErrorRate  float64 `json:"currentErrorRate"`
+	// Skipped is set when the class has too few requests to compare
+	Skipped     bool     `json:"skipped,omitempty"`
+	Regressions []string `json:"regressions,omitempty"`
+}
+
+// Result is the comparison of all request classes
+type Result struct {
+	Baseline string            `json:"baseline"`
+	Current  string            `json:"current"`
+	Classes  []ClassComparison `json:"classes"`
+	// Missing are the classes of the baseline which are not in the current run, and Added the other way around
+	Missing []string `json:"missing"`
+	Added   []string `json:"added"`
+}
+
+// Regressed is true if any class regressed
+func (r *Result) Regressed() bool {
+	for _, c := range r.Classes {
+		if len(c.Regressions) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare compares the classes of the current run with the same classes of the baseline
+func Compare(baseline, current common.MetricsSnapshot, thresholds Thresholds) *Result {
+	result := &Result{Baseline: baseline.Command, Current: current.Command, Classes: []ClassComparison{}, Missing: []string{}, Added: []string{}}
+	baselineByKey := make(map[string]common.ClassMetrics)
+	for _, c := range baseline.Classes {
+		baselineByKey[c.Key()] = c
+	}
+	matched := make(map[string]bool)
+	for _, cur := range current.Classes {
+		key := cur.Key()
+		base, ok := baselineByKey[key]
+		if !ok {
+			result.Added = append(result.Added, key)
+			continue
+		}
+		matched[key] = true
+		result.Classes = append(result.Classes, compareClass(key, base, cur, thresholds))
+	}
+	for key := range baselineByKey {
+		if !matched[key] {
+			result.Missing = append(result.Missing, key)
+		}
+	}
+	sort.Slice(result.Classes, func(i, j int) bool { return result.Classes[i].Class < result.Classes[j].Class })
+	sort.Strings(result.Missing)
+	sort.Strings(result.Added)
+	return result
+}
+
+func compareClass(key string, base, cur common.ClassMetrics, thresholds Thresholds) ClassComparison {
+	c := ClassComparison{
+		Class:         key,
+		BaselineCount: base.Count, CurrentCount: cur.Count,
+		BaselineP95Ms: base.P95Ms, CurrentP95Ms: cur.P95Ms,
+		BaselineErrorRate: base.ErrorRate, CurrentErrorRate: cur.ErrorRate,
+	}
+	if base.Count < thresholds.MinCount || cur.Count < thresholds.MinCount {
+		c.Skipped = true
+		return c
+	}
+	delta := cur.P95Ms - base.P95Ms
+	if delta > thresholds.MinP95DeltaMs && delta > base.P95Ms*thresholds.MaxP95Increase {
+		c.Regressions = append(c.Regressions, fmt.Sprintf("p95 %.1fms => %.1fms (+%.0f%%, allowed +%.0f%%)",
+			base.P95Ms, cur.P95Ms, percentIncrease(base.P95Ms, cur.P95Ms), thresholds.MaxP95Increase*100))
+	}
+	if cur.ErrorRate-base.ErrorRate > thresholds.MaxErrorRateIncrease {
+		c.Regressions = append(c.Regressions, fmt.Sprintf("error rate %.2f%% => %.2f%% (allowed +%.2f points)",
+			base.ErrorRate*100, cur.ErrorRate*100, thresholds.MaxErrorRateIncrease*100))
+	}
+	return c
+}
+
+func percentIncrease(base, cur float64) float64 {
+	if base <= 0 {
+		return 100
+	}
+	return (cur - base) / base * 100
+}
+
+// WriteText writes the comparison for people to read
+func (r *Result) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Performance comparison, baseline: %s, current: %s\n", r.Baseline, r.Current)
+	regressed := 0
+	for _, c := range r.Classes {
+		switch {
+		case c.Skipped:
+			fmt.Fprintf(w, "  [Skipped] %s, too few requests (%d => %d)\n", c.Class, c.BaselineCount, c.CurrentCount)
+		case len(c.Regressions) > 0:
+			regressed++
+			fmt.Fprintf(w, "  [Regressed] %s\n", c.Class)
+			for _, msg := range c.Regressions {
+				fmt.Fprintf(w, "      %s\n", msg)
+			}
+		default:
+			fmt.Fprintf(w, "  [OK] %s, p95 %.1fms => %.1fms, error rate %.2f%% => %.2f%%\n", c.Class,
+				c.BaselineP95Ms, c.CurrentP95Ms, c.BaselineErrorRate*100, c.CurrentErrorRate*100)
+		}
+	}
+	for _, key := range r.Missing {
+		fmt.Fprintf(w, "  [Missing] %s\n", key)
+	}
+	for _, key := range r.Added {
+		fmt.Fprintf(w, "  [Added] %s\n", key)
+	}
+	fmt.Fprintf(w, "%d of %d classes regressed\n", regressed, len(r.Classes))
+}
+
+// WriteJSON writes the comparison for pipelines
+func (r *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
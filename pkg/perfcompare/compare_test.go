@@ -0,0 +1,132 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package perfcompare
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func class(phase, pathClass string, count int, p95Ms, errorRate float64) common.ClassMetrics {
+	return common.ClassMetrics{Phase: phase, Method: common.MethodGet, StoreType: common.STORE_TYPE_GROUP, PathClass: pathClass,
+		Count: count, P95Ms: p95Ms, ErrorRate: errorRate}
+}
+
+func TestCompare(t *testing.T) {
+	Convey("Compare", t, func() {
+		baseline := common.MetricsSnapshot{Command: "build", Classes: []common.ClassMetrics{
+			class("downloads", common.PATH_CLASS_POM, 100, 50, 0),
+			class("downloads", common.PATH_CLASS_ARTIFACT, 100, 200, 0),
+			class("downloads", common.PATH_CLASS_MAVEN_METADATA, 100, 5, 0),
+			class("downloads", common.PATH_CLASS_CHECKSUM, 3, 10, 0),
+			class("uploads", common.PATH_CLASS_POM, 100, 50, 0),
+		}}
+		current := common.MetricsSnapshot{Command: "build", Classes: []common.ClassMetrics{
+			class("downloads", common.PATH_CLASS_POM, 100, 80, 0),           // +60%
+			class("downloads", common.PATH_CLASS_ARTIFACT, 100, 220, 0.05),  // +10%, errors +5 points
+			class("downloads", common.PATH_CLASS_MAVEN_METADATA, 100, 9, 0), // +80% but only 4ms
+			class("downloads", common.PATH_CLASS_CHECKSUM, 3, 100, 0),       // too few
+			class("downloads", common.PATH_CLASS_NPM_METADATA, 100, 10, 0),
+		}}
+		result := Compare(baseline, current, DefaultThresholds())
+		So(result.Regressed(), ShouldBeTrue)
+		So(len(result.Classes), ShouldEqual, 4)
+		byClass := map[string]ClassComparison{}
+		for _, c := range result.Classes {
+			byClass[c.Class] = c
+		}
+		So(len(byClass["downloads: GET group pom"].Regressions), ShouldEqual, 1)
+		So(byClass["downloads: GET group pom"].Regressions[0], ShouldContainSubstring, "p95 50.0ms => 80.0ms")
+		So(byClass["downloads: GET group artifact"].Regressions, ShouldResemble, []string{"error rate 0.00% => 5.00% (allowed +1.00 points)"})
+		So(byClass["downloads: GET group maven-metadata"].Regressions, ShouldBeEmpty)
+		So(byClass["downloads: GET group checksum"].Skipped, ShouldBeTrue)
+		So(result.Missing, ShouldResemble, []string{"uploads: GET group pom"})
+		So(result.Added, ShouldResemble, []string{"downloads: GET group npm-metadata"})
+
+		var text bytes.Buffer
+		result.WriteText(&text)
+		So(text.String(), ShouldContainSubstring, "[Regressed] downloads: GET group pom")
+		So(text.String(), ShouldContainSubstring, "2 of 4 classes regressed")
+
+		Convey("Looser thresholds should pass", func() {
+			options := GateOptions{MaxP95IncreasePercent: 100, MaxErrorRateIncreasePercent: 10}
+			So(Compare(baseline, current, options.Thresholds()).Regressed(), ShouldBeFalse)
+		})
+	})
+}
+
+func TestMetricsSnapshot(t *testing.T) {
+	Convey("Snapshot should be written and loaded in the stable schema", t, func() {
+		m := common.NewMetricsCollector()
+		m.Record(common.RequestSample{Phase: "metadata", Method: common.MethodGet, StoreType: common.STORE_TYPE_GROUP,
+			PathClass: common.PATH_CLASS_MAVEN_METADATA, StatusCode: 200, Start: time.Now(), Latency: 20 * time.Millisecond})
+		file := filepath.Join(t.TempDir(), "metrics.json")
+		So(common.WriteMetricsSnapshot(m.Snapshot("datest"), file), ShouldBeNil)
+
+		loaded, err := common.LoadMetricsSnapshot(file)
+		So(err, ShouldBeNil)
+		So(loaded.SchemaVersion, ShouldEqual, common.METRICS_SCHEMA_VERSION)
+		So(loaded.Command, ShouldEqual, "datest")
+		So(len(loaded.Classes), ShouldEqual, 2)
+		So(loaded.Classes[0].Key(), ShouldEqual, "metadata: GET group maven-metadata")
+		So(loaded.Classes[0].P95Ms, ShouldEqual, 20)
+		So(Compare(loaded, loaded, DefaultThresholds()).Regressed(), ShouldBeFalse)
+	})
+}
+
+func TestLoadBaseline(t *testing.T) {
+	Convey("LoadBaseline", t, func() {
+		dir := t.TempDir()
+
+		Convey("Should do nothing without a baseline", func() {
+			options := GateOptions{}
+			So(options.LoadBaseline(), ShouldBeNil)
+			So(options.baseline, ShouldBeNil)
+		})
+
+		Convey("Should fail on a missing file", func() {
+			options := GateOptions{Baseline: filepath.Join(dir, "missing.json")}
+			So(options.LoadBaseline(), ShouldNotBeNil)
+		})
+
+		Convey("Should fail on a baseline without classes", func() {
+			file := filepath.Join(dir, "empty.json")
+			So(common.WriteMetricsSnapshot(common.NewMetricsCollector().Snapshot("build"), file), ShouldBeNil)
+			options := GateOptions{Baseline: file}
+			err := options.LoadBaseline()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no request classes")
+		})
+
+		Convey("Should keep the loaded baseline for the gate", func() {
+			m := common.NewMetricsCollector()
+			m.Record(common.RequestSample{Phase: "downloads", Method: common.MethodGet, StoreType: common.STORE_TYPE_GROUP,
+				PathClass: common.PATH_CLASS_POM, StatusCode: 200, Start: time.Now(), Latency: 10 * time.Millisecond})
+			file := filepath.Join(dir, "baseline.json")
+			So(common.WriteMetricsSnapshot(m.Snapshot("build"), file), ShouldBeNil)
+			options := GateOptions{Baseline: file}
+			So(options.LoadBaseline(), ShouldBeNil)
+			So(options.baseline, ShouldNotBeNil)
+			So(options.baseline.Command, ShouldEqual, "build")
+		})
+	})
+}
@@ -0,0 +1,149 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package perfcompare
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
+	"github.com/spf13/pflag"
+)
+
+const (
+	FORMAT_TEXT  = "text"
+	FORMAT_JSON  = "json"
+	REPORT_SUITE = "perf-compare"
+)
+
+// GateOptions are the flags of the regression gate of a command, see Gate
+type GateOptions struct {
+	// Baseline is the metrics json of the baseline run, the gate is disabled if it is empty
+	Baseline                    string
+	MaxP95IncreasePercent       float64
+	MaxErrorRateIncreasePercent float64
+
+	baseline *common.MetricsSnapshot
+}
+
+// Thresholds converts the percents of the flags
+func (o GateOptions) Thresholds() Thresholds {
+	thresholds := DefaultThresholds()
+	thresholds.MaxP95Increase = o.MaxP95IncreasePercent / 100
+	thresholds.MaxErrorRateIncrease = o.MaxErrorRateIncreasePercent / 100
+	return thresholds
+}
+
+// AddThresholdFlags adds the flags of the thresholds
+func AddThresholdFlags(flags *pflag.FlagSet, options *GateOptions) {
+	defaults := DefaultThresholds()
+	flags.Float64Var(&options.MaxP95IncreasePercent, "maxP95Increase", defaults.MaxP95Increase*100, "Allowed increase of the p95 latency of a request class in percent.")
+	flags.Float64Var(&options.MaxErrorRateIncreasePercent, "maxErrorRateIncrease", defaults.MaxErrorRateIncrease*100, "Allowed increase of the error rate of a request class in percentage points.")
+}
+
+// AddGateFlags adds --baseline and the flags of the thresholds
+func AddGateFlags(flags *pflag.FlagSet, options *GateOptions) {
+	flags.StringVar(&options.Baseline, "baseline", "", "The metrics json of a baseline run (see --metricsFile). The run fails if the p95 latency or the error rate regress beyond the thresholds.")
+	AddThresholdFlags(flags, options)
+}
+
+// LoadBaseline loads and validates the baseline of the options, so Gate compares with it when the command
+// finished. It does nothing if no baseline is given.
+func (o *GateOptions) LoadBaseline() error {
+	if o.Baseline == "" {
+		return nil
+	}
+	baseline, err := common.LoadMetricsSnapshot(o.Baseline)
+	if err != nil {
+		return err
+	}
+	if len(baseline.Classes) == 0 {
+		return fmt.Errorf("no request classes in the baseline %s", o.Baseline)
+	}
+	o.baseline = &baseline
+	return nil
+}
+
+// PrepareGate loads the baseline of the options and exits with 1 if it is not valid. It should be called in
+// the PreRun of the command, so a bad --baseline fails before the work starts.
+func PrepareGate(options *GateOptions) {
+	if err := options.LoadBaseline(); err != nil {
+		fmt.Printf("Error: cannot load the baseline, %s\n", err)
+		report.Exit(1)
+	}
+}
+
+// Run compares the metrics files and prints the comparison in the format. It exits with 1 if any class regressed.
+func Run(baselineFile, currentFile string, thresholds Thresholds, format string) {
+	baseline, err := common.LoadMetricsSnapshot(baselineFile)
+	if err != nil {
+		fmt.Printf("Error: cannot load the baseline, %s\n", err)
+		report.Exit(1)
+	}
+	current, err := common.LoadMetricsSnapshot(currentFile)
+	if err != nil {
+		fmt.Printf("Error: cannot load the current metrics, %s\n", err)
+		report.Exit(1)
+	}
+	result := Compare(baseline, current, thresholds)
+	if format == FORMAT_JSON {
+		result.WriteJSON(os.Stdout)
+	} else {
+		result.WriteText(os.Stdout)
+	}
+	reportResult(result)
+	if result.Regressed() {
+		report.Exit(1)
+	}
+}
+
+// Gate compares the metrics of this run with the baseline of the options, and exits with 1 if any class
+// regressed. It does nothing if no baseline is given. It should be called when the command finished its work,
+// and the baseline is loaded here if PrepareGate was not called before.
+func Gate(options GateOptions, command string) {
+	if options.Baseline == "" {
+		return
+	}
+	if options.baseline == nil {
+		PrepareGate(&options)
+	}
+	result := Compare(*options.baseline, common.DefaultMetrics().Snapshot(command), options.Thresholds())
+	result.WriteText(os.Stdout)
+	reportResult(result)
+	if result.Regressed() {
+		fmt.Printf("Performance regressed against the baseline %s\n", options.Baseline)
+		report.Exit(1)
+	}
+}
+
+func reportResult(result *Result) {
+	suite := report.GetSuite(REPORT_SUITE)
+	for _, c := range result.Classes {
+		rc := suite.Start(c.Class)
+		rc.Set("baselineP95Ms", fmt.Sprintf("%.3f", c.BaselineP95Ms)).Set("currentP95Ms", fmt.Sprintf("%.3f", c.CurrentP95Ms))
+		rc.Set("baselineErrorRate", fmt.Sprintf("%.4f", c.BaselineErrorRate)).Set("currentErrorRate", fmt.Sprintf("%.4f", c.CurrentErrorRate))
+		switch {
+		case c.Skipped:
+			rc.Skip("too few requests")
+		case len(c.Regressions) > 0:
+			rc.Fail("%s", c.Regressions)
+		default:
+			rc.Pass()
+		}
+	}
+}
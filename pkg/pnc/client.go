@@ -0,0 +1,320 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pnc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+)
+
+const (
+	API_PATH          = "/pnc-rest/v2"
+	DEFAULT_PAGE_SIZE = 50
+	// RSQL_TIME is the time format in the RSQL queries of PNC
+	RSQL_TIME = "2006-01-02T15:04:05Z"
+)
+
+// ErrNotFound is wrapped by the Error of a 404 response
+var ErrNotFound = errors.New("not found")
+
+// Error is returned by all the requests of the client
+type Error struct {
+	Op         string
+	URL        string
+	StatusCode int
+	Message    string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("pnc %s %s failed", e.Op, e.URL)
+	if e.StatusCode > 0 {
+		msg += fmt.Sprintf(", status: %d", e.StatusCode)
+	}
+	if e.Message != "" {
+		msg += ", " + e.Message
+	}
+	if e.Err != nil {
+		msg += ", " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ListOptions are the options of the paginated listing. All the pages are fetched, until Limit items if it is set.
+type ListOptions struct {
+	PageSize int
+	// Query is the RSQL filter, e.g., "temporaryBuild==false", see EndTimeBetween
+	Query string
+	// Sort is the RSQL sort, e.g., "=desc=endTime"
+	Sort  string
+	Limit int
+}
+
+// EndTimeBetween is the RSQL query of the builds ended in [from, to), e.g., for ListBuilds. A zero time is open.
+func EndTimeBetween(from, to time.Time) string {
+	var q []string
+	if !from.IsZero() {
+		q = append(q, "endTime=ge="+from.UTC().Format(RSQL_TIME))
+	}
+	if !to.IsZero() {
+		q = append(q, "endTime=lt="+to.UTC().Format(RSQL_TIME))
+	}
+	return strings.Join(q, ";")
+}
+
+// And joins the RSQL queries by 'and', ignoring the empty ones
+func And(queries ...string) string {
+	var q []string
+	for _, query := range queries {
+		if query != "" {
+			q = append(q, query)
+		}
+	}
+	return strings.Join(q, ";")
+}
+
+// page is a page of a listing, the content is decoded by the caller
+type page struct {
+	PageIndex  int             `json:"pageIndex"`
+	PageSize   int             `json:"pageSize"`
+	TotalPages int             `json:"totalPages"`
+	TotalHits  int             `json:"totalHits"`
+	Content    json.RawMessage `json:"content"`
+}
+
+// Client reads the builds through the PNC REST api v2
+type Client struct {
+	PncURL string
+	// Authenticate is applied to the requests, e.g., KeycloakAuthenticator. nil means no authentication.
+	Authenticate common.Authenticate
+	// Client sends the requests, DefaultIndyClient is used if it is nil
+	Client *common.IndyClient
+}
+
+// NewClient creates a PNC client for the base url, e.g., https://orch.xyz.com
+func NewClient(pncURL string, auth common.Authenticate) *Client {
+	return &Client{PncURL: common.NormIndyURL(pncURL), Authenticate: auth}
+}
+
+func (c *Client) url(format string, a ...interface{}) string {
+	return c.PncURL + API_PATH + fmt.Sprintf(format, a...)
+}
+
+// GetBuild gets the build of the id
+func (c *Client) GetBuild(id string) (Build, error) {
+	build := Build{}
+	err := c.getJSON("get build", c.url("/builds/%s", url.PathEscape(id)), &build)
+	return build, err
+}
+
+// GetGroupBuild gets the group build of the id
+func (c *Client) GetGroupBuild(id string) (GroupBuild, error) {
+	groupBuild := GroupBuild{}
+	err := c.getJSON("get group build", c.url("/group-builds/%s", url.PathEscape(id)), &groupBuild)
+	return groupBuild, err
+}
+
+// GetDependencyGraph gets the dependency graph of the builds of the group build
+func (c *Client) GetDependencyGraph(groupBuildId string) (Graph, error) {
+	graph := Graph{}
+	err := c.getJSON("get dependency graph", c.url("/group-builds/%s/dependency-graph", url.PathEscape(groupBuildId)), &graph)
+	return graph, err
+}
+
+// GetAlignLog gets the alignment log of the build as text
+func (c *Client) GetAlignLog(buildId string) (string, error) {
+	b, err := c.get("get align log", c.url("/builds/%s/logs/align", url.PathEscape(buildId)), "text/plain")
+	return string(b), err
+}
+
+// CountBuiltArtifacts gets the number of the artifacts built by the build, by the total hits of the first page
+func (c *Client) CountBuiltArtifacts(buildId string) (int, error) {
+	p := page{}
+	err := c.getJSON("count artifacts", c.url("/builds/%s/artifacts/built?pageIndex=0&pageSize=1", url.PathEscape(buildId)), &p)
+	return p.TotalHits, err
+}
+
+// GetRaw gets the json of an api path as it is, e.g., "/builds/97241" to keep the response in a file
+func (c *Client) GetRaw(apiPath string) ([]byte, error) {
+	return c.get("get", c.PncURL+API_PATH+apiPath, common.ContentTypeJSON)
+}
+
+// ListBuilds lists the builds, filtered by the query of the options, e.g., EndTimeBetween
+func (c *Client) ListBuilds(options ListOptions) ([]Build, error) {
+	return c.listBuilds("list builds", c.url("/builds"), options)
+}
+
+// ListGroupBuildBuilds lists the builds of the group build
+func (c *Client) ListGroupBuildBuilds(groupBuildId string, options ListOptions) ([]Build, error) {
+	return c.listBuilds("list builds", c.url("/group-builds/%s/builds", url.PathEscape(groupBuildId)), options)
+}
+
+// ListMilestoneBuilds lists the builds attached to the product milestone
+func (c *Client) ListMilestoneBuilds(milestoneId string, options ListOptions) ([]Build, error) {
+	return c.listBuilds("list builds", c.url("/product-milestones/%s/builds", url.PathEscape(milestoneId)), options)
+}
+
+// ListGroupConfigGroupBuilds lists the group builds of the group config
+func (c *Client) ListGroupConfigGroupBuilds(groupConfigId string, options ListOptions) ([]GroupBuild, error) {
+	var groupBuilds []GroupBuild
+	err := c.list("list group builds", c.url("/group-configs/%s/group-builds", url.PathEscape(groupConfigId)), options,
+		func(content json.RawMessage) (int, error) {
+			var items []GroupBuild
+			err := json.Unmarshal(content, &items)
+			groupBuilds = append(groupBuilds, items...)
+			return len(groupBuilds), err
+		})
+	if options.Limit > 0 && len(groupBuilds) > options.Limit {
+		groupBuilds = groupBuilds[:options.Limit]
+	}
+	return groupBuilds, err
+}
+
+// ListGroupConfigBuilds lists the builds of all the group builds of the group config, filtered by the query
+// of the options
+func (c *Client) ListGroupConfigBuilds(groupConfigId string, options ListOptions) ([]Build, error) {
+	groupBuilds, err := c.ListGroupConfigGroupBuilds(groupConfigId, ListOptions{PageSize: options.PageSize})
+	if err != nil {
+		return nil, err
+	}
+	var builds []Build
+	for _, groupBuild := range groupBuilds {
+		limit := 0
+		if options.Limit > 0 {
+			if limit = options.Limit - len(builds); limit <= 0 {
+				break
+			}
+		}
+		items, err := c.ListGroupBuildBuilds(groupBuild.Id, ListOptions{PageSize: options.PageSize, Query: options.Query, Sort: options.Sort, Limit: limit})
+		if err != nil {
+			return builds, err
+		}
+		builds = append(builds, items...)
+	}
+	return builds, nil
+}
+
+func (c *Client) listBuilds(op, URL string, options ListOptions) ([]Build, error) {
+	var builds []Build
+	err := c.list(op, URL, options, func(content json.RawMessage) (int, error) {
+		var items []Build
+		err := json.Unmarshal(content, &items)
+		builds = append(builds, items...)
+		return len(builds), err
+	})
+	if options.Limit > 0 && len(builds) > options.Limit {
+		builds = builds[:options.Limit]
+	}
+	return builds, err
+}
+
+// list gets the pages one by one until the last page, or the limit of the options. The add function decodes
+// the content of a page and returns the number of the items got so far.
+func (c *Client) list(op, URL string, options ListOptions, add func(content json.RawMessage) (int, error)) error {
+	pageSize := options.PageSize
+	if pageSize <= 0 {
+		pageSize = DEFAULT_PAGE_SIZE
+	}
+	for index := 0; ; index++ {
+		query := url.Values{}
+		query.Set("pageIndex", strconv.Itoa(index))
+		query.Set("pageSize", strconv.Itoa(pageSize))
+		if options.Query != "" {
+			query.Set("q", options.Query)
+		}
+		if options.Sort != "" {
+			query.Set("sort", options.Sort)
+		}
+		p := page{}
+		pageURL := URL + "?" + query.Encode()
+		if err := c.getJSON(op, pageURL, &p); err != nil {
+			return err
+		}
+		if len(p.Content) == 0 {
+			return nil
+		}
+		got, err := add(p.Content)
+		if err != nil {
+			return &Error{Op: op, URL: pageURL, Err: fmt.Errorf("invalid content, %s", err)}
+		}
+		if index+1 >= p.TotalPages || (options.Limit > 0 && got >= options.Limit) {
+			return nil
+		}
+	}
+}
+
+func (c *Client) getJSON(op, URL string, out interface{}) error {
+	b, err := c.get(op, URL, common.ContentTypeJSON)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return &Error{Op: op, URL: URL, Err: fmt.Errorf("invalid json response, %s", err)}
+	}
+	return nil
+}
+
+func (c *Client) get(op, URL, accept string) ([]byte, error) {
+	req, err := http.NewRequest(common.MethodGet, URL, nil)
+	if err != nil {
+		return nil, &Error{Op: op, URL: URL, Err: err}
+	}
+	req.Header.Set("Accept", accept)
+	if c.Authenticate != nil {
+		if err := c.Authenticate(req); err != nil {
+			return nil, &Error{Op: op, URL: URL, Err: fmt.Errorf("auth failed, %s", err)}
+		}
+	}
+	client := c.Client
+	if client == nil {
+		client = common.DefaultIndyClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &Error{Op: op, URL: URL, Err: err}
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+	b, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		e := &Error{Op: op, URL: URL, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+		if resp.StatusCode == common.StatusNotFound {
+			e.Err = ErrNotFound
+		}
+		return nil, e
+	}
+	if err != nil {
+		return nil, &Error{Op: op, URL: URL, Err: err}
+	}
+	return b, nil
+}
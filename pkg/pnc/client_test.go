@@ -0,0 +1,153 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pnc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// pages serves the builds b1..bn in pages, recording the queries
+func pages(n int, queries *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*queries = append(*queries, r.URL.RawQuery)
+		index, _ := strconv.Atoi(r.URL.Query().Get("pageIndex"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+		var content []string
+		for i := index * size; i < n && i < (index+1)*size; i++ {
+			content = append(content, fmt.Sprintf(`{"id": "b%d", "status": "SUCCESS"}`, i+1))
+		}
+		fmt.Fprintf(w, `{"pageIndex": %d, "pageSize": %d, "totalPages": %d, "totalHits": %d, "content": [%s]}`,
+			index, size, (n+size-1)/size, n, strings.Join(content, ","))
+	}
+}
+
+func TestClient(t *testing.T) {
+	Convey("Client", t, func() {
+		var queries []string
+		var authorization string
+		mux := http.NewServeMux()
+		mux.HandleFunc(API_PATH+"/builds/97241", func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			fmt.Fprint(w, `{"id": "97241", "status": "SUCCESS", "temporaryBuild": true, "endTime": "2021-05-27T09:11:40.567Z",
+				"buildConfigRevision": {"id": "1", "rev": 3, "name": "foo", "buildType": "NPM"}, "unknown": 1}`)
+		})
+		mux.HandleFunc(API_PATH+"/builds/97241/logs/align", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "align log")
+		})
+		mux.HandleFunc(API_PATH+"/group-builds/2836/dependency-graph", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"vertices": {"a": {"name": "a", "data": {"id": "a", "buildConfigRevision": {"buildType": "MVN"}}}, "b": {"name": "b"}},
+				"edges": [{"source": "a", "target": "b", "cost": 1}]}`)
+		})
+		mux.HandleFunc(API_PATH+"/builds", pages(5, &queries))
+		mux.HandleFunc(API_PATH+"/product-milestones/9/builds", pages(3, &queries))
+		mux.HandleFunc(API_PATH+"/group-configs/7/group-builds", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"pageIndex": 0, "pageSize": 50, "totalPages": 1, "totalHits": 2, "content": [{"id": "g1"}, {"id": "g2"}]}`)
+		})
+		mux.HandleFunc(API_PATH+"/group-builds/g1/builds", pages(2, &queries))
+		mux.HandleFunc(API_PATH+"/group-builds/g2/builds", pages(3, &queries))
+		mux.HandleFunc(API_PATH+"/builds/broken", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"id": `)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		client := NewClient(server.URL+"/", nil)
+
+		Convey("Builds are typed", func() {
+			build, err := client.GetBuild("97241")
+			So(err, ShouldBeNil)
+			So(build.TemporaryBuild, ShouldBeTrue)
+			So(build.BuildType(), ShouldEqual, BUILD_TYPE_NPM)
+			So(build.BuildConfigRevision.Rev, ShouldEqual, 3)
+			So(build.Succeeded(), ShouldBeTrue)
+			So(build.EndTime.Equal(time.Date(2021, 5, 27, 9, 11, 40, 567000000, time.UTC)), ShouldBeTrue)
+			So(authorization, ShouldBeEmpty)
+
+			log, err := client.GetAlignLog("97241")
+			So(err, ShouldBeNil)
+			So(log, ShouldEqual, "align log")
+
+			graph, err := client.GetDependencyGraph("2836")
+			So(err, ShouldBeNil)
+			So(graph.Vertices["a"].Data.BuildType(), ShouldEqual, BUILD_TYPE_MVN)
+			So(graph.Edges, ShouldResemble, []Edge{{Source: "a", Target: "b", Cost: 1}})
+		})
+		Convey("The requests are authenticated", func() {
+			client.Authenticate = func(r *http.Request) error {
+				r.Header.Set("Authorization", "Bearer token")
+				return nil
+			}
+			_, err := client.GetBuild("97241")
+			So(err, ShouldBeNil)
+			So(authorization, ShouldEqual, "Bearer token")
+
+			client.Authenticate = func(r *http.Request) error { return errors.New("no token") }
+			_, err = client.GetBuild("97241")
+			So(err.Error(), ShouldContainSubstring, "auth failed, no token")
+		})
+		Convey("Errors are returned", func() {
+			_, err := client.GetGroupBuild("404")
+			So(errors.Is(err, ErrNotFound), ShouldBeTrue)
+			var pncErr *Error
+			So(errors.As(err, &pncErr), ShouldBeTrue)
+			So(pncErr.StatusCode, ShouldEqual, http.StatusNotFound)
+
+			_, err = client.GetBuild("broken")
+			So(err.Error(), ShouldContainSubstring, "invalid json response")
+		})
+		Convey("All pages are listed", func() {
+			builds, err := client.ListBuilds(ListOptions{PageSize: 2, Query: "temporaryBuild==false", Sort: "=desc=endTime"})
+			So(err, ShouldBeNil)
+			So(len(builds), ShouldEqual, 5)
+			So(builds[4].Id, ShouldEqual, "b5")
+			So(len(queries), ShouldEqual, 3)
+			So(queries[2], ShouldEqual, "pageIndex=2&pageSize=2&q=temporaryBuild%3D%3Dfalse&sort=%3Ddesc%3DendTime")
+		})
+		Convey("Listing stops at the limit", func() {
+			builds, err := client.ListMilestoneBuilds("9", ListOptions{PageSize: 2, Limit: 1})
+			So(err, ShouldBeNil)
+			So(len(builds), ShouldEqual, 1)
+			So(len(queries), ShouldEqual, 1)
+		})
+		Convey("Builds of a group config are the builds of its group builds", func() {
+			builds, err := client.ListGroupConfigBuilds("7", ListOptions{})
+			So(err, ShouldBeNil)
+			So(len(builds), ShouldEqual, 5)
+			builds, err = client.ListGroupConfigBuilds("7", ListOptions{Limit: 3})
+			So(err, ShouldBeNil)
+			So(len(builds), ShouldEqual, 3)
+		})
+	})
+}
+
+func TestQuery(t *testing.T) {
+	Convey("RSQL queries", t, func() {
+		from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+		So(EndTimeBetween(from, to), ShouldEqual, "endTime=ge=2021-01-01T00:00:00Z;endTime=lt=2021-02-01T00:00:00Z")
+		So(EndTimeBetween(from, time.Time{}), ShouldEqual, "endTime=ge=2021-01-01T00:00:00Z")
+		So(And("temporaryBuild==false", "", EndTimeBetween(time.Time{}, to)), ShouldEqual, "temporaryBuild==false;endTime=lt=2021-02-01T00:00:00Z")
+	})
+}
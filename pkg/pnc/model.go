@@ -0,0 +1,122 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pnc
+
+import "time"
+
+// The build types of a build config revision
+const (
+	BUILD_TYPE_MVN    = "MVN"
+	BUILD_TYPE_NPM    = "NPM"
+	BUILD_TYPE_GRADLE = "GRADLE"
+	BUILD_TYPE_SBT    = "SBT"
+)
+
+// The statuses of a build or a group build
+const (
+	STATUS_SUCCESS             = "SUCCESS"
+	STATUS_FAILED              = "FAILED"
+	STATUS_NO_REBUILD_REQUIRED = "NO_REBUILD_REQUIRED"
+	STATUS_CANCELLED           = "CANCELLED"
+)
+
+// Ref is the reference to another entity embedded in an entity, e.g., the project of a build
+type Ref struct {
+	Id   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// BuildConfigRevision is the build config as it was when the build ran
+type BuildConfigRevision struct {
+	Id               string            `json:"id"`
+	Rev              int               `json:"rev"`
+	Name             string            `json:"name"`
+	BuildScript      string            `json:"buildScript,omitempty"`
+	ScmRevision      string            `json:"scmRevision,omitempty"`
+	BuildType        string            `json:"buildType"`
+	CreationTime     *time.Time        `json:"creationTime,omitempty"`
+	ModificationTime *time.Time        `json:"modificationTime,omitempty"`
+	Parameters       map[string]string `json:"parameters,omitempty"`
+}
+
+// ProductMilestone is the milestone the build is attached to
+type ProductMilestone struct {
+	Id      string `json:"id"`
+	Version string `json:"version"`
+}
+
+// Build is a build of /pnc-rest/v2/builds
+type Build struct {
+	Id                  string              `json:"id"`
+	Status              string              `json:"status"`
+	BuildContentId      string              `json:"buildContentId,omitempty"`
+	TemporaryBuild      bool                `json:"temporaryBuild"`
+	AlignmentPreference string              `json:"alignmentPreference,omitempty"`
+	ScmUrl              string              `json:"scmUrl,omitempty"`
+	ScmRevision         string              `json:"scmRevision,omitempty"`
+	ScmTag              string              `json:"scmTag,omitempty"`
+	SubmitTime          *time.Time          `json:"submitTime,omitempty"`
+	StartTime           *time.Time          `json:"startTime,omitempty"`
+	EndTime             *time.Time          `json:"endTime,omitempty"`
+	BuildConfigRevision BuildConfigRevision `json:"buildConfigRevision"`
+	Project             *Ref                `json:"project,omitempty"`
+	User                *Ref                `json:"user,omitempty"`
+	GroupBuild          *Ref                `json:"groupBuild,omitempty"`
+	ProductMilestone    *ProductMilestone   `json:"productMilestone,omitempty"`
+	Attributes          map[string]string   `json:"attributes,omitempty"`
+}
+
+// BuildType is the build type of the build config revision, e.g., BUILD_TYPE_MVN
+func (b Build) BuildType() string {
+	return b.BuildConfigRevision.BuildType
+}
+
+// Succeeded is true if the build succeeded, or was not needed as an equal build succeeded before
+func (b Build) Succeeded() bool {
+	return b.Status == STATUS_SUCCESS || b.Status == STATUS_NO_REBUILD_REQUIRED
+}
+
+// GroupBuild is a group build of /pnc-rest/v2/group-builds
+type GroupBuild struct {
+	Id             string     `json:"id"`
+	Status         string     `json:"status"`
+	TemporaryBuild bool       `json:"temporaryBuild"`
+	StartTime      *time.Time `json:"startTime,omitempty"`
+	EndTime        *time.Time `json:"endTime,omitempty"`
+	GroupConfig    *Ref       `json:"groupConfig,omitempty"`
+	User           *Ref       `json:"user,omitempty"`
+}
+
+// Vertex is a build in the dependency graph of a group build
+type Vertex struct {
+	Name     string `json:"name"`
+	DataType string `json:"dataType,omitempty"`
+	Data     Build  `json:"data"`
+}
+
+// Edge is a dependency in the graph, the source build depends on the target build
+type Edge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Cost   int    `json:"cost,omitempty"`
+}
+
+// Graph is the dependency graph of the builds of a group build, keyed by the build id
+type Graph struct {
+	Vertices map[string]Vertex `json:"vertices"`
+	Edges    []Edge            `json:"edges"`
+}
@@ -1,10 +1,8 @@
 package promotetest
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
-	"html/template"
-	"log"
 	"strings"
 
 	common "github.com/commonjava/indy-tests/pkg/common"
@@ -12,15 +10,15 @@ import (
 
 // IndyPromoteVars ...
 type IndyPromoteVars struct {
-	TrackingId     string
-	Source         string
-	Target         string
-	Paths          []string
-	Async          bool
-	PurgeSource    bool
-	DryRun         bool
-	FireEvents     bool
-	FailWhenExists bool
+	TrackingId     string   `json:"trackingId"`
+	Source         string   `json:"source"`
+	Target         string   `json:"target"`
+	Paths          []string `json:"paths,omitempty"`
+	Async          bool     `json:"async"`
+	PurgeSource    bool     `json:"purgeSource"`
+	DryRun         bool     `json:"dryRun"`
+	FireEvents     bool     `json:"fireEvents"`
+	FailWhenExists bool     `json:"failWhenExists"`
 }
 
 func (promoteVars *IndyPromoteVars) fillDefaults() {
@@ -37,36 +35,13 @@ func createIndyPromoteVars(trackingId, source, target string, paths []string) In
 	return *promoteVars
 }
 
-// IndyPromoteJSONTemplate ...
-func IndyPromoteJSONTemplate(indyPromoteVars *IndyPromoteVars) string {
-	request := `{
-  "trackingId": "{{.TrackingId}}",
-  "async": {{.Async}},
-  "source": "{{.Source}}",
-  "target": "{{.Target}}",
-  {{if gt (len .Paths) 0}}
-  "paths": [{{range $index,$path := .Paths}}"{{$path}}"{{if isNotLast $index $.Paths}},{{end}}{{end}}],
-  {{end}}
-  "purgeSource": {{.PurgeSource}},
-  "dryRun": {{.DryRun}},
-  "fireEvents": {{.FireEvents}},
-  "failWhenExists": {{.FailWhenExists}}
-}`
-
-	t := template.Must(template.New("promote_request").Funcs(isNotLast).Parse(request))
-	var buf bytes.Buffer
-	err := t.Execute(&buf, indyPromoteVars)
+// IndyPromoteJSON is the json of the paths promote request
+func IndyPromoteJSON(indyPromoteVars *IndyPromoteVars) (string, error) {
+	b, err := json.MarshalIndent(indyPromoteVars, "", "  ")
 	if err != nil {
-		log.Fatal("executing template:", err)
+		return "", fmt.Errorf("marshalling promote request: %s", err)
 	}
-
-	return buf.String()
-}
-
-var isNotLast = template.FuncMap{
-	"isNotLast": func(index int, array []string) bool {
-		return index < len(array)-1
-	},
+	return string(b), nil
 }
 
 func promote(indyURL, trackingId, source, target string, paths []string, dryRun bool) (string, int, bool) {
@@ -76,7 +51,11 @@ func promote(indyURL, trackingId, source, target string, paths []string, dryRun
 		Target:     target,
 		Paths:      paths,
 	}
-	promote := IndyPromoteJSONTemplate(&promoteVars)
+	promote, err := IndyPromoteJSON(&promoteVars)
+	if err != nil {
+		fmt.Printf("Promote Error. %s\n\n", err)
+		return err.Error(), 0, false
+	}
 
 	URL := fmt.Sprintf("%s/api/promotion/paths/promote", indyURL)
 
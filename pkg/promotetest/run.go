@@ -2,20 +2,26 @@ package promotetest
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/report"
 )
 
 func Run(targetIndy, foloTrackId, targetStore string) {
-	indyHost, validated := common.ValidateTargetIndy(targetIndy)
+	indyURL, validated := common.ValidateTargetIndy(targetIndy)
 	if !validated {
-		os.Exit(1)
+		report.Exit(1)
 	}
 
-	indyURL := "http://" + indyHost
 	foloTrackContent := common.GetFoloRecord(indyURL, foloTrackId)
-	DoRun(indyURL, foloTrackId, "", targetStore, "", foloTrackContent, false)
+	step := report.Step("promote", "promote "+foloTrackId)
+	resp, code, success := DoRun(indyURL, foloTrackId, "", targetStore, "", foloTrackContent, false)
+	step.Set("status", code)
+	if success {
+		step.Pass()
+	} else {
+		step.Fail("%s", resp)
+	}
 }
 
 func DoRun(indyBaseUrl, foloTrackId, sourceStore, targetStore, newVersionNum string,
@@ -0,0 +1,63 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package promotetest
+
+import (
+	"testing"
+
+	"github.com/commonjava/indy-tests/pkg/common"
+	"github.com/commonjava/indy-tests/pkg/indymock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIndyPromoteJSON(t *testing.T) {
+	Convey("IndyPromoteJSON should return the request json", t, func() {
+		promoteVars := createIndyPromoteVars("build-1", "maven:hosted:build-1", "maven:hosted:pnc-builds", []string{"/a.pom"})
+		promote, err := IndyPromoteJSON(&promoteVars)
+		So(err, ShouldBeNil)
+		So(promote, ShouldContainSubstring, `"trackingId": "build-1"`)
+		So(promote, ShouldContainSubstring, `"failWhenExists": true`)
+	})
+}
+
+func TestPromoteAndRollback(t *testing.T) {
+	Convey("DoRun should promote the uploads with the new version and Rollback should revert it", t, func() {
+		mock, server := indymock.Start()
+		defer server.Close()
+		mock.PutStore(indymock.NewHosted("maven", "build-test-90001"))
+		pom := "/org/foo/foo/1.0.0.redhat-90001/foo-1.0.0.redhat-90001.pom"
+		mock.PutContent("maven:hosted:build-test-90001", pom, []byte("<project/>"))
+		record := common.TrackedContent{
+			Uploads: []common.TrackedContentEntry{
+				{Path: "/org/foo/foo/1.0.0.redhat-00001/foo-1.0.0.redhat-00001.pom", StoreKey: "maven:hosted:build-1"},
+				{Path: "/org/foo/foo/maven-metadata.xml", StoreKey: "maven:hosted:build-1"},
+			},
+		}
+
+		resp, _, success := DoRun(server.URL, "build-test-90001", "maven:hosted:build-test-90001", "maven:hosted:pnc-builds", "90001", record, false)
+		So(success, ShouldBeTrue)
+		So(resp, ShouldContainSubstring, pom)
+		So(mock.Paths("maven:hosted:pnc-builds"), ShouldResemble, []string{pom[1:]})
+		metadata, ok := mock.GetContent("maven:group:DA", "org/foo/foo/maven-metadata.xml")
+		So(ok, ShouldBeTrue)
+		So(string(metadata), ShouldContainSubstring, "<version>1.0.0.redhat-90001</version>")
+
+		_, _, success = Rollback(server.URL, resp, false)
+		So(success, ShouldBeTrue)
+		So(mock.Paths("maven:hosted:pnc-builds"), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,237 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Package report collects the test cases, steps, timings and failures of a command run, and writes them as
+// json, junit xml or text when the run finishes, so CI can show which artifact or step failed.
+package report
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPassed  Status = "passed"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+	// StatusRunning is the status of a case which is started and not finished yet
+	StatusRunning Status = "running"
+)
+
+// Case is one test case, e.g., an artifact download or an integration test step.
+type Case struct {
+	Name    string  `json:"name"`
+	Status  Status  `json:"status"`
+	Seconds float64 `json:"seconds"`
+	Message string  `json:"message,omitempty"`
+	// Properties are the details of the case, e.g., the url and the response status of a download
+	Properties map[string]string `json:"properties,omitempty"`
+
+	mu      sync.Mutex
+	started time.Time
+}
+
+// Pass finishes the case as passed
+func (c *Case) Pass() *Case {
+	return c.finish(StatusPassed, "")
+}
+
+// Fail finishes the case as failed with the message
+func (c *Case) Fail(format string, a ...interface{}) *Case {
+	return c.finish(StatusFailed, fmt.Sprintf(format, a...))
+}
+
+// Skip finishes the case as skipped with the reason
+func (c *Case) Skip(format string, a ...interface{}) *Case {
+	return c.finish(StatusSkipped, fmt.Sprintf(format, a...))
+}
+
+// Done finishes the case as passed if err is nil, otherwise as failed with the error
+func (c *Case) Done(err error) *Case {
+	if err != nil {
+		return c.Fail("%s", err)
+	}
+	return c.Pass()
+}
+
+// Set sets a property of the case
+func (c *Case) Set(key string, value interface{}) *Case {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Properties == nil {
+		c.Properties = make(map[string]string)
+	}
+	c.Properties[key] = fmt.Sprint(value)
+	return c
+}
+
+func (c *Case) finish(status Status, message string) *Case {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Status != StatusRunning {
+		return c // finished already
+	}
+	c.Status = status
+	c.Message = message
+	if !c.started.IsZero() {
+		c.Seconds = time.Since(c.started).Seconds()
+	}
+	return c
+}
+
+// Suite groups the cases of one kind, e.g., "downloads" or "integrationtest".
+type Suite struct {
+	Name  string  `json:"name"`
+	Cases []*Case `json:"cases"`
+
+	mu sync.Mutex
+}
+
+// Start adds a running case, which should be finished by Pass, Fail, Skip or Done
+func (s *Suite) Start(name string) *Case {
+	c := &Case{Name: name, Status: StatusRunning, started: time.Now()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Cases = append(s.Cases, c)
+	return c
+}
+
+// Add adds a finished case
+func (s *Suite) Add(name string, status Status, elapsed time.Duration, message string) *Case {
+	c := &Case{Name: name, Status: status, Seconds: elapsed.Seconds(), Message: message}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Cases = append(s.Cases, c)
+	return c
+}
+
+// Count returns the number of cases with the status
+func (s *Suite) Count(status Status) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, c := range s.Cases {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Seconds sums the time of all cases
+func (s *Suite) Seconds() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0.0
+	for _, c := range s.Cases {
+		total += c.Seconds
+	}
+	return total
+}
+
+// Report is the result of one command run.
+type Report struct {
+	Command  string    `json:"command"`
+	Args     []string  `json:"args,omitempty"`
+	Started  time.Time `json:"started"`
+	Seconds  float64   `json:"seconds"`
+	Status   Status    `json:"status"`
+	ExitCode int       `json:"exitCode"`
+	Message  string    `json:"message,omitempty"`
+	Suites   []*Suite  `json:"suites"`
+
+	mu sync.Mutex
+}
+
+// New creates an empty report of the command
+func New(command string, args []string) *Report {
+	return &Report{Command: command, Args: args, Started: time.Now(), Status: StatusRunning, Suites: []*Suite{}}
+}
+
+// Suite gets the suite by name, it is created when it does not exist
+func (r *Report) Suite(name string) *Suite {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.Suites {
+		if s.Name == name {
+			return s
+		}
+	}
+	s := &Suite{Name: name, Cases: []*Case{}}
+	r.Suites = append(r.Suites, s)
+	return s
+}
+
+// Finish sets the final status. The cases which are still running, e.g., the step which panicked, are failed.
+// The report fails if the exit code is not 0 or any case failed.
+func (r *Report) Finish(exitCode int, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Seconds = time.Since(r.Started).Seconds()
+	r.ExitCode = exitCode
+	r.Message = message
+	r.Status = StatusPassed
+	if exitCode != 0 {
+		r.Status = StatusFailed
+	}
+	unfinished := fmt.Sprintf("not finished, exit code %d", exitCode)
+	if message != "" {
+		unfinished = "not finished, " + message
+	}
+	for _, s := range r.Suites {
+		for _, c := range s.Cases {
+			c.finish(StatusFailed, unfinished)
+		}
+		if s.Count(StatusFailed) > 0 {
+			r.Status = StatusFailed
+		}
+	}
+}
+
+// Totals returns the number of all cases by status
+func (r *Report) Totals() map[Status]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	totals := make(map[Status]int)
+	for _, s := range r.Suites {
+		for _, status := range []Status{StatusPassed, StatusFailed, StatusSkipped, StatusRunning} {
+			totals[status] += s.Count(status)
+		}
+	}
+	return totals
+}
+
+// Failures returns "suite/case: message" of all failed cases, sorted
+func (r *Report) Failures() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	failures := []string{}
+	for _, s := range r.Suites {
+		s.mu.Lock()
+		for _, c := range s.Cases {
+			if c.Status == StatusFailed {
+				failures = append(failures, fmt.Sprintf("%s/%s: %s", s.Name, c.Name, c.Message))
+			}
+		}
+		s.mu.Unlock()
+	}
+	sort.Strings(failures)
+	return failures
+}
@@ -0,0 +1,134 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func sampleReport() *Report {
+	r := New("integrationtest", []string{"http://indy", "build-1"})
+	steps := r.Suite("integrationtest")
+	steps.Start("a. Load dataset").Pass()
+	steps.Start("b. Retrieve alignment metadata").Fail("%d metadata not found", 2)
+	steps.Start("g. Promote")
+	downloads := r.Suite("downloads")
+	downloads.Add("org/foo/1.0/foo-1.0.pom", StatusPassed, 1500*time.Millisecond, "").Set("status", 200)
+	downloads.Add("org/foo/1.0/foo-1.0.jar", StatusSkipped, 0, "canceled")
+	return r
+}
+
+func TestReport(t *testing.T) {
+	Convey("TestReport", t, func() {
+		r := sampleReport()
+		Convey("A case should only be finished once", func() {
+			c := r.Suite("integrationtest").Start("k. Clean up").Pass()
+			c.Fail("too late")
+			So(c.Status, ShouldEqual, StatusPassed)
+			So(c.Message, ShouldBeEmpty)
+		})
+		Convey("Finish should fail the running cases and the report", func() {
+			r.Finish(0, "")
+			So(r.Status, ShouldEqual, StatusFailed)
+			So(r.Suite("integrationtest").Cases[2].Status, ShouldEqual, StatusFailed)
+			So(r.Totals()[StatusFailed], ShouldEqual, 2)
+			So(r.Totals()[StatusSkipped], ShouldEqual, 1)
+			So(r.Failures(), ShouldResemble, []string{
+				"integrationtest/b. Retrieve alignment metadata: 2 metadata not found",
+				"integrationtest/g. Promote: not finished, exit code 0",
+			})
+		})
+		Convey("A report without failures and exit code 0 should pass", func() {
+			ok := New("build", nil)
+			ok.Suite("downloads").Add("a.pom", StatusPassed, time.Second, "")
+			ok.Finish(0, "")
+			So(ok.Status, ShouldEqual, StatusPassed)
+			ok.Finish(1, "")
+			So(ok.Status, ShouldEqual, StatusFailed)
+		})
+	})
+}
+
+func TestWrite(t *testing.T) {
+	Convey("TestWrite", t, func() {
+		r := sampleReport()
+		r.Finish(2, "panic: Promote failed")
+
+		Convey("JSON", func() {
+			var buf bytes.Buffer
+			So(Write(&buf, r, FORMAT_JSON), ShouldBeNil)
+			var decoded Report
+			So(json.Unmarshal(buf.Bytes(), &decoded), ShouldBeNil)
+			So(decoded.Command, ShouldEqual, "integrationtest")
+			So(decoded.ExitCode, ShouldEqual, 2)
+			So(decoded.Status, ShouldEqual, StatusFailed)
+			So(len(decoded.Suites), ShouldEqual, 2)
+			So(decoded.Suites[1].Cases[0].Properties["status"], ShouldEqual, "200")
+			So(decoded.Suites[1].Cases[0].Seconds, ShouldEqual, 1.5)
+		})
+
+		Convey("JUnit", func() {
+			var buf bytes.Buffer
+			So(Write(&buf, r, FORMAT_JUNIT), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, xml.Header)
+			var decoded junitTestSuites
+			So(xml.Unmarshal(buf.Bytes(), &decoded), ShouldBeNil)
+			So(decoded.Tests, ShouldEqual, 5)
+			So(decoded.Failures, ShouldEqual, 2)
+			So(decoded.Skipped, ShouldEqual, 1)
+			So(decoded.Suites[0].Name, ShouldEqual, "integrationtest.integrationtest")
+			So(decoded.Suites[0].Cases[1].Failure.Message, ShouldEqual, "2 metadata not found")
+			So(decoded.Suites[0].Cases[2].Failure.Message, ShouldEqual, "not finished, panic: Promote failed")
+			So(decoded.Suites[1].Cases[0].Time, ShouldEqual, "1.500")
+			So(decoded.Suites[1].Cases[0].SystemOut, ShouldEqual, "status: 200")
+			So(decoded.Suites[1].Cases[1].Skipped, ShouldNotBeNil)
+		})
+
+		Convey("JUnit of a command which failed outside of the cases", func() {
+			failed := New("promote", nil)
+			failed.Finish(1, "")
+			var buf bytes.Buffer
+			So(WriteJUnit(&buf, failed), ShouldBeNil)
+			var decoded junitTestSuites
+			So(xml.Unmarshal(buf.Bytes(), &decoded), ShouldBeNil)
+			So(decoded.Failures, ShouldEqual, 1)
+			So(decoded.Suites[0].Cases[0].Failure.Message, ShouldEqual, "exit code 1")
+		})
+
+		Convey("Text", func() {
+			var buf bytes.Buffer
+			So(Write(&buf, r, FORMAT_TEXT), ShouldBeNil)
+			text := buf.String()
+			So(text, ShouldContainSubstring, "Report of integrationtest: FAILED, exit code: 2")
+			So(text, ShouldContainSubstring, "downloads: 1 passed, 0 failed, 1 skipped")
+			So(text, ShouldContainSubstring, "[FAILED] integrationtest/b. Retrieve alignment metadata")
+		})
+
+		Convey("Unknown format", func() {
+			So(Write(&bytes.Buffer{}, r, "html"), ShouldNotBeNil)
+			So(Configure("html", ""), ShouldNotBeNil)
+			So(strings.ToLower(format), ShouldEqual, FORMAT_TEXT)
+		})
+	})
+}
@@ -0,0 +1,132 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package report
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Environment variables of the report options. The command flags take precedence over them.
+const (
+	ENVAR_REPORT_FORMAT = "INDY_REPORT_FORMAT"
+	ENVAR_REPORT_FILE   = "INDY_REPORT_FILE"
+)
+
+var (
+	current    = New("indy-test", nil)
+	started    = false
+	format     = FORMAT_TEXT
+	outputFile = ""
+	finishOnce sync.Once
+	exitHooks  []func(exitCode int)
+	hooksMu    sync.Mutex
+)
+
+// Configure sets how the report of this run is written when the run finishes. Without a file, it is written
+// to stdout.
+func Configure(reportFormat, reportFile string) error {
+	if err := Write(ioutil.Discard, New("", nil), reportFormat); err != nil {
+		return err
+	}
+	format = reportFormat
+	outputFile = reportFile
+	return nil
+}
+
+// Start begins the report of the command. It should be called before any case is added.
+func Start(command string, args []string) *Report {
+	current = New(command, args)
+	started = true
+	return current
+}
+
+// Current returns the report of this run
+func Current() *Report {
+	return current
+}
+
+// GetSuite gets the suite of this run by name, it is created when it does not exist
+func GetSuite(name string) *Suite {
+	return current.Suite(name)
+}
+
+// Step starts a case in the suite of this run, e.g., report.Step("integrationtest", "g. Promote")
+func Step(suite, name string) *Case {
+	return current.Suite(suite).Start(name)
+}
+
+// OnExit registers a hook which is run before the report is written, e.g., to add the last numbers. It is
+// safe to be called from concurrent goroutines, e.g., the pipelines of an integration test group.
+func OnExit(hook func(exitCode int)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	exitHooks = append(exitHooks, hook)
+}
+
+// Finish finishes the report of this run and writes it. Only the first call takes effect, and nothing is
+// written if no command was started, e.g., when only the help is shown.
+func Finish(exitCode int, message string) {
+	finishOnce.Do(func() {
+		if !started {
+			return
+		}
+		hooksMu.Lock()
+		hooks := append([]func(int){}, exitHooks...)
+		hooksMu.Unlock()
+		for _, hook := range hooks {
+			hook(exitCode)
+		}
+		current.Finish(exitCode, message)
+		if err := writeReport(); err != nil {
+			fmt.Printf("Warning: cannot write the report, %s\n", err)
+		}
+	})
+}
+
+// Exit finishes and writes the report, then exits with the code. It should be used instead of os.Exit so the
+// report is not lost.
+func Exit(exitCode int) {
+	Finish(exitCode, "")
+	os.Exit(exitCode)
+}
+
+// Recover records a panic of the run in the report before it goes on, should be deferred in main
+func Recover() {
+	if r := recover(); r != nil {
+		Finish(2, fmt.Sprintf("panic: %v", r))
+		panic(r)
+	}
+}
+
+func writeReport() error {
+	if outputFile == "" {
+		return Write(os.Stdout, current, format)
+	}
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := Write(f, current, format); err != nil {
+		return err
+	}
+	fmt.Printf("Report (%s) is written to %s\n", format, outputFile)
+	return nil
+}
@@ -0,0 +1,209 @@
+/*
+ *  Copyright (C) 2021-2023 Red Hat, Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *          http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	FORMAT_JSON  = "json"
+	FORMAT_JUNIT = "junit"
+	FORMAT_TEXT  = "text"
+)
+
+// Write writes the report in the format, which is one of json, junit and text
+func Write(w io.Writer, r *Report, format string) error {
+	switch strings.ToLower(format) {
+	case FORMAT_JSON:
+		return WriteJSON(w, r)
+	case FORMAT_JUNIT:
+		return WriteJUnit(w, r)
+	case FORMAT_TEXT, "":
+		return WriteText(w, r)
+	}
+	return fmt.Errorf("unknown report format %s, should be json, junit or text", format)
+}
+
+// WriteJSON writes the report as indented json
+func WriteJSON(w io.Writer, r *Report) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Cases      []junitTestCase  `xml:"testcase"`
+}
+
+type junitProperties struct {
+	Property []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as junit xml. Each suite is a testsuite with classname "command.suite", so
+// jenkins shows the cases grouped by command and suite.
+func WriteJUnit(w io.Writer, r *Report) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := junitTestSuites{Name: r.Command, Time: seconds(r.Seconds)}
+	for _, s := range r.Suites {
+		s.mu.Lock()
+		suite := junitTestSuite{
+			Name:      r.Command + "." + s.Name,
+			Time:      seconds(0),
+			Timestamp: r.Started.Format("2006-01-02T15:04:05"),
+		}
+		total := 0.0
+		for _, c := range s.Cases {
+			tc := junitTestCase{Name: c.Name, ClassName: suite.Name, Time: seconds(c.Seconds), SystemOut: properties(c.Properties)}
+			switch c.Status {
+			case StatusFailed, StatusRunning:
+				tc.Failure = &junitMessage{Message: c.Message, Text: c.Message}
+				suite.Failures++
+			case StatusSkipped:
+				tc.Skipped = &junitMessage{Message: c.Message}
+				suite.Skipped++
+			}
+			total += c.Seconds
+			suite.Cases = append(suite.Cases, tc)
+		}
+		s.mu.Unlock()
+		suite.Tests = len(suite.Cases)
+		suite.Time = seconds(total)
+		if len(r.Args) > 0 {
+			suite.Properties = &junitProperties{[]junitProperty{{Name: "args", Value: strings.Join(r.Args, " ")}}}
+		}
+		result.Tests += suite.Tests
+		result.Failures += suite.Failures
+		result.Skipped += suite.Skipped
+		result.Suites = append(result.Suites, suite)
+	}
+	if r.Status == StatusFailed && result.Failures == 0 {
+		// the command failed outside of any case, e.g., an invalid indy url, add it so the failure is not lost
+		message := r.Message
+		if message == "" {
+			message = fmt.Sprintf("exit code %d", r.ExitCode)
+		}
+		result.Suites = append(result.Suites, junitTestSuite{
+			Name: r.Command, Tests: 1, Failures: 1, Time: seconds(r.Seconds),
+			Timestamp: r.Started.Format("2006-01-02T15:04:05"),
+			Cases: []junitTestCase{{Name: r.Command, ClassName: r.Command, Time: seconds(r.Seconds),
+				Failure: &junitMessage{Message: message, Text: message}}},
+		})
+		result.Tests++
+		result.Failures++
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteText writes the report as a short summary which lists the failed cases
+func WriteText(w io.Writer, r *Report) error {
+	totals := r.Totals()
+	failures := r.Failures()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "==========================================\n")
+	fmt.Fprintf(&b, "Report of %s: %s, exit code: %d, elapsed(s): %.3f\n", r.Command, strings.ToUpper(string(r.Status)), r.ExitCode, r.Seconds)
+	if r.Message != "" {
+		fmt.Fprintf(&b, "Message: %s\n", r.Message)
+	}
+	for _, s := range r.Suites {
+		fmt.Fprintf(&b, "  %s: %d passed, %d failed, %d skipped, elapsed(s): %.3f\n", s.Name,
+			s.Count(StatusPassed), s.Count(StatusFailed), s.Count(StatusSkipped), s.Seconds())
+	}
+	fmt.Fprintf(&b, "Total: %d passed, %d failed, %d skipped\n", totals[StatusPassed], totals[StatusFailed], totals[StatusSkipped])
+	for _, f := range failures {
+		fmt.Fprintf(&b, "  [FAILED] %s\n", f)
+	}
+	fmt.Fprintf(&b, "==========================================\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func seconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
+
+func properties(props map[string]string) string {
+	if len(props) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, k+": "+props[k])
+	}
+	return strings.Join(lines, "\n")
+}